@@ -160,6 +160,7 @@ func createOrUpdateMongodbIndex(ctx context.Context) {
 		commonrepo.NewSystemSettingColl(),
 		commonrepo.NewTaskColl(),
 		commonrepo.NewTestTaskStatColl(),
+		commonrepo.NewTestTrendColl(),
 		commonrepo.NewTestingColl(),
 		commonrepo.NewWebHookColl(),
 		commonrepo.NewWebHookUserColl(),
@@ -198,6 +199,7 @@ func createOrUpdateMongodbIndex(ctx context.Context) {
 		commonrepo.NewSAEColl(),
 		commonrepo.NewSAEEnvColl(),
 		commonrepo.NewEnvInfoColl(),
+		commonrepo.NewHelmEnvAuditEventColl(),
 		commonrepo.NewApprovalTicketColl(),
 		commonrepo.NewWorkflowTaskRevertColl(),
 
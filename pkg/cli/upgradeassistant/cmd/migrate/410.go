@@ -17,13 +17,18 @@ limitations under the License.
 package migrate
 
 import (
+	"context"
 	"fmt"
 
 	internalmodels "github.com/koderover/zadig/v2/pkg/cli/upgradeassistant/internal/repository/models"
 	internalmongodb "github.com/koderover/zadig/v2/pkg/cli/upgradeassistant/internal/repository/mongodb"
 	"github.com/koderover/zadig/v2/pkg/cli/upgradeassistant/internal/upgradepath"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	templaterepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb/template"
 	internalhandler "github.com/koderover/zadig/v2/pkg/shared/handler"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
 )
 
 func init() {
@@ -48,6 +53,11 @@ func V400ToV410() error {
 		return err
 	}
 
+	err = migrateServiceTestModules(migrationInfo)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -75,6 +85,98 @@ func migrateProjectReleaseMaxHistory(ctx *internalhandler.Context, migrationInfo
 	return nil
 }
 
+// migrateServiceTestModules moves the inline test module of the service modules of the testing jobs into TestModules
+func migrateServiceTestModules(migrationInfo *internalmodels.Migration) error {
+	if migrationInfo.Migration410ServiceTestModules {
+		return nil
+	}
+
+	workflowCursor, err := commonrepo.NewWorkflowV4Coll().ListByCursor(&commonrepo.ListWorkflowV4Option{})
+	if err != nil {
+		return fmt.Errorf("failed to list workflows, err: %s", err)
+	}
+	for workflowCursor.Next(context.Background()) {
+		workflow := new(commonmodels.WorkflowV4)
+		if err := workflowCursor.Decode(workflow); err != nil {
+			log.Warnf("failed to decode workflow, err: %s", err)
+			continue
+		}
+		changed, err := convertServiceTestModules(workflow.Stages)
+		if err != nil {
+			log.Warnf("failed to convert the testing jobs of workflow: %s in project: %s, err: %s", workflow.Name, workflow.Project, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+			return fmt.Errorf("failed to update workflow: %s in project: %s, err: %s", workflow.Name, workflow.Project, err)
+		}
+	}
+
+	templateCursor, err := commonrepo.NewWorkflowV4TemplateColl().ListByCursor(&commonrepo.ListWorkflowV4TemplateOption{})
+	if err != nil {
+		return fmt.Errorf("failed to list workflow templates, err: %s", err)
+	}
+	for templateCursor.Next(context.Background()) {
+		workflowTemplate := new(commonmodels.WorkflowV4Template)
+		if err := templateCursor.Decode(workflowTemplate); err != nil {
+			log.Warnf("failed to decode workflow template, err: %s", err)
+			continue
+		}
+		changed, err := convertServiceTestModules(workflowTemplate.Stages)
+		if err != nil {
+			log.Warnf("failed to convert the testing jobs of workflow template: %s, err: %s", workflowTemplate.TemplateName, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := commonrepo.NewWorkflowV4TemplateColl().Update(workflowTemplate); err != nil {
+			return fmt.Errorf("failed to update workflow template: %s, err: %s", workflowTemplate.TemplateName, err)
+		}
+	}
+
+	_ = internalmongodb.NewMigrationColl().UpdateMigrationStatus(migrationInfo.ID, map[string]interface{}{
+		getMigrationFieldBsonTag(migrationInfo, &migrationInfo.Migration410ServiceTestModules): true,
+	})
+
+	return nil
+}
+
+// convertServiceTestModules converts the service modules of the testing jobs in the stages, it returns whether any of
+// them is changed
+func convertServiceTestModules(stages []*commonmodels.WorkflowStage) (bool, error) {
+	changed := false
+	for _, stage := range stages {
+		for _, job := range stage.Jobs {
+			if job.JobType != config.JobZadigTesting {
+				continue
+			}
+			spec := new(commonmodels.ZadigTestingJobSpec)
+			if err := commonmodels.IToi(job.Spec, spec); err != nil {
+				return false, fmt.Errorf("failed to decode testing job: %s, err: %s", job.Name, err)
+			}
+			jobChanged := false
+			for _, svcs := range [][]*commonmodels.ServiceAndTest{spec.ServiceTestOptions, spec.ServiceAndTests} {
+				for _, svc := range svcs {
+					if len(svc.TestModules) > 0 || svc.TestModule == nil {
+						continue
+					}
+					svc.TestModules = []*commonmodels.TestModule{svc.TestModule}
+					svc.TestModule = nil
+					jobChanged = true
+				}
+			}
+			if jobChanged {
+				job.Spec = spec
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
 func V410ToV400() error {
 	return nil
 }
@@ -33,6 +33,7 @@ type Migration struct {
 	Migration400CollaborationInstance    bool               `bson:"migration_400_collaboration_instance"`
 	Migration400ProjectManagement        bool               `bson:"migration_400_project_management"`
 	Migration400ProjectReleaseMaxHistory bool               `bson:"migration_400_project_release_max_history"`
+	Migration410ServiceTestModules       bool               `bson:"migration_410_service_test_modules"`
 	Error                                string             `bson:"error"`
 }
 
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"os/exec"
 
 	"github.com/koderover/zadig/v2/pkg/types"
@@ -64,16 +65,30 @@ func CheckoutHead() *exec.Cmd {
 	)
 }
 
-// Fetch fetches changes by ref, ref can be a tag, branch or pr. --depth=1 is used to limit fetching
-// to the last commit from the tip of each remote branch history.
+// Fetch fetches changes by ref, ref can be a tag, branch or pr. --depth is used to limit fetching
+// to the last commits from the tip of each remote branch history, 1 is used if depth is not positive.
 // e.g. git fetch origin +refs/heads/onboarding --depth=1
-func Fetch(remoteName, ref string) *exec.Cmd {
+func Fetch(remoteName, ref string, depth int) *exec.Cmd {
+	if depth <= 0 {
+		depth = 1
+	}
+	return exec.Command(
+		"git",
+		"fetch",
+		remoteName,
+		"+"+ref, // "+" means overwrite
+		fmt.Sprintf("--depth=%d", depth),
+	)
+}
+
+// FullFetch fetches changes by ref with the whole history
+// e.g. git fetch origin +6e3ac0f
+func FullFetch(remoteName, ref string) *exec.Cmd {
 	return exec.Command(
 		"git",
 		"fetch",
 		remoteName,
 		"+"+ref, // "+" means overwrite
-		"--depth=1",
 	)
 }
 
@@ -159,3 +174,13 @@ func ShowLastLog() *exec.Cmd {
 		"-1",
 	)
 }
+
+// RevParseHead returns command: git rev-parse HEAD
+// It shows the sha of the checked out commit
+func RevParseHead() *exec.Cmd {
+	return exec.Command(
+		"git",
+		"rev-parse",
+		"HEAD",
+	)
+}
@@ -276,7 +276,10 @@ func (e *JobExecutor) run() error {
 		if e.CheckZadigCancel() {
 			return fmt.Errorf("user cancel job %s", e.Job.JobName)
 		}
-		if hasFailed && !stepInfo.Onfailure {
+		if hasFailed && !stepInfo.Onfailure && !stepInfo.OnlyOnFailure {
+			continue
+		}
+		if !hasFailed && stepInfo.OnlyOnFailure {
 			continue
 		}
 		if err := step.RunStep(e.Ctx, e.JobCtx, stepInfo, e.Dirs, e.getUserEnvs(), e.JobCtx.SecretEnvs, e.Logger); err != nil {
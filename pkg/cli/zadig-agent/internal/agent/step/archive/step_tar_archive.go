@@ -75,7 +75,7 @@ func (s *TarArchiveStep) Run(ctx context.Context) error {
 	s.spec.TarDir = util.ReplaceEnvWithValue(s.spec.TarDir, envMap)
 
 	cmdAndArtifactFullPaths := make([]string, 0)
-	cmdAndArtifactFullPaths = append(cmdAndArtifactFullPaths, "-czf")
+	cmdAndArtifactFullPaths = append(cmdAndArtifactFullPaths, "-cf")
 	cmdAndArtifactFullPaths = append(cmdAndArtifactFullPaths, tarName)
 	if s.spec.ChangeTarDir {
 		cmdAndArtifactFullPaths = append(cmdAndArtifactFullPaths, "--exclude", tarName, "-C", s.spec.TarDir)
@@ -111,7 +111,7 @@ func (s *TarArchiveStep) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to close %s err: %s", tarName, err)
 	}
 
-	cmd := exec.Command("tar", cmdAndArtifactFullPaths...)
+	cmd := exec.Command("tar", append(s.spec.Compression.TarFlags(), cmdAndArtifactFullPaths...)...)
 	cmd.Stderr = os.Stderr
 
 	if err = cmd.Run(); err != nil {
@@ -17,10 +17,12 @@ limitations under the License.
 package git
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -36,6 +38,7 @@ import (
 	"github.com/koderover/zadig/v2/pkg/cli/zadig-agent/internal/common"
 	agenttypes "github.com/koderover/zadig/v2/pkg/cli/zadig-agent/internal/common/types"
 	codehostmodels "github.com/koderover/zadig/v2/pkg/microservice/systemconfig/core/codehost/repository/models"
+	"github.com/koderover/zadig/v2/pkg/setting"
 	gittool "github.com/koderover/zadig/v2/pkg/tool/git"
 	"github.com/koderover/zadig/v2/pkg/types"
 	"github.com/koderover/zadig/v2/pkg/types/step"
@@ -68,10 +71,10 @@ func (s *GitStep) Run(ctx context.Context) error {
 	defer func() {
 		s.Logger.Infof(fmt.Sprintf("Git clone ended. Duration: %.2f seconds.", time.Since(start).Seconds()))
 	}()
-	return s.runGitCmds()
+	return s.runGitCmds(ctx)
 }
 
-func (s *GitStep) runGitCmds() error {
+func (s *GitStep) runGitCmds(ctx context.Context) error {
 	// 获取git代码
 	cmds := make([]*common.Command, 0)
 
@@ -100,12 +103,19 @@ func (s *GitStep) runGitCmds() error {
 		if !c.DisableTrace {
 			s.Logger.Printf("%s\n", util.MaskSecretEnvs(strings.Join(c.Cmd.Args, " "), s.secretEnvs))
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := c.Cmd.Start(); err != nil {
 			if c.IgnoreError {
 				continue
 			}
 			return err
 		}
+		// kill the command once the step times out or the job is cancelled
+		stopKill := context.AfterFunc(ctx, func() {
+			c.Cmd.Process.Kill()
+		})
 
 		var wg sync.WaitGroup
 		needPersistentLog := true
@@ -124,16 +134,47 @@ func (s *GitStep) runGitCmds() error {
 		}()
 
 		wg.Wait()
-		if err := c.Cmd.Wait(); err != nil {
+		err = c.Cmd.Wait()
+		stopKill()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
 			if c.IgnoreError {
 				continue
 			}
 			return err
 		}
 	}
+
+	s.writeRepoCommitOutputs()
 	return nil
 }
 
+// writeRepoCommitOutputs writes the sha of the checked out commit of each repo into the output REPO_<index>_COMMIT,
+// the index is the position of the repo in the step. Failures are only logged since the code is already cloned.
+func (s *GitStep) writeRepoCommitOutputs() {
+	for index, repo := range s.spec.Repos {
+		if repo == nil || len(repo.RepoName) == 0 {
+			continue
+		}
+
+		cmd := gitcmd.RevParseHead()
+		cmd.Dir = s.GetWorkDir(repo)
+		cmd.Env = s.envs
+		out, err := cmd.Output()
+		if err != nil {
+			s.Logger.Warnf("failed to resolve the commit of repo %s, error: %v", repo.RepoName, err)
+			continue
+		}
+
+		outputName := fmt.Sprintf(setting.WorkflowTestingJobOutputKeyRepoCommit, index)
+		if err := os.WriteFile(filepath.Join(s.dirs.JobOutputsDir, outputName), bytes.TrimSpace(out), 0644); err != nil {
+			s.Logger.Warnf("failed to write output %s, error: %v", outputName, err)
+		}
+	}
+}
+
 func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String) []*common.Command {
 
 	cmds := make([]*common.Command, 0)
@@ -179,7 +220,24 @@ func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String
 	if len(owner) == 0 {
 		owner = repo.RepoOwner
 	}
-	if repo.Source == types.ProviderGitlab {
+	if repo.DeployKey != "" {
+		// deploy key of the repo takes precedence over the credentials of the code host
+		// the key is set on the repo since other repos on the same host may be cloned with other keys
+		_, remoteURL := repo.DeployKeySSHHostAndURL()
+		sshKeyPath, err := util.WriteDeployKeyFile(repo.DeployKey, repo.DeployKeyID)
+		if err != nil {
+			s.Logger.Errorf("failed to write deploy key file, err: %v", err)
+		} else {
+			cmds = append(cmds, &common.Command{
+				Cmd:          gitcmd.SetConfig("core.sshCommand", fmt.Sprintf("ssh -i %s", sshKeyPath)),
+				DisableTrace: true,
+			})
+		}
+		cmds = append(cmds, &common.Command{
+			Cmd:          gitcmd.RemoteAdd(repo.RemoteName, remoteURL),
+			DisableTrace: true,
+		})
+	} else if repo.Source == types.ProviderGitlab {
 		u, _ := url.Parse(repo.Address)
 		host := strings.TrimSuffix(strings.Join([]string{u.Host, u.Path}, "/"), "/")
 		cmds = append(cmds, &common.Command{
@@ -256,7 +314,14 @@ func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String
 		return cmds
 	}
 
-	cmds = append(cmds, &common.Command{Cmd: gitcmd.Fetch(repo.RemoteName, ref)}, &common.Command{Cmd: gitcmd.CheckoutHead()})
+	fetchCmd := &common.Command{Cmd: gitcmd.Fetch(repo.RemoteName, ref, repo.CloneDepth)}
+	if repo.EnableCommit && repo.CloneDepth > 0 {
+		// the commit may be outside the shallow window, fall back to a full clone if the shallow fetch failed
+		fetchCmd.IgnoreError = true
+		fetchCmd.AfterRun = s.fullFetchOnFailure
+		fetchCmd.AfterRunArgs = []interface{}{fetchCmd.Cmd, repo}
+	}
+	cmds = append(cmds, fetchCmd, &common.Command{Cmd: gitcmd.CheckoutHead()})
 
 	// PR rebase branch 请求
 	if len(repo.MergeBranches) > 0 {
@@ -316,6 +381,33 @@ func (s *GitStep) GetWorkDir(repo *types.Repository) string {
 	return workDir
 }
 
+func (s *GitStep) fullFetchOnFailure(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("invalid args length: %d", len(args))
+	}
+	shallowFetch, ok := args[0].(*exec.Cmd)
+	if !ok {
+		return fmt.Errorf("invalid args[0] type: %T", args[0])
+	}
+	repo, ok := args[1].(*types.Repository)
+	if !ok {
+		return fmt.Errorf("invalid args[1] type: %T", args[1])
+	}
+	if shallowFetch.ProcessState != nil && shallowFetch.ProcessState.Success() {
+		return nil
+	}
+
+	s.Logger.Warnf("failed to fetch commit %s of repo %s with depth %d, falling back to full clone", repo.CommitID, repo.RepoName, repo.CloneDepth)
+	fullFetch := gitcmd.FullFetch(repo.RemoteName, repo.Ref())
+	fullFetch.Dir = shallowFetch.Dir
+	fullFetch.Env = shallowFetch.Env
+	if err := fullFetch.Run(); err != nil {
+		s.Logger.Errorf("failed to fetch commit %s of repo %s, error: %v", repo.CommitID, repo.RepoName, err)
+		return err
+	}
+	return nil
+}
+
 // HTTPSCloneURL returns HTTPS clone url
 func HTTPSCloneURL(source, token, owner, name string, optionalGiteeAddr string) string {
 	if strings.ToLower(source) == types.ProviderGitee || strings.ToLower(source) == types.ProviderGiteeEE {
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package script
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestOutputScripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("output paths are asserted with unix separators")
+	}
+	outputsDir := "/zadig/outputs"
+	outputs := []string{"VERSION"}
+	versionFile := filepath.Join(outputsDir, "VERSION")
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "shell",
+			got:  outputScript(outputsDir, outputs),
+			want: []string{
+				"set +ex",
+				"echo $VERSION > " + versionFile,
+			},
+		},
+		{
+			name: "batch file",
+			got:  outputBatchFile(outputsDir, outputs),
+			want: []string{
+				"@echo off",
+				"echo %VERSION% > " + versionFile,
+				"@echo on",
+			},
+		},
+		{
+			name: "powershell",
+			got:  outputPowerShellScript(outputsDir, outputs),
+			want: []string{
+				"$Utf8NoBomEncoding = New-Object System.Text.UTF8Encoding($False)",
+				`$ZadigOutputValue = if ($env:VERSION) {$env:VERSION} else {Get-Variable -Name "VERSION" -ValueOnly -ErrorAction SilentlyContinue}`,
+				`if ($ZadigOutputValue) {[System.IO.File]::WriteAllLines("` + versionFile + `", "$ZadigOutputValue", $Utf8NoBomEncoding)}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
@@ -47,6 +47,7 @@ type StepPowerShellSpec struct {
 	Scripts     []string `json:"scripts"                                 yaml:"scripts,omitempty"`
 	Script      string   `json:"script"                                  yaml:"script"`
 	SkipPrepare bool     `json:"skip_prepare"                            yaml:"skip_prepare"`
+	Interpreter string   `json:"interpreter,omitempty"                   yaml:"interpreter,omitempty"`
 }
 
 func NewPowerShellStep(jobOutput []string, spec interface{}, dirs *types.AgentWorkDirs, envs, secretEnvs []string, logger *log.JobLogger) (*PowerShellStep, error) {
@@ -74,7 +75,11 @@ func (s *PowerShellStep) Run(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("generate script failed: %v", err)
 	}
-	cmd := exec.Command("powershell", "-F", userScriptFile)
+	interpreter := "powershell"
+	if s.spec.Interpreter != "" {
+		interpreter = s.spec.Interpreter
+	}
+	cmd := exec.Command(interpreter, "-F", userScriptFile)
 	cmd.Dir = s.dirs.Workspace
 	cmd.Env = s.envs
 
@@ -153,7 +158,9 @@ func generatePowerShellScript(spec *StepPowerShellSpec, dirs *types.AgentWorkDir
 func outputPowerShellScript(outputsDir string, outputs []string) []string {
 	resp := []string{"$Utf8NoBomEncoding = New-Object System.Text.UTF8Encoding($False)"}
 	for _, output := range outputs {
-		resp = append(resp, fmt.Sprintf("if ($env:%s) {[System.IO.File]::WriteAllLines(\"%s\", $env:%s, $Utf8NoBomEncoding)}", output, filepath.Join(outputsDir, output), output))
+		// outputs can be set either as an env or as a plain powershell variable, the env takes precedence
+		resp = append(resp, fmt.Sprintf("$ZadigOutputValue = if ($env:%s) {$env:%s} else {Get-Variable -Name \"%s\" -ValueOnly -ErrorAction SilentlyContinue}", output, output, output))
+		resp = append(resp, fmt.Sprintf("if ($ZadigOutputValue) {[System.IO.File]::WriteAllLines(\"%s\", \"$ZadigOutputValue\", $Utf8NoBomEncoding)}", filepath.Join(outputsDir, output)))
 	}
 	return resp
 }
@@ -49,6 +49,7 @@ type StepShellSpec struct {
 	Scripts     []string `json:"scripts"                                 yaml:"scripts,omitempty"`
 	Script      string   `json:"script"                                  yaml:"script"`
 	SkipPrepare bool     `json:"skip_prepare"                            yaml:"skip_prepare"`
+	Interpreter string   `json:"interpreter,omitempty"                   yaml:"interpreter,omitempty"`
 }
 
 func NewShellStep(jobOutput []string, spec interface{}, dirs *types.AgentWorkDirs, envs, secretEnvs []string, logger *log.JobLogger) (*ShellStep, error) {
@@ -78,7 +79,11 @@ func (s *ShellStep) Run(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("generate script failed: %v", err)
 	}
-	cmd := exec.Command("bash", userScriptFile)
+	interpreter := "bash"
+	if s.spec.Interpreter != "" {
+		interpreter = s.spec.Interpreter
+	}
+	cmd := exec.Command(interpreter, userScriptFile)
 	cmd.Dir = s.dirs.Workspace
 	cmd.Env = s.envs
 
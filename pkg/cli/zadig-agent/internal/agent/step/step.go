@@ -19,6 +19,7 @@ package step
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/koderover/zadig/v2/pkg/cli/zadig-agent/helper/log"
 	"github.com/koderover/zadig/v2/pkg/cli/zadig-agent/internal/agent/step/archive"
@@ -125,8 +126,34 @@ func RunStep(ctx context.Context, jobCtx *jobctl.JobContext, step *commonmodels.
 		log.Error(err)
 		return err
 	}
-	if err := stepInstance.Run(ctx); err != nil {
+	return runWithTimeout(ctx, stepInstance, step.Name, time.Duration(step.Timeout)*time.Minute)
+}
+
+// runWithTimeout runs the step and returns once the timeout is exceeded, even if the step does not stop when its ctx is done.
+// The step is not limited if the timeout is not positive, and it is waited for if the job is cancelled so that it can clean up.
+func runWithTimeout(ctx context.Context, stepInstance Step, name string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return stepInstance.Run(ctx)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stepInstance.Run(stepCtx)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil && ctx.Err() == nil && stepCtx.Err() != nil {
+			return fmt.Errorf("step %s timed out after %s: %v", name, timeout, err)
+		}
 		return err
+	case <-stepCtx.Done():
+		if ctx.Err() != nil {
+			return <-errCh
+		}
+		return fmt.Errorf("step %s timed out after %s", name, timeout)
 	}
-	return nil
 }
@@ -25,6 +25,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +34,7 @@ import (
 	"github.com/koderover/zadig/v2/pkg/cli/zadig-agent/helper/log"
 	"github.com/koderover/zadig/v2/pkg/cli/zadig-agent/internal/common/types"
 	"github.com/koderover/zadig/v2/pkg/microservice/reaper/core/service/meta"
+	"github.com/koderover/zadig/v2/pkg/setting"
 	"github.com/koderover/zadig/v2/pkg/tool/s3"
 	"github.com/koderover/zadig/v2/pkg/types/step"
 	"github.com/koderover/zadig/v2/pkg/util"
@@ -75,12 +77,16 @@ func (s *JunitReportStep) Run(ctx context.Context) error {
 	s.spec.ReportDir = util.ReplaceEnvWithValue(s.spec.ReportDir, envMap)
 
 	reportDir := filepath.Join(s.workspace, s.spec.ReportDir)
-	results, err := mergeGinkgoTestResults(s.spec.FileName, reportDir, s.spec.DestDir, time.Now(), s.Logger)
+	results, err := mergeGinkgoTestResults(s.spec.FileName, reportDir, s.spec.DestDir, time.Now(), readRepoCommitMetadata(s.dirs.JobOutputsDir), s.Logger)
 	if err != nil {
 		return fmt.Errorf("failed to merge test result: %s", err)
 	}
 	s.Logger.Infof("Finish merge ginkgo test results.")
 
+	if err := writeTestResultOutputs(results, s.dirs.JobOutputsDir); err != nil {
+		s.Logger.Warnf("failed to write test result outputs, error: %v", err)
+	}
+
 	s.Logger.Infof("Start archive %s.", s.spec.FileName)
 	if s.spec.S3DestDir == "" || s.spec.FileName == "" {
 		return nil
@@ -120,7 +126,7 @@ func (s *JunitReportStep) Run(ctx context.Context) error {
 	return nil
 }
 
-func mergeGinkgoTestResults(testResultFile, testResultPath, testUploadPath string, startTime time.Time, logger *log.JobLogger) (*meta.TestSuite, error) {
+func mergeGinkgoTestResults(testResultFile, testResultPath, testUploadPath string, startTime time.Time, metadata []meta.Property, logger *log.JobLogger) (*meta.TestSuite, error) {
 	var (
 		err           error
 		newXMLBytes   []byte
@@ -199,6 +205,7 @@ func mergeGinkgoTestResults(testResultFile, testResultPath, testUploadPath strin
 		}
 	}
 	summaryResult.Time = getSecondSince(startTime)
+	summaryResult.Metadata = metadata
 	if summaryResult.SuiteType == ReploaceTestSuite {
 		summaryResult.Successes = summaryResult.Tests - summaryResult.Failures - summaryResult.Errors
 		summaryResult.Tests = summaryResult.Tests + summaryResult.Skips
@@ -226,6 +233,57 @@ func mergeGinkgoTestResults(testResultFile, testResultPath, testUploadPath strin
 	return summaryResult, nil
 }
 
+// writeTestResultOutputs writes the statistics of the merged test results into the job output dir
+func writeTestResultOutputs(results *meta.TestSuite, outputDir string) error {
+	var duration float64
+	for _, tc := range results.TestCases {
+		duration += tc.Time
+	}
+	outputs := map[string]string{
+		setting.WorkflowTestingJobOutputKeyTotal:      strconv.Itoa(results.Tests),
+		setting.WorkflowTestingJobOutputKeyFailed:     strconv.Itoa(results.Failures + results.Errors),
+		setting.WorkflowTestingJobOutputKeySkipped:    strconv.Itoa(results.Skips),
+		setting.WorkflowTestingJobOutputKeyDurationMS: strconv.FormatInt(int64(duration*1000), 10),
+	}
+	for name, value := range outputs {
+		if err := os.WriteFile(filepath.Join(outputDir, name), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRepoCommitMetadata reads the commits of the repos written by the git step into the output dir, sorted by the
+// index of the repos. Nothing is returned if the git step is skipped.
+func readRepoCommitMetadata(outputDir string) []meta.Property {
+	files, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil
+	}
+	indexes := make([]int, 0)
+	for _, file := range files {
+		var index int
+		if _, err := fmt.Sscanf(file.Name(), setting.WorkflowTestingJobOutputKeyRepoCommit, &index); err != nil {
+			continue
+		}
+		if fmt.Sprintf(setting.WorkflowTestingJobOutputKeyRepoCommit, index) == file.Name() {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+
+	metadata := make([]meta.Property, 0, len(indexes))
+	for _, index := range indexes {
+		name := fmt.Sprintf(setting.WorkflowTestingJobOutputKeyRepoCommit, index)
+		commit, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil || len(strings.TrimSpace(string(commit))) == 0 {
+			continue
+		}
+		metadata = append(metadata, meta.Property{Name: name, Value: strings.TrimSpace(string(commit))})
+	}
+	return metadata
+}
+
 func getSecondSince(startTime time.Time) float64 {
 	return float64(time.Since(startTime).Round(time.Millisecond).Nanoseconds()) / float64(time.Second)
 }
@@ -41,10 +41,11 @@ type ZadigJobTask struct {
 }
 
 type Step struct {
-	Name      string      `json:"name"`
-	StepType  string      `json:"type"`
-	Onfailure bool        `json:"on_failure"`
-	Spec      interface{} `json:"spec"`
+	Name          string      `json:"name"`
+	StepType      string      `json:"type"`
+	Onfailure     bool        `json:"on_failure"`
+	OnlyOnFailure bool        `json:"only_on_failure"`
+	Spec          interface{} `json:"spec"`
 }
 
 type EnvVar []string
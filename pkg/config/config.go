@@ -18,7 +18,9 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 
@@ -32,6 +34,21 @@ func SystemAddress() string {
 	return viper.GetString(setting.ENVSystemAddress)
 }
 
+// ExternalAddress is the address users reach the system at, e.g. through a reverse proxy, it is used in the links
+// handed to jobs such as BUILD_URL. SystemAddress is returned if it is not set.
+func ExternalAddress() string {
+	externalAddress := viper.GetString(setting.ENVExternalAddress)
+	if externalAddress == "" {
+		return SystemAddress()
+	}
+
+	u, err := url.Parse(externalAddress)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		panic(fmt.Errorf("EXTERNAL_ADDRESS %s is not a valid url with scheme and host", externalAddress))
+	}
+	return strings.TrimSuffix(externalAddress, "/")
+}
+
 func ImagePullPolicy() string {
 	return viper.GetString(setting.ENVImagePullPolicy)
 }
@@ -19,8 +19,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -47,6 +49,103 @@ func ServiceStartTimeout() int {
 	return int(serviceStartTimeoutValue)
 }
 
+// 是否为工作流任务创建 OpenTelemetry span，默认关闭，span 由服务注册的 TracerProvider 导出
+func TracingEnabled() bool {
+	return viper.GetBool(setting.ENVTracingEnabled)
+}
+
+// 基础镜像的缓存时间，默认30秒，0 表示不缓存
+func BasicImageCacheTTL() time.Duration {
+	basicImageCacheTTL := viper.GetString(setting.ENVBasicImageCacheTTLSeconds)
+	if basicImageCacheTTL == "" {
+		return 30 * time.Second
+	}
+
+	basicImageCacheTTLValue, err := strconv.ParseInt(basicImageCacheTTL, 10, 32)
+	if err != nil || basicImageCacheTTLValue < 0 {
+		panic(errors.New("BASIC_IMAGE_CACHE_TTL_SECONDS is not int or less than 0"))
+	}
+
+	return time.Duration(basicImageCacheTTLValue) * time.Second
+}
+
+// helm 仓库列表的缓存时间，默认30秒，0 表示不缓存
+func HelmRepoCacheTTL() time.Duration {
+	helmRepoCacheTTL := viper.GetString(setting.ENVHelmRepoCacheTTLSeconds)
+	if helmRepoCacheTTL == "" {
+		return 30 * time.Second
+	}
+
+	helmRepoCacheTTLValue, err := strconv.ParseInt(helmRepoCacheTTL, 10, 32)
+	if err != nil || helmRepoCacheTTLValue < 0 {
+		panic(errors.New("HELM_REPO_CACHE_TTL_SECONDS is not int or less than 0"))
+	}
+
+	return time.Duration(helmRepoCacheTTLValue) * time.Second
+}
+
+// HelmEnvLockTTL is the expiry of the lock for updating helm environments, the lock is released after it even if the holder crashed
+func HelmEnvLockTTL() time.Duration {
+	helmEnvLockTTL := viper.GetString(setting.ENVHelmEnvLockTTLSeconds)
+	if helmEnvLockTTL == "" {
+		return 60 * time.Second
+	}
+
+	helmEnvLockTTLValue, err := strconv.ParseInt(helmEnvLockTTL, 10, 32)
+	if err != nil || helmEnvLockTTLValue <= 0 {
+		panic(errors.New("HELM_ENV_LOCK_TTL_SECONDS is not int or less than 1"))
+	}
+
+	return time.Duration(helmEnvLockTTLValue) * time.Second
+}
+
+// HelmEnvLockBlocking makes the updates of a locked helm environment wait for the lock instead of failing with ErrEnvLocked
+func HelmEnvLockBlocking() bool {
+	return viper.GetBool(setting.ENVHelmEnvLockBlocking)
+}
+
+// HelmEnvUpdateWebhooks are the comma separated endpoints notified after the updates of helm environments are committed
+func HelmEnvUpdateWebhooks() []string {
+	webhooks := make([]string, 0)
+	for _, webhook := range strings.Split(viper.GetString(setting.ENVHelmEnvUpdateWebhooks), ",") {
+		webhook = strings.TrimSpace(webhook)
+		if webhook == "" {
+			continue
+		}
+		if !strings.HasPrefix(webhook, "http://") && !strings.HasPrefix(webhook, "https://") {
+			panic(fmt.Errorf("HELM_ENV_UPDATE_WEBHOOKS has an invalid endpoint %s", webhook))
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+// HelmEnvUpdateWebhookToken is sent in the X-Zadig-Token header to the helm environment update webhooks
+func HelmEnvUpdateWebhookToken() string {
+	return viper.GetString(setting.ENVHelmEnvUpdateWebhookToken)
+}
+
+// HelmImportToDeployRerender makes the helm services switched from import to deploy drop the values captured on import,
+// so that their values are rendered from the template default values again
+func HelmImportToDeployRerender() bool {
+	return viper.GetBool(setting.ENVHelmImportDeployRerender)
+}
+
+// HelmChartUploadConcurrency is the number of workers copying a helm chart tarball to its other names in object storage, default is 5
+func HelmChartUploadConcurrency() int {
+	concurrency := viper.GetString(setting.ENVHelmChartUploadConcurrency)
+	if concurrency == "" {
+		return 5
+	}
+
+	concurrencyValue, err := strconv.ParseInt(concurrency, 10, 32)
+	if err != nil || concurrencyValue <= 0 {
+		panic(errors.New("HELM_CHART_UPLOAD_CONCURRENCY is not int or less than 1"))
+	}
+
+	return int(concurrencyValue)
+}
+
 // 环境默认回收天数，默认为0
 func DefaultRecycleDay() int {
 	defaultRecycleDay := viper.GetString(setting.ENVDefaultEnvRecycleDay)
@@ -190,6 +289,15 @@ func ObjectStorageProductionServicePath(project, service string) string {
 	return configbase.ObjectStorageProductionServicePath(project, service)
 }
 
+// ObjectStorageServicePathWithChartVersion returns the object storage path of the service with the chart version subpath,
+// it is the same as ObjectStorageServicePath if chartVersion is empty
+func ObjectStorageServicePathWithChartVersion(project, service, chartVersion string, production bool) string {
+	if chartVersion == "" {
+		return ObjectStorageServicePath(project, service, production)
+	}
+	return filepath.Join(ObjectStorageServicePath(project, service, production), chartVersion)
+}
+
 func LocalServicePath(project, service string, production bool) string {
 	if production {
 		return LocalProductionServicePath(project, service)
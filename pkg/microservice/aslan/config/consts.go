@@ -18,6 +18,7 @@ package config
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -320,6 +321,9 @@ const (
 	SourceRuntime DeploySourceType = "runtime"
 	SourceFixed   DeploySourceType = "fixed"
 	SourceFromJob DeploySourceType = "fromjob"
+	SourceFromEnv DeploySourceType = "fromenv"
+	// SourceFromCluster resolves the targets from the workloads running in a namespace of a cluster
+	SourceFromCluster DeploySourceType = "fromcluster"
 )
 
 type TriggerWorkflowSourceType string
@@ -341,6 +345,8 @@ type EnvOperation string
 const (
 	EnvOperationDefault  EnvOperation = "default"
 	EnvOperationRollback EnvOperation = "rollback"
+	// EnvOperationDelete is the version recorded when a service is removed from the environment
+	EnvOperationDelete EnvOperation = "delete"
 )
 
 type EnvOperationType string
@@ -559,6 +565,17 @@ const (
 	TestJobObjectStorageStepName     = "object-storage-step"
 )
 
+// TestJobHTMLReportIndexedStepName is the name of the step archiving the html report at the index of a test with
+// multiple html reports, a test with a single html report archives it in the step named TestJobHTMLReportStepName
+func TestJobHTMLReportIndexedStepName(index int) string {
+	return TestJobHTMLReportStepName + "-" + strconv.Itoa(index)
+}
+
+// IsTestJobHTMLReportStep returns if the step archives a html report of a test
+func IsTestJobHTMLReportStep(stepName string) bool {
+	return stepName == TestJobHTMLReportStepName || strings.HasPrefix(stepName, TestJobHTMLReportStepName+"-")
+}
+
 const (
 	ScanningJobArchiveResultStepName = "archive-result-step"
 )
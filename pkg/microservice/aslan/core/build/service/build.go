@@ -322,6 +322,9 @@ func CreateBuild(username string, build *commonmodels.Build, log *zap.SugaredLog
 			return e.ErrCreateBuildModule.AddDesc(err.Error())
 		}
 	}
+	if !build.CacheCompression.Valid() {
+		return e.ErrCreateBuildModule.AddDesc(fmt.Sprintf("invalid cache compression: %s", build.CacheCompression))
+	}
 
 	templateProdct, err := template.NewProductColl().Find(build.ProductName)
 	if err != nil {
@@ -349,6 +352,9 @@ func UpdateBuild(username string, build *commonmodels.Build, log *zap.SugaredLog
 	if err := commonutil.CheckDefineResourceParam(build.PreBuild.ResReq, build.PreBuild.ResReqSpec); err != nil {
 		return e.ErrUpdateBuildModule.AddDesc(err.Error())
 	}
+	if !build.CacheCompression.Valid() {
+		return e.ErrUpdateBuildModule.AddDesc(fmt.Sprintf("invalid cache compression: %s", build.CacheCompression))
+	}
 
 	existed, err := commonrepo.NewBuildColl().Find(&commonrepo.BuildFindOption{Name: build.Name, ProductName: build.ProductName})
 	if err == nil && existed.PreBuild != nil && build.PreBuild != nil {
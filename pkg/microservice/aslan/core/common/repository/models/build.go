@@ -74,6 +74,8 @@ type Build struct {
 	CacheEnable  bool               `bson:"cache_enable"   json:"cache_enable"`
 	CacheDirType types.CacheDirType `bson:"cache_dir_type" json:"cache_dir_type"`
 	CacheUserDir string             `bson:"cache_user_dir" json:"cache_user_dir"`
+	// CacheCompression is the compression of the object storage cache, empty means gzip
+	CacheCompression types.CacheCompression `bson:"cache_compression" json:"cache_compression"`
 	// New since V1.10.0. Only to tell the webpage should the advanced settings be displayed
 	EnablePrivilegedMode     bool      `bson:"enable_privileged_mode" json:"enable_privileged_mode"`
 	AdvancedSettingsModified bool      `bson:"advanced_setting_modified" json:"advanced_setting_modified"`
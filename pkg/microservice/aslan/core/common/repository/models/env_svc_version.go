@@ -45,6 +45,8 @@ type EnvServiceVersion struct {
 	CreateBy        string                          `bson:"create_by"                 json:"create_by"`
 	CreateTime      int64                           `bson:"create_time"               json:"create_time"`
 	UpdateTime      int64                           `bson:"update_time"               json:"update_time"`
+	// IdempotencyKey is given by the caller of the update, an update repeated with the same key is a no-op
+	IdempotencyKey string `bson:"idempotency_key,omitempty" json:"idempotency_key,omitempty"`
 }
 
 func (EnvServiceVersion) TableName() string {
@@ -0,0 +1,54 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	HelmEnvAuditOperationUpdateService       = "update_service"
+	HelmEnvAuditOperationUpdateAllServices   = "update_all_services"
+	HelmEnvAuditOperationUpdateServicesGroup = "update_services_group"
+	HelmEnvAuditOperationRollback            = "rollback"
+	HelmEnvAuditOperationSetDeployStrategies = "set_deploy_strategies"
+	HelmEnvAuditOperationImportReleases      = "import_releases"
+	HelmEnvAuditOperationRemoveService       = "remove_service"
+)
+
+// HelmEnvAuditEvent records who changed the services of a helm environment
+type HelmEnvAuditEvent struct {
+	ID          primitive.ObjectID     `bson:"_id,omitempty"  json:"id"`
+	ProjectName string                 `bson:"project_name"   json:"project_name"`
+	EnvName     string                 `bson:"env_name"       json:"env_name"`
+	Production  bool                   `bson:"production"     json:"production"`
+	Operation   string                 `bson:"operation"      json:"operation"`
+	User        string                 `bson:"user"           json:"user"`
+	Services    []*HelmEnvAuditService `bson:"services"       json:"services"`
+	CreateTime  int64                  `bson:"create_time"    json:"create_time"`
+}
+
+type HelmEnvAuditService struct {
+	ServiceName        string `bson:"service_name"         json:"service_name"`
+	ReleaseName        string `bson:"release_name"         json:"release_name"`
+	PrevDeployStrategy string `bson:"prev_deploy_strategy" json:"prev_deploy_strategy"`
+	DeployStrategy     string `bson:"deploy_strategy"      json:"deploy_strategy"`
+}
+
+func (HelmEnvAuditEvent) TableName() string {
+	return "helm_env_audit_event"
+}
@@ -17,13 +17,26 @@ limitations under the License.
 package models
 
 import (
+	"strings"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	HelmRepoTypeClassic = "classic"
+	HelmRepoTypeOCI     = "oci"
+
+	HelmRepoOCIScheme = "oci://"
+
+	// HelmRepoCredentialSourceK8sSecret means the password of the repo is read from a secret in a cluster
+	HelmRepoCredentialSourceK8sSecret = "k8s-secret"
+)
+
 type HelmRepo struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty"         json:"id,omitempty"`
 	RepoName    string             `bson:"repo_name,omitempty"   json:"repo_name,omitempty"`
 	URL         string             `bson:"url"                   json:"url"`
+	RepoType    string             `bson:"repo_type"             json:"repo_type"`
 	Username    string             `bson:"username"              json:"username"`
 	Password    string             `bson:"password"              json:"password"`
 	Projects    []string           `bson:"projects"              json:"projects"`
@@ -31,8 +44,49 @@ type HelmRepo struct {
 	UpdateBy    string             `bson:"update_by"             json:"update_by"`
 	CreatedAt   int64              `bson:"created_at"            json:"created_at"`
 	UpdatedAt   int64              `bson:"updated_at"            json:"updated_at"`
+	// CredentialSource is where the password comes from, it is stored with the repo if empty. The password of a repo
+	// with the k8s-secret source is never stored, it is read from the secret referenced by SecretRef when it is used.
+	CredentialSource string             `bson:"credential_source,omitempty" json:"credential_source,omitempty"`
+	SecretRef        *HelmRepoSecretRef `bson:"secret_ref,omitempty"        json:"secret_ref,omitempty"`
+	// CredentialError is only filled in api responses when the password can not be read from the secret
+	CredentialError string `bson:"-"                     json:"credential_error,omitempty"`
+	// Charts and ChartsError are only filled in api responses when the dependencies of charts are requested
+	Charts      []*ChartSummary `bson:"-"                     json:"charts,omitempty"`
+	ChartsError string          `bson:"-"                     json:"charts_error,omitempty"`
+}
+
+// HelmRepoSecretRef is the key of a secret holding the password of a helm repo
+type HelmRepoSecretRef struct {
+	ClusterID string `bson:"cluster_id" json:"cluster_id"`
+	Namespace string `bson:"namespace"  json:"namespace"`
+	Name      string `bson:"name"       json:"name"`
+	Key       string `bson:"key"        json:"key"`
+}
+
+// ChartSummary is the latest version of a chart in the repo index
+type ChartSummary struct {
+	Name         string             `json:"name"`
+	Version      string             `json:"version"`
+	Dependencies []*ChartDependency `json:"dependencies"`
+}
+
+type ChartDependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository"`
 }
 
 func (h HelmRepo) TableName() string {
 	return "helm_repo"
 }
+
+// GetRepoType returns the repo type, repos saved before the type was introduced are inferred from the url
+func (h *HelmRepo) GetRepoType() string {
+	if h.RepoType != "" {
+		return h.RepoType
+	}
+	if strings.HasPrefix(h.URL, HelmRepoOCIScheme) {
+		return HelmRepoTypeOCI
+	}
+	return HelmRepoTypeClassic
+}
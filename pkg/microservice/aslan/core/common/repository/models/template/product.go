@@ -48,6 +48,8 @@ type Product struct {
 	ProductFeature               *ProductFeature       `bson:"product_feature,omitempty" json:"product_feature,omitempty"`
 	ImageSearchingRules          []*ImageSearchingRule `bson:"image_searching_rules,omitempty" json:"image_searching_rules,omitempty"`
 	ReleaseMaxHistory            int                   `bson:"release_max_history"       json:"release_max_history"`
+	// helm项目的基础values，部署时合并在环境全局values和服务values之下
+	BaseValues string `bson:"base_values,omitempty"     json:"base_values,omitempty"`
 	// onboarding状态，0表示onboarding完成，1、2、3、4代表当前onboarding所在的步骤
 	OnboardingStatus int `bson:"onboarding_status"         json:"onboarding_status"`
 	// CI场景的onboarding流程创建的ci工作流id，用于前端跳转
@@ -0,0 +1,55 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TestTrend keeps the junit results of the latest runs of a test in a workflow job, service tests have one per service module
+type TestTrend struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"   json:"id"`
+	WorkflowName  string             `bson:"workflow_name"   json:"workflow_name"`
+	JobName       string             `bson:"job_name"        json:"job_name"`
+	ZadigTestName string             `bson:"zadig_test_name" json:"zadig_test_name"`
+	ServiceName   string             `bson:"service_name"    json:"service_name"`
+	ServiceModule string             `bson:"service_module"  json:"service_module"`
+	// Runs are sorted by the time they are recorded, the oldest runs are dropped once the limit is reached
+	Runs []*TestTrendRun `bson:"runs"            json:"runs"`
+	// Baseline is the result of the latest baseline run, the other runs are compared against it
+	Baseline   *TestTrendRun `bson:"baseline,omitempty" json:"baseline,omitempty"`
+	UpdateTime int64         `bson:"update_time"     json:"update_time"`
+}
+
+type TestTrendRun struct {
+	TaskID         int64 `bson:"task_id"          json:"task_id"`
+	RetryNum       int   `bson:"retry_num"        json:"retry_num"`
+	CreateTime     int64 `bson:"create_time"      json:"create_time"`
+	TestCaseNum    int   `bson:"test_case_num"    json:"test_case_num"`
+	SuccessCaseNum int   `bson:"success_case_num" json:"success_case_num"`
+	SkipCaseNum    int   `bson:"skip_case_num"    json:"skip_case_num"`
+	FailedCaseNum  int   `bson:"failed_case_num"  json:"failed_case_num"`
+	ErrorCaseNum   int   `bson:"error_case_num"   json:"error_case_num"`
+	// FailedCases are the failed and errored cases named as <classname>.<name>, the other cases passed or were skipped
+	FailedCases []string `bson:"failed_cases"     json:"failed_cases"`
+	// Baseline marks the run which replaced the baseline of the trend
+	Baseline bool `bson:"baseline,omitempty" json:"baseline,omitempty"`
+	// NewFailedCases are the failed cases which did not fail in the baseline, it is only set if there is a baseline
+	NewFailedCases []string `bson:"new_failed_cases,omitempty" json:"new_failed_cases,omitempty"`
+}
+
+func (TestTrend) TableName() string {
+	return "test_trend"
+}
@@ -17,6 +17,11 @@ limitations under the License.
 package models
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
 	"github.com/koderover/zadig/v2/pkg/util"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -42,10 +47,16 @@ type Testing struct {
 	UpdateBy       string              `bson:"update_by"                json:"update_by"`
 	// Junit 测试报告
 	TestResultPath string `bson:"test_result_path"         json:"test_result_path"`
-	// html 测试报告
+	// 合并后的 Junit 测试报告文件名，为空时默认为 merged.xml，服务测试默认为 <service>-<module>.xml
+	MergedReportName string `bson:"merged_report_name"       json:"merged_report_name"`
+	// Junit 测试报告在对象存储中的目录模板，可使用 JunitS3LayoutVariables 中的变量，为空时默认为 DefaultJunitS3Layout
+	JunitS3Layout string `bson:"junit_s3_layout"          json:"junit_s3_layout"`
+	// html 测试报告，TODO: Deprecated，仅在 TestReportPaths 为空时使用
 	TestReportPath string `bson:"test_report_path"         json:"test_report_path"`
-	Threshold      int    `bson:"threshold"                json:"threshold"`
-	TestType       string `bson:"test_type"                json:"test_type"`
+	// html 测试报告，可配置多个，例如覆盖率报告和测试报告
+	TestReportPaths []string `bson:"test_report_paths"        json:"test_report_paths"`
+	Threshold       int      `bson:"threshold"                json:"threshold"`
+	TestType        string   `bson:"test_type"                json:"test_type"`
 
 	// TODO: Deprecated.
 	Caches []string `bson:"caches"                   json:"caches"`
@@ -68,11 +79,152 @@ type Testing struct {
 	CacheEnable  bool               `bson:"cache_enable"              json:"cache_enable"`
 	CacheDirType types.CacheDirType `bson:"cache_dir_type"            json:"cache_dir_type"`
 	CacheUserDir string             `bson:"cache_user_dir"            json:"cache_user_dir"`
+	// CacheCompression is the compression of the object storage cache, empty means gzip
+	CacheCompression types.CacheCompression `bson:"cache_compression"         json:"cache_compression"`
 	// New since V1.10.0. Only to tell the webpage should the advanced settings be displayed
 	AdvancedSettingsModified bool      `bson:"advanced_setting_modified" json:"advanced_setting_modified"`
 	Outputs                  []*Output `bson:"outputs"                   json:"outputs"`
+	// ArchivePolicy decides when the html report, the artifacts and the object storage uploads are archived,
+	// the junit report is not affected
+	ArchivePolicy TestingArchivePolicy `bson:"archive_policy"            json:"archive_policy"`
+	// ScriptFromRepo runs the script file in one of the cloned repos instead of Scripts if it is set
+	ScriptFromRepo *TestingScriptFromRepo `bson:"script_from_repo"          json:"script_from_repo"`
+	// StepTimeouts limit the steps of the test separately, a step without a timeout is only limited by Timeout
+	StepTimeouts *TestingStepTimeouts `bson:"step_timeouts"             json:"step_timeouts"`
+	// LogMaskPatterns are regexes, the substrings of the script output matching them are masked in the job logs, the
+	// values of the credential envs are always masked. Testings running on vm are rejected, zadig-agent doesn't mask the output
+	LogMaskPatterns []string `bson:"log_mask_patterns"         json:"log_mask_patterns"`
+	// ShellInterpreter runs the test script instead of the default interpreter of the script type, like dash or pwsh
+	ShellInterpreter string `bson:"shell_interpreter"         json:"shell_interpreter"`
+}
+
+// DefaultJunitS3Layout is the object storage dir of the junit reports of a testing without JunitS3Layout
+const DefaultJunitS3Layout = "$WORKFLOW/$TASK_ID/$JOB_NAME/junit"
+
+// JunitS3LayoutVariables are the variables that can be used in JunitS3Layout, DATE is the date the job task is created
+// on in the form of 2006-01-02
+var JunitS3LayoutVariables = []string{"PROJECT", "WORKFLOW", "TASK_ID", "JOB_NAME", "TESTING_NAME", "SERVICE_NAME", "SERVICE_MODULE", "DATE"}
+
+// RenderJunitS3Layout renders the object storage dir of the junit reports with the layout, DefaultJunitS3Layout is used
+// if layout is empty. The rendered dir must be a non-empty relative path without "..".
+func RenderJunitS3Layout(layout string, variables map[string]string) (string, error) {
+	if layout == "" {
+		layout = DefaultJunitS3Layout
+	}
+
+	unknownVariables := make([]string, 0)
+	rendered := os.Expand(layout, func(key string) string {
+		value, ok := variables[key]
+		if !ok {
+			unknownVariables = append(unknownVariables, key)
+		}
+		return value
+	})
+	if len(unknownVariables) > 0 {
+		return "", fmt.Errorf("unknown variables %s in junit s3 layout %s", strings.Join(unknownVariables, ", "), layout)
+	}
+
+	if strings.HasPrefix(rendered, "/") {
+		return "", fmt.Errorf("junit s3 dir %s rendered from layout %s must be relative", rendered, layout)
+	}
+	for _, elem := range strings.Split(rendered, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("junit s3 dir %s rendered from layout %s must not contain ..", rendered, layout)
+		}
+	}
+	dir := path.Clean(rendered)
+	if dir == "." {
+		return "", fmt.Errorf("junit s3 dir rendered from layout %s is empty", layout)
+	}
+	return dir, nil
+}
+
+// ValidateJunitS3Layout checks that the layout only uses JunitS3LayoutVariables and can not be rendered out of the dir
+func ValidateJunitS3Layout(layout string) error {
+	if layout == "" {
+		return nil
+	}
+	variables := make(map[string]string, len(JunitS3LayoutVariables))
+	for _, key := range JunitS3LayoutVariables {
+		variables[key] = key
+	}
+	_, err := RenderJunitS3Layout(layout, variables)
+	return err
+}
+
+// GetTestReportPaths returns the html report paths of the testing, the single TestReportPath of the testings saved
+// before TestReportPaths is used if there is no TestReportPaths
+func (t *Testing) GetTestReportPaths() []string {
+	if len(t.TestReportPaths) > 0 {
+		return t.TestReportPaths
+	}
+	if t.TestReportPath != "" {
+		return []string{t.TestReportPath}
+	}
+	return nil
+}
+
+// ValidateTestReportPaths checks that none of the html report paths is empty
+func ValidateTestReportPaths(paths []string) error {
+	for i, reportPath := range paths {
+		if strings.TrimSpace(reportPath) == "" {
+			return fmt.Errorf("html report path %d is empty", i+1)
+		}
+	}
+	return nil
+}
+
+// TestingStepTimeouts are the timeouts of the steps of a test in minutes, 0 means the step is not limited separately
+type TestingStepTimeouts struct {
+	// Clone limits the git and perforce steps
+	Clone int `bson:"clone"   json:"clone"`
+	// Script limits the test script
+	Script int `bson:"script"  json:"script"`
+	// Archive limits the steps archiving the reports and the artifacts
+	Archive int `bson:"archive" json:"archive"`
+}
+
+// Validate checks that the timeouts are not negative and their sum does not exceed the timeout of the job in minutes
+func (t *TestingStepTimeouts) Validate(jobTimeout int) error {
+	if t == nil {
+		return nil
+	}
+	if t.Clone < 0 || t.Script < 0 || t.Archive < 0 {
+		return fmt.Errorf("step timeouts must not be negative")
+	}
+	if sum := t.Clone + t.Script + t.Archive; jobTimeout > 0 && sum > jobTimeout {
+		return fmt.Errorf("the sum of the step timeouts %d exceeds the job timeout %d", sum, jobTimeout)
+	}
+	return nil
+}
+
+type TestingScriptFromRepo struct {
+	// RepoIndex is the index of the repo in Repos
+	RepoIndex int `bson:"repo_index" json:"repo_index"`
+	// FilePath is the path of the script file relative to the root of the repo
+	FilePath string `bson:"file_path"  json:"file_path"`
+}
+
+// TestingEnvFileFromRepo is a dotenv file of KEY=VALUE lines, empty lines and lines starting with # are ignored and
+// the value may be quoted
+type TestingEnvFileFromRepo struct {
+	// RepoIndex is the index of the repo in the repos of the test
+	RepoIndex int `bson:"repo_index" yaml:"repo_index" json:"repo_index"`
+	// FilePath is the path of the dotenv file relative to the root of the repo
+	FilePath string `bson:"file_path"  yaml:"file_path"  json:"file_path"`
 }
 
+type TestingArchivePolicy string
+
+const (
+	// TestingArchivePolicyDefault archives the html report and the artifacts even if the test failed,
+	// and uploads to object storage only if the test passed
+	TestingArchivePolicyDefault   TestingArchivePolicy = ""
+	TestingArchivePolicyAlways    TestingArchivePolicy = "always"
+	TestingArchivePolicyOnSuccess TestingArchivePolicy = "on-success"
+	TestingArchivePolicyOnFailure TestingArchivePolicy = "on-failure"
+)
+
 type TestingHookCtrl struct {
 	Enabled bool           `bson:"enabled" json:"enabled"`
 	Items   []*TestingHook `bson:"items" json:"items"`
@@ -97,8 +249,12 @@ type PreTest struct {
 	// ResReq defines job requested resources
 	ResReq     setting.Request     `bson:"res_req"                json:"res_req"`
 	ResReqSpec setting.RequestSpec `bson:"res_req_spec"           json:"res_req_spec"`
+	// ResLimitSpec overrides the resource limits derived from ResReq, it is only supported on kubernetes
+	ResLimitSpec *setting.ResourceLimitSpec `bson:"res_limit_spec,omitempty" json:"res_limit_spec,omitempty"`
 	// Installs defines apps to be installed for build
 	Installs []*Item `bson:"installs,omitempty"    json:"installs"`
+	// InstallLocks stores the concrete versions that the installs with version patterns like 18.x are resolved to
+	InstallLocks []*ToolVersionLock `bson:"install_locks,omitempty" json:"install_locks,omitempty"`
 	// Envs stores user defined env key val for build
 	Envs KeyValList `bson:"envs,omitempty"              json:"envs"`
 	// EnableProxy
@@ -112,6 +268,70 @@ type PreTest struct {
 
 	CustomAnnotations []*util.KeyValue `bson:"custom_annotations"        json:"custom_annotations"`
 	CustomLabels      []*util.KeyValue `bson:"custom_labels"             json:"custom_labels"`
+	// Sidecars run alongside the test container in the same pod, only supported on kubernetes
+	Sidecars []*SidecarSpec `bson:"sidecars"                  json:"sidecars"`
+	// TerminationGracePeriodSeconds is the time the script has to clean up after the test times out or is cancelled,
+	// 0 keeps the default behavior
+	TerminationGracePeriodSeconds int64 `bson:"termination_grace_period_seconds" json:"termination_grace_period_seconds"`
+	// HostAliases are the entries appended to the hosts file of the test pod or vm
+	HostAliases []*HostAlias `bson:"host_aliases"             json:"host_aliases"`
+	// NodeStrategy decides the nodes the test pod prefers, the retry after an eviction is scheduled to the fallback
+	// nodes, it is only supported on kubernetes
+	NodeStrategy *NodeStrategy `bson:"node_strategy,omitempty" json:"node_strategy,omitempty"`
+	// VolumeClaims are the PVCs provisioned and mounted for the test pod, they are deleted after the test,
+	// only supported on kubernetes
+	VolumeClaims []*VolumeClaimSpec `bson:"volume_claims"            json:"volume_claims"`
+	// ExtraImagePullSecrets are the names of extra image pull secrets of the test pod, merged with the secrets of the
+	// registries. They must exist in the namespace of the test pod, only supported on kubernetes
+	ExtraImagePullSecrets []string `bson:"extra_image_pull_secrets" json:"extra_image_pull_secrets"`
+}
+
+// VolumeClaimSpec is a scratch volume provisioned by the storage class for a single run of the test
+type VolumeClaimSpec struct {
+	StorageClass     string `bson:"storage_class"       json:"storage_class"`
+	StorageSizeInGiB int64  `bson:"storage_size_in_gib" json:"storage_size_in_gib"`
+	// MountPath is the absolute path the volume is mounted to in the test container
+	MountPath string `bson:"mount_path"          json:"mount_path"`
+}
+
+// ValidateVolumeClaims checks that the volume claims have a storage class and a size and are mounted to different
+// absolute paths
+func ValidateVolumeClaims(claims []*VolumeClaimSpec) error {
+	mountPaths := make(map[string]bool, len(claims))
+	for _, claim := range claims {
+		if claim.StorageClass == "" {
+			return fmt.Errorf("storage class of the volume claim mounted to %s is empty", claim.MountPath)
+		}
+		if claim.StorageSizeInGiB <= 0 {
+			return fmt.Errorf("storage size of the volume claim mounted to %s must be positive", claim.MountPath)
+		}
+		if !path.IsAbs(claim.MountPath) {
+			return fmt.Errorf("mount path %s of the volume claim must be absolute", claim.MountPath)
+		}
+		mountPath := path.Clean(claim.MountPath)
+		if mountPaths[mountPath] {
+			return fmt.Errorf("more than one volume claim is mounted to %s", mountPath)
+		}
+		mountPaths[mountPath] = true
+	}
+	return nil
+}
+
+// ToolVersionLock pins the install Name with version Spec to the concrete Version
+type ToolVersionLock struct {
+	Name    string `bson:"name"    json:"name"`
+	Spec    string `bson:"spec"    json:"spec"`
+	Version string `bson:"version" json:"version"`
+}
+
+// LockedVersion returns the locked concrete version of the install, or its own version if it is not locked
+func (p *PreTest) LockedVersion(install *Item) string {
+	for _, lock := range p.InstallLocks {
+		if lock.Name == install.Name && lock.Spec == install.Version {
+			return lock.Version
+		}
+	}
+	return install.Version
 }
 
 type PostTest struct {
@@ -118,6 +118,11 @@ type JobTask struct {
 	ServiceModules   []*WorkflowServiceModule `bson:"service_modules"     json:"service_modules"`
 	Infrastructure   string                   `bson:"infrastructure"      json:"infrastructure"`
 	VMLabels         []string                 `bson:"vm_labels"           json:"vm_labels"`
+	// Labels are used to attribute the job task, e.g. by project or team, they are added to the pod labels on kubernetes
+	Labels map[string]string `bson:"labels"              json:"labels"`
+	// ParallelBatch is the 1-based batch of the job task among the tasks with the same origin name, a batch only starts
+	// after the previous one is done. 0 means the job task is not batched.
+	ParallelBatch int `bson:"parallel_batch"      json:"parallel_batch"`
 
 	ErrorPolicy   *JobErrorPolicy   `bson:"error_policy"         yaml:"error_policy"         json:"error_policy"`
 	ExecutePolicy *JobExecutePolicy `bson:"execute_policy"       yaml:"execute_policy"       json:"execute_policy"`
@@ -127,6 +132,8 @@ type JobTask struct {
 
 	RetryCount int  `bson:"retry_count" json:"retry_count" yaml:"retry_count"`
 	Reverted   bool `bson:"reverted"    json:"reverted"    yaml:"reverted"`
+	// Evicted is set once the pod of the job is evicted, the retries are scheduled to the fallback nodes of the NodeStrategy
+	Evicted bool `bson:"evicted" json:"evicted" yaml:"evicted"`
 }
 
 type TaskJobInfo struct {
@@ -136,6 +143,19 @@ type TaskJobInfo struct {
 	JobName       string `bson:"job_name"        json:"job_name"`
 	ServiceName   string `bson:"service_name"    json:"service_name"`
 	ServiceModule string `bson:"service_module"  json:"service_module"`
+	WarmCacheOnly string `bson:"warm_cache_only" json:"warm_cache_only"`
+	// TestedServices is the TESTED_SERVICES output of the testing job the job task belongs to
+	TestedServices string `bson:"tested_services" json:"tested_services"`
+}
+
+// IsWarmCacheOnly returns if the job task only warms the cache of a test, such a task does not run the test and is not
+// counted as a test run
+func (j *JobTask) IsWarmCacheOnly() bool {
+	jobInfo := new(TaskJobInfo)
+	if err := IToi(j.JobInfo, jobInfo); err != nil {
+		return false
+	}
+	return jobInfo.WarmCacheOnly == "true"
 }
 
 type WorkflowTaskPreview struct {
@@ -780,6 +800,10 @@ type StepTask struct {
 	Error     string          `bson:"error"          json:"error"        yaml:"error"`
 	StepType  config.StepType `bson:"type"           json:"type"         yaml:"type"`
 	Onfailure bool            `bson:"on_failure"     json:"on_failure"   yaml:"on_failure"`
+	// Timeout limits the step in minutes separately from the job, 0 means the step is only limited by the job timeout
+	Timeout int64 `bson:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// OnlyOnFailure makes the step run only after a previous step failed, it implies Onfailure
+	OnlyOnFailure bool `bson:"only_on_failure" json:"only_on_failure" yaml:"only_on_failure"`
 	// step input params,differ form steps
 	Spec interface{} `bson:"spec"           json:"spec"   yaml:"spec"`
 	// step output results,like testing results,differ form steps
@@ -486,6 +486,8 @@ type HookPayload struct {
 	DeliveryID     string `bson:"delivery_id"      json:"delivery_id,omitempty"`
 	CodehostID     int    `bson:"codehost_id"      json:"codehost_id"`
 	EventType      string `bson:"event_type"       json:"event_type"`
+	// ChangedFiles are the files changed by the push or the merge request, it is nil if the changes are unknown
+	ChangedFiles []string `bson:"changed_files,omitempty" json:"changed_files,omitempty"`
 }
 
 type TargetArgs struct {
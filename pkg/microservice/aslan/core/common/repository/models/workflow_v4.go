@@ -68,6 +68,12 @@ type WorkflowV4 struct {
 	CustomField          *CustomField `bson:"custom_field"           yaml:"-"                      json:"custom_field"`
 	EnableApprovalTicket bool         `bson:"enable_approval_ticket" yaml:"enable_approval_ticket" json:"enable_approval_ticket"`
 	ApprovalTicketID     string       `bson:"approval_ticket_id"     yaml:"approval_ticket_id"     json:"approval_ticket_id"`
+	// RegistryPreflightCheck pings the registry of the job images when the task is created, so that an unreachable registry
+	// fails the task at once instead of leaving the pods failing to pull the image
+	RegistryPreflightCheck bool `bson:"registry_preflight_check" yaml:"registry_preflight_check" json:"registry_preflight_check"`
+	// TestingTypedVariables injects the service variables only into service tests and TEST_MODULE_INDEX into product tests.
+	// It is set for the workflows created since it is added, the existing workflows keep the old variables unless it is turned on.
+	TestingTypedVariables bool `bson:"testing_typed_variables" yaml:"testing_typed_variables" json:"testing_typed_variables"`
 
 	// all hookCtls are deprecated
 	HookCtls        []*WorkflowV4Hook `bson:"hook_ctl"            yaml:"-"                   json:"hook_ctl"`
@@ -301,9 +307,13 @@ type Job struct {
 }
 
 type JobErrorPolicy struct {
-	Policy        config.JobErrorPolicy `bson:"policy"         yaml:"policy"         json:"policy"`
-	MaximumRetry  int                   `bson:"maximum_retry"  yaml:"maximum_retry"  json:"maximum_retry"`
-	ApprovalUsers []*User               `bson:"approval_users" yaml:"approval_users" json:"approval_users"`
+	Policy       config.JobErrorPolicy `bson:"policy"         yaml:"policy"         json:"policy"`
+	MaximumRetry int                   `bson:"maximum_retry"  yaml:"maximum_retry"  json:"maximum_retry"`
+	// RetryInterval is the seconds to wait between retries, 10 seconds will be used if not set
+	RetryInterval int `bson:"retry_interval" yaml:"retry_interval" json:"retry_interval"`
+	// RetryOnlyWithoutOutput stops retrying once a failed run has written job outputs or test reports
+	RetryOnlyWithoutOutput bool    `bson:"retry_only_without_output" yaml:"retry_only_without_output" json:"retry_only_without_output"`
+	ApprovalUsers          []*User `bson:"approval_users"            yaml:"approval_users"            json:"approval_users"`
 }
 
 type JobExecuteRule struct {
@@ -652,6 +662,12 @@ type ZadigTestingJobSpec struct {
 	JobName       string                  `bson:"job_name"          yaml:"job_name"          json:"job_name"`
 	OriginJobName string                  `bson:"origin_job_name"   yaml:"origin_job_name"   json:"origin_job_name"`
 	RefRepos      bool                    `bson:"ref_repos"         yaml:"ref_repos"         json:"ref_repos"`
+	// Env is the environment the service targets are resolved from when the source is fromenv
+	Env string `bson:"env"               yaml:"env"               json:"env"`
+	// ClusterID, Namespace and LabelSelector select the workloads the service targets are resolved from when the source is fromcluster
+	ClusterID     string `bson:"cluster_id"        yaml:"cluster_id"        json:"cluster_id"`
+	Namespace     string `bson:"namespace"         yaml:"namespace"         json:"namespace"`
+	LabelSelector string `bson:"label_selector"    yaml:"label_selector"    json:"label_selector"`
 	// selected service in service testing
 	DefaultServices []*ServiceTestTarget `bson:"target_services"   yaml:"target_services"   json:"target_services"`
 	// field for non-service tests.
@@ -660,12 +676,24 @@ type ZadigTestingJobSpec struct {
 	// in config: this is the test infos for all the services
 	ServiceAndTests    []*ServiceAndTest `bson:"service_and_tests"    yaml:"service_and_tests"    json:"service_and_tests"`
 	ServiceTestOptions []*ServiceAndTest `bson:"service_test_options" yaml:"service_test_options" json:"service_test_options"`
+	// Matrix expands every test module into one task per row, the row's key/values are injected as envs.
+	Matrix []map[string]string `bson:"matrix"               yaml:"matrix"               json:"matrix"`
+	// GenerateReportIndex provides an index page linking to the html reports of all the test modules in the job.
+	GenerateReportIndex bool `bson:"generate_report_index" yaml:"generate_report_index" json:"generate_report_index"`
+	// MaxParallel splits the job tasks into batches of at most MaxParallel tasks which run one after another, 0 means unlimited.
+	MaxParallel int `bson:"max_parallel"          yaml:"max_parallel"          json:"max_parallel"`
+	// BaselineRun records the junit results of the run as the new baseline of the test trends instead of comparing
+	// them against the baseline, it is an argument of the run and is not kept from the workflow configuration.
+	BaselineRun bool `bson:"baseline_run"          yaml:"baseline_run"          json:"baseline_run"`
 }
 
 type ServiceAndTest struct {
 	ServiceName   string `bson:"service_name"        yaml:"service_name"     json:"service_name"`
 	ServiceModule string `bson:"service_module"      yaml:"service_module"   json:"service_module"`
 	*TestModule   `bson:",inline"  yaml:",inline"  json:",inline"`
+	// TestModules are the testing definitions of the service module, each of them runs in its own job tasks. The inline
+	// TestModule of the existing data is used if it is empty.
+	TestModules []*TestModule `bson:"test_modules,omitempty" yaml:"test_modules,omitempty" json:"test_modules,omitempty"`
 }
 
 func (s *ServiceAndTest) GetKey() string {
@@ -675,6 +703,20 @@ func (s *ServiceAndTest) GetKey() string {
 	return s.ServiceName + "-" + s.ServiceModule
 }
 
+// GetTestModules returns the testing definitions of the service module, falling back to the inline TestModule
+func (s *ServiceAndTest) GetTestModules() []*TestModule {
+	if s == nil {
+		return nil
+	}
+	if len(s.TestModules) > 0 {
+		return s.TestModules
+	}
+	if s.TestModule != nil {
+		return []*TestModule{s.TestModule}
+	}
+	return nil
+}
+
 type ServiceTestTarget struct {
 	ServiceName   string `bson:"service_name"        yaml:"service_name"     json:"service_name"`
 	ServiceModule string `bson:"service_module"      yaml:"service_module"   json:"service_module"`
@@ -693,6 +735,50 @@ type TestModule struct {
 	KeyVals          RuntimeKeyValList   `bson:"key_vals"            yaml:"key_vals"         json:"key_vals"`
 	Repos            []*types.Repository `bson:"repos"               yaml:"repos"            json:"repos"`
 	ShareStorageInfo *ShareStorageInfo   `bson:"share_storage_info"   yaml:"share_storage_info"   json:"share_storage_info"`
+	RetrySpec        *TestRetrySpec      `bson:"retry_spec"           yaml:"retry_spec"           json:"retry_spec"`
+	// RunPolicy is a boolean expression evaluated against the job variables, the test module is skipped when it is false
+	RunPolicy string `bson:"run_policy"           yaml:"run_policy"           json:"run_policy"`
+	// TimeoutOverride replaces the timeout of the testing template for a single run when it is non-zero, in minutes
+	TimeoutOverride int `bson:"timeout_override"     yaml:"timeout_override"     json:"timeout_override"`
+	// ImageIDOverride replaces the basic image of the testing template for a single run when it is set
+	ImageIDOverride string `bson:"image_id_override"    yaml:"image_id_override"    json:"image_id_override"`
+	// SkipDefaultClone omits the git clone step for tests that fetch their source in the script, repo variables are still provided
+	SkipDefaultClone bool `bson:"skip_default_clone"   yaml:"skip_default_clone"   json:"skip_default_clone"`
+	// WorkingDir is the clone path of one of the repos relative to the workspace, the script runs in it if set
+	WorkingDir string `bson:"working_dir"          yaml:"working_dir"          json:"working_dir"`
+	// SecretRefs are resolved from the secret stores when the task is created and passed to the test as credential variables
+	SecretRefs []*SecretRef `bson:"secret_refs"          yaml:"secret_refs"          json:"secret_refs"`
+	// CleanupScript runs after all the other steps of the test, no matter whether they fail
+	CleanupScript string `bson:"cleanup_script"       yaml:"cleanup_script"       json:"cleanup_script"`
+	// CollectPodLogsOnFailure archives the logs of all the containers in the job pod when the test fails, only on kubernetes
+	CollectPodLogsOnFailure bool `bson:"collect_pod_logs_on_failure" yaml:"collect_pod_logs_on_failure" json:"collect_pod_logs_on_failure"`
+	// PathFilters are globs of the repo paths the test covers, a webhook triggered test is skipped if none of the changed
+	// files match them, it always runs if there is no filter
+	PathFilters []string `bson:"path_filters"         yaml:"path_filters"         json:"path_filters"`
+	// Shards splits the test into the number of job tasks running in parallel, each told its shard by TEST_SHARD_INDEX
+	// and TEST_SHARD_TOTAL, the test is not split if it is less than 2
+	Shards int `bson:"shards"               yaml:"shards"               json:"shards"`
+	// WarmCacheOnly runs the clone, tool install and cache upload steps only, it fills the object cache of a new test
+	// without running its script, the job task is marked by the warm_cache_only job info
+	WarmCacheOnly bool `bson:"warm_cache_only"      yaml:"warm_cache_only"      json:"warm_cache_only"`
+	// EnvFileFromRepo is a dotenv file in one of the cloned repos loaded at the start of the test script, before changing
+	// into WorkingDir. A variable already defined, e.g. one of the KeyVals or the job variables, is not overridden by it
+	EnvFileFromRepo *TestingEnvFileFromRepo `bson:"env_file_from_repo"   yaml:"env_file_from_repo"   json:"env_file_from_repo"`
+}
+
+// SecretRef refers to a secret in an external secret store
+type SecretRef struct {
+	// StoreID is the id of the external system serving a vault compatible kv api
+	StoreID string `bson:"store_id" yaml:"store_id" json:"store_id"`
+	// Key is formatted as <path>#<field>, e.g. secret/data/app#password
+	Key     string `bson:"key"      yaml:"key"      json:"key"`
+	EnvName string `bson:"env_name" yaml:"env_name" json:"env_name"`
+}
+
+// TestRetrySpec re-runs a failed test task before marking it as failed, it overrides the job's error policy
+type TestRetrySpec struct {
+	MaxRetries           int `bson:"max_retries"            yaml:"max_retries"            json:"max_retries"`
+	RetryIntervalSeconds int `bson:"retry_interval_seconds" yaml:"retry_interval_seconds" json:"retry_interval_seconds"`
 }
 
 type ZadigScanningJobSpec struct {
@@ -1487,6 +1573,7 @@ type JobProperties struct {
 	CacheEnable         bool                   `bson:"cache_enable"           json:"cache_enable"          yaml:"cache_enable"`
 	CacheDirType        types.CacheDirType     `bson:"cache_dir_type"         json:"cache_dir_type"        yaml:"cache_dir_type"`
 	CacheUserDir        string                 `bson:"cache_user_dir"         json:"cache_user_dir"        yaml:"cache_user_dir"`
+	CacheCompression    types.CacheCompression `bson:"cache_compression"      json:"cache_compression"     yaml:"cache_compression"`
 	ShareStorageDetails []*StorageDetail       `bson:"share_storage_details"  json:"share_storage_details" yaml:"-"`
 	EnablePrivileged    bool                   `bson:"enable_privileged,omitempty" json:"enable_privileged,omitempty" yaml:"enable_privileged,omitempty"`
 	UseHostDockerDaemon bool                   `bson:"use_host_docker_daemon,omitempty" json:"use_host_docker_daemon,omitempty" yaml:"use_host_docker_daemon"`
@@ -1496,6 +1583,21 @@ type JobProperties struct {
 
 	CustomAnnotations []*util.KeyValue `bson:"custom_annotations" json:"custom_annotations" yaml:"custom_annotations"`
 	CustomLabels      []*util.KeyValue `bson:"custom_labels"      json:"custom_labels"      yaml:"custom_labels"`
+	Sidecars          []*SidecarSpec   `bson:"sidecars"           json:"sidecars"           yaml:"sidecars"`
+	// TerminationGracePeriodSeconds is how long the job pod is given to clean up after it is told to stop, 0 keeps the cluster default
+	TerminationGracePeriodSeconds int64 `bson:"termination_grace_period_seconds" json:"termination_grace_period_seconds" yaml:"termination_grace_period_seconds"`
+	// HostAliases are rendered as the hostAliases of the job pod, they are only supported on kubernetes
+	HostAliases []*HostAlias `bson:"host_aliases" json:"host_aliases" yaml:"host_aliases"`
+	// CollectPodLogsOnFailure makes the job controller archive the logs of all the containers in the job pod if the job fails
+	CollectPodLogsOnFailure bool `bson:"collect_pod_logs_on_failure" json:"collect_pod_logs_on_failure" yaml:"collect_pod_logs_on_failure"`
+	// NodeStrategy schedules the job pod to its preferred nodes, it is only supported on kubernetes
+	NodeStrategy *NodeStrategy `bson:"node_strategy,omitempty" json:"node_strategy,omitempty" yaml:"node_strategy,omitempty"`
+	// ResLimitSpec replaces the limits derived from the resource request on kubernetes, the requests are kept
+	ResLimitSpec *setting.ResourceLimitSpec `bson:"res_limit_spec,omitempty" json:"res_limit_spec,omitempty" yaml:"res_limit_spec,omitempty"`
+	// ExtraImagePullSecrets are the names of the secrets in the job namespace attached to the job pod besides the ones of the registries
+	ExtraImagePullSecrets []string `bson:"extra_image_pull_secrets,omitempty" json:"extra_image_pull_secrets,omitempty" yaml:"extra_image_pull_secrets,omitempty"`
+	// LogMaskPatterns are the regexes of the substrings masked in the script output besides the values of the credential envs
+	LogMaskPatterns []string `bson:"log_mask_patterns,omitempty" json:"log_mask_patterns,omitempty" yaml:"log_mask_patterns,omitempty"`
 
 	// TODO: ???
 	Paths string `bson:"-" json:"-" yaml:"-"`
@@ -1503,6 +1605,42 @@ type JobProperties struct {
 	ShareStorageInfo *ShareStorageInfo `bson:"share_storage_info"     json:"share_storage_info"    yaml:"share_storage_info"`
 }
 
+// SidecarSpec describes a container running alongside the job container, it shares the pod network with the job
+type SidecarSpec struct {
+	Name    string     `bson:"name"    json:"name"    yaml:"name"`
+	Image   string     `bson:"image"   json:"image"   yaml:"image"`
+	Command []string   `bson:"command" json:"command" yaml:"command"`
+	Envs    KeyValList `bson:"envs"    json:"envs"    yaml:"envs"`
+	Ports   []int32    `bson:"ports"   json:"ports"   yaml:"ports"`
+}
+
+// HostAlias is an entry of the hosts file, resolving the hostnames to the ip
+type HostAlias struct {
+	IP        string   `bson:"ip"        json:"ip"        yaml:"ip"`
+	Hostnames []string `bson:"hostnames" json:"hostnames" yaml:"hostnames"`
+}
+
+// NodeStrategy makes the job pod prefer the Preferred nodes, e.g. a pool of cheap preemptible nodes,
+// once the pod is evicted the retries of the job are scheduled to the Fallback nodes instead
+type NodeStrategy struct {
+	Preferred *NodePool `bson:"preferred" json:"preferred" yaml:"preferred"`
+	Fallback  *NodePool `bson:"fallback"  json:"fallback"  yaml:"fallback"`
+}
+
+// NodePool selects the nodes with all the labels in NodeSelector, Tolerations let the pod run on the tainted nodes of the pool
+type NodePool struct {
+	NodeSelector map[string]string `bson:"node_selector" json:"node_selector" yaml:"node_selector"`
+	Tolerations  []*NodeToleration `bson:"tolerations"   json:"tolerations"   yaml:"tolerations"`
+}
+
+// NodeToleration is rendered as a toleration of the pod, Operator is Equal or Exists
+type NodeToleration struct {
+	Key      string `bson:"key"      json:"key"      yaml:"key"`
+	Operator string `bson:"operator" json:"operator" yaml:"operator"`
+	Value    string `bson:"value"    json:"value"    yaml:"value"`
+	Effect   string `bson:"effect"   json:"effect"   yaml:"effect"`
+}
+
 func (j *JobProperties) DeepCopyEnvs() []*KeyVal {
 	envs := make([]*KeyVal, 0)
 
@@ -1534,6 +1672,8 @@ type Step struct {
 type Output struct {
 	Name        string `bson:"name"           json:"name"             yaml:"name"`
 	Description string `bson:"description"    json:"description"      yaml:"description"`
+	// System is set for the outputs written by zadig itself instead of the user's scripts, e.g. the commits of the repos
+	System bool `bson:"system,omitempty" json:"system,omitempty" yaml:"system,omitempty"`
 }
 
 type WorkflowV4Hook struct {
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -76,6 +77,16 @@ func (c *EnvVersionColl) EnsureIndex(ctx context.Context) error {
 			},
 			Options: options.Index().SetUnique(true).SetName("idx_service_revision_1"),
 		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "product_name", Value: 1},
+				bson.E{Key: "env_name", Value: 1},
+				bson.E{Key: "production", Value: 1},
+				bson.E{Key: "idempotency_key", Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetName("idx_idempotency_key").
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
 	}
 
 	_, _ = c.Indexes().DropOne(ctx, "idx_service")
@@ -105,6 +116,58 @@ func (c *EnvVersionColl) Find(productName, envName, serviceName string, isHelmCh
 	return res, err
 }
 
+// FindByIdempotencyKey finds the version of the env recorded with the idempotency key in the session, keys of the
+// versions already deleted are forgotten
+func (c *EnvVersionColl) FindByIdempotencyKey(productName, envName string, production bool, idempotencyKey string) (*models.EnvServiceVersion, error) {
+	res := &models.EnvServiceVersion{}
+	query := bson.M{
+		"product_name":    productName,
+		"env_name":        envName,
+		"production":      production,
+		"idempotency_key": idempotencyKey,
+	}
+
+	err := c.FindOne(mongotool.SessionContext(context.TODO(), c.Session), query).Decode(res)
+	return res, err
+}
+
+func (c *EnvVersionColl) GetByID(id string) (*models.EnvServiceVersion, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &models.EnvServiceVersion{}
+	err = c.FindOne(context.TODO(), bson.M{"_id": oid}).Decode(res)
+	return res, err
+}
+
+// ListEnvVersionsBefore lists the versions of all the services in env created no later than createTime, sorted by create time
+func (c *EnvVersionColl) ListEnvVersionsBefore(productName, envName string, production bool, createTime int64) ([]*models.EnvServiceVersion, error) {
+	var ret []*models.EnvServiceVersion
+	query := bson.M{
+		"product_name": productName,
+		"env_name":     envName,
+		"production":   production,
+		"create_time":  bson.M{"$lte": createTime},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "create_time", Value: 1}, {Key: "revision", Value: 1}})
+
+	ctx := context.Background()
+	cursor, err := c.Collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
 func (c *EnvVersionColl) GetLatestRevision(productName, envName, serviceName string, isHelmChart, production bool) (int64, error) {
 	match := bson.M{
 		"product_name":         productName,
@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/v2/pkg/tool/mongo"
+)
+
+type HelmEnvAuditEventColl struct {
+	*mongo.Collection
+	mongo.Session
+
+	coll string
+}
+
+func NewHelmEnvAuditEventColl() *HelmEnvAuditEventColl {
+	name := models.HelmEnvAuditEvent{}.TableName()
+	return &HelmEnvAuditEventColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func NewHelmEnvAuditEventCollWithSession(session mongo.Session) *HelmEnvAuditEventColl {
+	name := models.HelmEnvAuditEvent{}.TableName()
+	return &HelmEnvAuditEventColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		Session:    session,
+		coll:       name,
+	}
+}
+
+func (c *HelmEnvAuditEventColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *HelmEnvAuditEventColl) EnsureIndex(ctx context.Context) error {
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "project_name", Value: 1},
+			bson.E{Key: "env_name", Value: 1},
+			bson.E{Key: "create_time", Value: -1},
+		},
+		Options: options.Index().SetUnique(false).SetName("idx_project_env_time"),
+	}
+
+	_, err := c.Indexes().CreateOne(ctx, mod)
+	return err
+}
+
+func (c *HelmEnvAuditEventColl) Create(args *models.HelmEnvAuditEvent) error {
+	if args == nil {
+		return errors.New("nil helm env audit event")
+	}
+
+	args.CreateTime = time.Now().Unix()
+	_, err := c.InsertOne(mongotool.SessionContext(context.TODO(), c.Session), args)
+	return err
+}
@@ -103,14 +103,17 @@ func (c *HelmRepoColl) Update(id string, args *models.HelmRepo) error {
 
 	query := bson.M{"_id": oid}
 	change := bson.M{"$set": bson.M{
-		"repo_name":    args.RepoName,
-		"url":          args.URL,
-		"username":     args.Username,
-		"password":     args.Password,
-		"projects":     args.Projects,
-		"enable_proxy": args.EnableProxy,
-		"update_by":    args.UpdateBy,
-		"updated_at":   time.Now().Unix(),
+		"repo_name":         args.RepoName,
+		"url":               args.URL,
+		"repo_type":         args.RepoType,
+		"username":          args.Username,
+		"password":          args.Password,
+		"credential_source": args.CredentialSource,
+		"secret_ref":        args.SecretRef,
+		"projects":          args.Projects,
+		"enable_proxy":      args.EnableProxy,
+		"update_by":         args.UpdateBy,
+		"updated_at":        time.Now().Unix(),
 	}}
 
 	_, err = c.UpdateOne(context.TODO(), query, change, options.Update().SetUpsert(true))
@@ -149,7 +152,8 @@ func (c *HelmRepoColl) List() ([]*models.HelmRepo, error) {
 	return resp, nil
 }
 
-func (c *HelmRepoColl) ListByProject(projectName string) ([]*models.HelmRepo, error) {
+// ListByProject returns the helm repos of the project from offset and the total count, all repos are returned if limit is 0
+func (c *HelmRepoColl) ListByProject(projectName string, offset, limit int64) ([]*models.HelmRepo, int64, error) {
 	resp := make([]*models.HelmRepo, 0)
 	query := bson.M{
 		"projects": bson.M{
@@ -160,15 +164,24 @@ func (c *HelmRepoColl) ListByProject(projectName string) ([]*models.HelmRepo, er
 	}
 
 	ctx := context.Background()
-	cursor, err := c.Collection.Find(ctx, query)
+	count, err := c.Collection.CountDocuments(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	opt := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if limit > 0 {
+		opt.SetSkip(offset).SetLimit(limit)
+	}
+	cursor, err := c.Collection.Find(ctx, query, opt)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	err = cursor.All(ctx, &resp)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return resp, nil
+	return resp, count, nil
 }
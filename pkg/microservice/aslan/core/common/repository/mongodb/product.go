@@ -741,6 +741,29 @@ func (c *ProductColl) ListEnvByNamespace(clusterID, namespace string) ([]*models
 	return resp, nil
 }
 
+// ListEnvsByChartRepo lists the envs with a chart release installed from the helm repo, only the names of the env and
+// the chart repos of the services are returned. The services are nested arrays which a multikey index does not cover,
+// so the query matches them with $elemMatch and the projection keeps the documents small.
+func (c *ProductColl) ListEnvsByChartRepo(repoName string) ([]*models.Product, error) {
+	resp := make([]*models.Product, 0)
+	query := bson.M{"services": bson.M{"$elemMatch": bson.M{"$elemMatch": bson.M{"render.chart_repo": repoName}}}}
+	opt := options.Find().SetProjection(bson.M{
+		"product_name":               1,
+		"env_name":                   1,
+		"production":                 1,
+		"services.render.chart_repo": 1,
+	})
+	cursor, err := c.Collection.Find(context.TODO(), query, opt)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(context.TODO(), &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (c *ProductColl) UpdateConfigs(envName, productName string, analysisConfig *models.AnalysisConfig, notificationConfigs []*models.NotificationConfig) error {
 	query := bson.M{"env_name": envName, "product_name": productName}
 
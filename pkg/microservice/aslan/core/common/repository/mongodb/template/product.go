@@ -562,6 +562,17 @@ func (c *ProductColl) UpdateGlobalVars(productName string, serviceVars []*types.
 	return err
 }
 
+func (c *ProductColl) UpdateBaseValues(productName, baseValues, updateBy string) error {
+	query := bson.M{"product_name": productName}
+	change := bson.M{"$set": bson.M{
+		"base_values": baseValues,
+		"update_time": time.Now().Unix(),
+		"update_by":   updateBy,
+	}}
+	_, err := c.UpdateOne(context.TODO(), query, change)
+	return err
+}
+
 func (c *ProductColl) Delete(productName string) error {
 	query := bson.M{"product_name": productName}
 
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/v2/pkg/tool/mongo"
+)
+
+type TestTrendColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewTestTrendColl() *TestTrendColl {
+	name := models.TestTrend{}.TableName()
+	return &TestTrendColl{Collection: mongotool.Database(config.MongoDatabase()).Collection(name), coll: name}
+}
+
+func (c *TestTrendColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *TestTrendColl) EnsureIndex(ctx context.Context) error {
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "workflow_name", Value: 1},
+			bson.E{Key: "job_name", Value: 1},
+			bson.E{Key: "service_name", Value: 1},
+			bson.E{Key: "service_module", Value: 1},
+			bson.E{Key: "zadig_test_name", Value: 1},
+		},
+		Options: options.Index().SetUnique(true).SetName("trend_index"),
+	}
+
+	_, err := c.Indexes().CreateOne(ctx, mod)
+	return err
+}
+
+// AppendRun upserts the trend of the test and appends the run to it, only the latest maxRuns runs are kept.
+// The baseline of the trend is replaced by the run if it is a baseline run and is never changed otherwise.
+func (c *TestTrendColl) AppendRun(workflowName, jobName, testName, serviceName, serviceModule string, run *models.TestTrendRun, maxRuns int) error {
+	if run == nil {
+		return errors.New("nil test trend run")
+	}
+
+	query := testTrendQuery(workflowName, jobName, testName, serviceName, serviceModule)
+	_, err := c.UpdateOne(context.TODO(), query, testTrendRunChange(run, maxRuns, time.Now().Unix()), options.Update().SetUpsert(true))
+	return err
+}
+
+// Find returns the trend of the test, mongo.ErrNoDocuments is returned if no run of the test is recorded
+func (c *TestTrendColl) Find(workflowName, jobName, testName, serviceName, serviceModule string) (*models.TestTrend, error) {
+	resp := new(models.TestTrend)
+	query := testTrendQuery(workflowName, jobName, testName, serviceName, serviceModule)
+	if err := c.FindOne(context.TODO(), query).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func testTrendQuery(workflowName, jobName, testName, serviceName, serviceModule string) bson.M {
+	return bson.M{
+		"workflow_name":   workflowName,
+		"job_name":        jobName,
+		"zadig_test_name": testName,
+		"service_name":    serviceName,
+		"service_module":  serviceModule,
+	}
+}
+
+func testTrendRunChange(run *models.TestTrendRun, maxRuns int, updateTime int64) bson.M {
+	set := bson.M{"update_time": updateTime}
+	if run.Baseline {
+		set["baseline"] = run
+	}
+	return bson.M{
+		"$set": set,
+		"$push": bson.M{"runs": bson.M{
+			"$each":  []*models.TestTrendRun{run},
+			"$slice": -maxRuns,
+		}},
+	}
+}
+
+// List returns the trends of the tests in the workflow job, filtered by the service if it is not empty
+func (c *TestTrendColl) List(workflowName, jobName, serviceName string) ([]*models.TestTrend, error) {
+	query := bson.M{
+		"workflow_name": workflowName,
+		"job_name":      jobName,
+	}
+	if serviceName != "" {
+		query["service_name"] = serviceName
+	}
+
+	resp := make([]*models.TestTrend, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "zadig_test_name", Value: 1}, {Key: "service_name", Value: 1}, {Key: "service_module", Value: 1}})
+	cursor, err := c.Collection.Find(context.TODO(), query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(context.TODO(), &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+)
+
+func TestTestTrendRunChange(t *testing.T) {
+	tests := []struct {
+		name         string
+		run          *models.TestTrendRun
+		wantBaseline bool
+	}{
+		{
+			name: "run does not change the baseline",
+			run:  &models.TestTrendRun{TaskID: 2},
+		},
+		{
+			name:         "baseline run replaces the baseline",
+			run:          &models.TestTrendRun{TaskID: 3, Baseline: true},
+			wantBaseline: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := testTrendRunChange(tt.run, 50, 100)
+			set := change["$set"].(bson.M)
+			if set["update_time"] != int64(100) {
+				t.Errorf("update_time = %v, want 100", set["update_time"])
+			}
+			baseline, ok := set["baseline"]
+			if ok != tt.wantBaseline {
+				t.Fatalf("baseline is set: %v, want %v", ok, tt.wantBaseline)
+			}
+			if ok && baseline != tt.run {
+				t.Errorf("baseline = %v, want the run", baseline)
+			}
+			runs := change["$push"].(bson.M)["runs"].(bson.M)
+			if each := runs["$each"].([]*models.TestTrendRun); len(each) != 1 || each[0] != tt.run {
+				t.Errorf("pushed runs = %v, want the run", each)
+			}
+			if runs["$slice"] != -50 {
+				t.Errorf("$slice = %v, want -50", runs["$slice"])
+			}
+		})
+	}
+}
@@ -137,6 +137,28 @@ func (c *TestingColl) Find(name, productName string) (*models.Testing, error) {
 	return resp, err
 }
 
+// FindMany finds the testings of the names in one query, the result is keyed by the testing name and the names
+// which are not found are not in it
+func (c *TestingColl) FindMany(names []string) (map[string]*models.Testing, error) {
+	resp := make(map[string]*models.Testing)
+	if len(names) == 0 {
+		return resp, nil
+	}
+
+	testings := make([]*models.Testing, 0)
+	cursor, err := c.Collection.Find(context.TODO(), bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(context.TODO(), &testings); err != nil {
+		return nil, err
+	}
+	for _, testing := range testings {
+		resp[testing.Name] = testing
+	}
+	return resp, nil
+}
+
 func (c *TestingColl) Delete(name, productName string) error {
 	query := bson.M{}
 	if name != "" {
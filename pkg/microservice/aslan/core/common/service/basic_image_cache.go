@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/v2/pkg/tool/metrics"
+)
+
+// basicImageCache keeps the basic images found by id in memory, it is shared by all the callers in this process
+// and it is invalidated when a basic image is updated or deleted in this process.
+type basicImageCache struct {
+	mu     sync.Mutex
+	images map[string]*cachedBasicImage
+}
+
+type cachedBasicImage struct {
+	image    *commonmodels.BasicImage
+	expireAt time.Time
+}
+
+var defaultBasicImageCache = &basicImageCache{}
+
+// find returns a copy of the cached basic image, the lookups of the same image by concurrent callers are made once
+func (c *basicImageCache) find(id string, ttl time.Duration, findFunc func(id string) (*commonmodels.BasicImage, error)) (*commonmodels.BasicImage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.images[id]; ok && time.Now().Before(cached.expireAt) {
+		metrics.RegisterBasicImageCacheRequest(true)
+		image := *cached.image
+		return &image, nil
+	}
+	metrics.RegisterBasicImageCacheRequest(false)
+
+	basicImage, err := findFunc(id)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		if c.images == nil {
+			c.images = make(map[string]*cachedBasicImage)
+		}
+		c.images[id] = &cachedBasicImage{image: basicImage, expireAt: time.Now().Add(ttl)}
+	}
+	image := *basicImage
+	return &image, nil
+}
+
+func (c *basicImageCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.images, id)
+}
+
+// FindBasicImage finds the basic image by id, the image is cached for BASIC_IMAGE_CACHE_TTL_SECONDS so that generating
+// the job tasks of a large workflow does not look up the same image for every job task
+func FindBasicImage(id string) (*commonmodels.BasicImage, error) {
+	return defaultBasicImageCache.find(id, config.BasicImageCacheTTL(), commonrepo.NewBasicImageColl().Find)
+}
+
+// InvalidateBasicImageCache should be called after the basic image is updated or deleted
+func InvalidateBasicImageCache(id string) {
+	defaultBasicImageCache.invalidate(id)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+)
+
+type countingBasicImageFinder struct {
+	finds atomic.Int64
+}
+
+func (f *countingBasicImageFinder) find(id string) (*models.BasicImage, error) {
+	f.finds.Add(1)
+	if id == "missing" {
+		return nil, fmt.Errorf("basic image %s not found", id)
+	}
+	return &models.BasicImage{Value: id}, nil
+}
+
+func TestBasicImageCache(t *testing.T) {
+	finder := &countingBasicImageFinder{}
+	cache := &basicImageCache{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			image, err := cache.find("bionic", time.Minute, finder.find)
+			if err != nil || image.Value != "bionic" {
+				t.Errorf("find() = %v, %v", image, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if finds := finder.finds.Load(); finds != 1 {
+		t.Fatalf("concurrent lookups of the same image made %d finds, want 1", finds)
+	}
+
+	image, _ := cache.find("bionic", time.Minute, finder.find)
+	image.Value = "modified"
+	if image, _ = cache.find("bionic", time.Minute, finder.find); image.Value != "bionic" {
+		t.Errorf("cached image is modified by the caller: %s", image.Value)
+	}
+
+	cache.invalidate("bionic")
+	cache.find("bionic", time.Minute, finder.find)
+	if finds := finder.finds.Load(); finds != 2 {
+		t.Errorf("lookup after invalidation made %d finds in total, want 2", finds)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.find("missing", time.Minute, finder.find); err == nil {
+			t.Errorf("find() of a missing image should fail")
+		}
+		cache.find("focal", 0, finder.find)
+	}
+	if finds := finder.finds.Load(); finds != 6 {
+		t.Errorf("errors and lookups without ttl should not be cached, %d finds in total, want 6", finds)
+	}
+}
+
+// BenchmarkBasicImageCache generates the job tasks of a job with 40 test modules using the same basic image, finds/op
+// is the number of mongo lookups made for each job
+func BenchmarkBasicImageCache(b *testing.B) {
+	const modules = 40
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		b.Run(fmt.Sprintf("ttl=%s", ttl), func(b *testing.B) {
+			finder := &countingBasicImageFinder{}
+			cache := &basicImageCache{}
+			for i := 0; i < b.N; i++ {
+				// every job is generated after the image is updated, so each of them starts with a cache miss
+				cache.invalidate("bionic")
+				for j := 0; j < modules; j++ {
+					if _, err := cache.find("bionic", ttl, finder.find); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(finder.finds.Load())/float64(b.N), "finds/op")
+		})
+	}
+}
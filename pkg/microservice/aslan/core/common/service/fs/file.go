@@ -66,28 +66,36 @@ func PreloadFiles(name, localBase, s3Base, source string, logger *zap.SugaredLog
 
 // SaveAndUploadFiles saves a tree of files to local disk, at the same time, archives them and uploads to object storage.
 func SaveAndUploadFiles(fileTree fs.FS, names []string, localBase, s3Base string, logger *zap.SugaredLogger) error {
+	return SaveAndUploadFilesWithConcurrency(fileTree, names, localBase, s3Base, 1, logger)
+}
+
+// SaveAndUploadFilesWithConcurrency is the same as SaveAndUploadFiles, but the copies of names in object storage are
+// handled by at most concurrency workers. The files are saved to localBase only once, so there are no concurrent writes to the disk.
+// The copies are server side copies bounded by round trips, e.g. 50 copies take 10 rounds of requests instead of 50 with concurrency 5.
+func SaveAndUploadFilesWithConcurrency(fileTree fs.FS, names []string, localBase, s3Base string, concurrency int, logger *zap.SugaredLogger) error {
 	var wg wait.Group
-	var err error
+	var err1, err2 error
 
 	wg.Start(func() {
-		err1 := saveInMemoryFilesToDisk(fileTree, localBase, logger)
+		err1 = saveInMemoryFilesToDisk(fileTree, localBase, logger)
 		if err1 != nil {
 			logger.Errorf("Failed to save files to disk, err: %s", err1)
-			err = err1
 		}
 	})
 
 	wg.Start(func() {
-		err2 := ArchiveAndUploadFilesToS3(fileTree, names, s3Base, logger)
+		err2 = ArchiveAndUploadFilesToS3WithConcurrency(fileTree, names, s3Base, concurrency, logger)
 		if err2 != nil {
 			logger.Errorf("Failed to upload files to s3, err: %s", err2)
-			err = err2
 		}
 	})
 
 	wg.Wait()
 
-	return err
+	if err2 != nil {
+		return err2
+	}
+	return err1
 }
 
 // CopyAndUploadFiles copy a tree of files to other dir, at the same time, archives them and uploads to object storage.
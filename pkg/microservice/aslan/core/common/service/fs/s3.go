@@ -22,7 +22,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/otiai10/copy"
 	"go.uber.org/zap"
 
@@ -41,7 +43,7 @@ func ArchiveAndUploadFilesToSpecifiedS3(fileTree fs.FS, names []string, s3Base,
 		logger.Errorf("Failed to find default s3, err:%v", err)
 		return err
 	}
-	return archiveAndUploadFiles(fileTree, names, s3Base, s3Storage, logger)
+	return archiveAndUploadFiles(fileTree, names, s3Base, s3Storage, 1, logger)
 }
 
 func ArchiveAndUploadFilesToS3(fileTree fs.FS, names []string, s3Base string, logger *zap.SugaredLogger) error {
@@ -50,12 +52,23 @@ func ArchiveAndUploadFilesToS3(fileTree fs.FS, names []string, s3Base string, lo
 		logger.Errorf("Failed to find default s3, err:%v", err)
 		return err
 	}
-	return archiveAndUploadFiles(fileTree, names, s3Base, s3Storage, logger)
+	return archiveAndUploadFiles(fileTree, names, s3Base, s3Storage, 1, logger)
+}
+
+// ArchiveAndUploadFilesToS3WithConcurrency is the same as ArchiveAndUploadFilesToS3, but the extra names are copied by
+// at most concurrency workers, a failed copy doesn't stop the others and all the errors are returned together.
+func ArchiveAndUploadFilesToS3WithConcurrency(fileTree fs.FS, names []string, s3Base string, concurrency int, logger *zap.SugaredLogger) error {
+	s3Storage, err := s3service.FindDefaultS3()
+	if err != nil {
+		logger.Errorf("Failed to find default s3, err:%v", err)
+		return err
+	}
+	return archiveAndUploadFiles(fileTree, names, s3Base, s3Storage, concurrency, logger)
 }
 
 // archiveAndUploadFiles archive local files and upload to default s3 storage
 // if multiple names appointed, s3storage.copy will be used to handle extra names
-func archiveAndUploadFiles(fileTree fs.FS, names []string, s3Base string, s3Storage *s3service.S3, logger *zap.SugaredLogger) error {
+func archiveAndUploadFiles(fileTree fs.FS, names []string, s3Base string, s3Storage *s3service.S3, concurrency int, logger *zap.SugaredLogger) error {
 	if len(names) == 0 {
 		return fmt.Errorf("names not appointed")
 	}
@@ -89,16 +102,48 @@ func archiveAndUploadFiles(fileTree fs.FS, names []string, s3Base string, s3Stor
 	}
 
 	// copy file to avoid duplicated file transfer
+	targetPaths := make([]string, 0, len(copies))
 	for _, copyName := range copies {
-		targetPath := filepath.Join(s3Storage.Subfolder, s3Base, fmt.Sprintf("%s.tar.gz", copyName))
-		err = client.CopyObject(s3Storage.Bucket, s3Path, targetPath)
-		if err != nil {
-			logger.Errorf("Failed to copy object from %s to %s", s3Path, targetPath)
-			return err
-		}
+		targetPaths = append(targetPaths, filepath.Join(s3Storage.Subfolder, s3Base, fmt.Sprintf("%s.tar.gz", copyName)))
 	}
+	return copyObjects(client, s3Storage.Bucket, s3Path, targetPaths, concurrency, logger)
+}
 
-	return nil
+type objectCopier interface {
+	CopyObject(bucketName, oldKey, newKey string) error
+}
+
+// copyObjects copies the object at srcPath to each of targetPaths with at most concurrency workers,
+// a failed copy doesn't stop the others and all the errors are returned together
+func copyObjects(client objectCopier, bucket, srcPath string, targetPaths []string, concurrency int, logger *zap.SugaredLogger) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		copyErrs *multierror.Error
+	)
+	semaphore := make(chan struct{}, concurrency)
+	for _, targetPath := range targetPaths {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(targetPath string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := client.CopyObject(bucket, srcPath, targetPath); err != nil {
+				logger.Errorf("Failed to copy object from %s to %s", srcPath, targetPath)
+				mu.Lock()
+				copyErrs = multierror.Append(copyErrs, fmt.Errorf("failed to copy object to %s: %s", targetPath, err))
+				mu.Unlock()
+			}
+		}(targetPath)
+	}
+	wg.Wait()
+
+	return copyErrs.ErrorOrNil()
 }
 
 func DownloadAndExtractFilesFromS3(name, localBase, s3Base string, logger *zap.SugaredLogger) error {
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type fakeCopier struct {
+	latency time.Duration
+	failed  map[string]bool
+
+	mu     sync.Mutex
+	copied []string
+}
+
+func (c *fakeCopier) CopyObject(bucketName, oldKey, newKey string) error {
+	time.Sleep(c.latency)
+	c.mu.Lock()
+	c.copied = append(c.copied, newKey)
+	c.mu.Unlock()
+	if c.failed[newKey] {
+		return fmt.Errorf("copy %s denied", newKey)
+	}
+	return nil
+}
+
+func targetPathsForTest(n int) []string {
+	targetPaths := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		targetPaths = append(targetPaths, fmt.Sprintf("charts/svc-%d.tar.gz", i))
+	}
+	return targetPaths
+}
+
+func TestCopyObjects(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	targetPaths := targetPathsForTest(10)
+
+	tests := []struct {
+		name        string
+		concurrency int
+		failed      map[string]bool
+		wantErrs    []string
+	}{
+		{
+			name:        "all copies succeed",
+			concurrency: 5,
+		},
+		{
+			name:        "one failed copy doesn't stop the others",
+			concurrency: 5,
+			failed:      map[string]bool{"charts/svc-3.tar.gz": true},
+			wantErrs:    []string{"charts/svc-3.tar.gz"},
+		},
+		{
+			name:        "errors of failed copies are aggregated",
+			concurrency: 3,
+			failed:      map[string]bool{"charts/svc-0.tar.gz": true, "charts/svc-9.tar.gz": true},
+			wantErrs:    []string{"charts/svc-0.tar.gz", "charts/svc-9.tar.gz"},
+		},
+		{
+			name:        "non-positive concurrency falls back to serial copies",
+			concurrency: 0,
+			failed:      map[string]bool{"charts/svc-5.tar.gz": true},
+			wantErrs:    []string{"charts/svc-5.tar.gz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeCopier{failed: tt.failed}
+			err := copyObjects(client, "bucket", "charts/svc.tar.gz", targetPaths, tt.concurrency, logger)
+
+			if len(client.copied) != len(targetPaths) {
+				t.Errorf("copied %d objects, want %d", len(client.copied), len(targetPaths))
+			}
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("copyObjects() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("copyObjects() error = nil, want errors for %v", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), "failed to copy object to "+want) {
+					t.Errorf("copyObjects() error = %v, want it to contain the failure of %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCopyObjects(b *testing.B) {
+	logger := zap.NewNop().Sugar()
+	targetPaths := targetPathsForTest(50)
+
+	for _, concurrency := range []int{1, 5} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			client := &fakeCopier{latency: time.Millisecond}
+			for i := 0; i < b.N; i++ {
+				if err := copyObjects(client, "bucket", "charts/svc.tar.gz", targetPaths, concurrency, logger); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/webhooknotify"
+	"github.com/koderover/zadig/v2/pkg/tool/httpclient"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
+)
+
+// HelmEnvUpdateHook is called with the audit event of an update of helm environment after the update is committed
+type HelmEnvUpdateHook func(event *commonmodels.HelmEnvAuditEvent)
+
+const (
+	helmEnvUpdateQueueSize = 1000
+	// helmEnvUpdateWebhookMaxElapsed is how long a notification is retried on transient failures before it is dropped
+	helmEnvUpdateWebhookMaxElapsed = 5 * time.Minute
+)
+
+var (
+	helmEnvUpdateHooksMu sync.RWMutex
+	helmEnvUpdateHooks   []HelmEnvUpdateHook
+
+	helmEnvUpdateQueue     = make(chan *commonmodels.HelmEnvAuditEvent, helmEnvUpdateQueueSize)
+	helmEnvUpdateQueueOnce sync.Once
+)
+
+// RegisterHelmEnvUpdateHook registers a hook called after the updates of helm environments are committed, the hooks are
+// called one by one in a background goroutine. The endpoints in HELM_ENV_UPDATE_WEBHOOKS are notified without registration.
+func RegisterHelmEnvUpdateHook(hook HelmEnvUpdateHook) {
+	helmEnvUpdateHooksMu.Lock()
+	defer helmEnvUpdateHooksMu.Unlock()
+
+	helmEnvUpdateHooks = append(helmEnvUpdateHooks, hook)
+}
+
+// notifyHelmEnvUpdated queues the event for the hooks without blocking, the event is dropped if the queue is full.
+// It must only be called after the update is committed, and failures of the hooks never affect the update.
+func notifyHelmEnvUpdated(event *commonmodels.HelmEnvAuditEvent) {
+	helmEnvUpdateQueueOnce.Do(func() {
+		go runHelmEnvUpdateHooks()
+	})
+
+	select {
+	case helmEnvUpdateQueue <- event:
+	default:
+		log.Warnf("the queue of helm environment update hooks is full, drop the event of %s/%s", event.ProjectName, event.EnvName)
+	}
+}
+
+func runHelmEnvUpdateHooks() {
+	for event := range helmEnvUpdateQueue {
+		helmEnvUpdateHooksMu.RLock()
+		hooks := append([]HelmEnvUpdateHook{notifyHelmEnvUpdateWebhooks}, helmEnvUpdateHooks...)
+		helmEnvUpdateHooksMu.RUnlock()
+
+		for _, hook := range hooks {
+			callHelmEnvUpdateHook(hook, event)
+		}
+	}
+}
+
+func callHelmEnvUpdateHook(hook HelmEnvUpdateHook, event *commonmodels.HelmEnvAuditEvent) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("helm environment update hook of %s/%s panics: %v", event.ProjectName, event.EnvName, err)
+		}
+	}()
+	hook(event)
+}
+
+func notifyHelmEnvUpdateWebhooks(event *commonmodels.HelmEnvAuditEvent) {
+	body := newHelmEnvUpdateHookBody(event)
+	for _, webhook := range config.HelmEnvUpdateWebhooks() {
+		bo := backoff.NewExponentialBackOff()
+		bo.MaxElapsedTime = helmEnvUpdateWebhookMaxElapsed
+		if err := sendHelmEnvUpdateWebhook(webhook, config.HelmEnvUpdateWebhookToken(), body, bo); err != nil {
+			log.Errorf("failed to notify %s of the update of helm environment %s/%s, err: %s", webhook, event.ProjectName, event.EnvName, err)
+		}
+	}
+}
+
+// sendHelmEnvUpdateWebhook posts the body to the webhook, network errors, 429 and 5xx responses are retried with bo
+func sendHelmEnvUpdateWebhook(webhook, token string, body *webhooknotify.HelmEnvUpdateHookBody, bo backoff.BackOff) error {
+	client := webhooknotify.NewClient(webhook, token)
+	return backoff.Retry(func() error {
+		err := client.SendHelmEnvUpdateWebhook(body)
+		httpErr := &httpclient.Error{}
+		if err != nil && errors.As(err, &httpErr) && httpErr.Code != http.StatusTooManyRequests && httpErr.Code < http.StatusInternalServerError {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, bo)
+}
+
+func newHelmEnvUpdateHookBody(event *commonmodels.HelmEnvAuditEvent) *webhooknotify.HelmEnvUpdateHookBody {
+	body := &webhooknotify.HelmEnvUpdateHookBody{
+		ProjectName: event.ProjectName,
+		EnvName:     event.EnvName,
+		Production:  event.Production,
+		Operation:   event.Operation,
+		User:        event.User,
+		Services:    make([]*webhooknotify.HelmEnvUpdateHookService, 0, len(event.Services)),
+		UpdateTime:  event.CreateTime,
+	}
+	for _, svc := range event.Services {
+		body.Services = append(body.Services, &webhooknotify.HelmEnvUpdateHookService{
+			ServiceName:        svc.ServiceName,
+			ReleaseName:        svc.ReleaseName,
+			PrevDeployStrategy: svc.PrevDeployStrategy,
+			DeployStrategy:     svc.DeployStrategy,
+		})
+	}
+	return body
+}
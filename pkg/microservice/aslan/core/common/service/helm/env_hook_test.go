@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/webhooknotify"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
+)
+
+func TestSendHelmEnvUpdateWebhook(t *testing.T) {
+	log.Init(&log.Config{
+		Level: "error",
+	})
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, wantCalls: 1},
+		{name: "transient failures are retried", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, wantCalls: 3},
+		{name: "client errors are not retried", statuses: []int{http.StatusBadRequest, http.StatusOK}, wantCalls: 1, wantErr: true},
+		{name: "retries are limited", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, wantCalls: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(webhooknotify.EventHeader) != string(webhooknotify.WebHookNotifyEventHelmEnvUpdate) {
+					t.Errorf("unexpected event header: %s", r.Header.Get(webhooknotify.EventHeader))
+				}
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer server.Close()
+
+			body := &webhooknotify.HelmEnvUpdateHookBody{ProjectName: "demo", EnvName: "dev", User: "admin"}
+			err := sendHelmEnvUpdateWebhook(server.URL, "token", body, backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sendHelmEnvUpdateWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("sendHelmEnvUpdateWebhook() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
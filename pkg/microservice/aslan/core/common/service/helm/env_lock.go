@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	configbase "github.com/koderover/zadig/v2/pkg/config"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/v2/pkg/tool/cache"
+	e "github.com/koderover/zadig/v2/pkg/tool/errors"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
+	"github.com/koderover/zadig/v2/pkg/tool/metrics"
+)
+
+// ErrEnvLocked is returned when the helm environment is being updated by others
+type ErrEnvLocked struct {
+	ProductName string
+	EnvName     string
+	// Holder and Since are empty if the holder of the lock is unknown, e.g. the lock is held by an old version
+	Holder string
+	Since  time.Time
+}
+
+func (err *ErrEnvLocked) Error() string {
+	if err.Holder == "" {
+		return fmt.Sprintf("environment %s/%s is being updated by others", err.ProductName, err.EnvName)
+	}
+	return fmt.Sprintf("environment %s/%s is being updated by %s since %s", err.ProductName, err.EnvName, err.Holder, err.Since.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, &ErrEnvLocked{}) match the lock failures of any environment
+func (err *ErrEnvLocked) Is(target error) bool {
+	_, ok := target.(*ErrEnvLocked)
+	return ok
+}
+
+// HTTPError makes the api return 409 for ErrEnvLocked
+func (err *ErrEnvLocked) HTTPError() *e.HTTPError {
+	return e.NewWithDesc(e.ErrConflict, err.Error()).(*e.HTTPError)
+}
+
+// newEnvLockError returns ErrEnvLocked with the holder of the lock if the lock is held by others,
+// the other failures of acquiring the lock are wrapped as internal errors
+func newEnvLockError(productName, envName string, err error, getHolder func() (string, error)) error {
+	if !cache.IsLockTaken(err) {
+		return errors.Wrapf(err, "failed to acquire lock of environment %s/%s", productName, envName)
+	}
+
+	lockedErr := &ErrEnvLocked{ProductName: productName, EnvName: envName}
+	holderInfo, getErr := getHolder()
+	if getErr == nil {
+		lockHolder := &helmEnvLockHolder{}
+		if json.Unmarshal([]byte(holderInfo), lockHolder) == nil {
+			lockedErr.Holder = lockHolder.Holder
+			lockedErr.Since = time.Unix(lockHolder.Since, 0)
+		}
+	}
+	return lockedErr
+}
+
+type helmEnvLockHolder struct {
+	Holder string `json:"holder"`
+	Since  int64  `json:"since"`
+}
+
+func helmEnvLockKey(productName, envName string) string {
+	return fmt.Sprintf("%s:%s:%s", UpdateHelmEnvLockKey, productName, envName)
+}
+
+// lockHelmEnv acquires the lock for updating the helm environment, the returned function releases it.
+// ErrEnvLocked is returned at once if the environment is locked by others, unless HELM_ENV_LOCK_BLOCKING is set,
+// in which case it waits for the lock and goes on without the lock if it is still not acquired like before.
+// The error of ctx is returned if ctx is done before the lock is acquired, other failures, e.g. redis is unreachable,
+// are returned as they are.
+var lockHelmEnv = func(ctx context.Context, productName, envName, holder string) (func(), error) {
+	key := helmEnvLockKey(productName, envName)
+	ttl := config.HelmEnvLockTTL()
+	envLock := cache.NewRedisLockWithExpiry(key, ttl)
+	redisCache := cache.NewRedisCache(configbase.RedisCommonCacheTokenDB())
+
+	start := time.Now()
+	var err error
+	if config.HelmEnvLockBlocking() {
+		err = envLock.LockContext(ctx)
+	} else {
+		err = envLock.TryLockContext(ctx)
+	}
+	metrics.RegisterHelmEnvLockWait(time.Since(start), err == nil)
+
+	if ctx.Err() != nil {
+		if err == nil {
+			envLock.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if config.HelmEnvLockBlocking() {
+			log.Warnf("failed to acquire lock of environment %s/%s, err: %s", productName, envName, err)
+			return func() {}, nil
+		}
+
+		return nil, newEnvLockError(productName, envName, err, func() (string, error) {
+			return redisCache.GetString(key + ":holder")
+		})
+	}
+
+	holderInfo, _ := json.Marshal(&helmEnvLockHolder{Holder: holder, Since: time.Now().Unix()})
+	if err = redisCache.Write(key+":holder", string(holderInfo), ttl); err != nil {
+		log.Warnf("failed to record holder of environment lock %s, err: %s", key, err)
+	}
+
+	return func() {
+		if err := redisCache.Delete(key + ":holder"); err != nil {
+			log.Warnf("failed to delete holder of environment lock %s, err: %s", key, err)
+		}
+		if err := envLock.Unlock(); err != nil {
+			log.Warnf("failed to release environment lock %s, err: %s", key, err)
+		}
+	}, nil
+}
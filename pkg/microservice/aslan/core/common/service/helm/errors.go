@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"github.com/pkg/errors"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+
+	e "github.com/koderover/zadig/v2/pkg/tool/errors"
+)
+
+// The kinds of failures of the helm environment updates, callers match them with errors.Is,
+// ErrEnvLocked is matched with errors.Is(err, &ErrEnvLocked{}) or errors.As.
+var (
+	// ErrProductNotFound is returned when the environment to update does not exist
+	ErrProductNotFound = errors.New("environment not found")
+	// ErrTemplateNotFound is returned when the project of the environment does not exist
+	ErrTemplateNotFound = errors.New("template product not found")
+	// ErrConcurrentModification is returned when the environment is updated by others after the caller read it,
+	// the caller should retry with the latest environment.
+	ErrConcurrentModification = errors.New("environment has been modified concurrently")
+	// ErrIdempotencyKeyReused is returned when the idempotency key of an update is recorded by the update of another service
+	ErrIdempotencyKeyReused = errors.New("idempotency key is used by another update")
+)
+
+// envError attaches the kind of failure to the underlying error, errors.Is matches both of them
+type envError struct {
+	kind error
+	err  error
+}
+
+func (err *envError) Error() string {
+	return err.err.Error()
+}
+
+func (err *envError) Unwrap() []error {
+	return []error{err.kind, err.err}
+}
+
+// HTTPError makes the api return 404 for missing environments and projects and 409 for concurrent modifications
+// and reused idempotency keys
+func (err *envError) HTTPError() *e.HTTPError {
+	httpErr := e.ErrInternalError
+	switch err.kind {
+	case ErrProductNotFound, ErrTemplateNotFound:
+		httpErr = e.ErrNotFound
+	case ErrConcurrentModification, ErrIdempotencyKeyReused:
+		httpErr = e.ErrConflict
+	}
+	return e.NewWithDesc(httpErr, err.Error()).(*e.HTTPError)
+}
+
+// wrapFindError wraps the error of finding the environment or project with the message,
+// kind is attached to it if the document does not exist
+func wrapFindError(err, kind error, format string, args ...interface{}) error {
+	wrapped := errors.Wrapf(err, format, args...)
+	if errors.Is(err, mongodriver.ErrNoDocuments) {
+		return &envError{kind: kind, err: wrapped}
+	}
+	return wrapped
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"testing"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	e "github.com/koderover/zadig/v2/pkg/tool/errors"
+)
+
+func TestEnvErrors(t *testing.T) {
+	networkErr := errors.New("connection refused")
+	redisErr := multierror.Append(nil, &redsync.RedisError{Err: networkErr})
+
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+		wantCode int
+	}{
+		{
+			name:     "missing environment",
+			err:      wrapFindError(mongodriver.ErrNoDocuments, ErrProductNotFound, "failed to find environment %s/%s", "demo", "dev"),
+			wantKind: ErrProductNotFound,
+			wantCode: 404,
+		},
+		{
+			name:     "missing project",
+			err:      wrapFindError(mongodriver.ErrNoDocuments, ErrTemplateNotFound, "failed to find template product %s", "demo"),
+			wantKind: ErrTemplateNotFound,
+			wantCode: 404,
+		},
+		{
+			name:     "concurrent modification",
+			err:      checkEnvNotModified(&commonmodels.Product{ProductName: "demo", EnvName: "dev"}, 1),
+			wantKind: ErrConcurrentModification,
+			wantCode: 409,
+		},
+		{
+			name:     "idempotency key reused",
+			err:      &envError{kind: ErrIdempotencyKeyReused, err: errors.New("idempotency key deploy-v2 is used by the update of service api")},
+			wantKind: ErrIdempotencyKeyReused,
+			wantCode: 409,
+		},
+		{
+			name:     "environment locked",
+			err:      errors.Wrap(&ErrEnvLocked{ProductName: "demo", EnvName: "dev"}, "failed to update environment"),
+			wantKind: &ErrEnvLocked{},
+			wantCode: 409,
+		},
+		{
+			name: "environment lock taken",
+			err: newEnvLockError("demo", "dev", &redsync.ErrTaken{Nodes: []int{0}}, func() (string, error) {
+				return `{"holder":"admin","since":1700000000}`, nil
+			}),
+			wantKind: &ErrEnvLocked{},
+			wantCode: 409,
+		},
+		{
+			name: "environment lock unavailable",
+			err: newEnvLockError("demo", "dev", redisErr, func() (string, error) {
+				return "", networkErr
+			}),
+			wantKind: redisErr,
+			wantCode: 500,
+		},
+		{
+			name:     "other failures",
+			err:      wrapFindError(networkErr, ErrProductNotFound, "failed to find environment %s/%s", "demo", "dev"),
+			wantKind: networkErr,
+			wantCode: 500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.wantKind) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", tt.err, tt.wantKind)
+			}
+			if code, _ := e.ErrorMessage(tt.err); code != tt.wantCode {
+				t.Errorf("status code of %v = %d, want %d", tt.err, code, tt.wantCode)
+			}
+			if e.ErrConflict.Desc() != "" {
+				t.Errorf("e.ErrConflict is changed to %v", e.ErrConflict)
+			}
+		})
+	}
+}
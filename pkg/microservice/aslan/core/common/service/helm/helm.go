@@ -24,6 +24,7 @@ import (
 	"strings"
 	"time"
 
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
@@ -38,12 +39,13 @@ import (
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/repository"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
 	"github.com/koderover/zadig/v2/pkg/setting"
-	"github.com/koderover/zadig/v2/pkg/tool/cache"
 	"github.com/koderover/zadig/v2/pkg/tool/crypto"
 	helmtool "github.com/koderover/zadig/v2/pkg/tool/helmclient"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
 	"github.com/koderover/zadig/v2/pkg/tool/mongo"
+	"github.com/koderover/zadig/v2/pkg/util"
 	"github.com/koderover/zadig/v2/pkg/util/converter"
+	yamlutil "github.com/koderover/zadig/v2/pkg/util/yaml"
 	"github.com/pkg/errors"
 )
 
@@ -57,11 +59,13 @@ func ListHelmRepos(encryptedKey string, log *zap.SugaredLogger) ([]*commonmodels
 		log.Errorf("ListHelmRepos GetAesKeyFromEncryptedKey err:%v", err)
 		return nil, err
 	}
-	helmRepos, err := commonrepo.NewHelmRepoColl().List()
+	helmRepos, err := listHelmReposWithCache()
 	if err != nil {
 		log.Errorf("ListHelmRepos err:%v", err)
 		return []*commonmodels.HelmRepo{}, nil
 	}
+	// the listed repos are copies of the cache, so the passwords read from the secrets are never kept
+	resolveHelmRepoPasswords(helmRepos)
 	for _, helmRepo := range helmRepos {
 		helmRepo.Password, err = crypto.AesEncryptByKey(helmRepo.Password, aesKey.PlainText)
 		if err != nil {
@@ -72,80 +76,167 @@ func ListHelmRepos(encryptedKey string, log *zap.SugaredLogger) ([]*commonmodels
 	return helmRepos, nil
 }
 
-func ListHelmReposByProject(projectName string, log *zap.SugaredLogger) ([]*commonmodels.HelmRepo, error) {
-	helmRepos, err := commonrepo.NewHelmRepoColl().ListByProject(projectName)
+var listHelmReposByProjectFromDB = func(projectName string, offset, limit int64) ([]*commonmodels.HelmRepo, int64, error) {
+	return commonrepo.NewHelmRepoColl().ListByProject(projectName, offset, limit)
+}
+
+// ListHelmReposByProject returns a page of the helm repos of the project without credentials and the total count, it is used for api responses.
+// All repos are returned if limit is 0. The latest charts in each repo with their dependencies are attached if withDependencies is set.
+func ListHelmReposByProject(projectName string, offset, limit int64, withDependencies bool, log *zap.SugaredLogger) ([]*commonmodels.HelmRepo, int64, error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, fmt.Errorf("invalid offset %d or limit %d", offset, limit)
+	}
+	helmRepos, total, err := listHelmReposByProjectFromDB(projectName, offset, limit)
 	if err != nil {
 		log.Errorf("ListHelmRepos err:%v", err)
-		return []*commonmodels.HelmRepo{}, nil
+		return []*commonmodels.HelmRepo{}, 0, nil
 	}
-	for _, helmRepo := range helmRepos {
-		helmRepo.Password = ""
-		helmRepo.Projects = nil
+	fillHelmRepoType(helmRepos)
+	if withDependencies {
+		// the charts are fetched with the passwords read from the secrets, which are dropped by sanitizeHelmRepos
+		resolveHelmRepoPasswords(helmRepos)
+		attachChartSummaries(helmRepos)
+	}
+	return sanitizeHelmRepos(helmRepos), total, nil
+}
+
+// ListHelmReposByProjectInternal returns the helm repos of the project with raw credentials, it is only for server side usage like pulling charts
+func ListHelmReposByProjectInternal(projectName string) ([]*commonmodels.HelmRepo, error) {
+	helmRepos, _, err := listHelmReposByProjectFromDB(projectName, 0, 0)
+	if err != nil {
+		return nil, err
 	}
+	fillHelmRepoType(helmRepos)
+	resolveHelmRepoPasswords(helmRepos)
 	return helmRepos, nil
 }
 
-func ListHelmReposPublic() ([]*commonmodels.HelmRepo, error) {
-	return commonrepo.NewHelmRepoColl().List()
+func fillHelmRepoType(helmRepos []*commonmodels.HelmRepo) {
+	for _, helmRepo := range helmRepos {
+		helmRepo.RepoType = helmRepo.GetRepoType()
+	}
 }
 
-func SaveAndUploadService(projectName, serviceName string, copies []string, fileTree fs.FS, isProduction bool) error {
-	var localBase, s3Base string
-	if !isProduction {
-		localBase = config.LocalTestServicePath(projectName, serviceName)
-		s3Base = config.ObjectStorageTestServicePath(projectName, serviceName)
-	} else {
-		localBase = config.LocalProductionServicePath(projectName, serviceName)
-		s3Base = config.ObjectStorageProductionServicePath(projectName, serviceName)
+// sanitizeHelmRepos returns copies of the helm repos without credentials, the given repos are not modified
+func sanitizeHelmRepos(helmRepos []*commonmodels.HelmRepo) []*commonmodels.HelmRepo {
+	resp := make([]*commonmodels.HelmRepo, 0, len(helmRepos))
+	for _, helmRepo := range helmRepos {
+		repo := *helmRepo
+		repo.Password = ""
+		repo.Projects = nil
+		resp = append(resp, &repo)
 	}
+	return resp
+}
+
+func ListHelmReposPublic() ([]*commonmodels.HelmRepo, error) {
+	return listHelmReposWithCache()
+}
+
+// SaveAndUploadService saves the chart locally and uploads it to object storage,
+// chartVersion is optional, the chart is uploaded under the version subpath if it is set so that different chart versions co-exist
+func SaveAndUploadService(projectName, serviceName string, copies []string, fileTree fs.FS, isProduction bool, chartVersion string) error {
+	localBase := config.LocalServicePath(projectName, serviceName, isProduction)
+	s3Base := config.ObjectStorageServicePathWithChartVersion(projectName, serviceName, chartVersion, isProduction)
 	names := append([]string{serviceName}, copies...)
-	return fsservice.SaveAndUploadFiles(fileTree, names, localBase, s3Base, log.SugaredLogger())
+	return fsservice.SaveAndUploadFilesWithConcurrency(fileTree, names, localBase, s3Base, config.HelmChartUploadConcurrency(), log.SugaredLogger())
 }
 
-func CopyAndUploadService(projectName, serviceName, currentChartPath string, copies []string, isProduction bool) error {
-	var localBase, s3Base string
-	if !isProduction {
-		localBase = config.LocalTestServicePath(projectName, serviceName)
-		s3Base = config.ObjectStorageTestServicePath(projectName, serviceName)
-	} else {
-		localBase = config.LocalProductionServicePath(projectName, serviceName)
-		s3Base = config.ObjectStorageProductionServicePath(projectName, serviceName)
-	}
+// CopyAndUploadService copies the chart locally and uploads it to object storage, chartVersion works the same as SaveAndUploadService
+func CopyAndUploadService(projectName, serviceName, currentChartPath string, copies []string, isProduction bool, chartVersion string) error {
+	localBase := config.LocalServicePath(projectName, serviceName, isProduction)
+	s3Base := config.ObjectStorageServicePathWithChartVersion(projectName, serviceName, chartVersion, isProduction)
 	names := append([]string{serviceName}, copies...)
 
 	return fsservice.CopyAndUploadFiles(names, path.Join(localBase, serviceName), s3Base, localBase, currentChartPath, log.SugaredLogger())
 }
 
 // Update Service and ServiceDeployStrategy for a single service in environment
-func UpdateServiceInEnv(product *commonmodels.Product, productSvc *commonmodels.ProductService, user string, operation config.EnvOperation, detail string) error {
-	session := mongo.Session()
-	defer session.EndSession(context.TODO())
+// valueOverrides is optional, it is deep merged into the override values of the service, e.g. image tags computed in a workflow
+// the service in environment before the update is returned for rollback, it is nil if the service was not in the environment
+// the transaction is aborted if ctx is cancelled before it is committed
+// the services moved to other groups to align with the service orchestration of the project are returned as well
+// the values captured on import are dropped in the same transaction when the service is switched from import to deploy
+// and HELM_IMPORT_TO_DEPLOY_RERENDER is set, see resetImportedServiceValues
+// idempotencyKey is optional, it is recorded with the version of the service, an update repeated with a recorded key
+// changes nothing and returns the service before the recorded update
+func UpdateServiceInEnv(ctx context.Context, product *commonmodels.Product, productSvc *commonmodels.ProductService, user string, operation config.EnvOperation, detail, idempotencyKey string, valueOverrides map[string]interface{}) (*commonmodels.ProductService, []*ServiceRegroup, error) {
+	session := newHelmEnvSession(ctx)
+	defer session.EndSession(session)
 
 	err := mongo.StartTransaction(session)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	product.LintServices()
-	err = commonutil.CreateEnvServiceVersion(product, productSvc, user, operation, detail, session, log.SugaredLogger())
+	unlockEnv, err := lockHelmEnv(ctx, product.ProductName, product.EnvName, user)
 	if err != nil {
-		log.Errorf("failed to create helm service version, err: %v", err)
+		mongo.AbortTransaction(session)
+		return nil, nil, err
 	}
-
-	envLock := cache.NewRedisLock(fmt.Sprintf("%s:%s:%s", UpdateHelmEnvLockKey, product.ProductName, product.EnvName))
-	envLock.Lock()
-	defer envLock.Unlock()
+	defer unlockEnv()
 
 	productColl := commonrepo.NewProductCollWithSession(session)
 	newProductInfo, err := productColl.Find(&commonrepo.ProductFindOptions{Name: product.ProductName, EnvName: product.EnvName})
 	if err != nil {
 		mongo.AbortTransaction(session)
-		return errors.Wrapf(err, "failed to find product %s", product.ProductName)
+		return nil, nil, wrapFindError(err, ErrProductNotFound, "failed to find environment %s/%s", product.ProductName, product.EnvName)
+	}
+
+	// the key is checked in the transaction under the env lock, so that concurrent retries can't both pass it
+	if idempotencyKey != "" {
+		done, prevSvc, err := findIdempotentServiceUpdate(commonrepo.NewEnvServiceVersionCollWithSession(session), product, productSvc, idempotencyKey)
+		if err != nil {
+			mongo.AbortTransaction(session)
+			return nil, nil, err
+		}
+		if done {
+			mongo.AbortTransaction(session)
+			log.Infof("service %s/%s/%s is already updated with idempotency key %s", product.ProductName, product.EnvName, productSvc.ServiceName, idempotencyKey)
+			return prevSvc, nil, nil
+		}
+	}
+
+	prevDeployStrategy := getHelmServiceDeployStrategy(productSvc, newProductInfo.ServiceDeployStrategy)
+	if resetImportedServiceValues(productSvc, prevDeployStrategy, config.HelmImportToDeployRerender()) {
+		log.Infof("values of service %s/%s/%s are rendered from the template default values since it is switched from import to deploy",
+			product.ProductName, product.EnvName, productSvc.ServiceName)
+	}
+
+	if err = mergeServiceValueOverrides(productSvc, valueOverrides); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, nil, errors.Wrapf(err, "failed to merge value overrides of service %s", productSvc.ServiceName)
+	}
+
+	product.LintServices()
+	err = commonutil.CreateEnvServiceVersionWithIdempotencyKey(product, productSvc, user, operation, detail, idempotencyKey, session, log.SugaredLogger())
+	if err != nil {
+		log.Errorf("failed to create helm service version, err: %v", err)
+		// a retry could not be told from the first call without the version recording the key
+		if idempotencyKey != "" {
+			mongo.AbortTransaction(session)
+			return nil, nil, errors.Wrapf(err, "failed to record idempotency key %s", idempotencyKey)
+		}
 	}
 
 	newProductInfo.LintServices()
 	productSvcMap := newProductInfo.GetServiceMap()
 	productChartSvcMap := newProductInfo.GetChartServiceMap()
+
+	// take the snapshot before the service in environment is replaced
+	var prevSvc *commonmodels.ProductService
+	currentSvc := productSvcMap[productSvc.ServiceName]
+	if !productSvc.FromZadig() {
+		currentSvc = productChartSvcMap[productSvc.ReleaseName]
+	}
+	if currentSvc != nil {
+		prevSvc = new(commonmodels.ProductService)
+		if err = util.DeepCopy(prevSvc, currentSvc); err != nil {
+			mongo.AbortTransaction(session)
+			return nil, nil, errors.Wrapf(err, "failed to copy service %s in environment", productSvc.ServiceName)
+		}
+	}
+
 	if productSvc.FromZadig() {
 		productSvcMap[productSvc.ServiceName] = productSvc
 		productSvcMap[productSvc.ServiceName].UpdateTime = time.Now().Unix()
@@ -164,14 +255,12 @@ func UpdateServiceInEnv(product *commonmodels.Product, productSvc *commonmodels.
 	templateProduct, err := template.NewProductCollWithSess(session).Find(product.ProductName)
 	if err != nil {
 		mongo.AbortTransaction(session)
-		return errors.Wrapf(err, "failed to find template product %s", product.ProductName)
+		return nil, nil, wrapFindError(err, ErrTemplateNotFound, "failed to find template product %s", product.ProductName)
 	}
 
+	servicesBefore := newProductInfo.Services
 	newProductInfo.Services = [][]*commonmodels.ProductService{}
-	serviceOrchestration := templateProduct.Services
-	if product.Production {
-		serviceOrchestration = templateProduct.ProductionServices
-	}
+	serviceOrchestration := getServiceOrchestration(templateProduct, product.Production)
 
 	for i, svcGroup := range serviceOrchestration {
 		// init slice
@@ -192,6 +281,8 @@ func UpdateServiceInEnv(product *commonmodels.Product, productSvc *commonmodels.
 		newProductInfo.Services[len(newProductInfo.Services)-1] = append(newProductInfo.Services[len(newProductInfo.Services)-1], service)
 	}
 
+	regroups := diffServiceRegroups(servicesBefore, newProductInfo.Services)
+
 	if productSvc.DeployStrategy == setting.ServiceDeployStrategyDeploy {
 		if productSvc.FromZadig() {
 			newProductInfo.ServiceDeployStrategy = commonutil.SetServiceDeployStrategyDepoly(newProductInfo.ServiceDeployStrategy, productSvc.ServiceName)
@@ -206,42 +297,410 @@ func UpdateServiceInEnv(product *commonmodels.Product, productSvc *commonmodels.
 		}
 	}
 
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return nil, nil, err
+	}
 	if err = productColl.Update(newProductInfo); err != nil {
 		log.Errorf("update product %s error: %s", newProductInfo.ProductName, err.Error())
 		mongo.AbortTransaction(session)
-		return fmt.Errorf("failed to update product info, name %s", newProductInfo.ProductName)
+		return nil, nil, errors.Wrapf(err, "failed to update product info, name %s", newProductInfo.ProductName)
+	}
+
+	auditEvent := newHelmEnvAuditEvent(newProductInfo, commonmodels.HelmEnvAuditOperationUpdateService, user)
+	auditEvent.Services = []*commonmodels.HelmEnvAuditService{{
+		ServiceName:        productSvc.ServiceName,
+		ReleaseName:        productSvc.ReleaseName,
+		PrevDeployStrategy: prevDeployStrategy,
+		DeployStrategy:     getHelmServiceDeployStrategy(productSvc, newProductInfo.ServiceDeployStrategy),
+	}}
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, nil, errors.Wrapf(err, "failed to create audit event of product %s", newProductInfo.ProductName)
+	}
+
+	// the snapshot and regroups are only returned once the update is committed, the caller must not act on an update that didn't happen
+	if err = commitIfNotCancelled(ctx, session, auditEvent); err != nil {
+		return nil, nil, err
 	}
+	return prevSvc, regroups, nil
+}
+
+// IsServiceUpdatedWithIdempotencyKey returns whether the service in env is already updated with the idempotency key,
+// ErrIdempotencyKeyReused is returned if the key is recorded by the update of another service
+func IsServiceUpdatedWithIdempotencyKey(product *commonmodels.Product, productSvc *commonmodels.ProductService, idempotencyKey string) (bool, error) {
+	done, _, err := findIdempotentServiceUpdate(commonrepo.NewEnvServiceVersionColl(), product, productSvc, idempotencyKey)
+	return done, err
+}
+
+type envServiceVersionFinder interface {
+	Find(productName, envName, serviceName string, isHelmChart, production bool, revision int64) (*commonmodels.EnvServiceVersion, error)
+	FindByIdempotencyKey(productName, envName string, production bool, idempotencyKey string) (*commonmodels.EnvServiceVersion, error)
+}
+
+// findIdempotentServiceUpdate returns whether the env is already updated with the idempotency key and the service
+// before that update, which is nil if the service was not in the environment or its version is deleted,
+// the key recorded by the update of another service is rejected instead of taking the update as done
+func findIdempotentServiceUpdate(versionColl envServiceVersionFinder, product *commonmodels.Product, productSvc *commonmodels.ProductService, idempotencyKey string) (bool, *commonmodels.ProductService, error) {
+	version, err := versionColl.FindByIdempotencyKey(product.ProductName, product.EnvName, product.Production, idempotencyKey)
+	if err != nil {
+		if err == mongodriver.ErrNoDocuments {
+			return false, nil, nil
+		}
+		return false, nil, errors.Wrapf(err, "failed to find version with idempotency key %s", idempotencyKey)
+	}
+	if version.Service == nil {
+		return true, nil, nil
+	}
+
+	name, isHelmChart := version.Service.ServiceName, !version.Service.FromZadig()
+	if isHelmChart {
+		name = version.Service.ReleaseName
+	}
+	targetName := productSvc.ServiceName
+	if !productSvc.FromZadig() {
+		targetName = productSvc.ReleaseName
+	}
+	if isHelmChart != !productSvc.FromZadig() || name != targetName {
+		return false, nil, &envError{
+			kind: ErrIdempotencyKeyReused,
+			err:  fmt.Errorf("idempotency key %s is used by the update of service %s in environment %s/%s", idempotencyKey, name, product.ProductName, product.EnvName),
+		}
+	}
+
+	prevVersion, err := versionColl.Find(product.ProductName, product.EnvName, name, isHelmChart, product.Production, version.Revision-1)
+	if err != nil {
+		return true, nil, nil
+	}
+	return true, prevVersion.Service, nil
+}
+
+func newHelmEnvAuditEvent(product *commonmodels.Product, operation, user string) *commonmodels.HelmEnvAuditEvent {
+	return &commonmodels.HelmEnvAuditEvent{
+		ProjectName: product.ProductName,
+		EnvName:     product.EnvName,
+		Production:  product.Production,
+		Operation:   operation,
+		User:        user,
+	}
+}
+
+// newHelmEnvAuditServices is for the updates which don't change the deploy strategy of services
+func newHelmEnvAuditServices(services []*commonmodels.ProductService, strategyMap map[string]string) []*commonmodels.HelmEnvAuditService {
+	resp := make([]*commonmodels.HelmEnvAuditService, 0, len(services))
+	for _, svc := range services {
+		strategy := getHelmServiceDeployStrategy(svc, strategyMap)
+		resp = append(resp, &commonmodels.HelmEnvAuditService{
+			ServiceName:        svc.ServiceName,
+			ReleaseName:        svc.ReleaseName,
+			PrevDeployStrategy: strategy,
+			DeployStrategy:     strategy,
+		})
+	}
+	return resp
+}
+
+func getHelmServiceDeployStrategy(svc *commonmodels.ProductService, strategyMap map[string]string) string {
+	if svc.FromZadig() {
+		return commonutil.GetServiceDeployStrategy(svc.ServiceName, strategyMap)
+	}
+	return commonutil.GetReleaseDeployStrategy(svc.ReleaseName, strategyMap)
+}
 
-	return mongo.CommitTransaction(session)
+// resetImportedServiceValues drops the override values of the service if rerender is set and it is switched from import to deploy,
+// since the values of imported services are often captured from the live cluster and should not be reused on the first real deploy.
+// The previous strategy is keyed by the service name for services from zadig and by the release name for chart services,
+// so a zadig service whose release name differs from its service name is still detected by its service name,
+// while a chart service deployed under another release name is a new release without previous strategy and keeps its values.
+func resetImportedServiceValues(productSvc *commonmodels.ProductService, prevDeployStrategy string, rerender bool) bool {
+	if !rerender || prevDeployStrategy != setting.ServiceDeployStrategyImport || productSvc.DeployStrategy != setting.ServiceDeployStrategyDeploy {
+		return false
+	}
+	render := productSvc.GetServiceRender()
+	render.OverrideValues = ""
+	render.OverrideYaml.YamlContent = ""
+	return true
+}
+
+func mergeServiceValueOverrides(productSvc *commonmodels.ProductService, valueOverrides map[string]interface{}) error {
+	if len(valueOverrides) == 0 {
+		return nil
+	}
+	overrideYaml, err := yaml.Marshal(valueOverrides)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value overrides, err: %s", err)
+	}
+	customYaml := productSvc.GetServiceRender().OverrideYaml
+	mergedYaml, err := yamlutil.Merge([][]byte{[]byte(customYaml.YamlContent), overrideYaml})
+	if err != nil {
+		return fmt.Errorf("failed to merge override yaml, err: %s", err)
+	}
+	customYaml.YamlContent = string(mergedYaml)
+	return nil
 }
 
+type EnvServicesMergeMode string
+
+const (
+	// EnvServicesMergeModeReplace replaces all the services in environment with the given services
+	EnvServicesMergeModeReplace EnvServicesMergeMode = "replace"
+	// EnvServicesMergeModeUpsert updates the given services and keeps the other services in environment at their positions
+	EnvServicesMergeModeUpsert EnvServicesMergeMode = "upsert"
+)
+
 // Update all services in environment
-func UpdateAllServicesInEnv(productName, envName string, services [][]*models.ProductService, production bool) error {
-	session := mongo.Session()
-	defer session.EndSession(context.TODO())
+// updateTime is the update time of the environment when the caller read it, the update is aborted with ErrConcurrentModification
+// if the environment has been updated since then. 0 skips the check. The update time has a resolution of one second,
+// so an update made in the same second as the read is not detected.
+// The given services moved to other groups to align with the service orchestration of the project are returned.
+func UpdateAllServicesInEnv(ctx context.Context, productName, envName string, services [][]*models.ProductService, production bool, updateTime int64, user string, mergeMode EnvServicesMergeMode) ([]*ServiceRegroup, error) {
+	return updateAllServicesInEnv(ctx, productName, envName, services, production, updateTime, user, mergeMode, &updateAllServicesOption{
+		auditOperation: commonmodels.HelmEnvAuditOperationUpdateAllServices,
+	})
+}
+
+type updateAllServicesOption struct {
+	auditOperation string
+	// a version with versionOperation is created for each given service in the transaction if it is set
+	versionOperation config.EnvOperation
+	versionDetail    string
+}
+
+func updateAllServicesInEnv(ctx context.Context, productName, envName string, services [][]*models.ProductService, production bool, updateTime int64, user string, mergeMode EnvServicesMergeMode, option *updateAllServicesOption) ([]*ServiceRegroup, error) {
+	if err := checkDuplicateReleaseNames(services); err != nil {
+		return nil, err
+	}
+
+	session := newHelmEnvSession(ctx)
+	defer session.EndSession(session)
 
 	err := mongo.StartTransaction(session)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	productColl := commonrepo.NewProductCollWithSession(session)
+	unlockEnv, err := lockHelmEnv(ctx, productName, envName, user)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, err
+	}
+	defer unlockEnv()
 
-	envLock := cache.NewRedisLock(fmt.Sprintf("%s:%s:%s", UpdateHelmEnvLockKey, productName, envName))
-	envLock.Lock()
-	defer envLock.Unlock()
+	templateProduct, err := findTemplateProductWithSession(session, productName)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, wrapFindError(err, ErrTemplateNotFound, "failed to find template product %s", productName)
+	}
 
-	templateProduct, err := template.NewProductCollWithSess(session).Find(productName)
+	serviceOrchestration := getServiceOrchestration(templateProduct, production)
+
+	currentProductInfo, err := findEnvWithSession(session, &commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
 	if err != nil {
 		mongo.AbortTransaction(session)
-		return errors.Wrapf(err, "failed to find template product %s", productName)
+		return nil, wrapFindError(err, ErrProductNotFound, "failed to find environment %s/%s", productName, envName)
+	}
+	if updateTime > 0 {
+		if err = checkEnvNotModified(currentProductInfo, updateTime); err != nil {
+			mongo.AbortTransaction(session)
+			return nil, err
+		}
 	}
 
-	serviceOrchestration := templateProduct.Services
-	if production {
-		serviceOrchestration = templateProduct.ProductionServices
+	var newServices [][]*commonmodels.ProductService
+	switch mergeMode {
+	case EnvServicesMergeModeReplace, "":
+		dummyEnv := &commonmodels.Product{
+			Services: services,
+		}
+		dummyEnv.LintServices()
+		productSvcMap := dummyEnv.GetServiceMap()
+		productChartSvcMap := dummyEnv.GetChartServiceMap()
+
+		newServices = [][]*commonmodels.ProductService{}
+		for i, svcGroup := range serviceOrchestration {
+			// init slice
+			if len(newServices) >= i {
+				newServices = append(newServices, []*commonmodels.ProductService{})
+			}
+
+			// set services in order
+			for _, svc := range svcGroup {
+				// if svc exists in productSvcMap
+				if productSvcMap[svc] != nil {
+					productSvcMap[svc].UpdateTime = time.Now().Unix()
+					newServices[i] = append(newServices[i], productSvcMap[svc])
+				}
+			}
+		}
+		// append chart services to the last group
+		for _, service := range productChartSvcMap {
+			service.UpdateTime = time.Now().Unix()
+			newServices[len(newServices)-1] = append(newServices[len(newServices)-1], service)
+		}
+	case EnvServicesMergeModeUpsert:
+		newServices = upsertEnvServices(currentProductInfo.Services, services, serviceOrchestration)
+	default:
+		mongo.AbortTransaction(session)
+		return nil, fmt.Errorf("invalid merge mode: %s", mergeMode)
+	}
+
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return nil, err
+	}
+	if err = updateEnvServicesWithSession(session, productName, envName, newServices); err != nil {
+		err = errors.Wrapf(err, "failed to update %s/%s product services", productName, envName)
+		mongo.AbortTransaction(session)
+		log.Error(err)
+		return nil, err
+	}
+
+	auditEvent := newHelmEnvAuditEvent(currentProductInfo, option.auditOperation, user)
+	for _, svcGroup := range newServices {
+		auditEvent.Services = append(auditEvent.Services, newHelmEnvAuditServices(svcGroup, currentProductInfo.ServiceDeployStrategy)...)
+	}
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to create audit event of %s/%s", productName, envName)
+	}
+
+	if option.versionOperation != "" {
+		currentProductInfo.Services = newServices
+		for _, svcGroup := range services {
+			for _, svc := range svcGroup {
+				if err = commonutil.CreateEnvServiceVersion(currentProductInfo, svc, user, option.versionOperation, option.versionDetail, session, log.SugaredLogger()); err != nil {
+					mongo.AbortTransaction(session)
+					return nil, errors.Wrapf(err, "failed to create version of service %s in %s/%s", svc.ServiceName, productName, envName)
+				}
+			}
+		}
+	}
+
+	if err = commitIfNotCancelled(ctx, session, auditEvent); err != nil {
+		return nil, err
+	}
+	return diffServiceRegroups(services, newServices), nil
+}
+
+// RollbackHelmEnvToVersion rolls back the services in environment to their versions at the time the given version was created,
+// the services without version at that time are kept. A rollback version is created for each rolled back service.
+func RollbackHelmEnvToVersion(ctx context.Context, productName, envName, versionID, user string) error {
+	targetVersion, err := commonrepo.NewEnvServiceVersionColl().GetByID(versionID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find version %s", versionID)
+	}
+	if targetVersion.ProductName != productName || targetVersion.EnvName != envName {
+		return fmt.Errorf("version %s does not belong to environment %s/%s", versionID, productName, envName)
+	}
+	production := targetVersion.Production
+
+	versions, err := commonrepo.NewEnvServiceVersionColl().ListEnvVersionsBefore(productName, envName, production, targetVersion.CreateTime)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list versions of %s/%s", productName, envName)
+	}
+
+	env, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to find environment %s/%s", productName, envName)
 	}
 
+	services := servicesFromVersions(versions)
+	_, err = updateAllServicesInEnv(ctx, productName, envName, services, production, env.UpdateTime, user, EnvServicesMergeModeUpsert, &updateAllServicesOption{
+		auditOperation:   commonmodels.HelmEnvAuditOperationRollback,
+		versionOperation: config.EnvOperationRollback,
+		versionDetail:    fmt.Sprintf("rollback environment to version %s", versionID),
+	})
+	return err
+}
+
+// servicesFromVersions returns the service of the latest version for each service, versions are sorted by create time.
+// The services whose latest version is a removal are left out.
+func servicesFromVersions(versions []*commonmodels.EnvServiceVersion) [][]*commonmodels.ProductService {
+	group := make([]*commonmodels.ProductService, 0)
+	removed := make([]bool, 0)
+	svcIndex := make(map[string]int)
+	chartSvcIndex := make(map[string]int)
+	for _, version := range versions {
+		svc := version.Service
+		if svc == nil {
+			continue
+		}
+		indexMap, key := svcIndex, svc.ServiceName
+		if !svc.FromZadig() {
+			indexMap, key = chartSvcIndex, svc.ReleaseName
+		}
+		if i, ok := indexMap[key]; ok {
+			group[i] = svc
+			removed[i] = version.Operation == config.EnvOperationDelete
+			continue
+		}
+		indexMap[key] = len(group)
+		group = append(group, svc)
+		removed = append(removed, version.Operation == config.EnvOperationDelete)
+	}
+
+	services := make([]*commonmodels.ProductService, 0, len(group))
+	for i, svc := range group {
+		if !removed[i] {
+			services = append(services, svc)
+		}
+	}
+	return [][]*commonmodels.ProductService{services}
+}
+
+// ServiceRegroup is a service moved to another group to align with the service orchestration of the project,
+// chart services are always moved to the last group
+type ServiceRegroup struct {
+	ServiceName string `json:"service_name"`
+	ReleaseName string `json:"release_name,omitempty"`
+	FromGroup   int    `json:"from_group"`
+	ToGroup     int    `json:"to_group"`
+}
+
+// diffServiceRegroups returns the services in before whose group index is changed in after
+func diffServiceRegroups(before, after [][]*commonmodels.ProductService) []*ServiceRegroup {
+	serviceKey := func(svc *commonmodels.ProductService) string {
+		if svc.FromZadig() {
+			return "service:" + svc.ServiceName
+		}
+		return "release:" + svc.ReleaseName
+	}
+
+	groupMap := make(map[string]int)
+	for i, group := range after {
+		for _, svc := range group {
+			groupMap[serviceKey(svc)] = i
+		}
+	}
+
+	regroups := make([]*ServiceRegroup, 0)
+	for i, group := range before {
+		for _, svc := range group {
+			toGroup, ok := groupMap[serviceKey(svc)]
+			if !ok || toGroup == i {
+				continue
+			}
+			regroup := &ServiceRegroup{FromGroup: i, ToGroup: toGroup}
+			if svc.FromZadig() {
+				regroup.ServiceName = svc.ServiceName
+			} else {
+				regroup.ReleaseName = svc.ReleaseName
+			}
+			regroups = append(regroups, regroup)
+		}
+	}
+	return regroups
+}
+
+// upsertEnvServices updates the services in current with the given services, the services not given are kept at their positions.
+// new services are added by the service orchestration like the replace mode, and new chart services are appended to the last group.
+func upsertEnvServices(current, services [][]*commonmodels.ProductService, serviceOrchestration [][]string) [][]*commonmodels.ProductService {
 	dummyEnv := &commonmodels.Product{
 		Services: services,
 	}
@@ -249,42 +708,126 @@ func UpdateAllServicesInEnv(productName, envName string, services [][]*models.Pr
 	productSvcMap := dummyEnv.GetServiceMap()
 	productChartSvcMap := dummyEnv.GetChartServiceMap()
 
-	newServices := [][]*commonmodels.ProductService{}
-	for i, svcGroup := range serviceOrchestration {
-		// init slice
-		if len(newServices) >= i {
-			newServices = append(newServices, []*commonmodels.ProductService{})
+	now := time.Now().Unix()
+	newServices := make([][]*commonmodels.ProductService, 0, len(current))
+	for _, svcGroup := range current {
+		newGroup := make([]*commonmodels.ProductService, 0, len(svcGroup))
+		for _, svc := range svcGroup {
+			if svc.FromZadig() && productSvcMap[svc.ServiceName] != nil {
+				svc = productSvcMap[svc.ServiceName]
+				svc.UpdateTime = now
+				delete(productSvcMap, svc.ServiceName)
+			} else if !svc.FromZadig() && productChartSvcMap[svc.ReleaseName] != nil {
+				svc = productChartSvcMap[svc.ReleaseName]
+				svc.UpdateTime = now
+				delete(productChartSvcMap, svc.ReleaseName)
+			}
+			newGroup = append(newGroup, svc)
 		}
+		newServices = append(newServices, newGroup)
+	}
 
-		// set services in order
+	for i, svcGroup := range serviceOrchestration {
 		for _, svc := range svcGroup {
-			// if svc exists in productSvcMap
-			if productSvcMap[svc] != nil {
-				productSvcMap[svc].UpdateTime = time.Now().Unix()
-				newServices[i] = append(newServices[i], productSvcMap[svc])
+			if productSvcMap[svc] == nil {
+				continue
+			}
+			for len(newServices) <= i {
+				newServices = append(newServices, []*commonmodels.ProductService{})
 			}
+			productSvcMap[svc].UpdateTime = now
+			newServices[i] = append(newServices[i], productSvcMap[svc])
 		}
 	}
-	// append chart services to the last group
+	if len(productChartSvcMap) > 0 && len(newServices) == 0 {
+		newServices = append(newServices, []*commonmodels.ProductService{})
+	}
 	for _, service := range productChartSvcMap {
-		service.UpdateTime = time.Now().Unix()
+		service.UpdateTime = now
 		newServices[len(newServices)-1] = append(newServices[len(newServices)-1], service)
 	}
+	return newServices
+}
+
+// checkDuplicateReleaseNames returns an error if chart services share the same release name,
+// otherwise only one of them is kept when the services are linted
+func checkDuplicateReleaseNames(services [][]*commonmodels.ProductService) error {
+	releaseNames := sets.NewString()
+	duplicates := sets.NewString()
+	for _, group := range services {
+		for _, svc := range group {
+			if svc.FromZadig() {
+				continue
+			}
+			if releaseNames.Has(svc.ReleaseName) {
+				duplicates.Insert(svc.ReleaseName)
+			}
+			releaseNames.Insert(svc.ReleaseName)
+		}
+	}
+	if duplicates.Len() > 0 {
+		return fmt.Errorf("duplicate release names: %s", strings.Join(duplicates.List(), ", "))
+	}
+	return nil
+}
+
+// newHelmEnvSession starts a session whose operations, including the queries of the collections using it, are bound to ctx
+var newHelmEnvSession = func(ctx context.Context) mongodriver.SessionContext {
+	return mongodriver.NewSessionContext(ctx, mongo.Session())
+}
 
-	if err = productColl.UpdateAllServices(productName, envName, newServices); err != nil {
-		err = fmt.Errorf("failed to update %s/%s product services, err %s", productName, envName, err)
+var findTemplateProductWithSession = func(session mongodriver.Session, productName string) (*templatemodels.Product, error) {
+	return template.NewProductCollWithSess(session).Find(productName)
+}
+
+var findEnvWithSession = func(session mongodriver.Session, opt *commonrepo.ProductFindOptions) (*commonmodels.Product, error) {
+	return commonrepo.NewProductCollWithSession(session).Find(opt)
+}
+
+var updateEnvServicesWithSession = func(session mongodriver.Session, productName, envName string, services [][]*commonmodels.ProductService) error {
+	return commonrepo.NewProductCollWithSession(session).UpdateAllServices(productName, envName, services)
+}
+
+// abortIfCancelled aborts the transaction if ctx is done, so that a cancelled request stops before writing the environment
+func abortIfCancelled(ctx context.Context, session mongodriver.Session) error {
+	if err := ctx.Err(); err != nil {
 		mongo.AbortTransaction(session)
-		log.Error(err)
+		return errors.Wrap(err, "update of environment is cancelled")
+	}
+	return nil
+}
+
+// commitIfNotCancelled commits the transaction unless ctx is done, the hooks are notified of the audit event of the update
+// once it is committed
+func commitIfNotCancelled(ctx context.Context, session mongodriver.Session, auditEvent *commonmodels.HelmEnvAuditEvent) error {
+	if err := abortIfCancelled(ctx, session); err != nil {
 		return err
 	}
+	if err := mongo.CommitTransaction(session); err != nil {
+		return err
+	}
+	notifyHelmEnvUpdated(auditEvent)
+	return nil
+}
 
-	return mongo.CommitTransaction(session)
+func checkEnvNotModified(env *commonmodels.Product, updateTime int64) error {
+	if env.UpdateTime != updateTime {
+		return &envError{
+			kind: ErrConcurrentModification,
+			err:  errors.Errorf("environment %s/%s has been modified concurrently, it is updated at %d, expected %d", env.ProductName, env.EnvName, env.UpdateTime, updateTime),
+		}
+	}
+	return nil
 }
 
 // Update a services group in environment
-func UpdateServicesGroupInEnv(productName, envName string, index int, group []*models.ProductService, production bool) error {
-	session := mongo.Session()
-	defer session.EndSession(context.TODO())
+func UpdateServicesGroupInEnv(ctx context.Context, productName, envName string, index int, group []*models.ProductService, production bool, user string) error {
+	if err := checkDuplicateReleaseNames([][]*models.ProductService{group}); err != nil {
+		return err
+	}
+
+	session := newHelmEnvSession(ctx)
+	defer session.EndSession(session)
 
 	err := mongo.StartTransaction(session)
 	if err != nil {
@@ -293,21 +836,69 @@ func UpdateServicesGroupInEnv(productName, envName string, index int, group []*m
 
 	productColl := commonrepo.NewProductCollWithSession(session)
 
-	envLock := cache.NewRedisLock(fmt.Sprintf("%s:%s:%s", UpdateHelmEnvLockKey, productName, envName))
-	envLock.Lock()
-	defer envLock.Unlock()
+	unlockEnv, err := lockHelmEnv(ctx, productName, envName, user)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return err
+	}
+	defer unlockEnv()
 
 	templateProduct, err := template.NewProductCollWithSess(session).Find(productName)
 	if err != nil {
 		mongo.AbortTransaction(session)
-		return errors.Wrapf(err, "failed to find template product %s", productName)
+		return wrapFindError(err, ErrTemplateNotFound, "failed to find template product %s", productName)
 	}
 
-	serviceOrchestration := templateProduct.Services
-	if production {
-		serviceOrchestration = templateProduct.ProductionServices
+	serviceOrchestration := getServiceOrchestration(templateProduct, production)
+
+	newGroup := orderServicesGroup(serviceOrchestration, group)
+	for _, service := range newGroup {
+		service.UpdateTime = time.Now().Unix()
+	}
+
+	newProductInfo, err := productColl.Find(&commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return wrapFindError(err, ErrProductNotFound, "failed to find environment %s/%s", productName, envName)
+	}
+
+	envSvcMap := newProductInfo.GetServiceMap()
+	for i, svc := range newGroup {
+		envSvc := envSvcMap[svc.ServiceName]
+		if envSvc != nil {
+			if envSvc.UpdateTime > svc.UpdateTime {
+				newGroup[i] = envSvc
+				log.Warnf("service %s in environment %s/%s is newer than the service in update request, ignore the update", svc.ServiceName, productName, envName)
+			}
+		}
 	}
 
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return err
+	}
+	if err = productColl.UpdateServicesGroup(productName, envName, index, newGroup); err != nil {
+		err = errors.Wrapf(err, "failed to update %s/%s product services", productName, envName)
+		mongo.AbortTransaction(session)
+		log.Error(err)
+		return err
+	}
+
+	auditEvent := newHelmEnvAuditEvent(newProductInfo, commonmodels.HelmEnvAuditOperationUpdateServicesGroup, user)
+	auditEvent.Services = newHelmEnvAuditServices(newGroup, newProductInfo.ServiceDeployStrategy)
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return errors.Wrapf(err, "failed to create audit event of %s/%s", productName, envName)
+	}
+
+	return commitIfNotCancelled(ctx, session, auditEvent)
+}
+
+// orderServicesGroup sorts the services in group by the service orchestration of the project, chart services are appended to the end
+func orderServicesGroup(serviceOrchestration [][]string, group []*commonmodels.ProductService) []*commonmodels.ProductService {
 	dummyEnv := &commonmodels.Product{
 		Services: [][]*commonmodels.ProductService{group},
 	}
@@ -321,46 +912,372 @@ func UpdateServicesGroupInEnv(productName, envName string, index int, group []*m
 		for _, svc := range svcGroup {
 			// if svc exists in productSvcMap
 			if productSvcMap[svc] != nil {
-				productSvcMap[svc].UpdateTime = time.Now().Unix()
 				newGroup = append(newGroup, productSvcMap[svc])
 			}
 		}
 	}
 	// append chart services to the last group
 	for _, service := range productChartSvcMap {
-		service.UpdateTime = time.Now().Unix()
 		newGroup = append(newGroup, service)
 	}
+	return newGroup
+}
 
-	newProductInfo, err := productColl.Find(&commonrepo.ProductFindOptions{
+const (
+	ServiceGroupChangeAdded     = "added"
+	ServiceGroupChangeRemoved   = "removed"
+	ServiceGroupChangeReordered = "reordered"
+	ServiceGroupChangeUnchanged = "unchanged"
+)
+
+type ServiceGroupDiff struct {
+	ServiceName           string `json:"service_name"`
+	ReleaseName           string `json:"release_name,omitempty"`
+	Change                string `json:"change"`
+	DeployStrategyChanged bool   `json:"deploy_strategy_changed"`
+}
+
+// SetDeployStrategiesBulk sets the deploy strategies of services in environment in one transaction,
+// the keys of strategies are service names for zadig services and release names for chart services.
+// The full deploy strategy map of the environment is returned.
+func SetDeployStrategiesBulk(ctx context.Context, productName, envName string, strategies map[string]string, production bool, user string) (map[string]string, error) {
+	if err := validateDeployStrategies(strategies); err != nil {
+		return nil, err
+	}
+
+	session := newHelmEnvSession(ctx)
+	defer session.EndSession(session)
+
+	err := mongo.StartTransaction(session)
+	if err != nil {
+		return nil, err
+	}
+
+	productColl := commonrepo.NewProductCollWithSession(session)
+
+	unlockEnv, err := lockHelmEnv(ctx, productName, envName, user)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, err
+	}
+	defer unlockEnv()
+
+	productInfo, err := productColl.Find(&commonrepo.ProductFindOptions{
 		Name:       productName,
 		EnvName:    envName,
 		Production: &production,
 	})
 	if err != nil {
 		mongo.AbortTransaction(session)
-		return errors.Wrapf(err, "failed to find environment %s/%s", productName, envName)
+		return nil, errors.Wrapf(err, "failed to find environment %s/%s", productName, envName)
 	}
 
-	envSvcMap := newProductInfo.GetServiceMap()
-	for i, svc := range newGroup {
-		envSvc := envSvcMap[svc.ServiceName]
-		if envSvc != nil {
-			if envSvc.UpdateTime > svc.UpdateTime {
-				newGroup[i] = envSvc
-				log.Warnf("service %s in environment %s/%s is newer than the service in update request, ignore the update", svc.ServiceName, productName, envName)
-			}
+	auditServices, err := applyDeployStrategies(productInfo, strategies)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, err
+	}
+
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return nil, err
+	}
+	if err = productColl.UpdateDeployStrategy(envName, productName, productInfo.ServiceDeployStrategy); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to update deploy strategies of %s/%s", productName, envName)
+	}
+
+	auditEvent := newHelmEnvAuditEvent(productInfo, commonmodels.HelmEnvAuditOperationSetDeployStrategies, user)
+	auditEvent.Services = auditServices
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to create audit event of %s/%s", productName, envName)
+	}
+
+	if err = commitIfNotCancelled(ctx, session, auditEvent); err != nil {
+		return nil, err
+	}
+	return productInfo.ServiceDeployStrategy, nil
+}
+
+func validateDeployStrategies(strategies map[string]string) error {
+	for _, name := range sets.StringKeySet(strategies).List() {
+		strategy := strategies[name]
+		if strategy != setting.ServiceDeployStrategyDeploy && strategy != setting.ServiceDeployStrategyImport {
+			return fmt.Errorf("invalid deploy strategy %q of service %s", strategy, name)
 		}
 	}
+	return nil
+}
 
-	if err = productColl.UpdateServicesGroup(productName, envName, index, newGroup); err != nil {
-		err = fmt.Errorf("failed to update %s/%s product services, err %s", productName, envName, err)
+// applyDeployStrategies sets the strategies in the deploy strategy map of env, it fails if a service is not in env
+func applyDeployStrategies(env *commonmodels.Product, strategies map[string]string) ([]*commonmodels.HelmEnvAuditService, error) {
+	svcMap := env.GetServiceMap()
+	chartSvcMap := env.GetChartServiceMap()
+
+	auditServices := make([]*commonmodels.HelmEnvAuditService, 0, len(strategies))
+	for _, name := range sets.StringKeySet(strategies).List() {
+		strategy := strategies[name]
+		svc := svcMap[name]
+		if svc == nil {
+			svc = chartSvcMap[name]
+		}
+		if svc == nil {
+			return nil, fmt.Errorf("service %s is not in environment %s/%s", name, env.ProductName, env.EnvName)
+		}
+
+		prevDeployStrategy := getHelmServiceDeployStrategy(svc, env.ServiceDeployStrategy)
+		switch {
+		case svc.FromZadig() && strategy == setting.ServiceDeployStrategyDeploy:
+			env.ServiceDeployStrategy = commonutil.SetServiceDeployStrategyDepoly(env.ServiceDeployStrategy, svc.ServiceName)
+		case svc.FromZadig():
+			env.ServiceDeployStrategy = commonutil.SetServiceDeployStrategyImport(env.ServiceDeployStrategy, svc.ServiceName)
+		case strategy == setting.ServiceDeployStrategyDeploy:
+			env.ServiceDeployStrategy = commonutil.SetChartServiceDeployStrategyDepoly(env.ServiceDeployStrategy, svc.ReleaseName)
+		default:
+			env.ServiceDeployStrategy = commonutil.SetChartServiceDeployStrategyImport(env.ServiceDeployStrategy, svc.ReleaseName)
+		}
+
+		auditServices = append(auditServices, &commonmodels.HelmEnvAuditService{
+			ServiceName:        svc.ServiceName,
+			ReleaseName:        svc.ReleaseName,
+			PrevDeployStrategy: prevDeployStrategy,
+			DeployStrategy:     strategy,
+		})
+	}
+	return auditServices, nil
+}
+
+// RemoveHelmServiceFromEnv removes a service from the groups of the environment, serviceOrReleaseName is the service
+// name of a zadig service or the release name of a chart service. The deploy strategy of the service is removed and a
+// removal version is recorded, so that rolling back to a later version does not bring it back. The release is not
+// uninstalled from the cluster.
+func RemoveHelmServiceFromEnv(ctx context.Context, productName, envName, serviceOrReleaseName string, production bool, user string) error {
+	session := newHelmEnvSession(ctx)
+	defer session.EndSession(session)
+
+	err := mongo.StartTransaction(session)
+	if err != nil {
+		return err
+	}
+
+	unlockEnv, err := lockHelmEnv(ctx, productName, envName, user)
+	if err != nil {
 		mongo.AbortTransaction(session)
-		log.Error(err)
 		return err
 	}
+	defer unlockEnv()
+
+	productColl := commonrepo.NewProductCollWithSession(session)
+	productInfo, err := productColl.Find(&commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return wrapFindError(err, ErrProductNotFound, "failed to find environment %s/%s", productName, envName)
+	}
+
+	removedSvc, services, err := removeServiceFromGroups(productInfo.Services, serviceOrReleaseName)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return errors.Wrapf(err, "failed to remove service from environment %s/%s", productName, envName)
+	}
+	productInfo.Services = services
+
+	if err = commonutil.CreateEnvServiceVersion(productInfo, removedSvc, user, config.EnvOperationDelete, "remove service from environment", session, log.SugaredLogger()); err != nil {
+		mongo.AbortTransaction(session)
+		return errors.Wrapf(err, "failed to create removal version of %s", serviceOrReleaseName)
+	}
+
+	auditService := &commonmodels.HelmEnvAuditService{
+		ServiceName:        removedSvc.ServiceName,
+		ReleaseName:        removedSvc.ReleaseName,
+		PrevDeployStrategy: getHelmServiceDeployStrategy(removedSvc, productInfo.ServiceDeployStrategy),
+	}
+	if removedSvc.FromZadig() {
+		delete(productInfo.ServiceDeployStrategy, removedSvc.ServiceName)
+	} else {
+		delete(productInfo.ServiceDeployStrategy, commonutil.GetReleaseDeployStrategyKey(removedSvc.ReleaseName))
+	}
+
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return err
+	}
+	if err = productColl.Update(productInfo); err != nil {
+		mongo.AbortTransaction(session)
+		return errors.Wrapf(err, "failed to update %s/%s product services", productName, envName)
+	}
+
+	auditEvent := newHelmEnvAuditEvent(productInfo, commonmodels.HelmEnvAuditOperationRemoveService, user)
+	auditEvent.Services = []*commonmodels.HelmEnvAuditService{auditService}
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return errors.Wrapf(err, "failed to create audit event of %s/%s", productName, envName)
+	}
+
+	return commitIfNotCancelled(ctx, session, auditEvent)
+}
+
+// removeServiceFromGroups removes the zadig service named name, or the chart service released as name if there is no
+// such zadig service, from the groups. The groups are kept even if they become empty.
+func removeServiceFromGroups(groups [][]*commonmodels.ProductService, name string) (*commonmodels.ProductService, [][]*commonmodels.ProductService, error) {
+	find := func(match func(svc *commonmodels.ProductService) bool) (int, int) {
+		for i, group := range groups {
+			for j, svc := range group {
+				if match(svc) {
+					return i, j
+				}
+			}
+		}
+		return -1, -1
+	}
+	groupIndex, svcIndex := find(func(svc *commonmodels.ProductService) bool {
+		return svc.FromZadig() && svc.ServiceName == name
+	})
+	if groupIndex < 0 {
+		groupIndex, svcIndex = find(func(svc *commonmodels.ProductService) bool {
+			return !svc.FromZadig() && svc.ReleaseName == name
+		})
+	}
+	if groupIndex < 0 {
+		return nil, nil, fmt.Errorf("service %s is not in the environment", name)
+	}
 
-	return mongo.CommitTransaction(session)
+	removedSvc := groups[groupIndex][svcIndex]
+	result := make([][]*commonmodels.ProductService, 0, len(groups))
+	for i, group := range groups {
+		if i != groupIndex {
+			result = append(result, group)
+			continue
+		}
+		newGroup := make([]*commonmodels.ProductService, 0, len(group)-1)
+		newGroup = append(newGroup, group[:svcIndex]...)
+		newGroup = append(newGroup, group[svcIndex+1:]...)
+		result = append(result, newGroup)
+	}
+	return removedSvc, result, nil
+}
+
+// getServiceOrchestration returns the service groups of the production or the test environments of the project
+func getServiceOrchestration(templateProduct *templatemodels.Product, production bool) [][]string {
+	if production {
+		return templateProduct.ProductionServices
+	}
+	return templateProduct.Services
+}
+
+// GetOrchestrationServiceNames returns the services of the test and the production environments of the project, in
+// the order of the service groups. It only reads the project and does not lock any environment.
+func GetOrchestrationServiceNames(productName string) (test []string, production []string, err error) {
+	templateProduct, err := template.NewProductColl().Find(productName)
+	if err != nil {
+		return nil, nil, wrapFindError(err, ErrTemplateNotFound, "failed to find template product %s", productName)
+	}
+	return flattenServiceOrchestration(getServiceOrchestration(templateProduct, false)),
+		flattenServiceOrchestration(getServiceOrchestration(templateProduct, true)), nil
+}
+
+// flattenServiceOrchestration returns the services in the order of the groups, a service in several groups is only
+// returned for the first of them
+func flattenServiceOrchestration(serviceOrchestration [][]string) []string {
+	serviceNames := make([]string, 0)
+	seen := sets.NewString()
+	for _, group := range serviceOrchestration {
+		for _, serviceName := range group {
+			if seen.Has(serviceName) {
+				continue
+			}
+			seen.Insert(serviceName)
+			serviceNames = append(serviceNames, serviceName)
+		}
+	}
+	return serviceNames
+}
+
+// DiffServicesGroupInEnv returns what UpdateServicesGroupInEnv would change in the services group, nothing is written
+func DiffServicesGroupInEnv(productName, envName string, index int, group []*models.ProductService, production bool) ([]*ServiceGroupDiff, error) {
+	templateProduct, err := template.NewProductColl().Find(productName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find template product %s", productName)
+	}
+
+	serviceOrchestration := getServiceOrchestration(templateProduct, production)
+
+	productInfo, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find environment %s/%s", productName, envName)
+	}
+
+	currentGroup := []*commonmodels.ProductService{}
+	if index >= 0 && index < len(productInfo.Services) {
+		currentGroup = productInfo.Services[index]
+	}
+
+	return diffServicesGroup(currentGroup, orderServicesGroup(serviceOrchestration, group), productInfo.ServiceDeployStrategy), nil
+}
+
+func diffServicesGroup(currentGroup, newGroup []*commonmodels.ProductService, strategyMap map[string]string) []*ServiceGroupDiff {
+	groupKey := func(svc *commonmodels.ProductService) string {
+		if svc.FromZadig() {
+			return svc.ServiceName
+		}
+		return commonutil.GetReleaseDeployStrategyKey(svc.ReleaseName)
+	}
+
+	currentSvcSet := sets.NewString()
+	for _, svc := range currentGroup {
+		currentSvcSet.Insert(groupKey(svc))
+	}
+	newSvcSet := sets.NewString()
+	for _, svc := range newGroup {
+		newSvcSet.Insert(groupKey(svc))
+	}
+
+	// only services from zadig are compared for reordering, chart services are not ordered by the service orchestration
+	currentOrder, newOrder := make(map[string]int), make(map[string]int)
+	for _, svc := range currentGroup {
+		if svc.FromZadig() && newSvcSet.Has(svc.ServiceName) {
+			currentOrder[svc.ServiceName] = len(currentOrder)
+		}
+	}
+	for _, svc := range newGroup {
+		if svc.FromZadig() && currentSvcSet.Has(svc.ServiceName) {
+			newOrder[svc.ServiceName] = len(newOrder)
+		}
+	}
+
+	resp := make([]*ServiceGroupDiff, 0)
+	for _, svc := range newGroup {
+		key := groupKey(svc)
+		diff := &ServiceGroupDiff{
+			ServiceName: svc.ServiceName,
+			ReleaseName: svc.ReleaseName,
+			Change:      ServiceGroupChangeUnchanged,
+		}
+		if !currentSvcSet.Has(key) {
+			diff.Change = ServiceGroupChangeAdded
+		} else if svc.FromZadig() && currentOrder[key] != newOrder[key] {
+			diff.Change = ServiceGroupChangeReordered
+		}
+
+		diff.DeployStrategyChanged = svc.DeployStrategy != "" && svc.DeployStrategy != getHelmServiceDeployStrategy(svc, strategyMap)
+		resp = append(resp, diff)
+	}
+	for _, svc := range currentGroup {
+		if !newSvcSet.Has(groupKey(svc)) {
+			resp = append(resp, &ServiceGroupDiff{
+				ServiceName: svc.ServiceName,
+				ReleaseName: svc.ReleaseName,
+				Change:      ServiceGroupChangeRemoved,
+			})
+		}
+	}
+	return resp
 }
 
 type HelmDeployService struct {
@@ -370,11 +1287,41 @@ func NewHelmDeployService() *HelmDeployService {
 	return &HelmDeployService{}
 }
 
+var getProjectBaseValues = func(projectName string) (string, error) {
+	if projectName == "" {
+		return "", nil
+	}
+	project, err := template.NewProductColl().Find(projectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to find project: %s, err: %s", projectName, err)
+	}
+	return project.BaseValues, nil
+}
+
 // GeneMergedValues generate values.yaml used to install or upgrade helm chart, like param in after option -f
 // defaultValues: global values yaml
 // productSvc: environment service, contains service's values yaml, override kvs and zadig recorded containers. And productSvc will be updated with correct image and values yaml in this function
 // images: ovrride images, used to deploy image feature in workflow and update container image feature in environment
+// the base values of the project are merged under the global values, precedence from low to high: base values, global values, service values, override kvs
 func (s *HelmDeployService) GenMergedValues(productSvc *commonmodels.ProductService, defaultValues string, images []string) (string, error) {
+	baseValues, err := getProjectBaseValues(productSvc.ProductName)
+	if err != nil {
+		return "", err
+	}
+	return s.genMergedValues(productSvc, baseValues, defaultValues, images)
+}
+
+// PreviewMergedValues returns the values.yaml the service would be deployed with if the base values of the project
+// were baseValues, productSvc is not changed and nothing is persisted
+func (s *HelmDeployService) PreviewMergedValues(productSvc *commonmodels.ProductService, baseValues, defaultValues string) (string, error) {
+	previewSvc := &commonmodels.ProductService{}
+	if err := util.DeepCopy(previewSvc, productSvc); err != nil {
+		return "", fmt.Errorf("failed to copy service %s, err: %s", productSvc.ServiceName, err)
+	}
+	return s.genMergedValues(previewSvc, baseValues, defaultValues, nil)
+}
+
+func (s *HelmDeployService) genMergedValues(productSvc *commonmodels.ProductService, baseValues, defaultValues string, images []string) (string, error) {
 	envValuesYaml := productSvc.GetServiceRender().GetOverrideYaml()
 	overrideKVs := productSvc.GetServiceRender().OverrideValues
 
@@ -458,7 +1405,7 @@ func (s *HelmDeployService) GenMergedValues(productSvc *commonmodels.ProductServ
 	productSvc.GetServiceRender().SetOverrideYaml(replacedEnvValuesYaml)
 
 	// 3. merge override values and kvs into values yaml
-	finalValuesYaml, err := helmtool.MergeOverrideValues("", defaultValues, replacedEnvValuesYaml, overrideKVs, nil)
+	finalValuesYaml, err := helmtool.MergeOverrideValues(baseValues, defaultValues, replacedEnvValuesYaml, overrideKVs, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to merge override values, err: %s", err)
 	}
@@ -0,0 +1,1017 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	templatemodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models/template"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
+	"github.com/koderover/zadig/v2/pkg/setting"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
+)
+
+func TestCheckEnvNotModified(t *testing.T) {
+	env := &commonmodels.Product{ProductName: "demo", EnvName: "dev", UpdateTime: 1700000100}
+
+	tests := []struct {
+		name       string
+		updateTime int64
+		wantErr    bool
+	}{
+		{name: "env not modified", updateTime: 1700000100},
+		{name: "stale update", updateTime: 1700000000, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEnvNotModified(env, tt.updateTime)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkEnvNotModified() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrConcurrentModification) {
+				t.Errorf("checkEnvNotModified() error = %v, want ErrConcurrentModification", err)
+			}
+		})
+	}
+}
+
+type fakeHelmEnvSession struct {
+	mongodriver.SessionContext
+}
+
+func (s *fakeHelmEnvSession) EndSession(context.Context) {}
+
+func TestUpdateAllServicesInEnvChecksUpdateTime(t *testing.T) {
+	log.Init(&log.Config{
+		Level: "error",
+	})
+
+	originSession, originLock := newHelmEnvSession, lockHelmEnv
+	originFindTemplate, originFindEnv, originUpdate := findTemplateProductWithSession, findEnvWithSession, updateEnvServicesWithSession
+	defer func() {
+		newHelmEnvSession, lockHelmEnv = originSession, originLock
+		findTemplateProductWithSession, findEnvWithSession, updateEnvServicesWithSession = originFindTemplate, originFindEnv, originUpdate
+	}()
+
+	newHelmEnvSession = func(ctx context.Context) mongodriver.SessionContext {
+		return &fakeHelmEnvSession{}
+	}
+	lockHelmEnv = func(ctx context.Context, productName, envName, holder string) (func(), error) {
+		return func() {}, nil
+	}
+	findTemplateProductWithSession = func(session mongodriver.Session, productName string) (*templatemodels.Product, error) {
+		return &templatemodels.Product{ProductName: productName}, nil
+	}
+	findEnvWithSession = func(session mongodriver.Session, opt *commonrepo.ProductFindOptions) (*commonmodels.Product, error) {
+		return &commonmodels.Product{ProductName: opt.Name, EnvName: opt.EnvName, UpdateTime: 1700000100}, nil
+	}
+	errWrite := errors.New("write stopped by test")
+	var written bool
+	updateEnvServicesWithSession = func(session mongodriver.Session, productName, envName string, services [][]*commonmodels.ProductService) error {
+		written = true
+		return errWrite
+	}
+
+	services := [][]*commonmodels.ProductService{{{ServiceName: "web", ReleaseName: "web", Type: setting.HelmDeployType}}}
+	tests := []struct {
+		name        string
+		updateTime  int64
+		wantErr     error
+		wantWritten bool
+	}{
+		{name: "stale update is aborted before any write", updateTime: 1700000000, wantErr: ErrConcurrentModification},
+		{name: "update of the read env is written", updateTime: 1700000100, wantErr: errWrite, wantWritten: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			written = false
+			_, err := UpdateAllServicesInEnv(context.Background(), "demo", "dev", services, false, tt.updateTime, "admin", EnvServicesMergeModeReplace)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateAllServicesInEnv() error = %v, want %v", err, tt.wantErr)
+			}
+			if written != tt.wantWritten {
+				t.Errorf("UpdateAllServicesInEnv() writes the env: %v, want %v", written, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestSanitizeHelmRepos(t *testing.T) {
+	helmRepos := []*commonmodels.HelmRepo{
+		{RepoName: "charts", Username: "admin", Password: "secret", Projects: []string{"demo"}},
+	}
+
+	sanitized := sanitizeHelmRepos(helmRepos)
+	if len(sanitized) != 1 {
+		t.Fatalf("sanitizeHelmRepos() returns %d repos, want 1", len(sanitized))
+	}
+	if sanitized[0].Password != "" || sanitized[0].Projects != nil {
+		t.Errorf("sanitizeHelmRepos() keeps credentials: %+v", sanitized[0])
+	}
+	if sanitized[0].RepoName != "charts" || sanitized[0].Username != "admin" {
+		t.Errorf("sanitizeHelmRepos() drops repo info: %+v", sanitized[0])
+	}
+	// repos listed for internal usage must keep the credentials
+	if helmRepos[0].Password != "secret" || len(helmRepos[0].Projects) != 1 {
+		t.Errorf("internal repos are modified: %+v", helmRepos[0])
+	}
+}
+
+func TestUpsertEnvServices(t *testing.T) {
+	current := [][]*commonmodels.ProductService{
+		{{ServiceName: "mysql", Revision: 1}, {ServiceName: "redis", Revision: 1}},
+		{{ServiceName: "backend", Revision: 1}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType, Revision: 1}},
+	}
+	services := [][]*commonmodels.ProductService{
+		{{ServiceName: "redis", Revision: 2}, {ServiceName: "frontend", Revision: 1}},
+	}
+	orchestration := [][]string{{"mysql", "redis"}, {"backend", "frontend"}}
+
+	got := upsertEnvServices(current, services, orchestration)
+
+	type svcInfo struct {
+		name     string
+		revision int64
+	}
+	want := [][]svcInfo{
+		{{"mysql", 1}, {"redis", 2}},
+		{{"backend", 1}, {"nginx", 1}, {"frontend", 1}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("upsertEnvServices() returns %d groups, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("group %d has %d services, want %d", i, len(got[i]), len(want[i]))
+		}
+		for j, svc := range got[i] {
+			name := svc.ServiceName
+			if !svc.FromZadig() {
+				name = svc.ReleaseName
+			}
+			if name != want[i][j].name || svc.Revision != want[i][j].revision {
+				t.Errorf("group %d service %d = %s revision %d, want %s revision %d", i, j, name, svc.Revision, want[i][j].name, want[i][j].revision)
+			}
+		}
+	}
+}
+
+func TestListHelmReposByProjectPaging(t *testing.T) {
+	helmRepos := make([]*commonmodels.HelmRepo, 0, 25)
+	for i := 0; i < 25; i++ {
+		helmRepos = append(helmRepos, &commonmodels.HelmRepo{
+			RepoName: fmt.Sprintf("repo-%02d", i),
+			URL:      "https://charts.example.com",
+			Password: "secret",
+			Projects: []string{"demo"},
+		})
+	}
+
+	origin := listHelmReposByProjectFromDB
+	defer func() { listHelmReposByProjectFromDB = origin }()
+	listHelmReposByProjectFromDB = func(projectName string, offset, limit int64) ([]*commonmodels.HelmRepo, int64, error) {
+		total := int64(len(helmRepos))
+		if limit == 0 {
+			return helmRepos, total, nil
+		}
+		end := offset + limit
+		if offset > total {
+			offset = total
+		}
+		if end > total {
+			end = total
+		}
+		return helmRepos[offset:end], total, nil
+	}
+
+	log := zap.NewNop().Sugar()
+	seen := make(map[string]bool)
+	pageSizes := []int{}
+	for offset := int64(0); ; offset += 10 {
+		page, total, err := ListHelmReposByProject("demo", offset, 10, false, log)
+		if err != nil {
+			t.Fatalf("ListHelmReposByProject() error = %v", err)
+		}
+		if total != 25 {
+			t.Fatalf("ListHelmReposByProject() total = %d, want 25", total)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pageSizes = append(pageSizes, len(page))
+		for _, repo := range page {
+			if repo.Password != "" || repo.Projects != nil {
+				t.Errorf("repo %s is not sanitized", repo.RepoName)
+			}
+			if seen[repo.RepoName] {
+				t.Errorf("repo %s is returned more than once", repo.RepoName)
+			}
+			seen[repo.RepoName] = true
+		}
+	}
+	if fmt.Sprint(pageSizes) != "[10 10 5]" {
+		t.Errorf("page sizes = %v, want [10 10 5]", pageSizes)
+	}
+	if len(seen) != 25 {
+		t.Errorf("got %d repos in all pages, want 25", len(seen))
+	}
+
+	all, _, err := ListHelmReposByProject("demo", 0, 0, false, log)
+	if err != nil {
+		t.Fatalf("ListHelmReposByProject() error = %v", err)
+	}
+	if len(all) != 25 {
+		t.Errorf("ListHelmReposByProject() with limit 0 returns %d repos, want 25", len(all))
+	}
+	if helmRepos[0].Password != "secret" {
+		t.Errorf("ListHelmReposByProject() modified the repos from db")
+	}
+}
+
+func TestCheckDuplicateReleaseNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		services [][]*commonmodels.ProductService
+		wantErr  string
+	}{
+		{
+			name: "unique release names",
+			services: [][]*commonmodels.ProductService{
+				{{ServiceName: "mysql"}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+				{{ReleaseName: "redis", Type: setting.HelmChartDeployType}},
+			},
+		},
+		{
+			name: "release name shared by two chart services",
+			services: [][]*commonmodels.ProductService{
+				{{ReleaseName: "nginx", Type: setting.HelmChartDeployType, Revision: 1}},
+				{{ServiceName: "mysql"}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType, Revision: 2}},
+			},
+			wantErr: "duplicate release names: nginx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDuplicateReleaseNames(tt.services)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkDuplicateReleaseNames() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkDuplicateReleaseNames() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServicesFromVersions(t *testing.T) {
+	versions := []*commonmodels.EnvServiceVersion{
+		{Revision: 1, Service: &commonmodels.ProductService{ServiceName: "mysql", Revision: 1}},
+		{Revision: 1, Service: &commonmodels.ProductService{ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+		{Revision: 2, Service: &commonmodels.ProductService{ServiceName: "mysql", Revision: 3}},
+		{Revision: 1, Service: &commonmodels.ProductService{ServiceName: "redis", Revision: 2}},
+	}
+
+	got := servicesFromVersions(versions)
+	if len(got) != 1 || len(got[0]) != 3 {
+		t.Fatalf("servicesFromVersions() = %v, want 1 group with 3 services", got)
+	}
+	if svc := got[0][0]; svc.ServiceName != "mysql" || svc.Revision != 3 {
+		t.Errorf("first service = %s revision %d, want mysql revision 3", svc.ServiceName, svc.Revision)
+	}
+	if svc := got[0][1]; svc.ReleaseName != "nginx" {
+		t.Errorf("second service = %s, want chart nginx", svc.ReleaseName)
+	}
+	if svc := got[0][2]; svc.ServiceName != "redis" || svc.Revision != 2 {
+		t.Errorf("third service = %s revision %d, want redis revision 2", svc.ServiceName, svc.Revision)
+	}
+
+	versions = append(versions,
+		&commonmodels.EnvServiceVersion{Revision: 3, Operation: config.EnvOperationDelete, Service: &commonmodels.ProductService{ServiceName: "mysql", Revision: 3}},
+		&commonmodels.EnvServiceVersion{Revision: 2, Operation: config.EnvOperationDelete, Service: &commonmodels.ProductService{ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+		&commonmodels.EnvServiceVersion{Revision: 3, Service: &commonmodels.ProductService{ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+	)
+	got = servicesFromVersions(versions)
+	if len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("servicesFromVersions() = %v, want 1 group with 2 services after mysql is removed", got)
+	}
+	if svc := got[0][0]; svc.ReleaseName != "nginx" {
+		t.Errorf("first service = %s, want chart nginx added back after its removal", svc.ReleaseName)
+	}
+}
+
+func TestApplyDeployStrategies(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategies   map[string]string
+		wantStrategy map[string]string
+		wantErr      bool
+	}{
+		{
+			name:       "set services and releases",
+			strategies: map[string]string{"mysql": setting.ServiceDeployStrategyImport, "nginx": setting.ServiceDeployStrategyDeploy},
+			wantStrategy: map[string]string{
+				"mysql": setting.ServiceDeployStrategyImport,
+				commonutil.GetReleaseDeployStrategyKey("nginx"): setting.ServiceDeployStrategyDeploy,
+			},
+		},
+		{
+			name:       "invalid strategy",
+			strategies: map[string]string{"mysql": "skip"},
+			wantErr:    true,
+		},
+		{
+			name:       "service not in env",
+			strategies: map[string]string{"redis": setting.ServiceDeployStrategyImport},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &commonmodels.Product{
+				ProductName: "demo",
+				EnvName:     "dev",
+				Services: [][]*commonmodels.ProductService{
+					{{ServiceName: "mysql"}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+				},
+			}
+			err := validateDeployStrategies(tt.strategies)
+			if err == nil {
+				_, err = applyDeployStrategies(env, tt.strategies)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyDeployStrategies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for key, strategy := range tt.wantStrategy {
+				if env.ServiceDeployStrategy[key] != strategy {
+					t.Errorf("strategy of %s = %s, want %s", key, env.ServiceDeployStrategy[key], strategy)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeChartIndex(t *testing.T) {
+	index := &repo.IndexFile{
+		Entries: map[string]repo.ChartVersions{
+			"nginx": {
+				{Metadata: &chart.Metadata{Name: "nginx", Version: "1.0.0"}},
+				{Metadata: &chart.Metadata{Name: "nginx", Version: "1.2.0", Dependencies: []*chart.Dependency{
+					{Name: "common", Version: "2.x", Repository: "https://charts.example.com"},
+				}}},
+			},
+			"empty": {},
+			"mysql": {
+				{Metadata: &chart.Metadata{Name: "mysql", Version: "8.0.0"}},
+			},
+		},
+	}
+
+	charts := summarizeChartIndex(index)
+	if len(charts) != 2 {
+		t.Fatalf("summarizeChartIndex() returns %d charts, want 2", len(charts))
+	}
+	if charts[0].Name != "mysql" || charts[0].Version != "8.0.0" || len(charts[0].Dependencies) != 0 {
+		t.Errorf("first chart = %+v, want mysql 8.0.0 without dependencies", charts[0])
+	}
+	if charts[1].Name != "nginx" || charts[1].Version != "1.2.0" {
+		t.Fatalf("second chart = %+v, want nginx 1.2.0", charts[1])
+	}
+	if len(charts[1].Dependencies) != 1 || charts[1].Dependencies[0].Name != "common" {
+		t.Errorf("dependencies of nginx = %+v, want common", charts[1].Dependencies)
+	}
+}
+
+func TestDiffServiceRegroups(t *testing.T) {
+	before := [][]*commonmodels.ProductService{
+		{{ServiceName: "backend"}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+		{{ServiceName: "mysql"}, {ServiceName: "frontend"}},
+	}
+	after := [][]*commonmodels.ProductService{
+		{{ServiceName: "mysql"}},
+		{{ServiceName: "backend"}, {ServiceName: "frontend"}, {ReleaseName: "nginx", Type: setting.HelmChartDeployType}},
+	}
+
+	regroups := diffServiceRegroups(before, after)
+	want := []ServiceRegroup{
+		{ServiceName: "backend", FromGroup: 0, ToGroup: 1},
+		{ReleaseName: "nginx", FromGroup: 0, ToGroup: 1},
+		{ServiceName: "mysql", FromGroup: 1, ToGroup: 0},
+	}
+	if len(regroups) != len(want) {
+		t.Fatalf("diffServiceRegroups() returns %d regroups, want %d", len(regroups), len(want))
+	}
+	for i, regroup := range regroups {
+		if *regroup != want[i] {
+			t.Errorf("regroup %d = %+v, want %+v", i, *regroup, want[i])
+		}
+	}
+}
+
+func TestDiffServicesGroup(t *testing.T) {
+	zadigSvc := func(name, strategy string) *commonmodels.ProductService {
+		return &commonmodels.ProductService{ServiceName: name, DeployStrategy: strategy}
+	}
+	chartSvc := func(releaseName, strategy string) *commonmodels.ProductService {
+		return &commonmodels.ProductService{ReleaseName: releaseName, Type: setting.HelmChartDeployType, DeployStrategy: strategy}
+	}
+	strategyMap := map[string]string{
+		"backend": setting.ServiceDeployStrategyImport,
+		commonutil.GetReleaseDeployStrategyKey("nginx"): setting.ServiceDeployStrategyImport,
+	}
+
+	tests := []struct {
+		name         string
+		currentGroup []*commonmodels.ProductService
+		newGroup     []*commonmodels.ProductService
+		want         []ServiceGroupDiff
+	}{
+		{
+			name:         "unchanged group",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("backend", ""), chartSvc("nginx", "")},
+			newGroup:     []*commonmodels.ProductService{zadigSvc("backend", ""), chartSvc("nginx", "")},
+			want: []ServiceGroupDiff{
+				{ServiceName: "backend", Change: ServiceGroupChangeUnchanged},
+				{ReleaseName: "nginx", Change: ServiceGroupChangeUnchanged},
+			},
+		},
+		{
+			name:         "added services",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("backend", "")},
+			newGroup:     []*commonmodels.ProductService{zadigSvc("backend", ""), zadigSvc("frontend", ""), chartSvc("redis", "")},
+			want: []ServiceGroupDiff{
+				{ServiceName: "backend", Change: ServiceGroupChangeUnchanged},
+				{ServiceName: "frontend", Change: ServiceGroupChangeAdded},
+				{ReleaseName: "redis", Change: ServiceGroupChangeAdded},
+			},
+		},
+		{
+			name:         "removed services",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("backend", ""), zadigSvc("frontend", ""), chartSvc("nginx", "")},
+			newGroup:     []*commonmodels.ProductService{zadigSvc("frontend", "")},
+			want: []ServiceGroupDiff{
+				{ServiceName: "frontend", Change: ServiceGroupChangeUnchanged},
+				{ServiceName: "backend", Change: ServiceGroupChangeRemoved},
+				{ReleaseName: "nginx", Change: ServiceGroupChangeRemoved},
+			},
+		},
+		{
+			name:         "reordered services",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("backend", ""), zadigSvc("frontend", ""), zadigSvc("mysql", "")},
+			newGroup:     []*commonmodels.ProductService{zadigSvc("frontend", ""), zadigSvc("backend", ""), zadigSvc("mysql", "")},
+			want: []ServiceGroupDiff{
+				{ServiceName: "frontend", Change: ServiceGroupChangeReordered},
+				{ServiceName: "backend", Change: ServiceGroupChangeReordered},
+				{ServiceName: "mysql", Change: ServiceGroupChangeUnchanged},
+			},
+		},
+		{
+			name:         "order is compared among the services in both groups",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("mysql", ""), zadigSvc("backend", ""), zadigSvc("frontend", "")},
+			newGroup:     []*commonmodels.ProductService{zadigSvc("gateway", ""), zadigSvc("backend", ""), zadigSvc("frontend", "")},
+			want: []ServiceGroupDiff{
+				{ServiceName: "gateway", Change: ServiceGroupChangeAdded},
+				{ServiceName: "backend", Change: ServiceGroupChangeUnchanged},
+				{ServiceName: "frontend", Change: ServiceGroupChangeUnchanged},
+				{ServiceName: "mysql", Change: ServiceGroupChangeRemoved},
+			},
+		},
+		{
+			name:         "chart services are not reordered",
+			currentGroup: []*commonmodels.ProductService{chartSvc("nginx", ""), chartSvc("redis", "")},
+			newGroup:     []*commonmodels.ProductService{chartSvc("redis", ""), chartSvc("nginx", "")},
+			want: []ServiceGroupDiff{
+				{ReleaseName: "redis", Change: ServiceGroupChangeUnchanged},
+				{ReleaseName: "nginx", Change: ServiceGroupChangeUnchanged},
+			},
+		},
+		{
+			name:         "deploy strategy changes",
+			currentGroup: []*commonmodels.ProductService{zadigSvc("backend", ""), zadigSvc("frontend", ""), chartSvc("nginx", "")},
+			newGroup: []*commonmodels.ProductService{
+				zadigSvc("backend", setting.ServiceDeployStrategyDeploy),
+				zadigSvc("frontend", setting.ServiceDeployStrategyDeploy),
+				chartSvc("nginx", setting.ServiceDeployStrategyDeploy),
+				chartSvc("redis", setting.ServiceDeployStrategyImport),
+			},
+			want: []ServiceGroupDiff{
+				{ServiceName: "backend", Change: ServiceGroupChangeUnchanged, DeployStrategyChanged: true},
+				{ServiceName: "frontend", Change: ServiceGroupChangeUnchanged},
+				{ReleaseName: "nginx", Change: ServiceGroupChangeUnchanged, DeployStrategyChanged: true},
+				{ReleaseName: "redis", Change: ServiceGroupChangeAdded, DeployStrategyChanged: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := diffServicesGroup(tt.currentGroup, tt.newGroup, strategyMap)
+			if len(diffs) != len(tt.want) {
+				t.Fatalf("diffServicesGroup() returns %d diffs, want %d", len(diffs), len(tt.want))
+			}
+			for i, diff := range diffs {
+				if *diff != tt.want[i] {
+					t.Errorf("diff %d = %+v, want %+v", i, *diff, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResetImportedServiceValues(t *testing.T) {
+	tests := []struct {
+		name               string
+		prevDeployStrategy string
+		deployStrategy     string
+		rerender           bool
+		wantReset          bool
+	}{
+		{
+			name:               "import to deploy with rerender",
+			prevDeployStrategy: setting.ServiceDeployStrategyImport,
+			deployStrategy:     setting.ServiceDeployStrategyDeploy,
+			rerender:           true,
+			wantReset:          true,
+		},
+		{
+			name:               "import to deploy without rerender",
+			prevDeployStrategy: setting.ServiceDeployStrategyImport,
+			deployStrategy:     setting.ServiceDeployStrategyDeploy,
+		},
+		{
+			name:               "deploy to deploy with rerender",
+			prevDeployStrategy: setting.ServiceDeployStrategyDeploy,
+			deployStrategy:     setting.ServiceDeployStrategyDeploy,
+			rerender:           true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &commonmodels.ProductService{
+				ServiceName:    "mysql",
+				ReleaseName:    "demo-mysql",
+				DeployStrategy: tt.deployStrategy,
+				Render: &templatemodels.ServiceRender{
+					ServiceName:    "mysql",
+					OverrideValues: `[{"key":"replicas","value":3}]`,
+					OverrideYaml:   &templatemodels.CustomYaml{YamlContent: "replicas: 3"},
+				},
+			}
+			if got := resetImportedServiceValues(svc, tt.prevDeployStrategy, tt.rerender); got != tt.wantReset {
+				t.Fatalf("resetImportedServiceValues() = %v, want %v", got, tt.wantReset)
+			}
+			reset := svc.Render.OverrideValues == "" && svc.Render.OverrideYaml.YamlContent == ""
+			if reset != tt.wantReset {
+				t.Errorf("values reset = %v, want %v", reset, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestGetServiceOrchestration(t *testing.T) {
+	templateProduct := &templatemodels.Product{
+		Services:           [][]string{{"mysql", "redis"}, {"backend", "frontend"}, {"redis"}},
+		ProductionServices: [][]string{{"mysql"}, {"backend"}},
+	}
+
+	tests := []struct {
+		name       string
+		production bool
+		want       string
+	}{
+		{name: "test orchestration", want: "[mysql redis backend frontend]"},
+		{name: "production orchestration", production: true, want: "[mysql backend]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := flattenServiceOrchestration(getServiceOrchestration(templateProduct, tt.production))
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("flattenServiceOrchestration() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveServiceFromGroups(t *testing.T) {
+	groups := func() [][]*commonmodels.ProductService {
+		return [][]*commonmodels.ProductService{
+			{{ServiceName: "mysql"}, {ServiceName: "redis"}},
+			{{ServiceName: "nginx", ReleaseName: "nginx", Type: setting.HelmChartDeployType}, {ServiceName: "backend", ReleaseName: "nginx"}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		wantRelease bool
+		want        string
+		wantErr     bool
+	}{
+		{name: "zadig service", target: "redis", want: "[[mysql] [nginx backend]]"},
+		{name: "zadig service preferred over chart service", target: "backend", want: "[[mysql redis] [nginx]]"},
+		{name: "chart service by release name", target: "nginx", wantRelease: true, want: "[[mysql redis] [backend]]"},
+		{name: "last service of group", target: "mysql", want: "[[redis] [nginx backend]]"},
+		{name: "not in env", target: "frontend", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, got, err := removeServiceFromGroups(groups(), tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("removeServiceFromGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if removed.FromZadig() == tt.wantRelease {
+				t.Errorf("removeServiceFromGroups() removed %+v, want chart service %v", removed, tt.wantRelease)
+			}
+			names := make([][]string, 0, len(got))
+			for _, group := range got {
+				groupNames := make([]string, 0, len(group))
+				for _, svc := range group {
+					groupNames = append(groupNames, svc.ServiceName)
+				}
+				names = append(names, groupNames)
+			}
+			if fmt.Sprint(names) != tt.want {
+				t.Errorf("removeServiceFromGroups() = %v, want %s", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHelmRepoPasswords(t *testing.T) {
+	origin := getHelmRepoSecretData
+	defer func() { getHelmRepoSecretData = origin }()
+	getHelmRepoSecretData = func(clusterID, namespace, name string) (map[string][]byte, error) {
+		if name == "forbidden" {
+			return nil, fmt.Errorf("secrets %q is forbidden", name)
+		}
+		return map[string][]byte{"password": []byte("from-secret")}, nil
+	}
+
+	secretRef := func(name, key string) *commonmodels.HelmRepoSecretRef {
+		return &commonmodels.HelmRepoSecretRef{ClusterID: "local", Namespace: "zadig", Name: name, Key: key}
+	}
+	helmRepos := []*commonmodels.HelmRepo{
+		{RepoName: "stored", Password: "stored"},
+		{RepoName: "secret", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret, SecretRef: secretRef("charts", "password")},
+		{RepoName: "missing-key", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret, SecretRef: secretRef("charts", "token")},
+		{RepoName: "forbidden", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret, SecretRef: secretRef("forbidden", "password")},
+		{RepoName: "no-ref", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret},
+	}
+	resolveHelmRepoPasswords(helmRepos)
+
+	want := map[string]struct {
+		password string
+		hasError bool
+	}{
+		"stored":      {password: "stored"},
+		"secret":      {password: "from-secret"},
+		"missing-key": {hasError: true},
+		"forbidden":   {hasError: true},
+		"no-ref":      {hasError: true},
+	}
+	for _, helmRepo := range helmRepos {
+		w := want[helmRepo.RepoName]
+		if helmRepo.Password != w.password {
+			t.Errorf("password of %s = %q, want %q", helmRepo.RepoName, helmRepo.Password, w.password)
+		}
+		if (helmRepo.CredentialError != "") != w.hasError {
+			t.Errorf("credential error of %s = %q, want error: %v", helmRepo.RepoName, helmRepo.CredentialError, w.hasError)
+		}
+	}
+}
+
+func TestFindHelmRepoWithCredential(t *testing.T) {
+	originSecret, originFind := getHelmRepoSecretData, findHelmRepo
+	defer func() { getHelmRepoSecretData, findHelmRepo = originSecret, originFind }()
+	getHelmRepoSecretData = func(clusterID, namespace, name string) (map[string][]byte, error) {
+		if name == "forbidden" {
+			return nil, fmt.Errorf("secrets %q is forbidden", name)
+		}
+		return map[string][]byte{"password": []byte("from-secret")}, nil
+	}
+	secretRef := func(name string) *commonmodels.HelmRepoSecretRef {
+		return &commonmodels.HelmRepoSecretRef{ClusterID: "local", Namespace: "zadig", Name: name, Key: "password"}
+	}
+	helmRepos := map[string]*commonmodels.HelmRepo{
+		"stored":    {RepoName: "stored", Password: "stored"},
+		"secret":    {RepoName: "secret", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret, SecretRef: secretRef("charts")},
+		"forbidden": {RepoName: "forbidden", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret, SecretRef: secretRef("forbidden")},
+	}
+	findHelmRepo = func(opt *commonrepo.HelmRepoFindOption) (*commonmodels.HelmRepo, error) {
+		helmRepo, ok := helmRepos[opt.RepoName]
+		if !ok {
+			return nil, mongodriver.ErrNoDocuments
+		}
+		repo := *helmRepo
+		return &repo, nil
+	}
+
+	tests := []struct {
+		repoName     string
+		wantPassword string
+		wantErr      bool
+	}{
+		{repoName: "stored", wantPassword: "stored"},
+		{repoName: "secret", wantPassword: "from-secret"},
+		{repoName: "forbidden", wantErr: true},
+		{repoName: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repoName, func(t *testing.T) {
+			helmRepo, err := FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: tt.repoName})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindHelmRepoWithCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && helmRepo.Password != tt.wantPassword {
+				t.Errorf("FindHelmRepoWithCredential() password = %q, want %q", helmRepo.Password, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestListHelmReposByProjectInternal(t *testing.T) {
+	originSecret, originList := getHelmRepoSecretData, listHelmReposByProjectFromDB
+	defer func() { getHelmRepoSecretData, listHelmReposByProjectFromDB = originSecret, originList }()
+	getHelmRepoSecretData = func(clusterID, namespace, name string) (map[string][]byte, error) {
+		return map[string][]byte{"password": []byte("from-secret")}, nil
+	}
+	listHelmReposByProjectFromDB = func(projectName string, offset, limit int64) ([]*commonmodels.HelmRepo, int64, error) {
+		return []*commonmodels.HelmRepo{
+			{RepoName: "stored", Password: "stored"},
+			{RepoName: "secret", CredentialSource: commonmodels.HelmRepoCredentialSourceK8sSecret,
+				SecretRef: &commonmodels.HelmRepoSecretRef{ClusterID: "local", Namespace: "zadig", Name: "charts", Key: "password"}},
+		}, 2, nil
+	}
+
+	helmRepos, err := ListHelmReposByProjectInternal("demo")
+	if err != nil {
+		t.Fatalf("ListHelmReposByProjectInternal() error = %v", err)
+	}
+	for _, helmRepo := range helmRepos {
+		if want := map[string]string{"stored": "stored", "secret": "from-secret"}[helmRepo.RepoName]; helmRepo.Password != want {
+			t.Errorf("password of %s = %q, want %q", helmRepo.RepoName, helmRepo.Password, want)
+		}
+	}
+}
+
+func TestGenMergedValuesWithBaseValues(t *testing.T) {
+	origin := getProjectBaseValues
+	defer func() { getProjectBaseValues = origin }()
+	getProjectBaseValues = func(projectName string) (string, error) {
+		return `
+image:
+  registry: registry.example.com
+  tag: base
+resources:
+  limits:
+    cpu: 500m
+    memory: 1Gi
+env:
+  LOG_LEVEL: info
+`, nil
+	}
+
+	defaultValues := `
+resources:
+  limits:
+    memory: 2Gi
+env:
+  REGION: cn
+`
+	serviceValues := `
+image:
+  tag: v2
+env:
+  LOG_LEVEL: debug
+`
+	want := map[string]interface{}{
+		"image": map[string]interface{}{"registry": "registry.example.com", "tag": "v2"},
+		"resources": map[string]interface{}{
+			"limits": map[string]interface{}{"cpu": "500m", "memory": "2Gi"},
+		},
+		"env": map[string]interface{}{"LOG_LEVEL": "debug", "REGION": "cn"},
+	}
+
+	newProductSvc := func() *commonmodels.ProductService {
+		return &commonmodels.ProductService{
+			ProductName: "demo",
+			ServiceName: "api",
+			Render: &templatemodels.ServiceRender{
+				ServiceName:  "api",
+				OverrideYaml: &templatemodels.CustomYaml{YamlContent: serviceValues},
+			},
+		}
+	}
+	checkValues := func(name, values string) {
+		got := make(map[string]interface{})
+		if err := yaml.Unmarshal([]byte(values), &got); err != nil {
+			t.Fatalf("%s returns invalid yaml: %s", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	mergedValues, err := NewHelmDeployService().GenMergedValues(newProductSvc(), defaultValues, nil)
+	if err != nil {
+		t.Fatalf("GenMergedValues() error = %v", err)
+	}
+	checkValues("GenMergedValues()", mergedValues)
+
+	productSvc := newProductSvc()
+	previewValues, err := NewHelmDeployService().PreviewMergedValues(productSvc, "image:\n  registry: mirror.example.com\n", defaultValues)
+	if err != nil {
+		t.Fatalf("PreviewMergedValues() error = %v", err)
+	}
+	want["image"] = map[string]interface{}{"registry": "mirror.example.com", "tag": "v2"}
+	delete(want["resources"].(map[string]interface{})["limits"].(map[string]interface{}), "cpu")
+	checkValues("PreviewMergedValues()", previewValues)
+	if productSvc.GetServiceRender().GetOverrideYaml() != serviceValues {
+		t.Errorf("PreviewMergedValues() changes the values of the service: %s", productSvc.GetServiceRender().GetOverrideYaml())
+	}
+}
+
+func TestListEnvsUsingHelmRepo(t *testing.T) {
+	origin := listEnvsByChartRepo
+	defer func() { listEnvsByChartRepo = origin }()
+
+	chartSvc := func(repoName string) *commonmodels.ProductService {
+		return &commonmodels.ProductService{Render: &templatemodels.ServiceRender{ChartRepo: repoName}}
+	}
+	listEnvsByChartRepo = func(repoName string) ([]*commonmodels.Product, error) {
+		return []*commonmodels.Product{
+			{ProductName: "demo", EnvName: "prod", Production: true, Services: [][]*commonmodels.ProductService{{chartSvc("charts")}}},
+			{ProductName: "demo", EnvName: "dev", Services: [][]*commonmodels.ProductService{{{}}, {chartSvc("other"), chartSvc("charts")}}},
+			// returned by a stale query, none of its services uses the repo anymore
+			{ProductName: "api", EnvName: "dev", Services: [][]*commonmodels.ProductService{{chartSvc("other")}}},
+		}, nil
+	}
+
+	envs, err := ListEnvsUsingHelmRepo("charts")
+	if err != nil {
+		t.Fatalf("ListEnvsUsingHelmRepo() error = %v", err)
+	}
+	want := []EnvRef{
+		{ProjectName: "demo", EnvName: "dev"},
+		{ProjectName: "demo", EnvName: "prod", Production: true},
+	}
+	if !reflect.DeepEqual(envs, want) {
+		t.Errorf("ListEnvsUsingHelmRepo() = %v, want %v", envs, want)
+	}
+
+	listEnvsByChartRepo = func(repoName string) ([]*commonmodels.Product, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if _, err := ListEnvsUsingHelmRepo("charts"); err == nil {
+		t.Errorf("ListEnvsUsingHelmRepo() should fail when the envs can not be listed")
+	}
+}
+
+type fakeEnvServiceVersionFinder struct {
+	versions []*commonmodels.EnvServiceVersion
+	err      error
+}
+
+func (f *fakeEnvServiceVersionFinder) Find(productName, envName, serviceName string, isHelmChart, production bool, revision int64) (*commonmodels.EnvServiceVersion, error) {
+	for _, version := range f.versions {
+		name := version.Service.ServiceName
+		if isHelmChart {
+			name = version.Service.ReleaseName
+		}
+		if name == serviceName && version.Revision == revision {
+			return version, nil
+		}
+	}
+	return nil, mongodriver.ErrNoDocuments
+}
+
+func (f *fakeEnvServiceVersionFinder) FindByIdempotencyKey(productName, envName string, production bool, idempotencyKey string) (*commonmodels.EnvServiceVersion, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, version := range f.versions {
+		if version.IdempotencyKey == idempotencyKey {
+			return version, nil
+		}
+	}
+	return nil, mongodriver.ErrNoDocuments
+}
+
+func TestFindIdempotentServiceUpdate(t *testing.T) {
+	product := &commonmodels.Product{ProductName: "demo", EnvName: "dev"}
+	apiV1 := &commonmodels.ProductService{ServiceName: "api", Containers: []*commonmodels.Container{{Image: "api:v1"}}}
+	apiV2 := &commonmodels.ProductService{ServiceName: "api", Containers: []*commonmodels.Container{{Image: "api:v2"}}}
+	chart := &commonmodels.ProductService{ServiceName: "redis", ReleaseName: "redis", Type: setting.HelmChartDeployType}
+	versions := []*commonmodels.EnvServiceVersion{
+		{Revision: 1, Service: apiV1},
+		{Revision: 2, Service: apiV2, IdempotencyKey: "deploy-v2"},
+		{Revision: 1, Service: chart, IdempotencyKey: "deploy-redis"},
+	}
+
+	tests := []struct {
+		name       string
+		finder     *fakeEnvServiceVersionFinder
+		productSvc *commonmodels.ProductService
+		key        string
+		wantDone   bool
+		wantPrev   *commonmodels.ProductService
+		wantKind   error
+		wantErr    bool
+	}{
+		{
+			name:       "new key updates the service",
+			finder:     &fakeEnvServiceVersionFinder{versions: versions},
+			productSvc: apiV2,
+			key:        "deploy-v3",
+		},
+		{
+			name:       "repeated key is a no-op returning the service before the earlier update",
+			finder:     &fakeEnvServiceVersionFinder{versions: versions},
+			productSvc: apiV2,
+			key:        "deploy-v2",
+			wantDone:   true,
+			wantPrev:   apiV1,
+		},
+		{
+			name:       "repeated key of a service added by the earlier update",
+			finder:     &fakeEnvServiceVersionFinder{versions: versions},
+			productSvc: chart,
+			key:        "deploy-redis",
+			wantDone:   true,
+		},
+		{
+			name:       "key reused by the update of another service",
+			finder:     &fakeEnvServiceVersionFinder{versions: versions},
+			productSvc: chart,
+			key:        "deploy-v2",
+			wantKind:   ErrIdempotencyKeyReused,
+			wantErr:    true,
+		},
+		{
+			name:       "key reused by a chart with the name of the service",
+			finder:     &fakeEnvServiceVersionFinder{versions: versions},
+			productSvc: &commonmodels.ProductService{ServiceName: "api", ReleaseName: "api", Type: setting.HelmChartDeployType},
+			key:        "deploy-v2",
+			wantKind:   ErrIdempotencyKeyReused,
+			wantErr:    true,
+		},
+		{
+			name:       "failed to find the key",
+			finder:     &fakeEnvServiceVersionFinder{err: errors.New("connection refused")},
+			productSvc: apiV2,
+			key:        "deploy-v2",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, prev, err := findIdempotentServiceUpdate(tt.finder, product, tt.productSvc, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findIdempotentServiceUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+				t.Errorf("findIdempotentServiceUpdate() error = %v, want %v", err, tt.wantKind)
+			}
+			if done != tt.wantDone {
+				t.Errorf("findIdempotentServiceUpdate() done = %v, want %v", done, tt.wantDone)
+			}
+			if prev != tt.wantPrev {
+				t.Errorf("findIdempotentServiceUpdate() prev = %v, want %v", prev, tt.wantPrev)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	templatemodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models/template"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
+	"github.com/koderover/zadig/v2/pkg/setting"
+	helmtool "github.com/koderover/zadig/v2/pkg/tool/helmclient"
+	"github.com/koderover/zadig/v2/pkg/tool/log"
+	"github.com/koderover/zadig/v2/pkg/tool/mongo"
+)
+
+// ReleaseImportResult is the result of importing a helm release, Error is set if the release is not imported
+type ReleaseImportResult struct {
+	ReleaseName string `json:"release_name"`
+	Imported    bool   `json:"imported"`
+	Error       string `json:"error,omitempty"`
+}
+
+// releaseReader reads the helm releases in the namespace of the environment
+type releaseReader interface {
+	GetRelease(name string) (*release.Release, error)
+	GetReleaseValues(name string, allValues bool) (map[string]interface{}, error)
+}
+
+// ImportHelmReleasesFromCluster adopts the helm releases deployed in the namespace of the environment as chart services
+// with the import deploy strategy, the values supplied to the releases are kept as the override values of the services.
+// A release that is not found, whose values can not be decoded or which is already in the environment is reported in
+// the results and the others are still imported. Nothing is written if no release is imported.
+func ImportHelmReleasesFromCluster(ctx context.Context, productName, envName, clusterID, namespace string, releaseNames []string, user string) ([]*ReleaseImportResult, error) {
+	session := mongo.Session()
+	defer session.EndSession(context.TODO())
+
+	err := mongo.StartTransaction(session)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockEnv, err := lockHelmEnv(ctx, productName, envName, user)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, err
+	}
+	defer unlockEnv()
+
+	productColl := commonrepo.NewProductCollWithSession(session)
+	productInfo, err := productColl.Find(&commonrepo.ProductFindOptions{Name: productName, EnvName: envName})
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, wrapFindError(err, ErrProductNotFound, "failed to find environment %s/%s", productName, envName)
+	}
+	if productInfo.ClusterID != clusterID || productInfo.Namespace != namespace {
+		mongo.AbortTransaction(session)
+		return nil, errors.Errorf("environment %s/%s is in namespace %s of cluster %s, releases in namespace %s of cluster %s can not be imported",
+			productName, envName, productInfo.Namespace, productInfo.ClusterID, namespace, clusterID)
+	}
+
+	helmClient, err := helmtool.NewClientFromNamespace(clusterID, namespace)
+	if err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to create helm client of namespace %s", namespace)
+	}
+
+	services, results := buildImportedReleaseServices(helmClient, productInfo, releaseNames)
+	for _, result := range results {
+		if !result.Imported {
+			log.Warnf("failed to import release %s into environment %s/%s, err: %s", result.ReleaseName, productName, envName, result.Error)
+		}
+	}
+	if len(services) == 0 {
+		mongo.AbortTransaction(session)
+		return results, nil
+	}
+
+	productInfo.LintServices()
+	if len(productInfo.Services) == 0 {
+		productInfo.Services = [][]*commonmodels.ProductService{{}}
+	}
+	lastGroup := len(productInfo.Services) - 1
+	auditServices := make([]*commonmodels.HelmEnvAuditService, 0, len(services))
+	for _, svc := range services {
+		prevDeployStrategy := getHelmServiceDeployStrategy(svc, productInfo.ServiceDeployStrategy)
+		productInfo.Services[lastGroup] = append(productInfo.Services[lastGroup], svc)
+		productInfo.ServiceDeployStrategy = commonutil.SetChartServiceDeployStrategyImport(productInfo.ServiceDeployStrategy, svc.ReleaseName)
+		auditServices = append(auditServices, &commonmodels.HelmEnvAuditService{
+			ServiceName:        svc.ServiceName,
+			ReleaseName:        svc.ReleaseName,
+			PrevDeployStrategy: prevDeployStrategy,
+			DeployStrategy:     setting.ServiceDeployStrategyImport,
+		})
+
+		if err = commonutil.CreateEnvServiceVersion(productInfo, svc, user, config.EnvOperationDefault, "", session, log.SugaredLogger()); err != nil {
+			log.Errorf("failed to create helm service version of release %s, err: %v", svc.ReleaseName, err)
+		}
+	}
+
+	if err = abortIfCancelled(ctx, session); err != nil {
+		return nil, err
+	}
+	if err = productColl.Update(productInfo); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to update %s/%s product services", productName, envName)
+	}
+
+	auditEvent := newHelmEnvAuditEvent(productInfo, commonmodels.HelmEnvAuditOperationImportReleases, user)
+	auditEvent.Services = auditServices
+	if err = commonrepo.NewHelmEnvAuditEventCollWithSession(session).Create(auditEvent); err != nil {
+		mongo.AbortTransaction(session)
+		return nil, errors.Wrapf(err, "failed to create audit event of %s/%s", productName, envName)
+	}
+
+	if err = commitIfNotCancelled(ctx, session, auditEvent); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// buildImportedReleaseServices reads the releases and builds the chart services to add to env, the result of each release
+// is returned in the order of releaseNames
+func buildImportedReleaseServices(reader releaseReader, env *commonmodels.Product, releaseNames []string) ([]*commonmodels.ProductService, []*ReleaseImportResult) {
+	existedReleases := sets.NewString()
+	for _, svc := range env.GetSvcList() {
+		if svc.ReleaseName != "" {
+			existedReleases.Insert(svc.ReleaseName)
+		}
+	}
+
+	services := make([]*commonmodels.ProductService, 0, len(releaseNames))
+	results := make([]*ReleaseImportResult, 0, len(releaseNames))
+	for _, releaseName := range releaseNames {
+		result := &ReleaseImportResult{ReleaseName: releaseName}
+		results = append(results, result)
+
+		if existedReleases.Has(releaseName) {
+			result.Error = "release is already in the environment"
+			continue
+		}
+
+		svc, err := buildImportedReleaseService(reader, env.ProductName, releaseName)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		existedReleases.Insert(releaseName)
+		services = append(services, svc)
+		result.Imported = true
+	}
+	return services, results
+}
+
+func buildImportedReleaseService(reader releaseReader, productName, releaseName string) (*commonmodels.ProductService, error) {
+	helmRelease, err := reader.GetRelease(releaseName)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil, errors.Errorf("release %s is not found", releaseName)
+		}
+		return nil, errors.Wrapf(err, "failed to get release %s", releaseName)
+	}
+
+	values, err := reader.GetReleaseValues(releaseName, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get values of release %s", releaseName)
+	}
+	valuesYaml := ""
+	if len(values) > 0 {
+		valuesBytes, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode values of release %s", releaseName)
+		}
+		valuesYaml = string(valuesBytes)
+	}
+
+	render := &templatemodels.ServiceRender{
+		ServiceName:       releaseName,
+		ReleaseName:       releaseName,
+		IsHelmChartDeploy: true,
+		OverrideYaml:      &templatemodels.CustomYaml{YamlContent: valuesYaml},
+	}
+	if helmRelease.Chart != nil && helmRelease.Chart.Metadata != nil {
+		render.ChartName = helmRelease.Chart.Metadata.Name
+		render.ChartVersion = helmRelease.Chart.Metadata.Version
+	}
+
+	return &commonmodels.ProductService{
+		ServiceName:    releaseName,
+		ReleaseName:    releaseName,
+		ProductName:    productName,
+		Type:           setting.HelmChartDeployType,
+		Render:         render,
+		UpdateTime:     time.Now().Unix(),
+		DeployStrategy: setting.ServiceDeployStrategyImport,
+	}, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/v2/pkg/setting"
+)
+
+type fakeReleaseReader struct {
+	releases  map[string]*release.Release
+	values    map[string]map[string]interface{}
+	valuesErr map[string]error
+}
+
+func (r *fakeReleaseReader) GetRelease(name string) (*release.Release, error) {
+	if rel, ok := r.releases[name]; ok {
+		return rel, nil
+	}
+	return nil, driver.ErrReleaseNotFound
+}
+
+func (r *fakeReleaseReader) GetReleaseValues(name string, allValues bool) (map[string]interface{}, error) {
+	if err, ok := r.valuesErr[name]; ok {
+		return nil, err
+	}
+	return r.values[name], nil
+}
+
+func TestBuildImportedReleaseServices(t *testing.T) {
+	newRelease := func(name, chartName, version string) *release.Release {
+		return &release.Release{Name: name, Chart: &chart.Chart{Metadata: &chart.Metadata{Name: chartName, Version: version}}}
+	}
+	reader := &fakeReleaseReader{
+		releases: map[string]*release.Release{
+			"redis":    newRelease("redis", "redis", "17.0.1"),
+			"mysql":    newRelease("mysql", "mysql", "9.4.0"),
+			"broken":   newRelease("broken", "nginx", "1.0.0"),
+			"existing": newRelease("existing", "nginx", "1.0.0"),
+		},
+		values: map[string]map[string]interface{}{
+			"redis": {"replicaCount": 2},
+		},
+		valuesErr: map[string]error{
+			"broken": fmt.Errorf("invalid values"),
+		},
+	}
+	env := &commonmodels.Product{
+		ProductName: "demo",
+		EnvName:     "dev",
+		Services: [][]*commonmodels.ProductService{{
+			{ServiceName: "existing", ReleaseName: "existing", Type: setting.HelmChartDeployType},
+		}},
+	}
+
+	services, results := buildImportedReleaseServices(reader, env, []string{"redis", "missing", "broken", "existing", "mysql", "redis"})
+
+	imported := make([]bool, 0, len(results))
+	for _, result := range results {
+		imported = append(imported, result.Imported)
+		if !result.Imported && result.Error == "" {
+			t.Errorf("release %s is not imported without an error", result.ReleaseName)
+		}
+	}
+	if want := []bool{true, false, false, false, true, false}; !reflect.DeepEqual(imported, want) {
+		t.Fatalf("imported = %v, want %v", imported, want)
+	}
+
+	if len(services) != 2 {
+		t.Fatalf("got %d services, want 2", len(services))
+	}
+	redis := services[0]
+	if redis.ReleaseName != "redis" || redis.Type != setting.HelmChartDeployType || redis.DeployStrategy != setting.ServiceDeployStrategyImport {
+		t.Errorf("unexpected service %+v", redis)
+	}
+	if redis.Render.ChartName != "redis" || redis.Render.ChartVersion != "17.0.1" || !redis.Render.IsHelmChartDeploy {
+		t.Errorf("unexpected render %+v", redis.Render)
+	}
+	if got := redis.Render.OverrideYaml.YamlContent; got != "replicaCount: 2\n" {
+		t.Errorf("override yaml = %q, want %q", got, "replicaCount: 2\n")
+	}
+	if got := services[1].Render.OverrideYaml.YamlContent; got != "" {
+		t.Errorf("override yaml of release without values = %q, want empty", got)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/v2/pkg/tool/metrics"
+)
+
+// helmRepoCache keeps the plaintext helm repo list in memory, it is shared by all the callers in this process
+// and it is invalidated when a helm repo is created, updated or deleted in this process.
+type helmRepoCache struct {
+	mu        sync.Mutex
+	helmRepos []*commonmodels.HelmRepo
+	expireAt  time.Time
+}
+
+var defaultHelmRepoCache = &helmRepoCache{}
+
+// list returns copies of the cached helm repos, so callers are free to modify them, e.g. encrypt the passwords
+func (c *helmRepoCache) list(ttl time.Duration, listFunc func() ([]*commonmodels.HelmRepo, error)) ([]*commonmodels.HelmRepo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.helmRepos != nil && time.Now().Before(c.expireAt) {
+		metrics.RegisterHelmRepoCacheRequest(true)
+		return copyHelmRepos(c.helmRepos), nil
+	}
+	metrics.RegisterHelmRepoCacheRequest(false)
+
+	helmRepos, err := listFunc()
+	if err != nil {
+		return nil, err
+	}
+	fillHelmRepoType(helmRepos)
+	if ttl > 0 {
+		c.helmRepos = helmRepos
+		c.expireAt = time.Now().Add(ttl)
+	}
+	return copyHelmRepos(helmRepos), nil
+}
+
+func (c *helmRepoCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.helmRepos = nil
+}
+
+func copyHelmRepos(helmRepos []*commonmodels.HelmRepo) []*commonmodels.HelmRepo {
+	resp := make([]*commonmodels.HelmRepo, 0, len(helmRepos))
+	for _, helmRepo := range helmRepos {
+		repo := *helmRepo
+		repo.Projects = append([]string(nil), helmRepo.Projects...)
+		resp = append(resp, &repo)
+	}
+	return resp
+}
+
+func listHelmReposWithCache() ([]*commonmodels.HelmRepo, error) {
+	return defaultHelmRepoCache.list(config.HelmRepoCacheTTL(), commonrepo.NewHelmRepoColl().List)
+}
+
+// InvalidateHelmRepoCache should be called after helm repos are changed
+func InvalidateHelmRepoCache() {
+	defaultHelmRepoCache.invalidate()
+}
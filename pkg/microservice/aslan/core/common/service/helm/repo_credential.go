@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/v2/pkg/tool/clientmanager"
+)
+
+var getHelmRepoSecretData = func(clusterID, namespace, name string) (map[string][]byte, error) {
+	clientset, err := clientmanager.NewKubeClientManager().GetKubernetesClientSet(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the client of cluster %s, err: %s", clusterID, err)
+	}
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+// GetHelmRepoSecretPassword reads the password of a helm repo from the key of the secret it references
+func GetHelmRepoSecretPassword(ref *commonmodels.HelmRepoSecretRef) (string, error) {
+	if ref == nil {
+		return "", fmt.Errorf("no secret is referenced")
+	}
+	data, err := getHelmRepoSecretData(ref.ClusterID, ref.Namespace, ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s/%s in cluster %s, err: %s", ref.Namespace, ref.Name, ref.ClusterID, err)
+	}
+	password, ok := data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s is not found in secret %s/%s in cluster %s", ref.Key, ref.Namespace, ref.Name, ref.ClusterID)
+	}
+	return string(password), nil
+}
+
+var findHelmRepo = func(opt *commonrepo.HelmRepoFindOption) (*commonmodels.HelmRepo, error) {
+	return commonrepo.NewHelmRepoColl().Find(opt)
+}
+
+// FindHelmRepoWithCredential finds the helm repo with its password, the password of a repo referencing a secret is
+// read from the secret. It is only for server side usage like pulling charts, the password must never be saved.
+func FindHelmRepoWithCredential(opt *commonrepo.HelmRepoFindOption) (*commonmodels.HelmRepo, error) {
+	helmRepo, err := findHelmRepo(opt)
+	if err != nil {
+		return nil, err
+	}
+	if helmRepo.CredentialSource != commonmodels.HelmRepoCredentialSourceK8sSecret {
+		return helmRepo, nil
+	}
+	password, err := GetHelmRepoSecretPassword(helmRepo.SecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the password of helm repo %s, err: %s", helmRepo.RepoName, err)
+	}
+	helmRepo.Password = password
+	return helmRepo, nil
+}
+
+// resolveHelmRepoPasswords sets the passwords of the repos from the secrets they reference, the password of a repo
+// whose secret can not be read is left empty with the reason in CredentialError. The repos must be copies which are
+// not saved, so that the passwords are never persisted.
+func resolveHelmRepoPasswords(helmRepos []*commonmodels.HelmRepo) {
+	for _, helmRepo := range helmRepos {
+		if helmRepo.CredentialSource != commonmodels.HelmRepoCredentialSourceK8sSecret {
+			continue
+		}
+		password, err := GetHelmRepoSecretPassword(helmRepo.SecretRef)
+		if err != nil {
+			helmRepo.Password = ""
+			helmRepo.CredentialError = err.Error()
+			continue
+		}
+		helmRepo.Password = password
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
+)
+
+const helmRepoIndexFetchTimeout = 5 * time.Second
+
+type helmRepoIndexCacheItem struct {
+	charts   []*commonmodels.ChartSummary
+	err      error
+	expireAt time.Time
+}
+
+// helmRepoIndexCache keeps the chart summaries of helm repos, failures are cached as well so that unreachable repos are not
+// requested on every listing
+type helmRepoIndexCache struct {
+	mu    sync.Mutex
+	items map[string]*helmRepoIndexCacheItem
+}
+
+var defaultHelmRepoIndexCache = &helmRepoIndexCache{items: make(map[string]*helmRepoIndexCacheItem)}
+
+func (c *helmRepoIndexCache) get(key string) (*helmRepoIndexCacheItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.expireAt) {
+		return nil, false
+	}
+	return item, true
+}
+
+func (c *helmRepoIndexCache) set(key string, item *helmRepoIndexCacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = item
+}
+
+// attachChartSummaries fills the charts of the helm repos, the repos must still have their credentials.
+// A repo whose index can not be fetched gets ChartsError instead of failing the others.
+func attachChartSummaries(helmRepos []*commonmodels.HelmRepo) {
+	ttl := config.HelmRepoCacheTTL()
+
+	var wg sync.WaitGroup
+	for _, helmRepo := range helmRepos {
+		if helmRepo.GetRepoType() == commonmodels.HelmRepoTypeOCI {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key := fmt.Sprintf("%s:%s:%s", helmRepo.ID.Hex(), helmRepo.URL, helmRepo.Username)
+			item, ok := defaultHelmRepoIndexCache.get(key)
+			if !ok {
+				item = &helmRepoIndexCacheItem{expireAt: time.Now().Add(ttl)}
+				item.charts, item.err = fetchChartSummaries(helmRepo)
+				if ttl > 0 {
+					defaultHelmRepoIndexCache.set(key, item)
+				}
+			}
+
+			helmRepo.Charts = item.charts
+			if item.err != nil {
+				helmRepo.ChartsError = item.err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func fetchChartSummaries(helmRepo *commonmodels.HelmRepo) ([]*commonmodels.ChartSummary, error) {
+	client, err := commonutil.NewHelmClient(helmRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create helm client: %s", err)
+	}
+	index, err := client.FetchRepoIndex(commonutil.GeneHelmRepo(helmRepo), helmRepoIndexFetchTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return summarizeChartIndex(index), nil
+}
+
+// summarizeChartIndex returns the latest version of each chart in the index with its dependencies, sorted by chart name
+func summarizeChartIndex(index *repo.IndexFile) []*commonmodels.ChartSummary {
+	index.SortEntries()
+
+	charts := make([]*commonmodels.ChartSummary, 0, len(index.Entries))
+	for name, versions := range index.Entries {
+		if len(versions) == 0 || versions[0].Metadata == nil {
+			continue
+		}
+		latest := versions[0]
+		chart := &commonmodels.ChartSummary{
+			Name:         name,
+			Version:      latest.Version,
+			Dependencies: make([]*commonmodels.ChartDependency, 0, len(latest.Dependencies)),
+		}
+		for _, dependency := range latest.Dependencies {
+			chart.Dependencies = append(chart.Dependencies, &commonmodels.ChartDependency{
+				Name:       dependency.Name,
+				Version:    dependency.Version,
+				Repository: dependency.Repository,
+			})
+		}
+		charts = append(charts, chart)
+	}
+	sort.Slice(charts, func(i, j int) bool {
+		return charts[i].Name < charts[j].Name
+	})
+	return charts
+}
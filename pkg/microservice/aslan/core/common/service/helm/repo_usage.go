@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"sort"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+)
+
+// EnvRef is an env of a project
+type EnvRef struct {
+	ProjectName string `json:"project_name"`
+	EnvName     string `json:"env_name"`
+	Production  bool   `json:"production"`
+}
+
+var listEnvsByChartRepo = func(repoName string) ([]*commonmodels.Product, error) {
+	return commonrepo.NewProductColl().ListEnvsByChartRepo(repoName)
+}
+
+// ListEnvsUsingHelmRepo returns the envs with a chart release installed from the helm repo, sorted by project and env,
+// so that the repo is not deleted or changed while the envs still depend on it
+func ListEnvsUsingHelmRepo(repoName string) ([]EnvRef, error) {
+	envs, err := listEnvsByChartRepo(repoName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list envs using helm repo: %s, err: %s", repoName, err)
+	}
+
+	resp := make([]EnvRef, 0, len(envs))
+	for _, env := range envs {
+		if !envUsesChartRepo(env, repoName) {
+			continue
+		}
+		resp = append(resp, EnvRef{ProjectName: env.ProductName, EnvName: env.EnvName, Production: env.Production})
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		if resp[i].ProjectName != resp[j].ProjectName {
+			return resp[i].ProjectName < resp[j].ProjectName
+		}
+		return resp[i].EnvName < resp[j].EnvName
+	})
+	return resp, nil
+}
+
+func envUsesChartRepo(env *commonmodels.Product, repoName string) bool {
+	for _, group := range env.Services {
+		for _, svc := range group {
+			if svc.Render != nil && svc.Render.ChartRepo == repoName {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -999,7 +999,7 @@ func RemoveHelmResource(applyParam *ResourceApplyParam, log *zap.SugaredLogger)
 		if len(targetServices) == 0 {
 			targetServices = []string{applyParam.ServiceName}
 		}
-		return DeleteHelmReleaseFromEnv("workflow", "", productInfo, targetServices, true, log)
+		return DeleteHelmReleaseFromEnv(context.TODO(), "workflow", "", productInfo, targetServices, true, log)
 	}
 	return nil
 }
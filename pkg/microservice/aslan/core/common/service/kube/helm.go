@@ -199,7 +199,7 @@ func UninstallRelease(helmClient helmclient.Client, env *commonmodels.Product, r
 
 // 1. Uninstall related resources
 // 2. Delete service info from database
-func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmodels.Product, releaseNames []string, isDelete bool, log *zap.SugaredLogger) error {
+func DeleteHelmReleaseFromEnv(ctx context.Context, userName, requestID string, productInfo *commonmodels.Product, releaseNames []string, isDelete bool, log *zap.SugaredLogger) error {
 
 	helmSvcOfflineLock := cache.NewRedisLock(fmt.Sprintf("product_svc_offline:%s:%s", productInfo.ProductName, productInfo.EnvName))
 
@@ -213,7 +213,6 @@ func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmod
 		return err
 	}
 
-	ctx := context.TODO()
 	kclient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(productInfo.ClusterID)
 	if err != nil {
 		return err
@@ -264,7 +263,7 @@ func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmod
 		newSevices = append(newSevices, group)
 	}
 	productInfo.Services = newSevices
-	err = helmservice.UpdateAllServicesInEnv(productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production)
+	_, err = helmservice.UpdateAllServicesInEnv(ctx, productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production, 0, userName, helmservice.EnvServicesMergeModeReplace)
 	if err != nil {
 		log.Errorf("UpdateHelmProductServices error: %v", err)
 		return err
@@ -290,6 +289,7 @@ func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmod
 		log.Errorf("failed to update product deploy strategy, err: %s", err)
 	}
 
+	// the releases are uninstalled in background, which outlives ctx
 	go func() {
 		failedServices := sync.Map{}
 		wg := sync.WaitGroup{}
@@ -340,12 +340,12 @@ func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmod
 		}
 
 		if productInfo.ShareEnv.Enable && !productInfo.ShareEnv.IsBase {
-			err = EnsureGrayEnvConfig(ctx, productInfo, kclient, istioClient)
+			err = EnsureGrayEnvConfig(context.TODO(), productInfo, kclient, istioClient)
 			if err != nil {
 				log.Errorf("Failed to ensure gray env config: %s", err)
 			}
 		} else if productInfo.IstioGrayscale.Enable && !productInfo.IstioGrayscale.IsBase {
-			err = EnsureFullPathGrayScaleConfig(ctx, productInfo, kclient, istioClient)
+			err = EnsureFullPathGrayScaleConfig(context.TODO(), productInfo, kclient, istioClient)
 			if err != nil {
 				log.Errorf("Failed to ensure full path gray scale config: %s", err)
 			}
@@ -357,7 +357,7 @@ func DeleteHelmReleaseFromEnv(userName, requestID string, productInfo *commonmod
 // DeleteHelmServiceFromEnv deletes the service from the environment
 // 1. Uninstall related resources
 // 2. Delete service info from database
-func DeleteHelmServiceFromEnv(userName, requestID string, productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
+func DeleteHelmServiceFromEnv(ctx context.Context, userName, requestID string, productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
 	helmSvcOfflineLock := cache.NewRedisLock(fmt.Sprintf("product_svc_offline:%s:%s", productInfo.ProductName, productInfo.EnvName))
 
 	helmSvcOfflineLock.Lock()
@@ -370,7 +370,6 @@ func DeleteHelmServiceFromEnv(userName, requestID string, productInfo *commonmod
 		return err
 	}
 
-	ctx := context.TODO()
 	kclient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(productInfo.ClusterID)
 	if err != nil {
 		return err
@@ -397,7 +396,7 @@ func DeleteHelmServiceFromEnv(userName, requestID string, productInfo *commonmod
 		newServices = append(newServices, group)
 	}
 	productInfo.Services = newServices
-	err = helmservice.UpdateAllServicesInEnv(productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production)
+	_, err = helmservice.UpdateAllServicesInEnv(ctx, productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production, 0, userName, helmservice.EnvServicesMergeModeReplace)
 	if err != nil {
 		err = fmt.Errorf("UpdateHelmProductServices error: %v", err)
 		log.Error(err)
@@ -421,6 +420,7 @@ func DeleteHelmServiceFromEnv(userName, requestID string, productInfo *commonmod
 		log.Errorf("failed to update product deploy strategy, err: %s", err)
 	}
 
+	// the releases are uninstalled in background, which outlives ctx
 	go func() {
 		failedServices := sync.Map{}
 		wg := sync.WaitGroup{}
@@ -456,7 +456,7 @@ func DeleteHelmServiceFromEnv(userName, requestID string, productInfo *commonmod
 		}
 
 		if productInfo.ShareEnv.Enable && !productInfo.ShareEnv.IsBase {
-			err = EnsureGrayEnvConfig(ctx, productInfo, kclient, istioClient)
+			err = EnsureGrayEnvConfig(context.TODO(), productInfo, kclient, istioClient)
 			if err != nil {
 				log.Errorf("Failed to ensure gray env config: %s", err)
 			}
@@ -540,8 +540,25 @@ func EnsureDeleteZadigServiceBySvcName(ctx context.Context, env *commonmodels.Pr
 	}
 	return nil
 }
-func DeploySingleHelmRelease(product *commonmodels.Product, productSvc *commonmodels.ProductService,
-	svcTemp *commonmodels.Service, images []string, maxHistory, timeout int, user string) error {
+
+// DeploySingleHelmRelease upgrades the release of the service and updates the service in environment,
+// idempotencyKey is optional, see helmservice.UpdateServiceInEnv
+func DeploySingleHelmRelease(ctx context.Context, product *commonmodels.Product, productSvc *commonmodels.ProductService,
+	svcTemp *commonmodels.Service, images []string, maxHistory, timeout int, user, idempotencyKey string) error {
+	if idempotencyKey != "" {
+		// the release is upgraded in the cluster before the update transaction starts, so a retry which is done already
+		// has to be told here, otherwise it would upgrade the release to a new revision and restart the pods again.
+		// the check in the transaction under the env lock is still the one deciding between concurrent retries.
+		done, err := helmservice.IsServiceUpdatedWithIdempotencyKey(product, productSvc, idempotencyKey)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.Infof("service %s in environment %s/%s is already updated with idempotency key %s", productSvc.ServiceName, product.ProductName, product.EnvName, idempotencyKey)
+			return nil
+		}
+	}
+
 	chartInfo := productSvc.GetServiceRender()
 
 	var (
@@ -583,7 +600,7 @@ func DeploySingleHelmRelease(product *commonmodels.Product, productSvc *commonmo
 			return fmt.Errorf("failed to gene merged values, err: %s", err)
 		}
 
-		chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: chartInfo.ChartRepo})
+		chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: chartInfo.ChartRepo})
 		if err != nil {
 			return fmt.Errorf("failed to query chart-repo info, productName: %s, repoName: %s", product.ProductName, chartInfo.ChartRepo)
 		}
@@ -657,7 +674,7 @@ func DeploySingleHelmRelease(product *commonmodels.Product, productSvc *commonmo
 		return err
 	}
 
-	err = helmservice.UpdateServiceInEnv(product, productSvc, user, config.EnvOperationDefault, "")
+	_, _, err = helmservice.UpdateServiceInEnv(ctx, product, productSvc, user, config.EnvOperationDefault, "", idempotencyKey, nil)
 	return err
 }
 
@@ -698,7 +715,7 @@ func DeployMultiHelmRelease(productResp *commonmodels.Product, helmClient *helmt
 		}()
 
 		if !param.ProdService.FromZadig() {
-			chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: param.RenderChart.ChartRepo})
+			chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: param.RenderChart.ChartRepo})
 			if err != nil {
 				return fmt.Errorf("failed to query chart-repo info, productName: %s, repoName: %s", productResp.ProductName, param.RenderChart.ChartRepo)
 			}
@@ -781,7 +798,7 @@ func DeployMultiHelmRelease(productResp *commonmodels.Product, helmClient *helmt
 			errList = multierror.Append(errList, groupServiceErr...)
 		}
 
-		err := helmservice.UpdateServicesGroupInEnv(productName, envName, groupIndex, groupServices, productResp.Production)
+		err := helmservice.UpdateServicesGroupInEnv(context.TODO(), productName, envName, groupIndex, groupServices, productResp.Production, user)
 		if err != nil {
 			log.Errorf("failed to UpdateHelmProductServices %s/%s, error: %v", productName, envName, err)
 			mongotool.AbortTransaction(session)
@@ -27,6 +27,7 @@ import (
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/kube"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
+	"github.com/koderover/zadig/v2/pkg/setting"
 	"github.com/koderover/zadig/v2/pkg/tool/crypto"
 	e "github.com/koderover/zadig/v2/pkg/tool/errors"
 	"github.com/koderover/zadig/v2/pkg/util"
@@ -73,6 +74,32 @@ func ListRegistryByProject(projectName string, log *zap.SugaredLogger) ([]*model
 	return resp, nil
 }
 
+// ListRegistryNamespacesByProject lists the registries available to the project with their credentials,
+// all the registries are returned if none is assigned to the project
+func ListRegistryNamespacesByProject(projectName string, getRealCredential bool, log *zap.SugaredLogger) ([]*models.RegistryNamespace, error) {
+	registries, err := ListRegistryNamespaces("", getRealCredential, log)
+	if err != nil {
+		return nil, err
+	}
+	return filterRegistriesByProject(registries, projectName), nil
+}
+
+func filterRegistriesByProject(registries []*models.RegistryNamespace, projectName string) []*models.RegistryNamespace {
+	resp := make([]*models.RegistryNamespace, 0, len(registries))
+	for _, reg := range registries {
+		for _, project := range reg.Projects {
+			if project == projectName || project == setting.AllProjects {
+				resp = append(resp, reg)
+				break
+			}
+		}
+	}
+	if len(resp) == 0 {
+		return registries
+	}
+	return resp
+}
+
 func ListRegistryNamespaces(encryptedKey string, getRealCredential bool, log *zap.SugaredLogger) ([]*models.RegistryNamespace, error) {
 	resp, err := mongodb.NewRegistryNamespaceColl().FindAll(&mongodb.FindRegOps{})
 	if err != nil {
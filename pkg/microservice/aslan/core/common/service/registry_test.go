@@ -0,0 +1,58 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/v2/pkg/setting"
+)
+
+func TestFilterRegistriesByProject(t *testing.T) {
+	shared := &models.RegistryNamespace{Namespace: "shared", Projects: []string{setting.AllProjects}}
+	demo := &models.RegistryNamespace{Namespace: "demo", Projects: []string{"demo"}}
+	other := &models.RegistryNamespace{Namespace: "other", Projects: []string{"other"}}
+
+	tests := []struct {
+		name       string
+		registries []*models.RegistryNamespace
+		project    string
+		want       []*models.RegistryNamespace
+	}{
+		{
+			name:       "registries of other projects are excluded",
+			registries: []*models.RegistryNamespace{shared, demo, other},
+			project:    "demo",
+			want:       []*models.RegistryNamespace{shared, demo},
+		},
+		{
+			name:       "all registries are kept for a project without registries",
+			registries: []*models.RegistryNamespace{demo, other},
+			project:    "empty",
+			want:       []*models.RegistryNamespace{demo, other},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterRegistriesByProject(tt.registries, tt.project); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterRegistriesByProject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/v2/pkg/tool/httpclient"
+)
+
+// GetExternalSecret reads a secret from the external system serving a vault compatible kv api, the headers of the
+// external system are used for authentication. The key is formatted as <path>#<field>, e.g. secret/data/app#password,
+// both kv v1 and v2 responses are supported.
+// The secret value is never part of the returned error.
+func GetExternalSecret(storeID, key string) (string, error) {
+	secretPath, field, err := parseSecretKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	store, err := commonrepo.NewExternalSystemColl().GetByID(storeID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find secret store: %s, error: %v", storeID, err)
+	}
+
+	headers := make(map[string]string)
+	for _, header := range store.Headers {
+		headers[header.Key] = fmt.Sprint(header.Value)
+	}
+	resp := &struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(store.Server, "/"), secretPath)
+	if _, err = httpclient.Get(url, httpclient.SetHeaders(headers), httpclient.SetResult(resp)); err != nil {
+		return "", fmt.Errorf("failed to read secret %s from secret store: %s, error: %v", secretPath, store.Name, err)
+	}
+
+	return lookupSecretField(resp.Data, field, secretPath)
+}
+
+func parseSecretKey(key string) (string, string, error) {
+	idx := strings.LastIndex(key, "#")
+	if idx <= 0 || idx == len(key)-1 {
+		return "", "", fmt.Errorf("invalid secret key %s, it should be formatted as <path>#<field>", key)
+	}
+	return strings.TrimPrefix(key[:idx], "/"), key[idx+1:], nil
+}
+
+// lookupSecretField finds the field in the data of a kv v2 response, where the secret is nested in data.data,
+// or a kv v1 response
+func lookupSecretField(data map[string]interface{}, field, secretPath string) (string, error) {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isMetadata := data["metadata"]; isMetadata {
+			data = nested
+		}
+	}
+
+	value, ok := data[field]
+	if !ok || value == nil {
+		return "", fmt.Errorf("field %s not found in secret %s", field, secretPath)
+	}
+	if strValue, ok := value.(string); ok {
+		return strValue, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupSecretField(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		data    map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "kv v2",
+			key:  "secret/data/app#password",
+			data: map[string]interface{}{
+				"data":     map[string]interface{}{"password": "s3cret"},
+				"metadata": map[string]interface{}{"version": 2},
+			},
+			want: "s3cret",
+		},
+		{
+			name: "kv v1",
+			key:  "/secret/app#password",
+			data: map[string]interface{}{"password": "s3cret"},
+			want: "s3cret",
+		},
+		{
+			name: "kv v1 with a field named data",
+			key:  "secret/app#data",
+			data: map[string]interface{}{"data": map[string]interface{}{"a": "b"}},
+			want: "map[a:b]",
+		},
+		{
+			name:    "missing field",
+			key:     "secret/data/app#token",
+			data:    map[string]interface{}{"data": map[string]interface{}{"password": "s3cret"}, "metadata": nil},
+			wantErr: true,
+		},
+		{
+			name:    "key without field",
+			key:     "secret/data/app",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretPath, field, err := parseSecretKey(tt.key)
+			if err == nil {
+				if strings.HasPrefix(secretPath, "/") {
+					t.Errorf("parseSecretKey() path = %s, want no leading slash", secretPath)
+				}
+				var got string
+				got, err = lookupSecretField(tt.data, field, secretPath)
+				if err == nil && got != tt.want {
+					t.Errorf("lookupSecretField() = %s, want %s", got, tt.want)
+				}
+				if err != nil && strings.Contains(err.Error(), "s3cret") {
+					t.Errorf("error should not contain the secret value: %v", err)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
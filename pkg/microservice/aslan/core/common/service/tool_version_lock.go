@@ -0,0 +1,135 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+)
+
+// ResolveAndLockToolVersions resolves the installs with version patterns like 18.x or 1.* to the highest enabled version
+// of the tool and stores them in InstallLocks, installs with concrete versions or without any matching version are not locked.
+// Existing locks of unchanged patterns are kept unless refresh is set, so runs keep using the same versions.
+func ResolveAndLockToolVersions(preTest *commonmodels.PreTest, refresh bool) error {
+	if preTest == nil {
+		return nil
+	}
+
+	var installs []*commonmodels.Install
+	for _, item := range preTest.Installs {
+		if isToolVersionPattern(item.Version) {
+			var err error
+			if installs, err = commonrepo.NewInstallColl().List(); err != nil {
+				return fmt.Errorf("failed to list installs: %s", err)
+			}
+			break
+		}
+	}
+	lockToolVersions(preTest, installs, refresh)
+	return nil
+}
+
+func lockToolVersions(preTest *commonmodels.PreTest, installs []*commonmodels.Install, refresh bool) {
+	locks := make([]*commonmodels.ToolVersionLock, 0)
+	for _, item := range preTest.Installs {
+		if !isToolVersionPattern(item.Version) {
+			continue
+		}
+		if !refresh {
+			if version := preTest.LockedVersion(item); version != item.Version {
+				locks = append(locks, &commonmodels.ToolVersionLock{Name: item.Name, Spec: item.Version, Version: version})
+				continue
+			}
+		}
+
+		resolved := ""
+		for _, install := range installs {
+			if install.Name != item.Name || !install.Enabled || !matchToolVersion(item.Version, install.Version) {
+				continue
+			}
+			if resolved == "" || compareToolVersions(install.Version, resolved) > 0 {
+				resolved = install.Version
+			}
+		}
+		if resolved == "" {
+			// keep the version as it is like before
+			continue
+		}
+		locks = append(locks, &commonmodels.ToolVersionLock{Name: item.Name, Spec: item.Version, Version: resolved})
+	}
+	preTest.InstallLocks = locks
+}
+
+func isToolVersionPattern(version string) bool {
+	for _, segment := range strings.Split(version, ".") {
+		if isToolVersionWildcard(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+func isToolVersionWildcard(segment string) bool {
+	return segment == "x" || segment == "X" || segment == "*"
+}
+
+// matchToolVersion checks whether version matches the pattern, a trailing wildcard matches any remaining segments
+func matchToolVersion(pattern, version string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	versionSegments := strings.Split(version, ".")
+	for i, segment := range patternSegments {
+		if i >= len(versionSegments) {
+			return false
+		}
+		if isToolVersionWildcard(segment) {
+			if i == len(patternSegments)-1 {
+				return true
+			}
+			continue
+		}
+		if segment != versionSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(versionSegments)
+}
+
+// compareToolVersions compares the versions segment by segment, numeric segments are compared by value
+func compareToolVersions(a, b string) int {
+	aSegments := strings.Split(a, ".")
+	bSegments := strings.Split(b, ".")
+	for i := 0; i < len(aSegments) && i < len(bSegments); i++ {
+		aNum, aErr := strconv.Atoi(aSegments[i])
+		bNum, bErr := strconv.Atoi(bSegments[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum > bNum {
+					return 1
+				}
+				return -1
+			}
+		case aSegments[i] != bSegments[i]:
+			return strings.Compare(aSegments[i], bSegments[i])
+		}
+	}
+	return len(aSegments) - len(bSegments)
+}
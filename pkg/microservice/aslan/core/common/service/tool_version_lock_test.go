@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+)
+
+func TestLockToolVersions(t *testing.T) {
+	installs := []*models.Install{
+		{Name: "node", Version: "18.9.1", Enabled: true},
+		{Name: "node", Version: "18.19.0", Enabled: true},
+		{Name: "node", Version: "18.20.0", Enabled: false},
+		{Name: "node", Version: "20.1.0", Enabled: true},
+		{Name: "go", Version: "1.21", Enabled: true},
+	}
+
+	tests := []struct {
+		name     string
+		preTest  *models.PreTest
+		refresh  bool
+		wantLock []*models.ToolVersionLock
+	}{
+		{
+			name: "patterns are resolved to the highest enabled version",
+			preTest: &models.PreTest{Installs: []*models.Item{
+				{Name: "node", Version: "18.x"},
+				{Name: "go", Version: "1.21"},
+			}},
+			wantLock: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.19.0"}},
+		},
+		{
+			name: "existing lock is kept",
+			preTest: &models.PreTest{
+				Installs:     []*models.Item{{Name: "node", Version: "18.x"}},
+				InstallLocks: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.9.1"}},
+			},
+			wantLock: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.9.1"}},
+		},
+		{
+			name: "existing lock is resolved again on refresh",
+			preTest: &models.PreTest{
+				Installs:     []*models.Item{{Name: "node", Version: "18.x"}},
+				InstallLocks: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.9.1"}},
+			},
+			refresh:  true,
+			wantLock: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.19.0"}},
+		},
+		{
+			name: "lock of a changed pattern is dropped",
+			preTest: &models.PreTest{
+				Installs:     []*models.Item{{Name: "node", Version: "*"}},
+				InstallLocks: []*models.ToolVersionLock{{Name: "node", Spec: "18.x", Version: "18.9.1"}},
+			},
+			wantLock: []*models.ToolVersionLock{{Name: "node", Spec: "*", Version: "20.1.0"}},
+		},
+		{
+			name:     "pattern without matching version is not locked",
+			preTest:  &models.PreTest{Installs: []*models.Item{{Name: "node", Version: "16.x"}}},
+			wantLock: []*models.ToolVersionLock{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockToolVersions(tt.preTest, installs, tt.refresh)
+			if !reflect.DeepEqual(tt.preTest.InstallLocks, tt.wantLock) {
+				t.Errorf("lockToolVersions() = %+v, want %+v", tt.preTest.InstallLocks, tt.wantLock)
+			}
+		})
+	}
+}
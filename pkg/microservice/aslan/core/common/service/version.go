@@ -176,7 +176,7 @@ func GetEnvServiceVersionYaml(ctx *internalhandler.Context, projectName, envName
 		chartRepoName := envSvcRevision.Service.GetServiceRender().ChartRepo
 		chartName := envSvcRevision.Service.GetServiceRender().ChartName
 		chartVersion := envSvcRevision.Service.GetServiceRender().ChartVersion
-		chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: chartRepoName})
+		chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: chartRepoName})
 		if err != nil {
 			return resp, fmt.Errorf("failed to query chart-repo info, repoName: %s", chartRepoName)
 		}
@@ -496,7 +496,7 @@ func RollbackEnvServiceVersion(ctx *internalhandler.Context, projectName, envNam
 				}
 
 				env.Services[groupIndex][svcIndex] = envSvcVersion.Service
-				err = helmservice.UpdateServiceInEnv(env, envSvcVersion.Service, ctx.UserName, config.EnvOperationRollback, detail)
+				_, _, err = helmservice.UpdateServiceInEnv(ctx, env, envSvcVersion.Service, ctx.UserName, config.EnvOperationRollback, detail, "", nil)
 				if err != nil {
 					return nil, e.ErrRollbackEnvServiceVersion.AddErr(fmt.Errorf("failed to update service %s in env %s/%s, isProudction %v", envSvcVersion.Service.ServiceName, envSvcVersion.ProductName, envSvcVersion.EnvName, envSvcVersion.Production))
 				}
@@ -571,7 +571,7 @@ func RollbackEnvServiceVersion(ctx *internalhandler.Context, projectName, envNam
 			envSvcVersion.Service.GetServiceRender().SetOverrideYaml(string(mergedValuesYaml))
 
 			go func(done chan bool) {
-				err = kube.DeploySingleHelmRelease(env, envSvcVersion.Service, svcTmpl, nil, templateProduct.ReleaseMaxHistory, 0, ctx.UserName)
+				err = kube.DeploySingleHelmRelease(context.TODO(), env, envSvcVersion.Service, svcTmpl, nil, templateProduct.ReleaseMaxHistory, 0, ctx.UserName, "")
 				if err != nil {
 					title := fmt.Sprintf("回滚 %s/%s 环境 %s 服务失败", projectName, envName, serviceName)
 					notify.SendErrorMessage(ctx.UserName, title, ctx.RequestID, err, log)
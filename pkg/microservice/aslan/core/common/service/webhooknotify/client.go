@@ -54,6 +54,15 @@ func (c *webhookNotifyclient) SendReleasePlanWebhook(webhookNotify *ReleasePlanH
 	return c.sendWebhook(notify)
 }
 
+func (c *webhookNotifyclient) SendHelmEnvUpdateWebhook(webhookNotify *HelmEnvUpdateHookBody) error {
+	notify := &WebHookNotify{
+		ObjectKind:    WebHookNotifyObjectKindEnvironment,
+		Event:         WebHookNotifyEventHelmEnvUpdate,
+		HelmEnvUpdate: webhookNotify,
+	}
+	return c.sendWebhook(notify)
+}
+
 func (c *webhookNotifyclient) sendWebhook(notify *WebHookNotify) error {
 	resp, err := httpclient.Post(
 		c.Address,
@@ -65,7 +74,7 @@ func (c *webhookNotifyclient) sendWebhook(notify *WebHookNotify) error {
 		httpclient.SetHeader(WebhookUUIDHeader, uuid.New().String()),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to execute post http request, url: %s, error: %v", c.Address, err)
+		return fmt.Errorf("failed to execute post http request, url: %s, error: %w", c.Address, err)
 	}
 
 	if resp.IsError() {
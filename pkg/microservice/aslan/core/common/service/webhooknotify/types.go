@@ -38,8 +38,9 @@ const (
 type WebHookNotifyEvent string
 
 const (
-	WebHookNotifyEventWorkflow    WebHookNotifyEvent = "workflow"
-	WebHookNotifyEventReleasePlan WebHookNotifyEvent = "release_plan"
+	WebHookNotifyEventWorkflow      WebHookNotifyEvent = "workflow"
+	WebHookNotifyEventReleasePlan   WebHookNotifyEvent = "release_plan"
+	WebHookNotifyEventHelmEnvUpdate WebHookNotifyEvent = "helm_env_update"
 )
 
 type WebHookNotifyObjectKind string
@@ -47,6 +48,7 @@ type WebHookNotifyObjectKind string
 const (
 	WebHookNotifyObjectKindWorkflow    WebHookNotifyObjectKind = "workflow"
 	WebHookNotifyObjectKindReleasePlan WebHookNotifyObjectKind = "release_plan"
+	WebHookNotifyObjectKindEnvironment WebHookNotifyObjectKind = "environment"
 )
 
 type WebHookNotify struct {
@@ -54,6 +56,26 @@ type WebHookNotify struct {
 	Event       WebHookNotifyEvent      `json:"event"`
 	Workflow    *WorkflowNotify         `json:"workflow"`
 	ReleasePlan *ReleasePlanHookBody    `json:"release_plan"`
+	// HelmEnvUpdate is only set for the helm_env_update event
+	HelmEnvUpdate *HelmEnvUpdateHookBody `json:"helm_env_update,omitempty"`
+}
+
+// HelmEnvUpdateHookBody describes a committed update of a helm environment
+type HelmEnvUpdateHookBody struct {
+	ProjectName string                      `json:"project_name"`
+	EnvName     string                      `json:"env_name"`
+	Production  bool                        `json:"production"`
+	Operation   string                      `json:"operation"`
+	User        string                      `json:"user"`
+	Services    []*HelmEnvUpdateHookService `json:"services"`
+	UpdateTime  int64                       `json:"update_time"`
+}
+
+type HelmEnvUpdateHookService struct {
+	ServiceName        string `json:"service_name"`
+	ReleaseName        string `json:"release_name"`
+	PrevDeployStrategy string `json:"prev_deploy_strategy"`
+	DeployStrategy     string `json:"deploy_strategy"`
 }
 
 type WorkflowNotify struct {
@@ -24,6 +24,7 @@ import (
 	"os"
 	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,8 +33,11 @@ import (
 
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/v2/pkg/setting"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
 	workflowtool "github.com/koderover/zadig/v2/pkg/tool/workflow"
+	jobspec "github.com/koderover/zadig/v2/pkg/types/job"
 	"github.com/koderover/zadig/v2/pkg/util"
 	"github.com/koderover/zadig/v2/pkg/util/rand"
 )
@@ -144,6 +148,7 @@ func runJob(ctx context.Context, job *commonmodels.JobTask, workflowCtx *commonm
 	}(&jobCtl)
 
 	setJobStartTimeContext(job, workflowCtx)
+	setTestingJobTestedServicesContext(job, workflowCtx)
 
 	// should skip passed job when workflow task be restarted
 	if job.Status == config.StatusPassed || job.Status == config.StatusSkipped {
@@ -205,15 +210,24 @@ func runJob(ctx context.Context, job *commonmodels.JobTask, workflowCtx *commonm
 		case config.JobErrorPolicyIgnoreError:
 			job.Status = config.StatusUnstable
 		case config.JobErrorPolicyRetry:
-			retryJob(ctx, workflowCtx.WorkflowName, workflowCtx.TaskID, job, jobCtl, ack, job.ErrorPolicy.MaximumRetry)
+			retryJob(ctx, workflowCtx.WorkflowName, workflowCtx.TaskID, job, jobCtl, ack, job.ErrorPolicy.MaximumRetry, func() bool {
+				return jobProducedOutput(job, workflowCtx, logger)
+			})
 		case config.JobErrorPolicyManualCheck:
 			waitForManualErrorHandling(ctx, workflowCtx.WorkflowName, workflowCtx.TaskID, job, ack, logger)
 		}
 	}
 }
 
-func retryJob(ctx context.Context, workflowName string, taskID int64, job *commonmodels.JobTask, jobCtl JobCtl, ack func(), maxRetry int) {
+// retryJob re-runs the failed job up to maxRetry times, if the error policy only retries failures without output, it
+// stops as soon as producedOutput reports that the failed run has written outputs or test results.
+func retryJob(ctx context.Context, workflowName string, taskID int64, job *commonmodels.JobTask, jobCtl JobCtl, ack func(), maxRetry int, producedOutput func() bool) {
 	retryCount := 1
+	retryInterval := 10 * time.Second
+	if job.ErrorPolicy.RetryInterval > 0 {
+		retryInterval = time.Duration(job.ErrorPolicy.RetryInterval) * time.Second
+	}
+	defer setJobInfoRetryCount(job)
 
 retryLoop:
 	for retryCount <= maxRetry {
@@ -223,7 +237,10 @@ retryLoop:
 			job.Error = fmt.Sprintf("controller shutdown, marking job as cancelled.")
 			return
 		default:
-			time.Sleep(10 * time.Second)
+			if job.ErrorPolicy.RetryOnlyWithoutOutput && producedOutput() {
+				break retryLoop
+			}
+			time.Sleep(retryInterval)
 			job.RetryCount = retryCount
 			job.Status = config.StatusPrepare
 			job.StartTime = time.Now().Unix()
@@ -241,6 +258,55 @@ retryLoop:
 	}
 }
 
+// jobProducedOutput checks whether the job has written any of its outputs into the workflow context, or saved a test
+// report in the current run of the workflow task.
+func jobProducedOutput(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger) bool {
+	if JobWroteOutputs(job, workflowCtx) {
+		return true
+	}
+	if job.JobType != string(config.JobZadigTesting) {
+		return false
+	}
+	reports, err := mongodb.NewCustomWorkflowTestReportColl().ListByWorkflowJobTaskName(workflowCtx.WorkflowName, job.Name, workflowCtx.TaskID)
+	if err != nil {
+		// retry the job anyway since we can not tell whether there are test results
+		logger.Errorf("failed to list test reports of job %s, error: %v", job.Name, err)
+		return false
+	}
+	for _, report := range reports {
+		if report.RetryNum == workflowCtx.RetryNum {
+			return true
+		}
+	}
+	return false
+}
+
+// JobWroteOutputs checks whether the job has written any of the outputs declared by the user into the workflow context.
+// The system outputs, e.g. the commits written by the git step before the test script runs, are not produced by the
+// job's scripts and ignored. So are the empty outputs, which are written for the variables never set by the scripts.
+// The retries stop at the first attempt writing outputs, so the outputs found are always written by the last attempt.
+func JobWroteOutputs(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx) bool {
+	for _, output := range job.Outputs {
+		if output.System {
+			continue
+		}
+		if value, ok := workflowCtx.GlobalContextGet(jobspec.GetJobOutputKey(job.Key, output.Name)); ok && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// setJobInfoRetryCount records the consumed retries in the job info so that it can be displayed along with the job
+func setJobInfoRetryCount(job *commonmodels.JobTask) {
+	switch jobInfo := job.JobInfo.(type) {
+	case map[string]string:
+		jobInfo["retry_count"] = strconv.Itoa(job.RetryCount)
+	case map[string]interface{}:
+		jobInfo["retry_count"] = strconv.Itoa(job.RetryCount)
+	}
+}
+
 func waitForManualErrorHandling(ctx context.Context, workflowName string, taskID int64, job *commonmodels.JobTask, ack func(), logger *zap.SugaredLogger) {
 	originalStatus := job.Status
 	job.Status = config.StatusManualApproval
@@ -313,6 +379,8 @@ type Pool struct {
 	ack         func()
 	ctx         context.Context
 	wg          sync.WaitGroup
+	// batches tracks the unfinished jobs of each parallel batch
+	batches map[string]*sync.WaitGroup
 }
 
 // NewPool initializes a new pool with the given tasks and
@@ -326,9 +394,14 @@ func NewPool(ctx context.Context, jobs []*commonmodels.JobTask, workflowCtx *com
 		logger:      logger,
 		ack:         ack,
 		ctx:         ctx,
+		batches:     make(map[string]*sync.WaitGroup),
 	}
 }
 
+func parallelBatchKey(originName string, batch int) string {
+	return fmt.Sprintf("%s/%d", originName, batch)
+}
+
 // Run runs all job within the pool and blocks until it's
 // finished.
 func (p *Pool) Run() {
@@ -336,6 +409,17 @@ func (p *Pool) Run() {
 		go p.work()
 	}
 
+	for _, job := range p.Jobs {
+		if job.ParallelBatch <= 0 {
+			continue
+		}
+		key := parallelBatchKey(job.OriginName, job.ParallelBatch)
+		if _, ok := p.batches[key]; !ok {
+			p.batches[key] = &sync.WaitGroup{}
+		}
+		p.batches[key].Add(1)
+	}
+
 	p.wg.Add(len(p.Jobs))
 	for _, task := range p.Jobs {
 		p.jobsChan <- task
@@ -350,7 +434,16 @@ func (p *Pool) Run() {
 // The work loop for any single goroutine.
 func (p *Pool) work() {
 	for job := range p.jobsChan {
+		// jobs are sent in order, so the previous batch has been taken by other workers when this one waits for it
+		if job.ParallelBatch > 1 {
+			if previous, ok := p.batches[parallelBatchKey(job.OriginName, job.ParallelBatch-1)]; ok {
+				previous.Wait()
+			}
+		}
 		runJob(p.ctx, job, p.workflowCtx, p.logger, p.ack)
+		if job.ParallelBatch > 0 {
+			p.batches[parallelBatchKey(job.OriginName, job.ParallelBatch)].Done()
+		}
 		p.wg.Done()
 	}
 }
@@ -449,6 +542,18 @@ func setJobStartTimeContext(job *commonmodels.JobTask, workflowCtx *commonmodels
 	workflowCtx.GlobalContextSet(contextKey, startTimeStr)
 }
 
+// setTestingJobTestedServicesContext sets the TESTED_SERVICES output of the testing job, every job task of the job
+// carries the same value so it is set no matter which of them is run or skipped
+// Format: .job.<jobName>.output.TESTED_SERVICES
+func setTestingJobTestedServicesContext(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx) {
+	jobInfo := new(commonmodels.TaskJobInfo)
+	if err := commonmodels.IToi(job.JobInfo, jobInfo); err != nil || jobInfo.TestedServices == "" {
+		return
+	}
+	contextKey := fmt.Sprintf("{{.job.%s.output.%s}}", jobInfo.JobName, setting.WorkflowTestingJobOutputKeyTestedServices)
+	workflowCtx.GlobalContextSet(contextKey, jobInfo.TestedServices)
+}
+
 // setJobStatusContext sets the global context variable for job status
 // Format: .job.<jobKey>.status
 func setJobFinalStatusContext(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx) {
@@ -267,6 +267,13 @@ func (c *FreestyleJobCtl) run(ctx context.Context) error {
 	for _, lb := range c.jobTaskSpec.Properties.CustomLabels {
 		customLabel[lb.Key] = lb.Value.(string)
 	}
+	// custom labels configured by the user take precedence over the attribution labels of the job
+	for k, v := range c.job.Labels {
+		if _, ok := customLabel[k]; ok || v == "" {
+			continue
+		}
+		customLabel[k] = c.sanitizeLabelValue(v)
+	}
 	for _, annotate := range c.jobTaskSpec.Properties.CustomAnnotations {
 		customAnnotation[annotate.Key] = annotate.Value.(string)
 	}
@@ -1248,6 +1255,12 @@ func (c *FreestyleJobCtl) complete(ctx context.Context) {
 		c.job.Status, c.job.Error = config.StatusFailed, errors.Wrap(err, "get job outputs").Error()
 	}
 
+	if c.jobTaskSpec.Properties.CollectPodLogsOnFailure && jobStatusFailed(c.job.Status) {
+		if err := savePodLogs(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient); err != nil {
+			c.logger.Errorf("failed to collect pod logs of job %s, err: %s", c.job.Name, err)
+		}
+	}
+
 	if err := saveContainerLog(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient); err != nil {
 		c.logger.Error(err)
 		if c.job.Error == "" {
@@ -1358,6 +1371,8 @@ func BuildJobExecutorContext(jobTaskSpec *commonmodels.JobTaskFreestyleSpec, job
 		Steps:         jobTaskSpec.Steps,
 		ConfigMapName: job.K8sJobName,
 		Files:         files,
+
+		LogMaskPatterns: jobTaskSpec.Properties.LogMaskPatterns,
 	}
 
 	if job.Infrastructure == setting.JobVMInfrastructure {
@@ -1445,6 +1460,11 @@ func (c *FreestyleJobCtl) SaveInfo(ctx context.Context) error {
 		}
 	}
 
+	// a warm cache only run does not test anything, it is kept out of the test trends
+	if c.job.IsWarmCacheOnly() {
+		return nil
+	}
+
 	jobInfo := &commonmodels.JobInfo{
 		Type:                c.job.JobType,
 		WorkflowName:        c.workflowCtx.WorkflowName,
@@ -199,7 +199,7 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 	// deploy helm chart
 	done := make(chan bool)
 	util.Go(func() {
-		if err = kube.DeploySingleHelmRelease(productInfo, newEnvService, tmplSvc, nil, c.jobTaskSpec.MaxHistory, c.jobTaskSpec.Timeout, c.workflowCtx.WorkflowTaskCreatorUsername); err != nil {
+		if err = kube.DeploySingleHelmRelease(context.TODO(), productInfo, newEnvService, tmplSvc, nil, c.jobTaskSpec.MaxHistory, c.jobTaskSpec.Timeout, c.workflowCtx.WorkflowTaskCreatorUsername, ""); err != nil {
 			err = errors.WithMessagef(err,
 				"failed to upgrade helm chart %s/%s",
 				c.namespace, c.jobTaskSpec.ServiceName)
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	jobspec "github.com/koderover/zadig/v2/pkg/types/job"
+)
+
+type fakeJobCtl struct {
+	job    *commonmodels.JobTask
+	status []config.Status
+	runs   int
+}
+
+func (c *fakeJobCtl) Run(ctx context.Context) {
+	c.job.Status = c.status[c.runs]
+	c.runs++
+}
+
+func (c *fakeJobCtl) Clean(ctx context.Context) {}
+
+func (c *fakeJobCtl) SaveInfo(ctx context.Context) error { return nil }
+
+func TestRetryJob(t *testing.T) {
+	tests := []struct {
+		name           string
+		errorPolicy    *commonmodels.JobErrorPolicy
+		producedOutput bool
+		status         []config.Status
+		wantRuns       int
+		wantStatus     config.Status
+		wantJobInfo    map[string]string
+	}{
+		{
+			name:        "retried until passed",
+			errorPolicy: &commonmodels.JobErrorPolicy{Policy: config.JobErrorPolicyRetry, MaximumRetry: 3, RetryInterval: 1, RetryOnlyWithoutOutput: true},
+			status:      []config.Status{config.StatusPassed},
+			wantRuns:    1,
+			wantStatus:  config.StatusPassed,
+			wantJobInfo: map[string]string{"service_name": "svc", "retry_count": "1"},
+		},
+		{
+			name:           "failure with outputs is not retried",
+			errorPolicy:    &commonmodels.JobErrorPolicy{Policy: config.JobErrorPolicyRetry, MaximumRetry: 3, RetryInterval: 1, RetryOnlyWithoutOutput: true},
+			producedOutput: true,
+			wantStatus:     config.StatusFailed,
+			wantJobInfo:    map[string]string{"service_name": "svc", "retry_count": "0"},
+		},
+		{
+			name:           "outputs are ignored by the job error policy",
+			errorPolicy:    &commonmodels.JobErrorPolicy{Policy: config.JobErrorPolicyRetry, MaximumRetry: 1, RetryInterval: 1},
+			producedOutput: true,
+			status:         []config.Status{config.StatusFailed},
+			wantRuns:       1,
+			wantStatus:     config.StatusFailed,
+			wantJobInfo:    map[string]string{"service_name": "svc", "retry_count": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &commonmodels.JobTask{
+				Status:      config.StatusFailed,
+				ErrorPolicy: tt.errorPolicy,
+				JobInfo:     map[string]string{"service_name": "svc"},
+			}
+			jobCtl := &fakeJobCtl{job: job, status: tt.status}
+			retryJob(context.Background(), "workflow", 1, job, jobCtl, func() {}, tt.errorPolicy.MaximumRetry, func() bool { return tt.producedOutput })
+
+			if jobCtl.runs != tt.wantRuns {
+				t.Errorf("retryJob() ran the job %d times, want %d", jobCtl.runs, tt.wantRuns)
+			}
+			if job.Status != tt.wantStatus {
+				t.Errorf("retryJob() status = %s, want %s", job.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(job.JobInfo, tt.wantJobInfo) {
+				t.Errorf("retryJob() job info = %v, want %v", job.JobInfo, tt.wantJobInfo)
+			}
+		})
+	}
+}
+
+func TestSetJobInfoRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobInfo interface{}
+		want    interface{}
+	}{
+		{name: "string map", jobInfo: map[string]string{}, want: map[string]string{"retry_count": "2"}},
+		{name: "interface map", jobInfo: map[string]interface{}{}, want: map[string]interface{}{"retry_count": "2"}},
+		{name: "no job info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &commonmodels.JobTask{RetryCount: 2, JobInfo: tt.jobInfo}
+			setJobInfoRetryCount(job)
+			if !reflect.DeepEqual(job.JobInfo, tt.want) {
+				t.Errorf("setJobInfoRetryCount() job info = %v, want %v", job.JobInfo, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobProducedOutput(t *testing.T) {
+	globalContext := map[string]string{
+		jobspec.GetJobOutputKey("build", "IMAGE"): "koderover/svc:v1",
+		jobspec.GetJobOutputKey("build", "TAG"):   "",
+	}
+	workflowCtx := &commonmodels.WorkflowTaskCtx{
+		GlobalContextGet: func(key string) (string, bool) {
+			v, ok := globalContext[key]
+			return v, ok
+		},
+	}
+	tests := []struct {
+		name string
+		job  *commonmodels.JobTask
+		want bool
+	}{
+		{name: "output written", job: &commonmodels.JobTask{Key: "build", Outputs: []*commonmodels.Output{{Name: "IMAGE"}}}, want: true},
+		{name: "output not written", job: &commonmodels.JobTask{Key: "build", Outputs: []*commonmodels.Output{{Name: "VERSION"}}}},
+		{name: "empty output is ignored", job: &commonmodels.JobTask{Key: "build", Outputs: []*commonmodels.Output{{Name: "TAG"}}}},
+		{name: "system output is ignored", job: &commonmodels.JobTask{Key: "build", Outputs: []*commonmodels.Output{{Name: "IMAGE", System: true}}}},
+		{name: "no outputs", job: &commonmodels.JobTask{Key: "build"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobProducedOutput(tt.job, workflowCtx, zap.NewNop().Sugar()); got != tt.want {
+				t.Errorf("jobProducedOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -41,6 +41,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -246,7 +247,7 @@ echo $result > %s
 		JobName: jobTask.K8sJobName,
 	}, customLabels)
 
-	ImagePullSecrets, err := getImagePullSecrets(jobTaskSpec.Properties.Registries)
+	ImagePullSecrets, err := getImagePullSecrets(jobTaskSpec.Properties.Registries, jobTaskSpec.Properties.ExtraImagePullSecrets)
 	if err != nil {
 		return nil, err
 	}
@@ -376,7 +377,7 @@ func buildJobWithFiles(jobType, jobImage, jobName, clusterID, currentNamespace s
 		JobName: jobTask.K8sJobName,
 	}, customLabels)
 
-	ImagePullSecrets, err := getImagePullSecrets(jobTaskSpec.Properties.Registries)
+	ImagePullSecrets, err := getImagePullSecrets(jobTaskSpec.Properties.Registries, jobTaskSpec.Properties.ExtraImagePullSecrets)
 	if err != nil {
 		return nil, err
 	}
@@ -480,6 +481,14 @@ EOF`,
 		},
 	}
 
+	if jobTaskSpec.Properties.TerminationGracePeriodSeconds > 0 {
+		// the job executor forwards SIGTERM to the user script, so a trap handler has this long before the pod is killed
+		job.Spec.Template.Spec.TerminationGracePeriodSeconds = int64Ptr(jobTaskSpec.Properties.TerminationGracePeriodSeconds)
+	}
+	setJobResourceLimits(job, jobTaskSpec.Properties.ResLimitSpec)
+	setJobSidecars(job, jobTaskSpec.Properties.Sidecars)
+	setJobHostAliases(job, jobTaskSpec.Properties.HostAliases)
+	setJobNodeStrategy(job, jobTaskSpec.Properties.NodeStrategy, jobTask.Evicted)
 	setJobStorages(job, workflowCtx, jobTaskSpec.Properties.Storages, targetCluster)
 	setJobShareStorages(job, workflowCtx, jobTaskSpec.Properties.ShareStorageDetails, targetCluster)
 
@@ -600,6 +609,112 @@ func BuildCleanJob(jobName, clusterID, workflowName string, taskID int64) (*batc
 	return job, nil
 }
 
+// setJobSidecars adds the sidecar containers to the job pod, containers in a pod share the network so the job reaches them on localhost.
+// the job result is reported through the job context configMap, so running sidecars don't block the job from finishing.
+func setJobSidecars(job *batchv1.Job, sidecars []*commonmodels.SidecarSpec) {
+	for i, sidecar := range sidecars {
+		name := sidecar.Name
+		if name == "" {
+			name = fmt.Sprintf("sidecar-%d", i)
+		}
+		container := corev1.Container{
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Name:            name,
+			Image:           sidecar.Image,
+			Command:         sidecar.Command,
+		}
+		for _, env := range sidecar.Envs {
+			container.Env = append(container.Env, corev1.EnvVar{Name: env.Key, Value: env.Value})
+		}
+		for _, port := range sidecar.Ports {
+			container.Ports = append(container.Ports, corev1.ContainerPort{ContainerPort: port})
+		}
+		job.Spec.Template.Spec.Containers = append(job.Spec.Template.Spec.Containers, container)
+	}
+}
+
+func setJobHostAliases(job *batchv1.Job, hostAliases []*commonmodels.HostAlias) {
+	for _, hostAlias := range hostAliases {
+		job.Spec.Template.Spec.HostAliases = append(job.Spec.Template.Spec.HostAliases, corev1.HostAlias{
+			IP:        hostAlias.IP,
+			Hostnames: hostAlias.Hostnames,
+		})
+	}
+}
+
+// setJobNodeStrategy makes the job pod prefer the preferred nodes of the strategy in addition to the scheduling strategy of the cluster.
+// Once the job is evicted, the pod is pinned to the fallback nodes instead, so the retries are not preempted again.
+func setJobNodeStrategy(job *batchv1.Job, strategy *commonmodels.NodeStrategy, evicted bool) {
+	if strategy == nil {
+		return
+	}
+	podSpec := &job.Spec.Template.Spec
+
+	if evicted && strategy.Fallback != nil {
+		if len(strategy.Fallback.NodeSelector) > 0 {
+			podSpec.NodeSelector = strategy.Fallback.NodeSelector
+		}
+		podSpec.Tolerations = append(podSpec.Tolerations, buildNodeTolerations(strategy.Fallback.Tolerations)...)
+		return
+	}
+
+	if strategy.Preferred == nil {
+		return
+	}
+	podSpec.Tolerations = append(podSpec.Tolerations, buildNodeTolerations(strategy.Preferred.Tolerations)...)
+	if len(strategy.Preferred.NodeSelector) == 0 {
+		return
+	}
+	requirements := make([]corev1.NodeSelectorRequirement, 0, len(strategy.Preferred.NodeSelector))
+	for key, value := range strategy.Preferred.NodeSelector {
+		requirements = append(requirements, corev1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{value},
+		})
+	}
+	sort.Slice(requirements, func(i, j int) bool {
+		return requirements[i].Key < requirements[j].Key
+	})
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.PreferredSchedulingTerm{
+			Weight:     100,
+			Preference: corev1.NodeSelectorTerm{MatchExpressions: requirements},
+		})
+}
+
+func buildNodeTolerations(tolerations []*commonmodels.NodeToleration) []corev1.Toleration {
+	resp := make([]corev1.Toleration, 0, len(tolerations))
+	for _, toleration := range tolerations {
+		resp = append(resp, corev1.Toleration{
+			Key:      toleration.Key,
+			Operator: corev1.TolerationOperator(toleration.Operator),
+			Value:    toleration.Value,
+			Effect:   corev1.TaintEffect(toleration.Effect),
+		})
+	}
+	return resp
+}
+
+// isPodEvicted checks whether the pod is evicted by the kubelet, e.g. on node pressure, or is disrupted by preemption or node shutdown
+func isPodEvicted(pod *corev1.Pod) bool {
+	if pod.Status.Reason == "Evicted" {
+		return true
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
 func setJobStorages(job *batchv1.Job, workflowCtx *commonmodels.WorkflowTaskCtx, storages []*types.NFSProperties, cluster *commonmodels.K8SCluster) {
 	if len(storages) <= 0 {
 		return
@@ -676,7 +791,8 @@ func ensureVolumeMounts(job *batchv1.Job) {
 	}
 }
 
-func getImagePullSecrets(registries []*commonmodels.RegistryNamespace) ([]corev1.LocalObjectReference, error) {
+// getImagePullSecrets returns the secrets of the registries followed by the extra secrets which are not among them
+func getImagePullSecrets(registries []*commonmodels.RegistryNamespace, extraSecrets []string) ([]corev1.LocalObjectReference, error) {
 	ImagePullSecrets := []corev1.LocalObjectReference{
 		{
 			Name: setting.DefaultImagePullSecret,
@@ -693,6 +809,18 @@ func getImagePullSecrets(registries []*commonmodels.RegistryNamespace) ([]corev1
 		}
 		ImagePullSecrets = append(ImagePullSecrets, secret)
 	}
+
+	secretNames := sets.NewString()
+	for _, secret := range ImagePullSecrets {
+		secretNames.Insert(secret.Name)
+	}
+	for _, name := range extraSecrets {
+		if name == "" || secretNames.Has(name) {
+			continue
+		}
+		secretNames.Insert(name)
+		ImagePullSecrets = append(ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
 	return ImagePullSecrets, nil
 }
 
@@ -792,25 +920,23 @@ func getVolumes(jobName string, userHostDockerDaemon bool) []corev1.Volume {
 }
 
 func getResourceRequirements(resReq setting.Request, resReqSpec setting.RequestSpec) corev1.ResourceRequirements {
+	return generateResourceRequirements(resReq, resReq.GetRequestSpec(resReqSpec))
+}
 
-	switch resReq {
-	case setting.HighRequest:
-		return generateResourceRequirements(setting.HighRequest, setting.HighRequestSpec)
-
-	case setting.MediumRequest:
-		return generateResourceRequirements(setting.MediumRequest, setting.MediumRequestSpec)
-
-	case setting.LowRequest:
-		return generateResourceRequirements(setting.LowRequest, setting.LowRequestSpec)
-
-	case setting.MinRequest:
-		return generateResourceRequirements(setting.MinRequest, setting.MinRequestSpec)
-
-	case setting.DefineRequest:
-		return generateResourceRequirements(resReq, resReqSpec)
-
-	default:
-		return generateResourceRequirements(setting.DefaultRequest, setting.DefaultRequestSpec)
+// setJobResourceLimits replaces the cpu and memory limits of the job container with the non-zero limits of limitSpec
+func setJobResourceLimits(job *batchv1.Job, limitSpec *setting.ResourceLimitSpec) {
+	if limitSpec == nil {
+		return
+	}
+	resources := &job.Spec.Template.Spec.Containers[0].Resources
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if limitSpec.CpuLimit > 0 {
+		resources.Limits[corev1.ResourceCPU] = resource.MustParse(strconv.Itoa(limitSpec.CpuLimit) + setting.CpuUintM)
+	}
+	if limitSpec.MemoryLimit > 0 {
+		resources.Limits[corev1.ResourceMemory] = resource.MustParse(strconv.Itoa(limitSpec.MemoryLimit) + setting.MemoryUintMi)
 	}
 }
 
@@ -1016,6 +1142,10 @@ func waitJobEndByCheckingConfigMap(ctx context.Context, taskTimeout <-chan time.
 						continue
 					}
 					if ipod.Failed() {
+						if isPodEvicted(pod) {
+							jobTask.Evicted = true
+							return config.StatusFailed, fmt.Sprintf("job pod %s is evicted", pod.Name)
+						}
 						return config.StatusFailed, ""
 					}
 					if !ipod.Finished() {
@@ -1038,6 +1168,14 @@ func waitJobEndByCheckingConfigMap(ctx context.Context, taskTimeout <-chan time.
 			case job.Status.Succeeded != 0:
 				return config.StatusPassed, ""
 			case job.Status.Failed != 0:
+				if pods, err := podLister.List(labels.Set{"job-name": jobName}.AsSelector()); err == nil {
+					for _, pod := range pods {
+						if isPodEvicted(pod) {
+							jobTask.Evicted = true
+							return config.StatusFailed, fmt.Sprintf("job pod %s is evicted", pod.Name)
+						}
+					}
+				}
 				return config.StatusFailed, ""
 			}
 			if status, ok := cm.Data[commontypes.JobResultKey]; ok {
@@ -1200,6 +1338,72 @@ func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID
 	return nil
 }
 
+// savePodLogs uploads the logs of all the init containers and containers in the job pod to the default s3 storage,
+// under the logs subpath of the job task, e.g. for crashed sidecars whose logs are not in the job log
+func savePodLogs(namespace, clusterID, workflowName, jobName string, taskID int64, jobLabel *JobLabel, kubeClient crClient.Client) error {
+	selector := labels.Set(getJobLabels(jobLabel)).AsSelector()
+	pods, err := getter.ListPods(namespace, selector, kubeClient)
+	if err != nil {
+		return err
+	}
+	if len(pods) < 1 {
+		return fmt.Errorf("no pod found with selector: %s", selector)
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	pod := pods[0]
+
+	clientSet, err := clientmanager.NewKubeClientManager().GetKubernetesClientSet(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get client set: %s", err)
+	}
+	store, err := commonrepo.NewS3StorageColl().FindDefault()
+	if err != nil {
+		return fmt.Errorf("failed to get default s3 storage: %s", err)
+	}
+	s3client, err := s3tool.NewClient(store.Endpoint, store.Ak, store.Sk, store.Region, store.Insecure, store.Provider)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client: %s", err)
+	}
+
+	containers := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, container := range pod.Spec.InitContainers {
+		containers = append(containers, container.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, container.Name)
+	}
+
+	// a container failing to give its logs doesn't stop the others from being collected
+	var errs []string
+	for _, container := range containers {
+		buf := new(bytes.Buffer)
+		if err := containerlog.GetContainerLogs(namespace, pod.Name, container, false, int64(0), buf, clientSet); err != nil {
+			errs = append(errs, fmt.Sprintf("get logs of container %s: %s", container, err))
+			continue
+		}
+
+		tempFileName, err := util.GenerateTmpFile()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("generate temp file for container %s: %s", container, err))
+			continue
+		}
+		if err = saveFile(buf, tempFileName); err == nil {
+			objectKey := GetObjectPath(store.Subfolder, path.Join(workflowName, fmt.Sprint(taskID), jobName, "logs", container+".log"))
+			err = s3client.Upload(store.Bucket, tempFileName, objectKey)
+		}
+		_ = os.Remove(tempFileName)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("upload logs of container %s: %s", container, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func GetObjectPath(subFolder, name string) string {
 	// target should not be started with /
 	if subFolder != "" {
@@ -43,6 +43,8 @@ type JobContext struct {
 	Paths string `yaml:"paths"`
 	// ConfigMapName save the name of the configmap in which the jobContext resides
 	ConfigMapName string `yaml:"config_map_name"`
+	// LogMaskPatterns 脚本输出中匹配的内容会被替换为掩码 [optional]
+	LogMaskPatterns []string `yaml:"log_mask_patterns"`
 
 	Steps   []*commonmodels.StepTask `yaml:"steps"`
 	Outputs []string                 `yaml:"outputs"`
@@ -26,12 +26,16 @@ import (
 	"path/filepath"
 	"time"
 
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/sets"
 
+	configbase "github.com/koderover/zadig/v2/pkg/config"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/s3"
+	"github.com/koderover/zadig/v2/pkg/tool/cache"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
 	s3tool "github.com/koderover/zadig/v2/pkg/tool/s3"
 	"github.com/koderover/zadig/v2/pkg/types/step"
@@ -158,5 +162,160 @@ func (s *junitReportCtl) AfterRun(ctx context.Context) error {
 		log.Error("save junit test result failed, error: %v", err)
 	}
 
+	if len(s.junitReportSpec.ShardJobTaskNames) > 1 {
+		// the trend of a sharded test is recorded from the merged report of all the shards
+		return s.mergeShardReports(client, storage.Bucket)
+	}
+
+	if s.junitReportSpec.RecordTrend {
+		recordTestTrend(s.junitReportSpec, testReport, s.workflowCtx.RetryNum)
+	}
+
+	return nil
+}
+
+// mergeShardReports merges the reports of all the shards of the test once the last of them is reported, the merged
+// report is uploaded to MergedS3DestDir and recorded in the test trend.
+func (s *junitReportCtl) mergeShardReports(client *s3tool.Client, bucket string) error {
+	spec := s.junitReportSpec
+	key := fmt.Sprintf("junit-shards:%s:%d", spec.MergedS3DestDir, s.workflowCtx.RetryNum)
+	redisCache := cache.NewRedisCache(configbase.RedisCommonCacheTokenDB())
+	if err := redisCache.AddElementsToSet(key, []string{spec.JobTaskName}, junitShardReportTTL); err != nil {
+		return fmt.Errorf("failed to record the report of shard %s, error: %v", spec.JobTaskName, err)
+	}
+	reportedShards, err := redisCache.ListSetMembers(key)
+	if err != nil {
+		return fmt.Errorf("failed to list the reported shards of %s, error: %v", spec.MergedS3DestDir, err)
+	}
+	if len(reportedShards) < len(spec.ShardJobTaskNames) {
+		return nil
+	}
+	// the lock is never released so that only one of the shards reported at the same time merges the reports
+	if err := cache.NewRedisLockWithExpiry(key+":merged", junitShardReportTTL).TryLock(); err != nil {
+		return nil
+	}
+
+	reports, err := commonrepo.NewCustomWorkflowTestReportColl().ListByWorkflowJobName(spec.SourceWorkflow, spec.SourceJobKey, spec.TaskID)
+	if err != nil {
+		return fmt.Errorf("failed to list the reports of the shards, error: %v", err)
+	}
+	shardJobTaskNames := sets.NewString(spec.ShardJobTaskNames...)
+	shardReports := make([]*commonmodels.CustomWorkflowTestReport, 0, len(spec.ShardJobTaskNames))
+	for _, report := range reports {
+		if shardJobTaskNames.Has(report.JobTaskName) && report.RetryNum == s.workflowCtx.RetryNum {
+			shardReports = append(shardReports, report)
+		}
+	}
+	mergedReport := mergeShardTestReports(shardReports)
+
+	b, err := xml.MarshalIndent(mergedReport, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the merged report, error: %v", err)
+	}
+	filename, err := util.GenerateTmpFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filename)
+	if err := os.WriteFile(filename, b, 0644); err != nil {
+		return err
+	}
+	objectKey := filepath.Join(spec.S3Storage.Subfolder, spec.MergedS3DestDir, spec.FileName)
+	if err := client.Upload(bucket, filename, objectKey); err != nil {
+		log.Errorf("upload the merged junit report of %s err: %v", spec.MergedS3DestDir, err)
+	}
+
+	if spec.RecordTrend {
+		recordTestTrend(spec, mergedReport, s.workflowCtx.RetryNum)
+	}
 	return nil
 }
+
+// junitShardReportTTL is how long the reported shards of a test are kept, it covers the run time of the slowest shard
+const junitShardReportTTL = 24 * time.Hour
+
+func mergeShardTestReports(reports []*commonmodels.CustomWorkflowTestReport) *commonmodels.TestSuite {
+	merged := &commonmodels.TestSuite{TestCases: make([]commonmodels.TestCase, 0)}
+	for _, report := range reports {
+		if merged.Name == "" {
+			merged.Name = report.TestName
+		}
+		merged.Tests += report.TestCaseNum
+		merged.Successes += report.SuccessCaseNum
+		merged.Skips += report.SkipCaseNum
+		merged.Failures += report.FailedCaseNum
+		merged.Errors += report.ErrorCaseNum
+		merged.Time += report.TestTime
+		merged.TestCases = append(merged.TestCases, report.TestCases...)
+	}
+	return merged
+}
+
+// testTrendMaxRuns is the number of runs kept in a test trend
+const testTrendMaxRuns = 50
+
+// recordTestTrend appends the result to the test trend, a baseline run replaces the baseline of the trend and the
+// other runs are compared against it
+func recordTestTrend(spec *step.StepJunitReportSpec, testReport *commonmodels.TestSuite, retryNum int) {
+	coll := commonrepo.NewTestTrendColl()
+	var baseline *commonmodels.TestTrendRun
+	if !spec.BaselineRun {
+		trend, err := coll.Find(spec.SourceWorkflow, spec.SourceJobKey, spec.TestName, spec.ServiceName, spec.ServiceModule)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Errorf("find test trend of %s failed, error: %v", spec.TestName, err)
+		}
+		if trend != nil {
+			baseline = trend.Baseline
+		}
+	}
+
+	run := newTestTrendRun(testReport, spec.TaskID, retryNum)
+	compareTestTrendRun(run, baseline, spec.BaselineRun)
+	if err := coll.AppendRun(spec.SourceWorkflow, spec.SourceJobKey, spec.TestName, spec.ServiceName, spec.ServiceModule, run, testTrendMaxRuns); err != nil {
+		log.Errorf("save test trend of %s failed, error: %v", spec.TestName, err)
+	}
+}
+
+// compareTestTrendRun marks a baseline run, the other runs get the failed cases which did not fail in the baseline
+func compareTestTrendRun(run, baseline *commonmodels.TestTrendRun, baselineRun bool) {
+	if baselineRun {
+		run.Baseline = true
+		return
+	}
+	if baseline == nil {
+		return
+	}
+
+	baselineFailedCases := sets.NewString(baseline.FailedCases...)
+	run.NewFailedCases = make([]string, 0)
+	for _, name := range run.FailedCases {
+		if !baselineFailedCases.Has(name) {
+			run.NewFailedCases = append(run.NewFailedCases, name)
+		}
+	}
+}
+
+func newTestTrendRun(testReport *commonmodels.TestSuite, taskID int64, retryNum int) *commonmodels.TestTrendRun {
+	run := &commonmodels.TestTrendRun{
+		TaskID:         taskID,
+		RetryNum:       retryNum,
+		CreateTime:     time.Now().Unix(),
+		TestCaseNum:    testReport.Tests,
+		SuccessCaseNum: testReport.Successes,
+		SkipCaseNum:    testReport.Skips,
+		FailedCaseNum:  testReport.Failures,
+		ErrorCaseNum:   testReport.Errors,
+		FailedCases:    make([]string, 0),
+	}
+	for _, testCase := range testReport.TestCases {
+		if testCase.Failure == nil && testCase.Error == nil {
+			continue
+		}
+		name := testCase.Name
+		if testCase.ClassName != "" {
+			name = testCase.ClassName + "." + testCase.Name
+		}
+		run.FailedCases = append(run.FailedCases, name)
+	}
+	return run
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stepcontroller
+
+import (
+	"reflect"
+	"testing"
+
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+)
+
+func TestCompareTestTrendRun(t *testing.T) {
+	baseline := &commonmodels.TestTrendRun{TaskID: 1, Baseline: true, FailedCases: []string{"suite.flaky"}}
+
+	tests := []struct {
+		name               string
+		baseline           *commonmodels.TestTrendRun
+		baselineRun        bool
+		wantBaseline       bool
+		wantNewFailedCases []string
+	}{
+		{
+			name:               "run is compared against the baseline",
+			baseline:           baseline,
+			wantNewFailedCases: []string{"suite.broken"},
+		},
+		{
+			name:     "run without a baseline is not compared",
+			baseline: nil,
+		},
+		{
+			name:         "baseline run is not compared",
+			baseline:     baseline,
+			baselineRun:  true,
+			wantBaseline: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &commonmodels.TestTrendRun{TaskID: 2, FailedCases: []string{"suite.flaky", "suite.broken"}}
+			compareTestTrendRun(run, tt.baseline, tt.baselineRun)
+			if run.Baseline != tt.wantBaseline {
+				t.Errorf("run.Baseline = %v, want %v", run.Baseline, tt.wantBaseline)
+			}
+			if !reflect.DeepEqual(run.NewFailedCases, tt.wantNewFailedCases) {
+				t.Errorf("run.NewFailedCases = %v, want %v", run.NewFailedCases, tt.wantNewFailedCases)
+			}
+			if baseline.TaskID != 1 || !reflect.DeepEqual(baseline.FailedCases, []string{"suite.flaky"}) {
+				t.Errorf("the baseline is changed: %+v", baseline)
+			}
+		})
+	}
+}
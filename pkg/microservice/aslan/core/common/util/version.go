@@ -22,6 +22,12 @@ func GenerateEnvServiceNextRevision(projectName, envName, serviceName string, is
 }
 
 func CreateEnvServiceVersion(env *models.Product, prodSvc *models.ProductService, createBy string, operation config.EnvOperation, detail string, session mongo.Session, log *zap.SugaredLogger) error {
+	return CreateEnvServiceVersionWithIdempotencyKey(env, prodSvc, createBy, operation, detail, "", session, log)
+}
+
+// CreateEnvServiceVersionWithIdempotencyKey creates the version recording the idempotency key of the update,
+// creating a second version of the env with the same key fails
+func CreateEnvServiceVersionWithIdempotencyKey(env *models.Product, prodSvc *models.ProductService, createBy string, operation config.EnvOperation, detail, idempotencyKey string, session mongo.Session, log *zap.SugaredLogger) error {
 	name := prodSvc.ServiceName
 	isHelmChart := !prodSvc.FromZadig()
 	if isHelmChart {
@@ -66,6 +72,7 @@ func CreateEnvServiceVersion(env *models.Product, prodSvc *models.ProductService
 		DefaultValues:   env.DefaultValues,
 		YamlData:        env.YamlData,
 		CreateBy:        createBy,
+		IdempotencyKey:  idempotencyKey,
 	}
 	err = svcVersionColl.Create(version)
 	if err != nil {
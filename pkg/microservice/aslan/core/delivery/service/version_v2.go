@@ -50,6 +50,7 @@ import (
 	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	templaterepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb/template"
 	commonservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service"
+	helmservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/helm"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/repository"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
 	workflowservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/workflow/service/workflow"
@@ -1468,7 +1469,7 @@ func getIndexInfoFromChartRepo(chartRepoName string) (*repo.IndexFile, error) {
 }
 
 func getChartRepoData(repoName string) (*commonmodels.HelmRepo, error) {
-	return commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: repoName})
+	return helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: repoName})
 }
 
 func CheckDeliveryVersion(projectName, deliveryVersionName string) error {
@@ -1727,7 +1727,7 @@ func DeleteProductServices(c *gin.Context) {
 
 	detail := fmt.Sprintf("%s:[%s]", envName, strings.Join(args.ServiceNames, ","))
 	internalhandler.InsertDetailedOperationLog(c, ctx.UserName, projectKey, setting.OperationSceneEnv, "删除", "环境的服务", detail, detail, "", types.RequestBodyTypeJSON, ctx.Logger, envName)
-	ctx.RespErr = service.DeleteProductServices(ctx.UserName, ctx.RequestID, envName, projectKey, args.ServiceNames, production, isDelete, ctx.Logger)
+	ctx.RespErr = service.DeleteProductServices(ctx, ctx.UserName, ctx.RequestID, envName, projectKey, args.ServiceNames, production, isDelete, ctx.Logger)
 }
 
 // @Summary Delete helm release from envrionment
@@ -1799,7 +1799,7 @@ func DeleteHelmReleases(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.DeleteProductHelmReleases(ctx.UserName, ctx.RequestID, envName, projectKey, releaseNameArr, production, isDelete, ctx.Logger)
+	ctx.RespErr = service.DeleteProductHelmReleases(ctx, ctx.UserName, ctx.RequestID, envName, projectKey, releaseNameArr, production, isDelete, ctx.Logger)
 }
 
 func ListGroups(c *gin.Context) {
@@ -108,7 +108,7 @@ func UpdateStatefulSetContainerImage(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, args, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, args, ctx.Logger)
 }
 
 func UpdateDeploymentContainerImage(c *gin.Context) {
@@ -205,7 +205,7 @@ func UpdateDeploymentContainerImage(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, args, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, args, ctx.Logger)
 }
 
 func UpdateCronJobContainerImage(c *gin.Context) {
@@ -281,7 +281,7 @@ func UpdateCronJobContainerImage(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, args, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, args, ctx.Logger)
 }
 
 type OpenAPIUpdateContainerImageArgs struct {
@@ -370,7 +370,7 @@ func OpenAPIUpdateDeploymentContainerImage(c *gin.Context) {
 		Image:         args.Image,
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
 }
 
 func OpenAPIUpdateStatefulSetContainerImage(c *gin.Context) {
@@ -438,7 +438,7 @@ func OpenAPIUpdateStatefulSetContainerImage(c *gin.Context) {
 		Image:         args.Image,
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
 }
 
 func OpenAPIUpdateCronJobContainerImage(c *gin.Context) {
@@ -504,5 +504,5 @@ func OpenAPIUpdateCronJobContainerImage(c *gin.Context) {
 		Image:         args.Image,
 	}
 
-	ctx.RespErr = service.UpdateContainerImage(ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
+	ctx.RespErr = service.UpdateContainerImage(ctx, ctx.RequestID, ctx.UserName, origArgs, ctx.Logger)
 }
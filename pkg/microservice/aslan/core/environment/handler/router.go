@@ -165,6 +165,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		environments.GET("/:name/helm/releases", ListReleases)
 		environments.DELETE("/:name/helm/releases", DeleteHelmReleases)
 		environments.GET("/:name/helm/values", GetChartValues)
+		environments.POST("/:name/helm/values/preview", PreviewHelmServiceValues)
 		environments.GET("/:name/helm/charts", GetChartInfos)
 		environments.GET("/:name/helm/images", GetImageInfos)
 
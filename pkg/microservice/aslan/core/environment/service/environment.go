@@ -862,7 +862,7 @@ func updateProductImpl(updateRevisionSvcs []string, deployStrategy map[string]st
 		}
 		wg.Wait()
 
-		err = helmservice.UpdateServicesGroupInEnv(productName, envName, groupIndex, groupSvcs, updateProd.Production)
+		err = helmservice.UpdateServicesGroupInEnv(context.TODO(), productName, envName, groupIndex, groupSvcs, updateProd.Production, user)
 		if err != nil {
 			log.Errorf("Failed to update %s/%s - service group %d. Error: %v", productName, envName, groupIndex, err)
 			err = e.ErrUpdateEnv.AddDesc(err.Error())
@@ -1563,7 +1563,7 @@ func GenEstimatedValues(projectName, envName, serviceOrReleaseName string, scene
 		// service exists in the current environment, update it
 		if isHelmChartDeploy {
 			render := prodSvc.GetServiceRender()
-			chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: render.ChartRepo})
+			chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: render.ChartRepo})
 			if err != nil {
 				return nil, fmt.Errorf("failed to query chart-repo info, repoName: %s", render.ChartRepo)
 			}
@@ -1603,7 +1603,7 @@ func GenEstimatedValues(projectName, envName, serviceOrReleaseName string, scene
 
 	// generate the new yaml content
 	if isHelmChartDeploy {
-		chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: arg.ChartRepo})
+		chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: arg.ChartRepo})
 		if err != nil {
 			return nil, fmt.Errorf("failed to query chart-repo info, repoName: %s", arg.ChartRepo)
 		}
@@ -2395,7 +2395,7 @@ func DeleteProduct(username, envName, productName, requestID string, isDelete bo
 				}
 
 				// @todo fix env already deleted issue, may cause service not really deleted in k8s
-				err = DeleteProductServices("", requestID, envName, productName, svcNames, false, isDelete, log)
+				err = DeleteProductServices(context.TODO(), "", requestID, envName, productName, svcNames, false, isDelete, log)
 				if err != nil {
 					log.Warnf("DeleteProductServices error: %v", err)
 				}
@@ -2438,7 +2438,7 @@ func DeleteProduct(username, envName, productName, requestID string, isDelete bo
 	return nil
 }
 
-func DeleteProductServices(userName, requestID, envName, productName string, serviceNames []string, production, isDelete bool, log *zap.SugaredLogger) (err error) {
+func DeleteProductServices(ctx context.Context, userName, requestID, envName, productName string, serviceNames []string, production, isDelete bool, log *zap.SugaredLogger) (err error) {
 	productInfo, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: productName, EnvName: envName, Production: util.GetBoolPointer(production)})
 	if err != nil {
 		err = fmt.Errorf("failed to find product, productName: %s, envName: %s, production: %v, error: %v", productName, envName, production, err)
@@ -2446,25 +2446,25 @@ func DeleteProductServices(userName, requestID, envName, productName string, ser
 		return err
 	}
 	if getProjectType(productName) == setting.HelmDeployType {
-		return deleteHelmProductServices(userName, requestID, productInfo, serviceNames, isDelete, log)
+		return deleteHelmProductServices(ctx, userName, requestID, productInfo, serviceNames, isDelete, log)
 	}
-	return deleteK8sProductServices(productInfo, serviceNames, isDelete, log)
+	return deleteK8sProductServices(userName, productInfo, serviceNames, isDelete, log)
 }
 
-func DeleteProductHelmReleases(userName, requestID, envName, productName string, releases []string, production, isDelete bool, log *zap.SugaredLogger) (err error) {
+func DeleteProductHelmReleases(ctx context.Context, userName, requestID, envName, productName string, releases []string, production, isDelete bool, log *zap.SugaredLogger) (err error) {
 	productInfo, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: productName, EnvName: envName, Production: util.GetBoolPointer(production)})
 	if err != nil {
 		log.Errorf("find product error: %v", err)
 		return err
 	}
-	return kube.DeleteHelmReleaseFromEnv(userName, requestID, productInfo, releases, isDelete, log)
+	return kube.DeleteHelmReleaseFromEnv(ctx, userName, requestID, productInfo, releases, isDelete, log)
 }
 
-func deleteHelmProductServices(userName, requestID string, productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
-	return kube.DeleteHelmServiceFromEnv(userName, requestID, productInfo, serviceNames, isDelete, log)
+func deleteHelmProductServices(ctx context.Context, userName, requestID string, productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
+	return kube.DeleteHelmServiceFromEnv(ctx, userName, requestID, productInfo, serviceNames, isDelete, log)
 }
 
-func deleteK8sProductServices(productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
+func deleteK8sProductServices(userName string, productInfo *commonmodels.Product, serviceNames []string, isDelete bool, log *zap.SugaredLogger) error {
 	serviceRelatedYaml := make(map[string]string)
 	for _, service := range productInfo.GetServiceMap() {
 		if !commonutil.ServiceDeployed(service.ServiceName, productInfo.ServiceDeployStrategy) || !isDelete {
@@ -2495,7 +2495,7 @@ func deleteK8sProductServices(productInfo *commonmodels.Product, serviceNames []
 		}
 		newServices = append(newServices, group)
 	}
-	err := helmservice.UpdateAllServicesInEnv(productInfo.ProductName, productInfo.EnvName, newServices, productInfo.Production)
+	_, err := helmservice.UpdateAllServicesInEnv(context.TODO(), productInfo.ProductName, productInfo.EnvName, newServices, productInfo.Production, 0, userName, helmservice.EnvServicesMergeModeReplace)
 	if err != nil {
 		log.Errorf("failed to UpdateHelmProductServices %s/%s, error: %v", productInfo.ProductName, productInfo.EnvName, err)
 		return err
@@ -2675,7 +2675,7 @@ func createGroups(user, requestID string, args *commonmodels.Product, eventStart
 			log.Errorf("createGroup error :%+v", err)
 			return
 		}
-		err = helmservice.UpdateServicesGroupInEnv(args.ProductName, args.EnvName, groupIndex, group, args.Production)
+		err = helmservice.UpdateServicesGroupInEnv(context.TODO(), args.ProductName, args.EnvName, groupIndex, group, args.Production, user)
 		if err != nil {
 			log.Errorf("Failed to update helm product %s/%s - service group %d. Error: %v", args.ProductName, args.EnvName, groupIndex, err)
 			err = e.ErrUpdateEnv.AddDesc(err.Error())
@@ -3232,6 +3232,43 @@ func extractRootKeyFromFlat(flatKey string) string {
 	return strings.Split(splitStrs[0], "[")[0]
 }
 
+// PreviewHelmServiceMergedValues returns the values the service or chart release in the env would be deployed with,
+// the base values of the project are replaced by baseValues if it is set, so that a change can be checked before it
+// is saved
+func PreviewHelmServiceMergedValues(productName, envName, serviceName string, baseValues *string, production bool, log *zap.SugaredLogger) (*commonservice.ValuesResp, error) {
+	product, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{
+		Name:       productName,
+		EnvName:    envName,
+		Production: &production,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find env: %s of project: %s, err: %s", envName, productName, err)
+	}
+
+	prodSvc, ok := product.GetServiceMap()[serviceName]
+	if !ok {
+		prodSvc, ok = product.GetChartServiceMap()[serviceName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to find service: %s in env: %s", serviceName, envName)
+	}
+
+	if baseValues == nil {
+		projectInfo, err := templaterepo.NewProductColl().Find(productName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find project: %s, err: %s", productName, err)
+		}
+		baseValues = &projectInfo.BaseValues
+	}
+
+	mergedValues, err := helmservice.NewHelmDeployService().PreviewMergedValues(prodSvc, *baseValues, product.DefaultValues)
+	if err != nil {
+		log.Errorf("failed to preview merged values of service: %s in env: %s, err: %s", serviceName, envName, err)
+		return nil, err
+	}
+	return &commonservice.ValuesResp{ValuesYaml: mergedValues}, nil
+}
+
 func PreviewHelmProductGlobalVariables(productName, envName, globalVariable string, proudction bool, log *zap.SugaredLogger) ([]*SvcDiffResult, error) {
 	ret := make([]*SvcDiffResult, 0)
 	variableKvs, err := commontypes.YamlToServiceVariableKV(globalVariable, nil)
@@ -17,6 +17,7 @@ limitations under the License.
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -82,7 +83,7 @@ func setProductServiceError(productInfo *commonmodels.Product, serviceName strin
 		}
 	}
 	if foundSvc {
-		err := helmservice.UpdateAllServicesInEnv(productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production)
+		_, err := helmservice.UpdateAllServicesInEnv(context.TODO(), productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production, 0, setting.SystemUser, helmservice.EnvServicesMergeModeReplace)
 		if err != nil {
 			return fmt.Errorf("failed to update %s/%s product services, err: %s ", productInfo.ProductName, productInfo.EnvName, err)
 		}
@@ -107,7 +108,7 @@ func updateServiceRevisionInProduct(productInfo *commonmodels.Product, serviceNa
 		}
 	}
 	if foundSvc {
-		err := helmservice.UpdateAllServicesInEnv(productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production)
+		_, err := helmservice.UpdateAllServicesInEnv(context.TODO(), productInfo.ProductName, productInfo.EnvName, productInfo.Services, productInfo.Production, 0, setting.SystemUser, helmservice.EnvServicesMergeModeReplace)
 		if err != nil {
 			return fmt.Errorf("failed to update %s/%s product services, err: %s ", productInfo.ProductName, productInfo.EnvName, err)
 		}
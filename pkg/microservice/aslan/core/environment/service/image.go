@@ -48,9 +48,11 @@ type UpdateContainerImageArgs struct {
 	ContainerName string `json:"container_name"`
 	Image         string `json:"image"`
 	Production    bool   `json:"production"`
+	// IdempotencyKey is optional, a retry with the same key doesn't update the image of a helm service again
+	IdempotencyKey string `json:"idempotency_key"`
 }
 
-func updateContainerForHelmChart(username, serviceName, image, containerName string, maxHistory int, product *models.Product) error {
+func updateContainerForHelmChart(ctx context.Context, username, serviceName, image, containerName, idempotencyKey string, maxHistory int, product *models.Product) error {
 	targetProductService := product.GetServiceMap()[serviceName]
 	if targetProductService == nil {
 		return fmt.Errorf("failed to find service in product: %s", serviceName)
@@ -70,14 +72,14 @@ func updateContainerForHelmChart(username, serviceName, image, containerName str
 	}
 
 	targetProductService.DeployStrategy = setting.ServiceDeployStrategyDeploy
-	err = kube.DeploySingleHelmRelease(product, targetProductService, serviceObj, []string{image}, maxHistory, 0, username)
+	err = kube.DeploySingleHelmRelease(ctx, product, targetProductService, serviceObj, []string{image}, maxHistory, 0, username, idempotencyKey)
 	if err != nil {
 		return fmt.Errorf("failed to upgrade helm release, err: %s", err.Error())
 	}
 	return nil
 }
 
-func UpdateContainerImage(requestID, username string, args *UpdateContainerImageArgs, log *zap.SugaredLogger) error {
+func UpdateContainerImage(ctx context.Context, requestID, username string, args *UpdateContainerImageArgs, log *zap.SugaredLogger) error {
 	templateProduct, err := templaterepo.NewProductColl().Find(args.ProductName)
 	if err != nil {
 		return e.ErrUpdateConainterImage.AddErr(fmt.Errorf("failed to find template project %s, error: %v", args.ProductName, err))
@@ -135,7 +137,7 @@ func UpdateContainerImage(requestID, username string, args *UpdateContainerImage
 		if err != nil {
 			return e.ErrUpdateConainterImage.AddErr(err)
 		}
-		err = updateContainerForHelmChart(username, serviceName, args.Image, args.ContainerName, templateProduct.ReleaseMaxHistory, product)
+		err = updateContainerForHelmChart(ctx, username, serviceName, args.Image, args.ContainerName, args.IdempotencyKey, templateProduct.ReleaseMaxHistory, product)
 		if err != nil {
 			return e.ErrUpdateConainterImage.AddErr(err)
 		}
@@ -677,6 +677,101 @@ func UpdateProductionGlobalVariables(c *gin.Context) {
 	ctx.RespErr = projectservice.UpdateGlobalVariables(projectKey, ctx.UserName, args.GlobalVariables, true)
 }
 
+// @Summary Get helm base values
+// @Description Get the base values merged under the values of all the services of the helm project
+// @Tags 	project
+// @Accept 	json
+// @Produce json
+// @Param 	name	path		string							true	"project name"
+// @Success 200 	{object} 	projectservice.HelmBaseValues
+// @Router /api/aslan/project/products/{name}/helmBaseValues [get]
+func GetHelmBaseValues(c *gin.Context) {
+	ctx, err := internalhandler.NewContextWithAuthorization(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	if err != nil {
+
+		ctx.RespErr = fmt.Errorf("authorization Info Generation failed: err %s", err)
+		ctx.UnAuthorized = true
+		return
+	}
+
+	projectKey := c.Param("name")
+
+	if projectKey == "" {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("productName can not be null!")
+		return
+	}
+
+	// authorization checks
+	if !ctx.Resources.IsSystemAdmin {
+		if _, ok := ctx.Resources.ProjectAuthInfo[projectKey]; !ok {
+			ctx.UnAuthorized = true
+			return
+		}
+		if !ctx.Resources.ProjectAuthInfo[projectKey].IsProjectAdmin &&
+			!ctx.Resources.ProjectAuthInfo[projectKey].Service.View &&
+			!ctx.Resources.ProjectAuthInfo[projectKey].Service.Edit {
+			ctx.UnAuthorized = true
+			return
+		}
+	}
+
+	ctx.Resp, ctx.RespErr = projectservice.GetHelmBaseValues(projectKey)
+}
+
+// @Summary Update helm base values
+// @Description Update the base values merged under the values of all the services of the helm project
+// @Tags 	project
+// @Accept 	json
+// @Produce json
+// @Param 	name	path		string							true	"project name"
+// @Param 	body 	body 		projectservice.HelmBaseValues 	true 	"body"
+// @Success 200
+// @Router /api/aslan/project/products/{name}/helmBaseValues [put]
+func UpdateHelmBaseValues(c *gin.Context) {
+	ctx, err := internalhandler.NewContextWithAuthorization(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	if err != nil {
+
+		ctx.RespErr = fmt.Errorf("authorization Info Generation failed: err %s", err)
+		ctx.UnAuthorized = true
+		return
+	}
+
+	projectKey := c.Param("name")
+
+	if projectKey == "" {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("productName can not be null!")
+		return
+	}
+
+	internalhandler.InsertOperationLog(c, ctx.UserName, projectKey, "更新", "工程管理-项目-基础values", c.Param("name"), c.Param("name"), "", types.RequestBodyTypeJSON, ctx.Logger)
+
+	args := new(projectservice.HelmBaseValues)
+	if err := c.BindJSON(args); err != nil {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("invalid HelmBaseValues json args")
+		return
+	}
+
+	// authorization checks
+	if !ctx.Resources.IsSystemAdmin {
+		if _, ok := ctx.Resources.ProjectAuthInfo[projectKey]; !ok {
+			ctx.UnAuthorized = true
+			return
+		}
+		if !ctx.Resources.ProjectAuthInfo[projectKey].IsProjectAdmin &&
+			!ctx.Resources.ProjectAuthInfo[projectKey].Service.Create &&
+			!ctx.Resources.ProjectAuthInfo[projectKey].Service.Edit {
+			ctx.UnAuthorized = true
+			return
+		}
+	}
+
+	ctx.RespErr = projectservice.UpdateHelmBaseValues(projectKey, ctx.UserName, args.BaseValues)
+}
+
 // @Summary Get global variable candidates
 // @Description Get global variable candidates
 // @Tags 	project
@@ -48,6 +48,9 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		product.GET("/:name/productionGlobalVariables", GetProductionGlobalVariables)
 		product.PUT("/:name/productionGlobalVariables", UpdateProductionGlobalVariables)
 		product.GET("/:name/productionGlobalVariableCandidates", GetProductionGlobalVariableCandidates)
+
+		product.GET("/:name/helmBaseValues", GetHelmBaseValues)
+		product.PUT("/:name/helmBaseValues", UpdateHelmBaseValues)
 	}
 
 	group := router.Group("group")
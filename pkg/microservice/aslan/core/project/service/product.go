@@ -1203,6 +1203,39 @@ func UpdateGlobalVariables(productName, userName string, globalVariables []*comm
 	return nil
 }
 
+type HelmBaseValues struct {
+	BaseValues string `json:"base_values"`
+}
+
+func GetHelmBaseValues(productName string) (*HelmBaseValues, error) {
+	productInfo, err := templaterepo.NewProductColl().Find(productName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find product %s, err: %w", productName, err)
+	}
+	return &HelmBaseValues{BaseValues: productInfo.BaseValues}, nil
+}
+
+// UpdateHelmBaseValues updates the base values of the helm project, they take effect the next time a service is
+// deployed in any env of the project
+func UpdateHelmBaseValues(productName, userName, baseValues string) error {
+	productInfo, err := templaterepo.NewProductColl().Find(productName)
+	if err != nil {
+		return fmt.Errorf("failed to find product %s, err: %w", productName, err)
+	}
+	if !productInfo.IsHelmProduct() {
+		return fmt.Errorf("base values are only supported by helm projects")
+	}
+	if err = yaml.Unmarshal([]byte(baseValues), &map[string]interface{}{}); err != nil {
+		return fmt.Errorf("invalid base values, err: %w", err)
+	}
+
+	err = templaterepo.NewProductColl().UpdateBaseValues(productName, baseValues, userName)
+	if err != nil {
+		return fmt.Errorf("failed to update base values of product: %s, err: %w", productName, err)
+	}
+	return nil
+}
+
 type GetGlobalVariableCandidatesRespone struct {
 	KeyName        string   `json:"key_name"`
 	RelatedService []string `json:"related_service"`
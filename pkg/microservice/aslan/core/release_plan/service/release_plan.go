@@ -1886,15 +1886,17 @@ func convertWorkflowV4ToOpenAPIWorkflowV4(workflow *commonmodels.WorkflowV4) (*w
 
 				serviceAndTests := []*webhooknotify.OpenAPIWorkflowServiceAndTest{}
 				for _, serviceAndTest := range spec.ServiceAndTests {
-					serviceAndTests = append(serviceAndTests, &webhooknotify.OpenAPIWorkflowServiceAndTest{
-						ServiceName:   serviceAndTest.ServiceName,
-						ServiceModule: serviceAndTest.ServiceModule,
-						OpenAPIWorkflowTestModule: &webhooknotify.OpenAPIWorkflowTestModule{
-							Name:    serviceAndTest.Name,
-							KeyVals: serviceAndTest.KeyVals,
-							Repos:   convertReposToOpenAPIWorkflowRepository(serviceAndTest.Repos),
-						},
-					})
+					for _, testModule := range serviceAndTest.GetTestModules() {
+						serviceAndTests = append(serviceAndTests, &webhooknotify.OpenAPIWorkflowServiceAndTest{
+							ServiceName:   serviceAndTest.ServiceName,
+							ServiceModule: serviceAndTest.ServiceModule,
+							OpenAPIWorkflowTestModule: &webhooknotify.OpenAPIWorkflowTestModule{
+								Name:    testModule.Name,
+								KeyVals: testModule.KeyVals,
+								Repos:   convertReposToOpenAPIWorkflowRepository(testModule.Repos),
+							},
+						})
+					}
 				}
 
 				hookSpec = &webhooknotify.OpenAPIWorkflowTestingJobSpec{
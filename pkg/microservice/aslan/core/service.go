@@ -119,6 +119,8 @@ func Start(ctx context.Context) {
 		SendToFile:  commonconfig.SendLogToFile(),
 		Development: commonconfig.Mode() != setting.ReleaseMode,
 	})
+	// fail at startup rather than in the first job task if the external address is invalid
+	configbase.ExternalAddress()
 
 	start := time.Now().UnixMilli()
 	initDatabaseConnection()
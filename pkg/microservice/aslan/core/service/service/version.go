@@ -168,7 +168,7 @@ func RollbackServiceVersion(ctx *internalhandler.Context, projectName, serviceNa
 		}
 
 		// upload it as new version
-		if err = helmservice.CopyAndUploadService(projectName, serviceName, localBase+"/"+serviceName, []string{fmt.Sprintf("%s-%d", serviceName, rev)}, isProduction); err != nil {
+		if err = helmservice.CopyAndUploadService(projectName, serviceName, localBase+"/"+serviceName, []string{fmt.Sprintf("%s-%d", serviceName, rev)}, isProduction, ""); err != nil {
 			return e.ErrRollbackServiceTemplateVersion.AddErr(fmt.Errorf("Failed to save or upload files for service %s in project %s, error: %s", serviceName, projectName, err))
 		}
 
@@ -109,6 +109,9 @@ func GetTestStatByProdutName(productName string, startTimestamp int64, log *zap.
 					for _, job := range stage.Jobs {
 						switch job.JobType {
 						case string(config.JobZadigTesting):
+							if job.IsWarmCacheOnly() {
+								continue
+							}
 							if job.Status == config.StatusPassed {
 								totalSuccess++
 							} else if job.Status == config.StatusFailed {
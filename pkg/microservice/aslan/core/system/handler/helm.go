@@ -19,6 +19,7 @@ package handler
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -62,6 +63,9 @@ func ListHelmRepos(c *gin.Context) {
 // @Accept 	json
 // @Produce json
 // @Param 	projectName	query		string										true	"project name"
+// @Param 	offset		query		int											false	"offset"
+// @Param 	limit		query		int											false	"limit, all repos are returned if it is 0"
+// @Param 	withDependencies	query	bool									false	"attach the charts and their dependencies of each repo"
 // @Success 200 		{array} 	commonmodels.HelmRepo
 // @Router /api/aslan/system/helm/project [get]
 func ListHelmReposByProject(c *gin.Context) {
@@ -88,7 +92,24 @@ func ListHelmReposByProject(c *gin.Context) {
 		}
 	}
 
-	ctx.Resp, ctx.RespErr = helmservice.ListHelmReposByProject(projectKey, ctx.Logger)
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("invalid offset")
+		return
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "0"), 10, 64)
+	if err != nil {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("invalid limit")
+		return
+	}
+
+	resp, total, err := helmservice.ListHelmReposByProject(projectKey, offset, limit, c.Query("withDependencies") == "true", ctx.Logger)
+	if err != nil {
+		ctx.RespErr = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	ctx.Resp = resp
+	c.Writer.Header().Set("X-Total", strconv.FormatInt(total, 10))
 }
 
 func ListHelmReposPublic(c *gin.Context) {
@@ -128,7 +149,7 @@ func CreateHelmRepo(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.CreateHelmRepo(args, ctx.Logger)
+	ctx.RespErr = service.CreateHelmRepo(args, c.Query("skipValidation") == "true", ctx.Logger)
 }
 
 // @Summary 验证 Helm 仓库连接
@@ -168,7 +189,7 @@ func ValidateHelmRepo(c *gin.Context) {
 		return
 	}
 
-	ctx.RespErr = service.ValidateHelmRepo(args, ctx.Logger)
+	ctx.Resp, ctx.RespErr = service.ValidateHelmRepo(args, ctx.Logger)
 }
 
 func UpdateHelmRepo(c *gin.Context) {
@@ -197,7 +218,7 @@ func UpdateHelmRepo(c *gin.Context) {
 	}
 
 	args.UpdateBy = ctx.UserName
-	ctx.RespErr = service.UpdateHelmRepo(c.Param("id"), args, ctx.Logger)
+	ctx.RespErr = service.UpdateHelmRepo(c.Param("id"), args, c.Query("skipValidation") == "true", ctx.Logger)
 }
 
 func DeleteHelmRepo(c *gin.Context) {
@@ -221,6 +242,28 @@ func DeleteHelmRepo(c *gin.Context) {
 	ctx.RespErr = service.DeleteHelmRepo(c.Param("id"), ctx.Logger)
 }
 
+// ListHelmRepoEnvs lists the envs with a chart release installed from the helm repo
+func ListHelmRepoEnvs(c *gin.Context) {
+	ctx, err := internalhandler.NewContextWithAuthorization(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	if err != nil {
+		ctx.RespErr = fmt.Errorf("authorization Info Generation failed: err %s", err)
+		ctx.UnAuthorized = true
+		return
+	}
+
+	// authorization checks
+	if !ctx.Resources.IsSystemAdmin {
+		if !ctx.Resources.SystemActions.HelmRepoManagement.View {
+			ctx.UnAuthorized = true
+			return
+		}
+	}
+
+	ctx.Resp, ctx.RespErr = helmservice.ListEnvsUsingHelmRepo(c.Param("name"))
+}
+
 func ListCharts(c *gin.Context) {
 	ctx := internalhandler.NewContext(c)
 	defer func() { internalhandler.JSONResponse(c, ctx) }()
@@ -177,6 +177,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		integration.PUT("/:id", UpdateHelmRepo)
 		integration.DELETE("/:id", DeleteHelmRepo)
 		integration.GET("/:name/index", ListCharts)
+		integration.GET("/:name/envs", ListHelmRepoEnvs)
 	}
 
 	// ---------------------------------------------------------------------------------------
@@ -25,6 +25,7 @@ import (
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	commonservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/base"
 	e "github.com/koderover/zadig/v2/pkg/tool/errors"
 )
@@ -127,6 +128,7 @@ func UpdateBasicImage(id string, args *commonmodels.BasicImage, log *zap.Sugared
 		log.Errorf("BasicImage.Update %s error: %v", id, err)
 		return e.ErrUpdateBasicImage
 	}
+	commonservice.InvalidateBasicImageCache(id)
 	return nil
 }
 
@@ -185,5 +187,6 @@ func DeleteBasicImage(id string, log *zap.SugaredLogger) error {
 		log.Errorf("BasicImage.Delete %s error: %v", id, err)
 		return e.ErrDeleteBasicImage
 	}
+	commonservice.InvalidateBasicImageCache(id)
 	return nil
 }
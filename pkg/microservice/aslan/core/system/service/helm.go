@@ -18,12 +18,17 @@ package service
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
+	helmservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/helm"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
+	e "github.com/koderover/zadig/v2/pkg/tool/errors"
+	helmtool "github.com/koderover/zadig/v2/pkg/tool/helmclient"
 )
 
 type IndexFileResp struct {
@@ -45,46 +50,140 @@ func ListHelmRepos(log *zap.SugaredLogger) ([]*commonmodels.HelmRepo, error) {
 	return helmRepos, nil
 }
 
-func CreateHelmRepo(args *commonmodels.HelmRepo, log *zap.SugaredLogger) error {
+func CreateHelmRepo(args *commonmodels.HelmRepo, skipValidation bool, log *zap.SugaredLogger) error {
+	if err := validateHelmRepoType(args); err != nil {
+		return err
+	}
+	if err := validateHelmRepoCredentialSource(args); err != nil {
+		return err
+	}
+	if !skipValidation {
+		if _, err := ValidateHelmRepo(args, log); err != nil {
+			return err
+		}
+	}
 	if err := commonrepo.NewHelmRepoColl().Create(args); err != nil {
 		log.Errorf("CreateHelmRepo err:%v", err)
 		return err
 	}
+	helmservice.InvalidateHelmRepoCache()
+	return nil
+}
+
+const helmRepoValidateTimeout = 5 * time.Second
+
+// validateHelmRepoType sets the repo type from the url if it is not specified, and makes sure the url matches the type.
+// charts of oci repos are pulled from the oci:// url, so the url scheme decides how charts are fetched.
+func validateHelmRepoType(args *commonmodels.HelmRepo) error {
+	args.RepoType = args.GetRepoType()
+	isOCIURL := strings.HasPrefix(args.URL, commonmodels.HelmRepoOCIScheme)
+	switch args.RepoType {
+	case commonmodels.HelmRepoTypeOCI:
+		if !isOCIURL {
+			return e.ErrInvalidParam.AddDesc(fmt.Sprintf("url of oci helm repo must start with %s", commonmodels.HelmRepoOCIScheme))
+		}
+	case commonmodels.HelmRepoTypeClassic:
+		if isOCIURL {
+			return e.ErrInvalidParam.AddDesc(fmt.Sprintf("url of classic helm repo can't start with %s", commonmodels.HelmRepoOCIScheme))
+		}
+	default:
+		return e.ErrInvalidParam.AddDesc(fmt.Sprintf("invalid helm repo type: %s", args.RepoType))
+	}
 	return nil
 }
 
-func ValidateHelmRepo(args *commonmodels.HelmRepo, log *zap.SugaredLogger) error {
+// validateHelmRepoCredentialSource makes sure the secret holding the password is referenced if the password is read
+// from a secret, the password in args is cleared in this case so that it is never saved.
+func validateHelmRepoCredentialSource(args *commonmodels.HelmRepo) error {
+	switch args.CredentialSource {
+	case "":
+		args.SecretRef = nil
+	case commonmodels.HelmRepoCredentialSourceK8sSecret:
+		ref := args.SecretRef
+		if ref == nil || ref.ClusterID == "" || ref.Namespace == "" || ref.Name == "" || ref.Key == "" {
+			return e.ErrInvalidParam.AddDesc("cluster, namespace, name and key of the secret holding the password of helm repo are required")
+		}
+		args.Password = ""
+	default:
+		return e.ErrInvalidParam.AddDesc(fmt.Sprintf("invalid credential source of helm repo: %s", args.CredentialSource))
+	}
+	return nil
+}
+
+// ValidateHelmRepo checks the helm repo with its credentials, both the result and the reason of the failure are returned
+func ValidateHelmRepo(args *commonmodels.HelmRepo, log *zap.SugaredLogger) (*helmtool.RepoCheckResult, error) {
+	if args.CredentialSource == commonmodels.HelmRepoCredentialSourceK8sSecret {
+		password, err := helmservice.GetHelmRepoSecretPassword(args.SecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("读取 Helm 仓库密码失败: %s", err)
+		}
+		helmRepo := *args
+		helmRepo.Password = password
+		args = &helmRepo
+	}
+
 	client, err := commonutil.NewHelmClient(args)
 	if err != nil {
-		return fmt.Errorf("创建 Helm 客户端失败: %s", err)
+		return nil, fmt.Errorf("创建 Helm 客户端失败: %s", err)
 	}
 
-	_, err = client.FetchIndexYaml(commonutil.GeneHelmRepo(args))
+	result, err := client.CheckRepo(commonutil.GeneHelmRepo(args), helmRepoValidateTimeout)
 	if err != nil {
-		return fmt.Errorf("验证 Helm 仓库失败: %s", err)
+		log.Warnf("failed to validate helm repo %s, err: %s", args.URL, err)
+		return result, fmt.Errorf("验证 Helm 仓库失败: %s", err)
 	}
 
-	return nil
+	return result, nil
 }
 
-func UpdateHelmRepo(id string, args *commonmodels.HelmRepo, log *zap.SugaredLogger) error {
+func UpdateHelmRepo(id string, args *commonmodels.HelmRepo, skipValidation bool, log *zap.SugaredLogger) error {
+	if err := validateHelmRepoType(args); err != nil {
+		return err
+	}
+	if err := validateHelmRepoCredentialSource(args); err != nil {
+		return err
+	}
+	if !skipValidation {
+		if _, err := ValidateHelmRepo(args, log); err != nil {
+			return err
+		}
+	}
 	if err := commonrepo.NewHelmRepoColl().Update(id, args); err != nil {
 		log.Errorf("UpdateHelmRepo err:%v", err)
 		return err
 	}
+	helmservice.InvalidateHelmRepoCache()
 	return nil
 }
 
 func DeleteHelmRepo(id string, log *zap.SugaredLogger) error {
+	helmRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{Id: id})
+	if err != nil {
+		log.Errorf("DeleteHelmRepo find helm repo: %s err:%v", id, err)
+		return err
+	}
+	envs, err := helmservice.ListEnvsUsingHelmRepo(helmRepo.RepoName)
+	if err != nil {
+		return err
+	}
+	if len(envs) > 0 {
+		envNames := make([]string, 0, len(envs))
+		for _, env := range envs {
+			envNames = append(envNames, fmt.Sprintf("%s/%s", env.ProjectName, env.EnvName))
+		}
+		return fmt.Errorf("helm repo: %s is used by the charts deployed in envs: %s", helmRepo.RepoName, strings.Join(envNames, ", "))
+	}
+
 	if err := commonrepo.NewHelmRepoColl().Delete(id); err != nil {
 		log.Errorf("DeleteHelmRepo err:%v", err)
 		return err
 	}
+	helmservice.InvalidateHelmRepoCache()
 	return nil
 }
 
 func ListCharts(name string, log *zap.SugaredLogger) (*IndexFileResp, error) {
-	chartRepo, err := commonrepo.NewHelmRepoColl().Find(&commonrepo.HelmRepoFindOption{RepoName: name})
+	chartRepo, err := helmservice.FindHelmRepoWithCredential(&commonrepo.HelmRepoFindOption{RepoName: name})
 	if err != nil {
 		return nil, err
 	}
@@ -43,9 +43,10 @@ type giteeEventMatcherForWorkflowV4 interface {
 }
 
 type giteePushEventMatcherForWorkflowV4 struct {
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *gitee.PushEvent
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *gitee.PushEvent
+	changedFiles []string
 }
 
 func (gpem *giteePushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -74,12 +75,17 @@ func (gpem *giteePushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Mai
 			changedFiles = append(changedFiles, commit.Removed...)
 			changedFiles = append(changedFiles, commit.Modified...)
 		}
+		gpem.changedFiles = changedFiles
 		return MatchChanges(hookRepo, changedFiles), nil
 	}
 
 	return false, nil
 }
 
+func (gpem *giteePushEventMatcherForWorkflowV4) GetChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 func (gpem *giteePushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -92,10 +98,11 @@ func (gpem *giteePushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmode
 }
 
 type giteeMergeEventMatcherForWorkflowV4 struct {
-	diffFunc giteePullRequestDiffFunc
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *gitee.PullRequestEvent
+	diffFunc     giteePullRequestDiffFunc
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *gitee.PullRequestEvent
+	changedFiles []string
 }
 
 func (gmem *giteeMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -126,12 +133,17 @@ func (gmem *giteeMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Ma
 			}
 			gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
 
+			gmem.changedFiles = changedFiles
 			return MatchChanges(hookRepo, changedFiles), nil
 		}
 	}
 	return false, nil
 }
 
+func (gmem *giteeMergeEventMatcherForWorkflowV4) GetChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 func (gmem *giteeMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -337,6 +349,9 @@ func TriggerWorkflowV4ByGiteeEvent(event interface{}, baseURI, requestID string,
 			if notification != nil {
 				workflowController.NotificationID = notification.ID.Hex()
 			}
+			if changedFilesMatcher, ok := matcher.(changedFilesMatcher); ok && hookPayload != nil {
+				hookPayload.ChangedFiles = changedFilesMatcher.GetChangedFiles()
+			}
 			workflowController.HookPayload = hookPayload
 			if resp, err := workflowservice.CreateWorkflowTaskV4(&workflowservice.CreateWorkflowTaskV4Args{
 				Name: setting.WebhookTaskCreator,
@@ -42,9 +42,10 @@ type gitEventMatcherForWorkflowV4 interface {
 }
 
 type githubPushEventMatcheForWorkflowV4 struct {
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *github.PushEvent
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *github.PushEvent
+	changedFiles []string
 }
 
 func (gpem *githubPushEventMatcheForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -76,9 +77,14 @@ func (gpem *githubPushEventMatcheForWorkflowV4) Match(hookRepo *commonmodels.Mai
 		changedFiles = append(changedFiles, commit.Removed...)
 		changedFiles = append(changedFiles, commit.Modified...)
 	}
+	gpem.changedFiles = changedFiles
 	return MatchChanges(hookRepo, changedFiles), nil
 }
 
+func (gpem *githubPushEventMatcheForWorkflowV4) GetChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 func (gpem *githubPushEventMatcheForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -93,10 +99,11 @@ func (gpem *githubPushEventMatcheForWorkflowV4) GetHookRepo(hookRepo *commonmode
 }
 
 type githubMergeEventMatcherForWorkflowV4 struct {
-	diffFunc githubPullRequestDiffFunc
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *github.PullRequestEvent
+	diffFunc     githubPullRequestDiffFunc
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *github.PullRequestEvent
+	changedFiles []string
 }
 
 func (gmem *githubMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -130,12 +137,17 @@ func (gmem *githubMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.M
 		}
 		gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
 
+		gmem.changedFiles = changedFiles
 		return MatchChanges(hookRepo, changedFiles), nil
 	}
 
 	return false, nil
 }
 
+func (gmem *githubMergeEventMatcherForWorkflowV4) GetChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 func (gmem *githubMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -334,6 +346,9 @@ func TriggerWorkflowV4ByGithubEvent(event interface{}, baseURI, deliveryID, requ
 				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
 				continue
 			}
+			if changedFilesMatcher, ok := matcher.(changedFilesMatcher); ok {
+				hookPayload.ChangedFiles = changedFilesMatcher.GetChangedFiles()
+			}
 			workflowController.HookPayload = hookPayload
 			if resp, err := workflowservice.CreateWorkflowTaskV4(&workflowservice.CreateWorkflowTaskV4Args{
 				Name: setting.WebhookTaskCreator,
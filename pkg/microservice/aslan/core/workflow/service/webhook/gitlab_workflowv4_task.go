@@ -48,6 +48,7 @@ type gitlabMergeEventMatcherForWorkflowV4 struct {
 	trigger            *TriggerYaml
 	isYaml             bool
 	yamlServiceChanged []BuildServices
+	changedFiles       []string
 }
 
 func (gmem *gitlabMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -91,6 +92,7 @@ func (gmem *gitlabMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.M
 			return false, err
 		}
 		gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
+		gmem.changedFiles = changedFiles
 		if gmem.isYaml {
 			serviceChangeds := ServicesMatchChangesFiles(gmem.trigger.Rules.MatchFolders, changedFiles)
 			gmem.yamlServiceChanged = serviceChangeds
@@ -101,6 +103,10 @@ func (gmem *gitlabMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.M
 	return false, nil
 }
 
+func (gmem *gitlabMergeEventMatcherForWorkflowV4) GetChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 func (gmem *gitlabMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -148,6 +154,7 @@ type gitlabPushEventMatcherForWorkflowV4 struct {
 	trigger            *TriggerYaml
 	isYaml             bool
 	yamlServiceChanged []BuildServices
+	changedFiles       []string
 }
 
 func (gpem *gitlabPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -216,6 +223,7 @@ func (gpem *gitlabPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Ma
 			changedFiles = append(changedFiles, diff.OldPath)
 		}
 	}
+	gpem.changedFiles = changedFiles
 	if gpem.isYaml {
 		serviceChangeds := ServicesMatchChangesFiles(gpem.trigger.Rules.MatchFolders, changedFiles)
 		gpem.yamlServiceChanged = serviceChangeds
@@ -224,6 +232,10 @@ func (gpem *gitlabPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Ma
 	return MatchChanges(hookRepo, changedFiles), nil
 }
 
+func (gpem *gitlabPushEventMatcherForWorkflowV4) GetChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 func (gpem *gitlabPushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
 	return &types.Repository{
 		CodehostID:    hookRepo.CodehostID,
@@ -423,6 +435,9 @@ func TriggerWorkflowV4ByGitlabEvent(event interface{}, baseURI, requestID string
 			if notification != nil {
 				workflowController.NotificationID = notification.ID.Hex()
 			}
+			if changedFilesMatcher, ok := matcher.(changedFilesMatcher); ok && hookPayload != nil {
+				hookPayload.ChangedFiles = changedFilesMatcher.GetChangedFiles()
+			}
 			workflowController.HookPayload = hookPayload
 			if resp, err := workflowservice.CreateWorkflowTaskV4(&workflowservice.CreateWorkflowTaskV4Args{
 				Name: setting.WebhookTaskCreator,
@@ -489,6 +489,11 @@ func (m MatchFolders) ContainsFile(file string) bool {
 	return false
 }
 
+// changedFilesMatcher is implemented by the event matchers that know the files changed by the event after a match
+type changedFilesMatcher interface {
+	GetChangedFiles() []string
+}
+
 func MatchChanges(m *commonmodels.MainHookRepo, files []string) bool {
 	// if it is an empty commit, allow triggering workflow tasks
 	if len(files) == 0 {
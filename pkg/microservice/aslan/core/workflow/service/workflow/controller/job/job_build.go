@@ -354,7 +354,7 @@ func (j BuildJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, error
 		if err != nil {
 			return nil, fmt.Errorf("find build: %s error: %v", build.BuildName, err)
 		}
-		basicImage, err := commonrepo.NewBasicImageColl().Find(buildInfo.PreBuild.ImageID)
+		basicImage, err := commonservice.FindBasicImage(buildInfo.PreBuild.ImageID)
 		if err != nil {
 			return nil, fmt.Errorf("find base image: %s error: %v", buildInfo.PreBuild.ImageID, err)
 		}
@@ -435,6 +435,7 @@ func (j BuildJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, error
 			jobTaskSpec.Properties.CacheEnable = buildInfo.CacheEnable
 			jobTaskSpec.Properties.CacheDirType = buildInfo.CacheDirType
 			jobTaskSpec.Properties.CacheUserDir = buildInfo.CacheUserDir
+			jobTaskSpec.Properties.CacheCompression = buildInfo.CacheCompression
 		} else {
 			clusterInfo, err := commonrepo.NewK8SClusterColl().Get(buildInfo.PreBuild.ClusterID)
 			if err != nil {
@@ -449,6 +450,7 @@ func (j BuildJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, error
 				jobTaskSpec.Properties.CacheEnable = buildInfo.CacheEnable
 				jobTaskSpec.Properties.CacheDirType = buildInfo.CacheDirType
 				jobTaskSpec.Properties.CacheUserDir = buildInfo.CacheUserDir
+				jobTaskSpec.Properties.CacheCompression = buildInfo.CacheCompression
 			}
 
 			if jobTaskSpec.Properties.CacheEnable {
@@ -641,6 +643,7 @@ func (j BuildJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, error
 					S3DestDir:    getBuildJobCacheObjectPath(j.workflow.Name, build.ServiceName, build.ServiceModule),
 					IgnoreErr:    true,
 					S3Storage:    modelToS3StepSpec(cacheS3),
+					Compression:  jobTaskSpec.Properties.CacheCompression,
 				},
 			}
 			jobTaskSpec.Steps = append(jobTaskSpec.Steps, tarArchiveStep)
@@ -1294,7 +1297,7 @@ func getBuildJobVariables(build *commonmodels.ServiceAndBuild, taskID int64, pro
 	ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_NAME", Value: build.ServiceName, IsCredential: false})
 	ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_MODULE", Value: build.ServiceModule, IsCredential: false})
 	ret = append(ret, &commonmodels.KeyVal{Key: "IMAGE", Value: image, IsCredential: false})
-	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.SystemAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
+	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.ExternalAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
 	ret = append(ret, &commonmodels.KeyVal{Key: "BUILD_URL", Value: buildURL, IsCredential: false})
 	ret = append(ret, &commonmodels.KeyVal{Key: "PKG_FILE", Value: pkgFile, IsCredential: false})
 
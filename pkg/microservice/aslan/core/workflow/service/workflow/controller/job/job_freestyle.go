@@ -24,7 +24,6 @@ import (
 	configbase "github.com/koderover/zadig/v2/pkg/config"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
-	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	commonservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
 	codehostrepo "github.com/koderover/zadig/v2/pkg/microservice/systemconfig/core/codehost/repository/mongodb"
@@ -517,7 +516,7 @@ func (j FreestyleJobController) getReferredJobTargets(jobName string) ([]*common
 }
 
 func (j FreestyleJobController) generateSubTask(taskID int64, jobSubTaskID int, registries []*commonmodels.RegistryNamespace, service *commonmodels.FreeStyleServiceInfo) (*commonmodels.JobTask, error) {
-	basicImage, err := commonrepo.NewBasicImageColl().Find(j.jobSpec.Runtime.ImageID)
+	basicImage, err := commonservice.FindBasicImage(j.jobSpec.Runtime.ImageID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find base image: %s,error :%v", j.jobSpec.Runtime.ImageID, err)
 	}
@@ -760,7 +759,7 @@ func getFreestyleJobVariables(taskID int64, project, workflowName, workflowDispl
 		ret = append(ret, &commonmodels.KeyVal{Key: registry.Namespace + "_REGISTRY_SK", Value: registry.SecretKey, IsCredential: true})
 	}
 
-	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.SystemAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
+	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.ExternalAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
 	ret = append(ret, &commonmodels.KeyVal{Key: "BUILD_URL", Value: buildURL, IsCredential: false})
 
 	// TODO: remove it
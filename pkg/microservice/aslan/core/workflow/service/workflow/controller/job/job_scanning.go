@@ -492,7 +492,7 @@ func (j ScanningJobController) toJobTask(jobSubTaskID int, scanning *commonmodel
 		return nil, err
 	}
 
-	basicImage, err := commonrepo.NewBasicImageColl().Find(scanningInfo.ImageID)
+	basicImage, err := commonservice.FindBasicImage(scanningInfo.ImageID)
 	if err != nil {
 		return nil, fmt.Errorf("find basic image: %s error: %v", scanningInfo.ImageID, err)
 	}
@@ -17,13 +17,30 @@ limitations under the License.
 package job
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"net"
 	"net/url"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-
+	"time"
+
+	"github.com/Knetic/govaluate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/sets"
 
@@ -35,15 +52,22 @@ import (
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
 	codehostrepo "github.com/koderover/zadig/v2/pkg/microservice/systemconfig/core/codehost/repository/mongodb"
 	"github.com/koderover/zadig/v2/pkg/setting"
+	"github.com/koderover/zadig/v2/pkg/tool/clientmanager"
+	"github.com/koderover/zadig/v2/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
+	"github.com/koderover/zadig/v2/pkg/tool/metrics"
+	"github.com/koderover/zadig/v2/pkg/tool/tracing"
 	"github.com/koderover/zadig/v2/pkg/types"
 	"github.com/koderover/zadig/v2/pkg/types/step"
+	"github.com/koderover/zadig/v2/pkg/util"
 )
 
 type TestingJobController struct {
 	*BasicInfo
 
 	jobSpec *commonmodels.ZadigTestingJobSpec
+	// traceEnvs carries the trace context of the ToTask span into the envs of the job tasks
+	traceEnvs map[string]string
 }
 
 func CreateTestingJobController(job *commonmodels.Job, workflow *commonmodels.WorkflowV4) (Job, error) {
@@ -75,18 +99,126 @@ func (j TestingJobController) GetSpec() interface{} {
 }
 
 func (j TestingJobController) Validate(isExecution bool) error {
-	for _, svcTesting := range j.jobSpec.ServiceTestOptions {
+	testingNames := sets.NewString()
+	testingEnvKeys := make(map[string][]string)
+	testingKeyVals := make(map[string][]*commonmodels.KeyVal)
+	for _, svcTesting := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
 		if svcTesting.Name == "" {
 			return fmt.Errorf("test name cannot be empty in service testing")
 		}
+		testingNames.Insert(svcTesting.Name)
+		testingEnvKeys[svcTesting.Name] = append(testingEnvKeys[svcTesting.Name], getTestModuleEnvKeys(svcTesting.TestModule)...)
+		testingKeyVals[svcTesting.Name] = append(testingKeyVals[svcTesting.Name], getTestModuleKeyVals(svcTesting.TestModule)...)
+	}
+	for _, testing := range j.jobSpec.TestModuleOptions {
+		testingNames.Insert(testing.Name)
+		testingEnvKeys[testing.Name] = append(testingEnvKeys[testing.Name], getTestModuleEnvKeys(testing)...)
+		testingKeyVals[testing.Name] = append(testingKeyVals[testing.Name], getTestModuleKeyVals(testing)...)
+	}
+
+	// the testings are found in one query and shared by the checks below, the checks against the clusters of the
+	// testings are only made when the workflow is executed
+	testings, err := findTestingsByName(testingNames.List())
+	if err != nil {
+		return fmt.Errorf("failed to find testings: %s, error: %v", strings.Join(testingNames.List(), ", "), err)
+	}
+	testingInfos := make([]*commonmodels.Testing, 0, testingNames.Len())
+	for _, testingName := range testingNames.List() {
+		testingInfo, err := getTestingByName(testings, testingName)
+		if err != nil {
+			return err
+		}
+		testingInfos = append(testingInfos, testingInfo)
+
+		if err := validateTestingCache(testingInfo); err != nil {
+			return err
+		}
+		if err := validateTestingEnvKeys(testingInfo, testingEnvKeys[testingName]); err != nil {
+			return err
+		}
+		if err := j.validateTestingEnvReferences(testingInfo, testingKeyVals[testingName], testingEnvKeys[testingName]); err != nil {
+			return err
+		}
+		if err := validateTestingHostAliases(testingInfo); err != nil {
+			return err
+		}
+		if err := validateTestingResourceLimits(testingInfo); err != nil {
+			return err
+		}
+		if err := validateTestingStepTimeouts(testingInfo, 0); err != nil {
+			return err
+		}
+		if err := validateTestingVolumeClaims(testingInfo, isExecution); err != nil {
+			return err
+		}
+		if err := checkTestingImagePullSecrets(testingInfo, isExecution); err != nil {
+			return err
+		}
+		if err := checkTestingLogMaskPatterns(testingInfo); err != nil {
+			return err
+		}
+		if err := checkTestingShellInterpreter(testingInfo); err != nil {
+			return err
+		}
+	}
+	if err := validateTestingStorages(testingInfos); err != nil {
+		return err
+	}
+
+	if j.jobSpec.TestType == config.ServiceTestType && j.jobSpec.Source == config.SourceFromEnv {
+		if j.jobSpec.Env == "" {
+			return fmt.Errorf("env cannot be empty when the service targets come from env")
+		}
+		if isExecution {
+			if _, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: j.workflow.Project, EnvName: j.jobSpec.Env}); err != nil {
+				return fmt.Errorf("failed to find env: %s of project: %s, error: %v", j.jobSpec.Env, j.workflow.Project, err)
+			}
+		}
+	}
+
+	if j.jobSpec.TestType == config.ServiceTestType && j.jobSpec.Source == config.SourceFromCluster {
+		if err := validateTestingClusterSource(j.jobSpec.ClusterID, j.jobSpec.Namespace, j.jobSpec.LabelSelector, isExecution); err != nil {
+			return err
+		}
 	}
 
 	if isExecution {
-		for _, svcTesting := range j.jobSpec.ServiceAndTests {
+		for _, svcTesting := range getServiceTestings(j.jobSpec.ServiceAndTests) {
 			if svcTesting.Name == "" {
 				return fmt.Errorf("scan name cannot be empty in service scanning")
 			}
+			if svcTesting.TimeoutOverride < 0 {
+				return fmt.Errorf("timeout override of testing: %s must be positive", svcTesting.Name)
+			}
+			if svcTesting.TimeoutOverride > 0 {
+				if err := validateTestingStepTimeoutOverride(testings, svcTesting.Name, svcTesting.TimeoutOverride); err != nil {
+					return err
+				}
+			}
+			if err := validateTestingImageIDOverride(svcTesting.TestModule); err != nil {
+				return err
+			}
+		}
+		for _, testing := range j.jobSpec.TestModules {
+			if testing.TimeoutOverride < 0 {
+				return fmt.Errorf("timeout override of testing: %s must be positive", testing.Name)
+			}
+			if testing.TimeoutOverride > 0 {
+				if err := validateTestingStepTimeoutOverride(testings, testing.Name, testing.TimeoutOverride); err != nil {
+					return err
+				}
+			}
+			if err := validateTestingImageIDOverride(testing); err != nil {
+				return err
+			}
 		}
+		if j.jobSpec.MaxParallel < 0 {
+			return fmt.Errorf("max parallel of job: %s must not be negative", j.name)
+		}
+	}
+
+	if err := validateTestingOutputRefs(j.name, GetJobRankMap(j.workflow.Stages), j.getAllTestModules()); err != nil {
+		return err
 	}
 
 	return nil
@@ -108,24 +240,40 @@ func (j TestingJobController) Update(useUserInput bool, ticket *commonmodels.App
 	j.jobSpec.JobName = currJobSpec.JobName
 	j.jobSpec.OriginJobName = currJobSpec.OriginJobName
 	j.jobSpec.RefRepos = currJobSpec.RefRepos
+	j.jobSpec.Env = currJobSpec.Env
+	j.jobSpec.ClusterID = currJobSpec.ClusterID
+	j.jobSpec.Namespace = currJobSpec.Namespace
+	j.jobSpec.LabelSelector = currJobSpec.LabelSelector
 	j.jobSpec.TestModuleOptions = currJobSpec.TestModuleOptions
 	j.jobSpec.ServiceTestOptions = currJobSpec.ServiceTestOptions
+	j.jobSpec.GenerateReportIndex = currJobSpec.GenerateReportIndex
+	j.jobSpec.MaxParallel = currJobSpec.MaxParallel
 
-	testSvc := commonservice.NewTestingService()
+	optionNames := make([]string, 0)
+	for _, option := range j.jobSpec.TestModuleOptions {
+		optionNames = append(optionNames, option.Name)
+	}
+	for _, option := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
+		optionNames = append(optionNames, option.Name)
+	}
+	testings, err := findTestingsByName(optionNames)
+	if err != nil {
+		return fmt.Errorf("find testings error: %v", err)
+	}
 
 	// merge the input with the configuration
 	switch j.jobSpec.TestType {
 	case config.ServiceTestType:
-		configuredServiceScanningMap := make(map[string]*commonmodels.TestModule)
-		for _, configuredSvcTesting := range j.jobSpec.ServiceTestOptions {
+		configuredServiceScanningMap := make(map[string][]*commonmodels.TestModule)
+		for _, configuredSvcTesting := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
 			key := fmt.Sprintf("%s++%s", configuredSvcTesting.ServiceName, configuredSvcTesting.ServiceModule)
-			testInfo, err := testSvc.GetByName("", configuredSvcTesting.Name)
+			testInfo, err := getTestingByName(testings, configuredSvcTesting.Name)
 			if err != nil {
 				return err
 			}
 			configuredSvcTesting.TestModule.KeyVals = applyKeyVals(testInfo.PreTest.Envs.ToRuntimeList(), configuredSvcTesting.KeyVals, true)
 			configuredSvcTesting.TestModule.Repos = applyRepos(testInfo.Repos, configuredSvcTesting.Repos)
-			configuredServiceScanningMap[key] = configuredSvcTesting.TestModule
+			configuredServiceScanningMap[key] = append(configuredServiceScanningMap[key], configuredSvcTesting.TestModule)
 		}
 
 		newSelectedService := make([]*commonmodels.ServiceAndTest, 0)
@@ -134,14 +282,37 @@ func (j TestingJobController) Update(useUserInput bool, ticket *commonmodels.App
 			if _, ok := configuredServiceScanningMap[key]; !ok {
 				continue
 			}
-			svc.KeyVals = applyKeyVals(configuredServiceScanningMap[key].KeyVals, svc.KeyVals, false)
-			svc.Repos = applyRepos(configuredServiceScanningMap[key].Repos, svc.Repos)
+			selectedTests := make([]*commonmodels.TestModule, 0)
+			for _, test := range svc.GetTestModules() {
+				configuredTest := findServiceTestingOption(configuredServiceScanningMap[key], test.Name)
+				if configuredTest == nil {
+					continue
+				}
+				test.KeyVals = applyKeyVals(configuredTest.KeyVals, test.KeyVals, false)
+				test.Repos = applyRepos(configuredTest.Repos, test.Repos)
+				test.RetrySpec = configuredTest.RetrySpec
+				test.RunPolicy = configuredTest.RunPolicy
+				test.SkipDefaultClone = configuredTest.SkipDefaultClone
+				test.WorkingDir = configuredTest.WorkingDir
+				test.SecretRefs = configuredTest.SecretRefs
+				test.CleanupScript = configuredTest.CleanupScript
+				test.CollectPodLogsOnFailure = configuredTest.CollectPodLogsOnFailure
+				test.PathFilters = configuredTest.PathFilters
+				test.Shards = configuredTest.Shards
+				selectedTests = append(selectedTests, test)
+			}
+			if len(selectedTests) == 0 {
+				continue
+			}
+			if len(svc.TestModules) > 0 {
+				svc.TestModules = selectedTests
+			}
 			newSelectedService = append(newSelectedService, svc)
 		}
 		j.jobSpec.ServiceAndTests = newSelectedService
 	default:
 		for _, configuredTesting := range j.jobSpec.TestModuleOptions {
-			testInfo, err := testSvc.GetByName("", configuredTesting.Name)
+			testInfo, err := getTestingByName(testings, configuredTesting.Name)
 			if err != nil {
 				return err
 			}
@@ -162,10 +333,22 @@ func (j TestingJobController) Update(useUserInput bool, ticket *commonmodels.App
 				ShareStorageInfo: option.ShareStorageInfo,
 				KeyVals:          option.KeyVals,
 				Repos:            option.Repos,
+				RetrySpec:        option.RetrySpec,
+				RunPolicy:        option.RunPolicy,
+				SkipDefaultClone: option.SkipDefaultClone,
+				WorkingDir:       option.WorkingDir,
+				SecretRefs:       option.SecretRefs,
+				CleanupScript:    option.CleanupScript,
+				PathFilters:      option.PathFilters,
+				Shards:           option.Shards,
+
+				CollectPodLogsOnFailure: option.CollectPodLogsOnFailure,
 			}
 			if input, ok := userInputMap[option.Name]; ok {
 				item.KeyVals = applyKeyVals(item.KeyVals, input.KeyVals, false)
 				item.Repos = applyRepos(item.Repos, input.Repos)
+				item.TimeoutOverride = input.TimeoutOverride
+				item.ImageIDOverride = input.ImageIDOverride
 			}
 			newSelectedTest = append(newSelectedTest, item)
 		}
@@ -191,28 +374,94 @@ func (j TestingJobController) ClearOptions() {
 	return
 }
 
+// ClearSelection clears all the selected test modules and service modules, it is used when the spec is reused as a
+// template for new runs. Use ResetSelectionForRerun instead when a historical run is opened to run again.
 func (j TestingJobController) ClearSelection() {
 	j.jobSpec.TestModules = make([]*commonmodels.TestModule, 0)
 	j.jobSpec.ServiceAndTests = make([]*commonmodels.ServiceAndTest, 0)
 	return
 }
 
+// ResetSelectionForRerun clears the selection of a historical run which is opened to run again. The test modules and
+// the service modules picked by the user are cleared, while the service modules resolved from the origin job, the env
+// or the cluster are kept together with the origin job reference, so that the rerun resolves its targets the same way
+// the original run did.
+func (j TestingJobController) ResetSelectionForRerun() {
+	j.jobSpec.TestModules = make([]*commonmodels.TestModule, 0)
+	if j.jobSpec.TestType == config.ServiceTestType && j.jobSpec.Source != config.SourceFromJob &&
+		j.jobSpec.Source != config.SourceFromEnv && j.jobSpec.Source != config.SourceFromCluster {
+		j.jobSpec.ServiceAndTests = make([]*commonmodels.ServiceAndTest, 0)
+	}
+}
+
 func (j TestingJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, error) {
+	ctx, span := tracing.Tracer(config.TracingEnabled()).Start(context.Background(), "TestingJob.ToTask", trace.WithAttributes(
+		attribute.String("zadig.project", j.workflow.Project),
+		attribute.String("zadig.workflow", j.workflow.Name),
+		attribute.Int64("zadig.task_id", taskID),
+		attribute.String("zadig.job", j.name),
+		attribute.String("zadig.test_type", string(j.jobSpec.TestType)),
+	))
+	defer span.End()
+
+	j.traceEnvs = tracing.TraceContextEnvs(ctx)
+	resp, err := j.toTask(taskID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(attribute.Int("zadig.job_tasks", len(resp)))
+	return resp, nil
+}
+
+func (j TestingJobController) toTask(taskID int64) ([]*commonmodels.JobTask, error) {
 	logger := log.SugaredLogger()
 	resp := make([]*commonmodels.JobTask, 0)
 
+	defer func(start time.Time) {
+		metrics.RegisterTestingJobGeneration(string(j.jobSpec.TestType), j.workflow.Project, time.Since(start))
+	}(time.Now())
+
+	start := time.Now()
 	defaultS3, err := commonrepo.NewS3StorageColl().FindDefault()
-	if err != nil {
-		return resp, fmt.Errorf("failed to find default s3 storage, error: %v", err)
+	if err = j.observeLookup(testingLookupS3, start, err); err != nil {
+		j.registerGenerationFailure(testingGenerationFailureCause(err))
+		return resp, fmt.Errorf("failed to find default s3 storage, error: %w", err)
+	}
+
+	// the testings of all the modules are found up front in one query instead of one query per job task
+	testingNames := make([]string, 0)
+	for _, testing := range j.jobSpec.TestModules {
+		testingNames = append(testingNames, testing.Name)
+	}
+	for _, testing := range getServiceTestings(j.jobSpec.ServiceAndTests) {
+		testingNames = append(testingNames, testing.Name)
+	}
+	start = time.Now()
+	testings, err := findTestingsByName(testingNames)
+	if err = j.observeLookup(testingLookupTesting, start, err); err != nil {
+		j.registerGenerationFailure(testingGenerationFailureCause(err))
+		return resp, fmt.Errorf("find testings error: %w", err)
 	}
 
 	if j.jobSpec.TestType == config.ProductTestType {
-		for jobSubTaskID, testing := range j.jobSpec.TestModules {
-			jobTask, err := j.toJobTask(jobSubTaskID, testing, defaultS3, taskID, "", "", "", logger)
-			if err != nil {
-				return resp, err
+		jobSubTaskID := 0
+		for _, testing := range j.jobSpec.TestModules {
+			for _, matrixRow := range getTestingMatrixRows(j.jobSpec.Matrix) {
+				shardJobTasks := make([]*commonmodels.JobTask, 0)
+				for _, shard := range getTestingShards(testing.Shards) {
+					jobTask, err := j.toJobTask(jobSubTaskID, testing, testings, matrixRow, shard, defaultS3, taskID, "", "", "", "", logger)
+					if err != nil {
+						j.registerGenerationFailure(testingGenerationFailureCause(err))
+						return resp, err
+					}
+					jobSubTaskID++
+					shardJobTasks = append(shardJobTasks, jobTask)
+				}
+				setTestingShardReports(shardJobTasks, j.workflow.Name, taskID)
+				resp = append(resp, shardJobTasks...)
 			}
-			resp = append(resp, jobTask)
 		}
 	}
 
@@ -227,56 +476,301 @@ func (j TestingJobController) ToTask(taskID int64) ([]*commonmodels.JobTask, err
 	if j.jobSpec.TestType == config.ServiceTestType {
 		jobSubTaskID := 0
 		targetsMap := make(map[string]*commonmodels.ServiceTestTarget)
+		var targets []*commonmodels.ServiceTestTarget
+		var originJobInfo map[string]string
 		if j.jobSpec.Source == config.SourceFromJob {
 			referredJob := getOriginJobName(j.workflow, j.jobSpec.JobName)
-			targets, err := j.getReferredJobTargets(referredJob)
+			var referredJobType config.JobType
+			targets, referredJobType, err = j.getReferredJobTargets(referredJob)
 			if err != nil {
+				j.registerGenerationFailure(testingFailureCauseTargets)
 				return resp, fmt.Errorf("get origin refered job: %s targets failed, err: %v", referredJob, err)
 			}
-			for _, target := range targets {
-				key := fmt.Sprintf("%s++%s", target.ServiceName, target.ServiceModule)
-				targetsMap[key] = target
+			originJobInfo = getTestingOriginJobInfo(referredJob, referredJobType, targets)
+		} else if j.jobSpec.Source == config.SourceFromEnv {
+			targets, err = j.getEnvTargets(j.jobSpec.Env)
+			if err != nil {
+				j.registerGenerationFailure(testingFailureCauseTargets)
+				return resp, fmt.Errorf("get env: %s targets failed, err: %v", j.jobSpec.Env, err)
+			}
+		} else if j.jobSpec.Source == config.SourceFromCluster {
+			targets, err = getClusterTargets(j.jobSpec.ClusterID, j.jobSpec.Namespace, j.jobSpec.LabelSelector)
+			if err != nil {
+				j.registerGenerationFailure(testingFailureCauseTargets)
+				return resp, fmt.Errorf("get targets from namespace: %s of cluster: %s failed, err: %v", j.jobSpec.Namespace, j.jobSpec.ClusterID, err)
 			}
 		}
+		for _, target := range targets {
+			key := fmt.Sprintf("%s++%s", target.ServiceName, target.ServiceModule)
+			targetsMap[key] = target
+		}
 
-		for _, testing := range j.jobSpec.ServiceAndTests {
-			if j.jobSpec.Source == config.SourceFromJob {
-				key := fmt.Sprintf("%s++%s", testing.ServiceName, testing.ServiceModule)
+		serviceJobTasks := make([]*commonmodels.JobTask, 0)
+		// keyed by the testing as well, since a service module may have several testings
+		testedTargets := sets.NewString()
+		failedTargets := make(map[string]error)
+		for _, testing := range j.getSelectedServiceTestings() {
+			key := fmt.Sprintf("%s++%s", testing.ServiceName, testing.ServiceModule)
+			testingKey := fmt.Sprintf("%s++%s", key, testing.Name)
+			if j.jobSpec.Source == config.SourceFromJob || j.jobSpec.Source == config.SourceFromEnv || j.jobSpec.Source == config.SourceFromCluster {
 				if _, ok := targetsMap[key]; !ok {
 					// if a service is not referred but passed in, ignore it
 					continue
 				}
+			} else {
+				targets = append(targets, &commonmodels.ServiceTestTarget{ServiceName: testing.ServiceName, ServiceModule: testing.ServiceModule})
 			}
 
-			jobTask, err := j.toJobTask(jobSubTaskID, testing.TestModule, defaultS3, taskID, string(j.jobSpec.TestType), testing.ServiceName, testing.ServiceModule, logger)
-			if err != nil {
-				return resp, err
+			// a target whose testing can't be found is skipped so that the other services are still tested,
+			// any other error fails the job
+			shardJobTasks := make([]*commonmodels.JobTask, 0)
+			for _, shard := range getTestingShards(testing.Shards) {
+				jobTask, err := j.toJobTask(jobSubTaskID+len(shardJobTasks), testing.TestModule, testings, nil, shard, defaultS3, taskID, string(j.jobSpec.TestType), testing.ServiceName, testing.ServiceModule, testing.keyTestingName(), logger)
+				if err != nil {
+					j.registerGenerationFailure(testingGenerationFailureCause(err))
+					if !isTestingNotFound(err) {
+						return resp, err
+					}
+					logger.Warnf("skip testing: %s of service: %s/%s in job: %s, error: %v", testing.Name, testing.ServiceName, testing.ServiceModule, j.name, err)
+					failedTargets[testingKey] = err
+					shardJobTasks = nil
+					break
+				}
+				if jobInfo, ok := jobTask.JobInfo.(map[string]string); ok {
+					for k, v := range originJobInfo {
+						jobInfo[k] = v
+					}
+				}
+				shardJobTasks = append(shardJobTasks, jobTask)
+			}
+			if shardJobTasks == nil {
+				continue
+			}
+			testedTargets.Insert(testingKey)
+			setTestingShardReports(shardJobTasks, j.workflow.Name, taskID)
+			jobSubTaskID += len(shardJobTasks)
+			serviceJobTasks = append(serviceJobTasks, shardJobTasks...)
+		}
+
+		skippedTargets := getTestingSkippedTargets(targets, testedTargets, failedTargets)
+		if len(serviceJobTasks) == 0 && len(skippedTargets) > 0 {
+			return resp, fmt.Errorf("no service of job: %s can be tested: %s", j.name, strings.Join(skippedTargets, "; "))
+		}
+		if len(skippedTargets) > 0 {
+			for _, jobTask := range serviceJobTasks {
+				if jobInfo, ok := jobTask.JobInfo.(map[string]string); ok {
+					jobInfo["skipped_targets"] = strings.Join(skippedTargets, "; ")
+				}
+			}
+		}
+		resp = append(resp, serviceJobTasks...)
+	}
+
+	if err := setTestingTestedServices(resp); err != nil {
+		return resp, err
+	}
+	setTestingParallelBatches(resp, j.jobSpec.MaxParallel)
+	return resp, nil
+}
+
+// testingTestedTarget is an item of the TESTED_SERVICES output, the test modules of product tests have no service
+type testingTestedTarget struct {
+	TestingName   string `json:"testing_name,omitempty"`
+	ServiceName   string `json:"service_name,omitempty"`
+	ServiceModule string `json:"service_module,omitempty"`
+	// JobTasks is the number of job tasks the target is expanded into by the matrix and the shards
+	JobTasks int `json:"job_tasks"`
+}
+
+// setTestingTestedServices sets the TESTED_SERVICES output into the job info of all the job tasks. The targets are the
+// services or test modules with job tasks which really run the tests, the skipped and the warm cache only job tasks
+// are not counted.
+func setTestingTestedServices(jobTasks []*commonmodels.JobTask) error {
+	targets := make([]*testingTestedTarget, 0)
+	targetMap := make(map[string]*testingTestedTarget)
+	for _, jobTask := range jobTasks {
+		jobInfo, ok := jobTask.JobInfo.(map[string]string)
+		if !ok || jobTask.Status == config.StatusSkipped || jobInfo["warm_cache_only"] == "true" {
+			continue
+		}
+		target := &testingTestedTarget{ServiceName: jobInfo["service_name"], ServiceModule: jobInfo["service_module"]}
+		if target.ServiceName == "" {
+			target.TestingName = jobInfo["testing_name"]
+		}
+		key := strings.Join([]string{target.TestingName, target.ServiceName, target.ServiceModule}, "/")
+		if _, ok := targetMap[key]; !ok {
+			targetMap[key] = target
+			targets = append(targets, target)
+		}
+		targetMap[key].JobTasks++
+	}
+
+	b, err := json.Marshal(targets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tested services, error: %v", err)
+	}
+	for _, jobTask := range jobTasks {
+		if jobInfo, ok := jobTask.JobInfo.(map[string]string); ok {
+			jobInfo["tested_services"] = string(b)
+		}
+	}
+	return nil
+}
+
+// ResolveEffectiveEnv returns the envs of the test module as they are injected into its job task, without building the
+// job task. Credential values are masked. Matrix values are not included since they differ between the job tasks.
+func (j TestingJobController) ResolveEffectiveEnv(testModule *commonmodels.TestModule, taskID int64) ([]*commonmodels.KeyVal, error) {
+	logger := log.SugaredLogger()
+
+	testingInfo, err := commonrepo.NewTestingColl().Find(testModule.Name, "")
+	if err != nil {
+		return nil, fmt.Errorf("find testing: %s error: %v", testModule.Name, err)
+	}
+
+	testType, serviceName, serviceModule := "", "", ""
+	if j.jobSpec.TestType == config.ServiceTestType {
+		for _, svcTesting := range getServiceTestings(j.jobSpec.ServiceAndTests) {
+			if svcTesting.TestModule == testModule {
+				testType, serviceName, serviceModule = string(config.ServiceTestType), svcTesting.ServiceName, svcTesting.ServiceModule
+				break
 			}
-			jobSubTaskID++
-			resp = append(resp, jobTask)
 		}
+		if testType == "" {
+			return nil, fmt.Errorf("testing: %s is not a service testing of job: %s", testModule.Name, j.name)
+		}
+	}
+
+	customEnvs, err := getTestingCustomEnvs(testingInfo, testModule, nil, testType, serviceName, serviceModule)
+	if err != nil {
+		return nil, err
+	}
+	envs, err := j.getTestingEnvs(customEnvs, testModule, taskID, testType, serviceName, serviceModule, testingInfo.Infrastructure, logger)
+	if err != nil {
+		return nil, err
 	}
 
+	resp := make([]*commonmodels.KeyVal, 0, len(envs))
+	for _, env := range envs {
+		kv := *env
+		if kv.IsCredential {
+			kv.Value = setting.MaskValue
+		}
+		resp = append(resp, &kv)
+	}
 	return resp, nil
 }
 
+// getTestingCustomEnvs returns the envs of the testing template overridden by the job, the matrix row and the service
+func getTestingCustomEnvs(testingInfo *commonmodels.Testing, testing *commonmodels.TestModule, matrixRow map[string]string, testType, serviceName, serviceModule string) ([]*commonmodels.KeyVal, error) {
+	customEnvs := applyKeyVals(testingInfo.PreTest.Envs.ToRuntimeList(), testing.KeyVals, true).ToKVList()
+	if len(matrixRow) > 0 {
+		// matrix values take precedence over the envs configured in the testing module
+		customEnvs = mergeKeyVals(testingMatrixRowToKVs(matrixRow), customEnvs)
+	}
+	if testType == string(config.ServiceTestType) {
+		var err error
+		customEnvs, err = replaceServiceAndModules(customEnvs, serviceName, serviceModule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render service variables, error: %v", err)
+		}
+	}
+	return customEnvs, nil
+}
+
+// getTestingEnvs adds the workflow params, the builtin variables and the secrets to the custom envs
+func (j TestingJobController) getTestingEnvs(customEnvs []*commonmodels.KeyVal, testing *commonmodels.TestModule, taskID int64, testType, serviceName, serviceModule, infrastructure string, logger *zap.SugaredLogger) ([]*commonmodels.KeyVal, error) {
+	paramEnvs := generateKeyValsFromWorkflowParam(j.workflow.Params)
+	envs := mergeKeyVals(customEnvs, paramEnvs)
+
+	moduleIndex := testModuleIndex(j.jobSpec.TestModules, testing)
+	envs = append(envs, getTestingJobVariables(testing.Repos, taskID, j.workflow.Project, j.workflow.Name, j.workflow.DisplayName, testing.ProjectName, testing.Name, testType, serviceName, serviceModule, infrastructure, j.workflow.TestingTypedVariables, moduleIndex, j.traceEnvs, logger)...)
+	start := time.Now()
+	secretEnvs, err := resolveTestingSecretRefs(testing.SecretRefs)
+	if err = j.observeLookup(testingLookupSecret, start, err); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets of testing: %s, error: %w", testing.Name, err)
+	}
+	return append(envs, secretEnvs...), nil
+}
+
+// getTestingSkippedTargets returns the targets without a job task in order, each with the reason it is skipped,
+// targets are keyed by service++module in tested and failed
+func getTestingSkippedTargets(targets []*commonmodels.ServiceTestTarget, tested sets.String, failed map[string]error) []string {
+	resp := make([]string, 0)
+	seen := sets.NewString()
+	for _, target := range targets {
+		key := fmt.Sprintf("%s++%s", target.ServiceName, target.ServiceModule)
+		if seen.Has(key) {
+			continue
+		}
+		seen.Insert(key)
+
+		// tested and failed are keyed by service++module++testing
+		prefix := key + "++"
+		hasTesting := false
+		for _, testedKey := range tested.List() {
+			if strings.HasPrefix(testedKey, prefix) {
+				hasTesting = true
+				break
+			}
+		}
+		failedKeys := make([]string, 0)
+		for failedKey := range failed {
+			if strings.HasPrefix(failedKey, prefix) {
+				failedKeys = append(failedKeys, failedKey)
+			}
+		}
+		sort.Strings(failedKeys)
+		for _, failedKey := range failedKeys {
+			resp = append(resp, fmt.Sprintf("%s/%s/%s: %v", target.ServiceName, target.ServiceModule, strings.TrimPrefix(failedKey, prefix), failed[failedKey]))
+		}
+		if !hasTesting && len(failedKeys) == 0 {
+			resp = append(resp, fmt.Sprintf("%s/%s: no testing is configured", target.ServiceName, target.ServiceModule))
+		}
+	}
+	return resp
+}
+
+// setTestingParallelBatches tags the job tasks into batches of maxParallel tasks in order, so that the job controller
+// runs at most maxParallel of them at a time.
+func setTestingParallelBatches(jobTasks []*commonmodels.JobTask, maxParallel int) {
+	if maxParallel <= 0 {
+		return
+	}
+	for i, jobTask := range jobTasks {
+		jobTask.ParallelBatch = i/maxParallel + 1
+	}
+}
+
 func (j TestingJobController) SetRepo(repo *types.Repository) error {
 	for _, testing := range j.jobSpec.TestModules {
-		testing.Repos = applyRepos(testing.Repos, []*types.Repository{repo})
+		testing.Repos = applyWebhookRepo(testing.Repos, repo)
 	}
-	for _, serviceAndTest := range j.jobSpec.ServiceAndTests {
-		serviceAndTest.Repos = applyRepos(serviceAndTest.Repos, []*types.Repository{repo})
+	for _, serviceAndTest := range getServiceTestings(j.jobSpec.ServiceAndTests) {
+		serviceAndTest.Repos = applyWebhookRepo(serviceAndTest.Repos, repo)
 	}
 	return nil
 }
 
+// applyWebhookRepo merges the webhook repo only into the repos cloning the same codehost/owner/name, other repos are kept as they are.
+func applyWebhookRepo(base []*types.Repository, repo *types.Repository) []*types.Repository {
+	resp := make([]*types.Repository, 0, len(base))
+	for _, item := range base {
+		if item.GetKey() != repo.GetKey() || (item.CodehostID != 0 && repo.CodehostID != 0 && item.CodehostID != repo.CodehostID) {
+			resp = append(resp, item)
+			continue
+		}
+		resp = append(resp, applyRepos([]*types.Repository{item}, []*types.Repository{repo})...)
+	}
+	return resp
+}
+
 func (j TestingJobController) SetRepoCommitInfo() error {
 	for _, test := range j.jobSpec.TestModules {
 		if err := setRepoInfo(test.Repos); err != nil {
 			return err
 		}
 	}
-	for _, serviceAndTest := range j.jobSpec.ServiceAndTests {
+	for _, serviceAndTest := range getServiceTestings(j.jobSpec.ServiceAndTests) {
 		if err := setRepoInfo(serviceAndTest.Repos); err != nil {
 			return err
 		}
@@ -310,13 +804,20 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 	}
 
 	if getRuntimeVariables {
+		resp = append(resp, &commonmodels.KeyVal{
+			Key:          strings.Join([]string{"job", j.name, "output", setting.WorkflowTestingJobOutputKeyTestedServices}, "."),
+			Value:        "",
+			Type:         "string",
+			IsCredential: false,
+		})
+
 		testNames := make([]string, 0)
 		if j.jobSpec.TestType == config.ProductTestType {
 			for _, scanning := range j.jobSpec.TestModuleOptions {
 				testNames = append(testNames, scanning.Name)
 			}
 		} else if j.jobSpec.TestType == config.ServiceTestType {
-			for _, scanning := range j.jobSpec.ServiceTestOptions {
+			for _, scanning := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
 				testNames = append(testNames, scanning.Name)
 			}
 		}
@@ -329,7 +830,7 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 			if j.jobSpec.TestType == config.ServiceTestType {
 				if getPlaceHolderVariables {
 					jobKey := strings.Join([]string{j.name, "<SERVICE>", "<MODULE>"}, ".")
-					for _, output := range testInfo.Outputs {
+					for _, output := range ensureTestingOutputs(testInfo) {
 						resp = append(resp, &commonmodels.KeyVal{
 							Key:          strings.Join([]string{"job", jobKey, "output", output.Name}, "."),
 							Value:        "",
@@ -346,12 +847,50 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 					})
 				}
 				if getServiceSpecificVariables {
-					for _, test := range j.jobSpec.ServiceTestOptions {
+					for _, test := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
 						if testInfo.Name != test.Name {
 							continue
 						}
-						jobKey := strings.Join([]string{j.name, test.ServiceName, test.ServiceModule}, ".")
-						for _, output := range testInfo.Outputs {
+						for _, shardKey := range getTestingShardKeys(test.Shards) {
+							jobKey := genJobKey(j.name, test.keyParts()...)
+							if shardKey != "" {
+								jobKey = genJobKey(jobKey, shardKey)
+							}
+							for _, output := range ensureTestingOutputs(testInfo) {
+								resp = append(resp, &commonmodels.KeyVal{
+									Key:          strings.Join([]string{"job", jobKey, "output", output.Name}, "."),
+									Value:        "",
+									Type:         "string",
+									IsCredential: false,
+								})
+							}
+							// Add status variable for each service/module
+							resp = append(resp, &commonmodels.KeyVal{
+								Key:          strings.Join([]string{"job", jobKey, "status"}, "."),
+								Value:        "",
+								Type:         "string",
+								IsCredential: false,
+							})
+						}
+					}
+				}
+			} else {
+				shards := 0
+				for _, option := range j.jobSpec.TestModuleOptions {
+					if option.Name == testInfo.Name {
+						shards = option.Shards
+					}
+				}
+				for _, matrixRow := range getTestingMatrixRows(j.jobSpec.Matrix) {
+					for _, shardKey := range getTestingShardKeys(shards) {
+						jobKey := strings.Join([]string{j.name, testInfo.Name}, ".")
+						if len(matrixRow) > 0 {
+							jobKey = strings.Join([]string{jobKey, genTestingMatrixKey(matrixRow)}, ".")
+						}
+						if shardKey != "" {
+							jobKey = genJobKey(jobKey, shardKey)
+						}
+						for _, output := range ensureTestingOutputs(testInfo) {
 							resp = append(resp, &commonmodels.KeyVal{
 								Key:          strings.Join([]string{"job", jobKey, "output", output.Name}, "."),
 								Value:        "",
@@ -359,7 +898,7 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 								IsCredential: false,
 							})
 						}
-						// Add status variable for each service/module
+
 						resp = append(resp, &commonmodels.KeyVal{
 							Key:          strings.Join([]string{"job", jobKey, "status"}, "."),
 							Value:        "",
@@ -368,23 +907,6 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 						})
 					}
 				}
-			} else {
-				jobKey := strings.Join([]string{j.name, testInfo.Name}, ".")
-				for _, output := range testInfo.Outputs {
-					resp = append(resp, &commonmodels.KeyVal{
-						Key:          strings.Join([]string{"job", jobKey, "output", output.Name}, "."),
-						Value:        "",
-						Type:         "string",
-						IsCredential: false,
-					})
-				}
-
-				resp = append(resp, &commonmodels.KeyVal{
-					Key:          strings.Join([]string{"job", jobKey, "status"}, "."),
-					Value:        "",
-					Type:         "string",
-					IsCredential: false,
-				})
 			}
 		}
 	}
@@ -407,7 +929,7 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 			})
 
 			keySet := sets.NewString()
-			for _, service := range j.jobSpec.ServiceTestOptions {
+			for _, service := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
 				for _, keyVal := range service.KeyVals {
 					keySet.Insert(keyVal.Key)
 				}
@@ -425,12 +947,12 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 	}
 
 	if getServiceSpecificVariables {
-		targets := j.jobSpec.ServiceTestOptions
+		targets := getServiceTestings(j.jobSpec.ServiceTestOptions)
 		if useUserInputValue {
-			targets = j.jobSpec.ServiceAndTests
+			targets = j.getSelectedServiceTestings()
 		}
 		for _, service := range targets {
-			jobKey := strings.Join([]string{"job", j.name, service.ServiceName, service.ServiceModule}, ".")
+			jobKey := strings.Join(append([]string{"job", j.name}, service.keyParts()...), ".")
 			for _, keyVal := range service.KeyVals {
 				resp = append(resp, &commonmodels.KeyVal{
 					Key:          fmt.Sprintf("%s.%s", jobKey, keyVal.Key),
@@ -460,28 +982,66 @@ func (j TestingJobController) GetVariableList(jobName string, getAggregatedVaria
 }
 
 func (j TestingJobController) GetUsedRepos() ([]*types.Repository, error) {
+	modules, reposByModule := j.getReposByModule()
 	resp := make([]*types.Repository, 0)
+	for _, module := range modules {
+		resp = append(resp, reposByModule[module]...)
+	}
+	return resp, nil
+}
+
+// GetReposByModule returns the repos of each test module, keyed by the testing name for product tests
+// and by <testing name>/<service>/<module> for service tests
+func (j TestingJobController) GetReposByModule() (map[string][]*types.Repository, error) {
+	_, reposByModule := j.getReposByModule()
+	return reposByModule, nil
+}
+
+// getReposByModule returns the modules in the order of the options together with their repos
+func (j TestingJobController) getReposByModule() ([]string, map[string][]*types.Repository) {
+	modules := make([]string, 0)
+	reposByModule := make(map[string][]*types.Repository)
+
+	testingNames := make([]string, 0)
+	for _, test := range j.jobSpec.TestModuleOptions {
+		testingNames = append(testingNames, test.Name)
+	}
+	for _, test := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
+		testingNames = append(testingNames, test.Name)
+	}
+	testings, err := findTestingsByName(testingNames)
+	if err != nil {
+		log.Errorf("find testings error: %v", err)
+		return modules, reposByModule
+	}
+
 	if j.jobSpec.TestType == config.ProductTestType || j.jobSpec.TestType == "" {
 		for _, test := range j.jobSpec.TestModuleOptions {
-			testingInfo, err := commonrepo.NewTestingColl().Find(test.Name, "")
+			testingInfo, err := getTestingByName(testings, test.Name)
 			if err != nil {
 				log.Errorf("find testing: %s error: %v", test.Name, err)
 				continue
 			}
-			resp = append(resp, applyRepos(testingInfo.Repos, test.Repos)...)
+			if _, ok := reposByModule[test.Name]; !ok {
+				modules = append(modules, test.Name)
+			}
+			reposByModule[test.Name] = append(reposByModule[test.Name], applyRepos(testingInfo.Repos, test.Repos)...)
 		}
 	} else if j.jobSpec.TestType == config.ServiceTestType {
-		for _, test := range j.jobSpec.ServiceTestOptions {
-			testingInfo, err := commonrepo.NewTestingColl().Find(test.Name, "")
+		for _, test := range getServiceTestings(j.jobSpec.ServiceTestOptions) {
+			testingInfo, err := getTestingByName(testings, test.Name)
 			if err != nil {
 				log.Errorf("find testing: %s error: %v", test.Name, err)
 				continue
 			}
-			resp = append(resp, applyRepos(testingInfo.Repos, test.Repos)...)
+			module := fmt.Sprintf("%s/%s/%s", test.Name, test.ServiceName, test.ServiceModule)
+			if _, ok := reposByModule[module]; !ok {
+				modules = append(modules, module)
+			}
+			reposByModule[module] = append(reposByModule[module], applyRepos(testingInfo.Repos, test.Repos)...)
 		}
 	}
-
-	return resp, nil
+	return modules, reposByModule
 }
 
 func (j TestingJobController) RenderDynamicVariableOptions(key string, option *RenderDynamicVariableValue) ([]string, error) {
@@ -492,7 +1052,8 @@ func (j TestingJobController) IsServiceTypeJob() bool {
 	return j.jobSpec.TestType == config.ServiceTestType
 }
 
-func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmodels.ServiceTestTarget, error) {
+// getReferredJobTargets returns the service targets of the referred job and its type
+func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmodels.ServiceTestTarget, config.JobType, error) {
 	servicetargets := make([]*commonmodels.ServiceTestTarget, 0)
 	for _, stage := range j.workflow.Stages {
 		for _, job := range stage.Jobs {
@@ -502,7 +1063,7 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 			if job.JobType == config.JobZadigBuild {
 				buildSpec := &commonmodels.ZadigBuildJobSpec{}
 				if err := commonmodels.IToi(job.Spec, buildSpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				for _, build := range buildSpec.ServiceAndBuilds {
 					servicetargets = append(servicetargets, &commonmodels.ServiceTestTarget{
@@ -510,12 +1071,12 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 						ServiceModule: build.ServiceModule,
 					})
 				}
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 			if job.JobType == config.JobZadigDistributeImage {
 				distributeSpec := &commonmodels.ZadigDistributeImageJobSpec{}
 				if err := commonmodels.IToi(job.Spec, distributeSpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				for _, distribute := range distributeSpec.Targets {
 					servicetargets = append(servicetargets, &commonmodels.ServiceTestTarget{
@@ -523,12 +1084,12 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 						ServiceModule: distribute.ServiceModule,
 					})
 				}
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 			if job.JobType == config.JobZadigDeploy {
 				deploySpec := &commonmodels.ZadigDeployJobSpec{}
 				if err := commonmodels.IToi(job.Spec, deploySpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				for _, svc := range deploySpec.Services {
 					for _, module := range svc.Modules {
@@ -538,12 +1099,12 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 						})
 					}
 				}
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 			if job.JobType == config.JobZadigScanning {
 				scanningSpec := &commonmodels.ZadigScanningJobSpec{}
 				if err := commonmodels.IToi(job.Spec, scanningSpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				scanTargets := make([]*commonmodels.ServiceTestTarget, 0)
 				for _, svc := range scanningSpec.ServiceAndScannings {
@@ -553,12 +1114,12 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 					})
 				}
 				servicetargets = scanTargets
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 			if job.JobType == config.JobZadigTesting {
 				testingSpec := &commonmodels.ZadigTestingJobSpec{}
 				if err := commonmodels.IToi(job.Spec, testingSpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				testTargets := make([]*commonmodels.ServiceTestTarget, 0)
 				for _, svc := range testingSpec.ServiceAndTests {
@@ -568,15 +1129,15 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 					})
 				}
 				servicetargets = testTargets
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 			if job.JobType == config.JobFreestyle {
 				deploySpec := &commonmodels.FreestyleJobSpec{}
 				if err := commonmodels.IToi(job.Spec, deploySpec); err != nil {
-					return servicetargets, err
+					return servicetargets, job.JobType, err
 				}
 				if deploySpec.FreestyleJobType != config.ServiceFreeStyleJobType {
-					return servicetargets, fmt.Errorf("freestyle job type %s not supported in reference", deploySpec.FreestyleJobType)
+					return servicetargets, job.JobType, fmt.Errorf("freestyle job type %s not supported in reference", deploySpec.FreestyleJobType)
 				}
 				for _, svc := range deploySpec.Services {
 					target := &commonmodels.ServiceTestTarget{
@@ -585,56 +1146,219 @@ func (j TestingJobController) getReferredJobTargets(jobName string) ([]*commonmo
 					}
 					servicetargets = append(servicetargets, target)
 				}
-				return servicetargets, nil
+				return servicetargets, job.JobType, nil
 			}
 		}
 	}
-	return nil, fmt.Errorf("TestingJob: refered job %s not found", jobName)
+	return nil, "", fmt.Errorf("TestingJob: refered job %s not found", jobName)
 }
 
-func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.TestModule, defaultS3 *commonmodels.S3Storage, taskID int64, testType, serviceName, serviceModule string, logger *zap.SugaredLogger) (*commonmodels.JobTask, error) {
-	testingInfo, err := commonrepo.NewTestingColl().Find(testing.Name, "")
-	if err != nil {
-		return nil, fmt.Errorf("find testing: %s error: %v", testing.Name, err)
+// getTestingOriginJobInfo returns the job info recording the job the service targets are referred from,
+// so that the tests can be traced back to the artifacts built or deployed by it
+func getTestingOriginJobInfo(jobName string, jobType config.JobType, targets []*commonmodels.ServiceTestTarget) map[string]string {
+	targetKeys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		targetKeys = append(targetKeys, fmt.Sprintf("%s/%s", target.ServiceName, target.ServiceModule))
 	}
-	basicImage, err := commonrepo.NewBasicImageColl().Find(testingInfo.PreTest.ImageID)
-	if err != nil {
-		return nil, fmt.Errorf("find basic image: %s error: %v", testingInfo.PreTest.ImageID, err)
+	return map[string]string{
+		"origin_job_name": jobName,
+		"origin_job_type": string(jobType),
+		"origin_targets":  strings.Join(targetKeys, ","),
 	}
-	registries, err := commonservice.ListRegistryNamespaces("", true, logger)
+}
+
+// getEnvTargets returns the service modules deployed in the given environment of the project
+func (j TestingJobController) getEnvTargets(envName string) ([]*commonmodels.ServiceTestTarget, error) {
+	product, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: j.workflow.Project, EnvName: envName})
 	if err != nil {
-		return nil, fmt.Errorf("list registries error: %v", err)
-	}
-	randStr := rand.String(5)
-	jobKey := genJobKey(j.name, testing.Name)
-	jobName := GenJobName(j.workflow, j.name, jobSubTaskID)
-	jobDisplayName := genJobDisplayName(j.name, testing.Name)
-	jobInfo := map[string]string{
-		JobNameKey:     j.name,
-		"test_type":    testType,
-		"testing_name": testing.Name,
-		"rand_str":     randStr,
+		return nil, fmt.Errorf("failed to find env: %s of project: %s, error: %v", envName, j.workflow.Project, err)
 	}
+	return getProductServiceTargets(product), nil
+}
 
-	customEnvs := applyKeyVals(testingInfo.PreTest.Envs.ToRuntimeList(), testing.KeyVals, true).ToKVList()
-	if testType == string(config.ServiceTestType) {
-		jobDisplayName = genJobDisplayName(j.name, serviceName, serviceModule)
-		jobKey = genJobKey(j.name, serviceName, serviceModule)
-		jobInfo = map[string]string{
-			JobNameKey:       j.name,
-			"test_type":      testType,
-			"service_name":   serviceName,
-			"service_module": serviceModule,
+// getProductServiceTargets returns the service modules of the product in the order of its service groups,
+// so the subtasks of the job keep the same order between runs
+func getProductServiceTargets(product *commonmodels.Product) []*commonmodels.ServiceTestTarget {
+	servicetargets := make([]*commonmodels.ServiceTestTarget, 0)
+	for _, group := range product.Services {
+		for _, svc := range group {
+			if !svc.FromZadig() {
+				continue
+			}
+			for _, container := range svc.Containers {
+				servicetargets = append(servicetargets, &commonmodels.ServiceTestTarget{
+					ServiceName:   svc.ServiceName,
+					ServiceModule: container.Name,
+				})
+			}
 		}
+	}
+	return servicetargets
+}
 
-		customEnvs, err = replaceServiceAndModules(customEnvs, serviceName, serviceModule)
-		if err != nil {
-			return nil, fmt.Errorf("failed to render service variables, error: %v", err)
-		}
+func validateTestingClusterSource(clusterID, namespace, labelSelector string, checkCluster bool) error {
+	if clusterID == "" || namespace == "" {
+		return fmt.Errorf("cluster and namespace cannot be empty when the service targets come from cluster")
+	}
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return fmt.Errorf("invalid label selector: %s, error: %v", labelSelector, err)
+	}
+	if !checkCluster {
+		return nil
 	}
 
-	jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{}
-	jobTask := &commonmodels.JobTask{
+	if _, err := commonrepo.NewK8SClusterColl().Get(clusterID); err != nil {
+		return fmt.Errorf("failed to find cluster: %s, error: %v", clusterID, err)
+	}
+
+	kubeClient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get kube client of cluster: %s, error: %v", clusterID, err)
+	}
+	_, found, err := getter.GetNamespace(namespace, kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to get namespace: %s of cluster: %s, error: %v", namespace, clusterID, err)
+	}
+	if !found {
+		return fmt.Errorf("namespace: %s not found in cluster: %s", namespace, clusterID)
+	}
+	return nil
+}
+
+// getClusterTargets returns the containers of the deployments and statefulsets matching the label selector in the namespace,
+// the service name is taken from the zadig service label of the workload and falls back to the workload name
+func getClusterTargets(clusterID, namespace, labelSelector string) ([]*commonmodels.ServiceTestTarget, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %s, error: %v", labelSelector, err)
+	}
+	kubeClient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kube client of cluster: %s, error: %v", clusterID, err)
+	}
+
+	deployments, err := getter.ListDeployments(namespace, selector, kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments, error: %v", err)
+	}
+	statefulSets, err := getter.ListStatefulSets(namespace, selector, kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets, error: %v", err)
+	}
+
+	servicetargets := make([]*commonmodels.ServiceTestTarget, 0)
+	targetKeys := sets.NewString()
+	addTargets := func(workloadName string, workloadLabels map[string]string, containers []corev1.Container) {
+		serviceName := workloadLabels[setting.ServiceLabel]
+		if serviceName == "" {
+			serviceName = workloadName
+		}
+		for _, container := range containers {
+			target := &commonmodels.ServiceTestTarget{ServiceName: serviceName, ServiceModule: container.Name}
+			if targetKeys.Has(target.GetKey()) {
+				continue
+			}
+			targetKeys.Insert(target.GetKey())
+			servicetargets = append(servicetargets, target)
+		}
+	}
+	for _, deployment := range deployments {
+		addTargets(deployment.Name, deployment.Labels, deployment.Spec.Template.Spec.Containers)
+	}
+	for _, statefulSet := range statefulSets {
+		addTargets(statefulSet.Name, statefulSet.Labels, statefulSet.Spec.Template.Spec.Containers)
+	}
+
+	if len(servicetargets) == 0 {
+		return nil, fmt.Errorf("no workload in namespace: %s of cluster: %s matches label selector: %s", namespace, clusterID, labelSelector)
+	}
+	return servicetargets, nil
+}
+
+// toJobTask generates the job task of the test module, testings are the testing definitions found by ToTask
+func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.TestModule, testings map[string]*commonmodels.Testing, matrixRow map[string]string, shard *testingShard, defaultS3 *commonmodels.S3Storage, taskID int64, testType, serviceName, serviceModule, serviceTestingName string, logger *zap.SugaredLogger) (*commonmodels.JobTask, error) {
+	testingInfo, err := getTestingByName(testings, testing.Name)
+	if err != nil {
+		return nil, &testingLookupError{lookup: testingLookupTesting, err: err}
+	}
+	imageID := testingInfo.PreTest.ImageID
+	if testing.ImageIDOverride != "" {
+		imageID = testing.ImageIDOverride
+	}
+	start := time.Now()
+	basicImage, err := commonservice.FindBasicImage(imageID)
+	if err = j.observeLookup(testingLookupBasicImage, start, err); err != nil {
+		return nil, fmt.Errorf("find basic image: %s error: %w", imageID, err)
+	}
+	start = time.Now()
+	registries, err := commonservice.ListRegistryNamespacesByProject(j.workflow.Project, true, logger)
+	if err = j.observeLookup(testingLookupRegistry, start, err); err != nil {
+		return nil, fmt.Errorf("list registries error: %w", err)
+	}
+	randStr := rand.String(5)
+	jobKey := genJobKey(j.name, testing.Name)
+	jobName := GenJobName(j.workflow, j.name, jobSubTaskID)
+	jobDisplayName := genJobDisplayName(j.name, testing.Name)
+	jobInfo := map[string]string{
+		JobNameKey:     j.name,
+		"test_type":    testType,
+		"testing_name": testing.Name,
+		"rand_str":     randStr,
+	}
+
+	customEnvs, err := getTestingCustomEnvs(testingInfo, testing, matrixRow, testType, serviceName, serviceModule)
+	if err != nil {
+		return nil, err
+	}
+	customEnvs, err = j.resolveTestingEnvOutputRefs(customEnvs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the outputs referred by testing: %s, error: %v", testing.Name, err)
+	}
+	if len(matrixRow) > 0 {
+		matrixKey := genTestingMatrixKey(matrixRow)
+		jobKey = genJobKey(j.name, testing.Name, matrixKey)
+		jobDisplayName = genJobDisplayName(j.name, testing.Name, genTestingMatrixDisplayName(matrixRow))
+		jobInfo["matrix_key"] = matrixKey
+	}
+	if testType == string(config.ServiceTestType) {
+		jobDisplayName = genJobDisplayName(j.name, serviceName, serviceModule)
+		jobKey = genJobKey(j.name, serviceName, serviceModule)
+		jobInfo = map[string]string{
+			JobNameKey:       j.name,
+			"test_type":      testType,
+			"service_name":   serviceName,
+			"service_module": serviceModule,
+		}
+		if serviceTestingName != "" {
+			jobDisplayName = genJobDisplayName(jobDisplayName, serviceTestingName)
+			jobKey = genJobKey(jobKey, serviceTestingName)
+			jobInfo["testing_name"] = serviceTestingName
+		}
+	}
+	unshardedJobKey := jobKey
+	if shard != nil {
+		customEnvs = mergeKeyVals(shard.toKVs(), customEnvs)
+		jobKey = genJobKey(jobKey, shard.key())
+		jobDisplayName = genJobDisplayName(jobDisplayName, shard.key())
+		jobInfo["shard_index"] = strconv.Itoa(shard.Index)
+		jobInfo["shard_total"] = strconv.Itoa(shard.Total)
+	}
+	if testing.WarmCacheOnly {
+		jobDisplayName = genJobDisplayName(jobDisplayName, testingWarmCacheDisplayName)
+		jobInfo["warm_cache_only"] = "true"
+	}
+
+	timeout := testingInfo.Timeout
+	if testing.TimeoutOverride > 0 {
+		timeout = testing.TimeoutOverride
+		jobInfo["timeout_override"] = strconv.Itoa(testing.TimeoutOverride)
+	}
+	if testing.ImageIDOverride != "" {
+		jobInfo["image_id_override"] = testing.ImageIDOverride
+	}
+
+	jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{}
+	jobTask := &commonmodels.JobTask{
 		Key:            jobKey,
 		Name:           jobName,
 		DisplayName:    jobDisplayName,
@@ -642,15 +1366,24 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 		JobInfo:        jobInfo,
 		JobType:        string(config.JobZadigTesting),
 		Spec:           jobTaskSpec,
-		Timeout:        int64(testingInfo.Timeout),
-		Outputs:        testingInfo.Outputs,
+		Timeout:        int64(timeout),
+		Outputs:        ensureTestingOutputs(testingInfo),
 		Infrastructure: testingInfo.Infrastructure,
 		VMLabels:       testingInfo.VMLabels,
 		ErrorPolicy:    j.errorPolicy,
 		ExecutePolicy:  j.executePolicy,
+		Labels: map[string]string{
+			setting.JobLabelProjectKey:  j.workflow.Project,
+			setting.JobLabelWorkflowKey: j.workflow.Name,
+			setting.JobLabelTestingKey:  testing.Name,
+		},
 	}
+	if testingInfo.Team != "" {
+		jobTask.Labels[setting.JobLabelTeamKey] = testingInfo.Team
+	}
+	jobTask.ErrorPolicy = getTestingRetryErrorPolicy(testing.RetrySpec, jobTask.ErrorPolicy)
 	jobTaskSpec.Properties = commonmodels.JobProperties{
-		Timeout:             int64(testingInfo.Timeout),
+		Timeout:             int64(timeout),
 		ResourceRequest:     testingInfo.PreTest.ResReq,
 		ResReqSpec:          testingInfo.PreTest.ResReqSpec,
 		CustomEnvs:          customEnvs,
@@ -662,18 +1395,68 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 		ShareStorageDetails: getShareStorageDetail(j.workflow.ShareStorages, testing.ShareStorageInfo, j.workflow.Name, taskID),
 		CustomLabels:        testingInfo.PreTest.CustomLabels,
 		CustomAnnotations:   testingInfo.PreTest.CustomAnnotations,
+
+		TerminationGracePeriodSeconds: testingInfo.PreTest.TerminationGracePeriodSeconds,
+	}
+	if j.workflow.RegistryPreflightCheck && jobTask.Infrastructure != setting.JobVMInfrastructure {
+		testingImage := basicImage.Value
+		if testingInfo.PreTest.ImageFrom != setting.ImageFromCustom {
+			testingImage = strings.ReplaceAll(config.BuildBaseImage(), "${BuildOS}", basicImage.Value)
+		}
+		if err := checkImageRegistryReachable(testingImage, registries, logger); err != nil {
+			return nil, fmt.Errorf("registry pre-flight check of testing: %s failed: %v", testing.Name, err)
+		}
+	}
+	if len(testingInfo.PreTest.Sidecars) > 0 {
+		if jobTask.Infrastructure == setting.JobVMInfrastructure {
+			logger.Warnf("sidecars of testing: %s are ignored since they are not supported on vm infrastructure", testing.Name)
+		} else {
+			jobTaskSpec.Properties.Sidecars = testingInfo.PreTest.Sidecars
+		}
+	}
+	if len(testingInfo.PreTest.ExtraImagePullSecrets) > 0 && jobTask.Infrastructure != setting.JobVMInfrastructure {
+		jobTaskSpec.Properties.ExtraImagePullSecrets = testingInfo.PreTest.ExtraImagePullSecrets
+	}
+	jobTaskSpec.Properties.LogMaskPatterns = testingInfo.LogMaskPatterns
+	if testingInfo.PreTest.ResLimitSpec != nil {
+		if jobTask.Infrastructure == setting.JobVMInfrastructure {
+			logger.Warnf("resource limits of testing: %s are ignored since they are not supported on vm infrastructure", testing.Name)
+		} else {
+			jobTaskSpec.Properties.ResLimitSpec = testingInfo.PreTest.ResLimitSpec
+		}
+	}
+	if testingInfo.PreTest.NodeStrategy != nil {
+		if jobTask.Infrastructure == setting.JobVMInfrastructure {
+			logger.Warnf("node strategy of testing: %s is ignored since it is not supported on vm infrastructure", testing.Name)
+		} else {
+			jobTaskSpec.Properties.NodeStrategy = testingInfo.PreTest.NodeStrategy
+		}
+	}
+	if len(testingInfo.PreTest.VolumeClaims) > 0 {
+		if jobTask.Infrastructure == setting.JobVMInfrastructure {
+			logger.Warnf("volume claims of testing: %s are ignored since they are not supported on vm infrastructure", testing.Name)
+		} else {
+			jobTaskSpec.Properties.Storages = getTestingVolumeClaimStorages(testingInfo.PreTest.VolumeClaims)
+		}
+	}
+	if jobTask.Infrastructure != setting.JobVMInfrastructure {
+		jobTaskSpec.Properties.HostAliases = testingInfo.PreTest.HostAliases
+		// the logs are read from the kubernetes api after the pod ends, there is no such pod on vm
+		jobTaskSpec.Properties.CollectPodLogsOnFailure = testing.CollectPodLogsOnFailure
 	}
 
 	cacheS3 := &commonmodels.S3Storage{}
+	start = time.Now()
 	clusterInfo, err := commonrepo.NewK8SClusterColl().Get(testingInfo.PreTest.ClusterID)
-	if err != nil {
-		return jobTask, fmt.Errorf("failed to find cluster: %s, error: %v", testingInfo.PreTest.ClusterID, err)
+	if err = j.observeLookup(testingLookupCluster, start, err); err != nil {
+		return jobTask, fmt.Errorf("failed to find cluster: %s, error: %w", testingInfo.PreTest.ClusterID, err)
 	}
 
 	if jobTask.Infrastructure == setting.JobVMInfrastructure {
 		jobTaskSpec.Properties.CacheEnable = testingInfo.CacheEnable
 		jobTaskSpec.Properties.CacheDirType = testingInfo.CacheDirType
 		jobTaskSpec.Properties.CacheUserDir = testingInfo.CacheUserDir
+		jobTaskSpec.Properties.CacheCompression = testingInfo.CacheCompression
 	} else {
 		if clusterInfo.Cache.MediumType == "" {
 			jobTaskSpec.Properties.CacheEnable = false
@@ -682,38 +1465,47 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 			jobTaskSpec.Properties.CacheEnable = testingInfo.CacheEnable
 			jobTaskSpec.Properties.CacheDirType = testingInfo.CacheDirType
 			jobTaskSpec.Properties.CacheUserDir = testingInfo.CacheUserDir
+			jobTaskSpec.Properties.CacheCompression = testingInfo.CacheCompression
 
 			if jobTaskSpec.Properties.Cache.MediumType == types.ObjectMedium {
+				start = time.Now()
 				cacheS3, err = commonrepo.NewS3StorageColl().Find(jobTaskSpec.Properties.Cache.ObjectProperties.ID)
-				if err != nil {
-					return jobTask, fmt.Errorf("find cache s3 storage: %s error: %v", jobTaskSpec.Properties.Cache.ObjectProperties.ID, err)
+				if err = j.observeLookup(testingLookupS3, start, err); err != nil {
+					return jobTask, fmt.Errorf("find cache s3 storage: %s error: %w", jobTaskSpec.Properties.Cache.ObjectProperties.ID, err)
 				}
 			}
 		}
 		if jobTaskSpec.Properties.CacheEnable {
 			jobTaskSpec.Properties.CacheUserDir = commonutil.RenderEnv(jobTaskSpec.Properties.CacheUserDir, jobTaskSpec.Properties.Envs)
-			if jobTaskSpec.Properties.Cache.MediumType == types.NFSMedium {
-				jobTaskSpec.Properties.Cache.NFSProperties.Subpath = commonutil.RenderEnv(jobTaskSpec.Properties.Cache.NFSProperties.Subpath, jobTaskSpec.Properties.Envs)
-			} else if jobTaskSpec.Properties.Cache.MediumType == types.ObjectMedium {
+			if jobTaskSpec.Properties.Cache.MediumType == types.ObjectMedium {
+				start = time.Now()
 				cacheS3, err = commonrepo.NewS3StorageColl().Find(jobTaskSpec.Properties.Cache.ObjectProperties.ID)
-				if err != nil {
-					return jobTask, fmt.Errorf("find cache s3 storage: %s error: %v", jobTaskSpec.Properties.Cache.ObjectProperties.ID, err)
+				if err = j.observeLookup(testingLookupS3, start, err); err != nil {
+					return jobTask, fmt.Errorf("find cache s3 storage: %s error: %w", jobTaskSpec.Properties.Cache.ObjectProperties.ID, err)
 				}
 			}
 		}
 	}
 
-	paramEnvs := generateKeyValsFromWorkflowParam(j.workflow.Params)
-	envs := mergeKeyVals(jobTaskSpec.Properties.CustomEnvs, paramEnvs)
+	if testing.WarmCacheOnly && !(jobTaskSpec.Properties.CacheEnable && jobTaskSpec.Properties.Cache.MediumType == types.ObjectMedium) {
+		return nil, fmt.Errorf("testing: %s can not run in warm cache only mode since its object storage cache is not enabled", testing.Name)
+	}
 
-	jobTaskSpec.Properties.Envs = append(envs, getTestingJobVariables(testing.Repos, taskID, j.workflow.Project, j.workflow.Name, j.workflow.DisplayName, testing.ProjectName, testing.Name, testType, serviceName, serviceModule, jobTask.Infrastructure, logger)...)
+	jobTaskSpec.Properties.Envs, err = j.getTestingEnvs(jobTaskSpec.Properties.CustomEnvs, testing, taskID, testType, serviceName, serviceModule, jobTask.Infrastructure, logger)
+	if err != nil {
+		return nil, err
+	}
+	renderTestingReportPaths(testingInfo, jobTaskSpec.Properties.Envs)
+	if jobTaskSpec.Properties.CacheEnable && jobTaskSpec.Properties.Cache.MediumType == types.NFSMedium {
+		jobTaskSpec.Properties.Cache.NFSProperties.Subpath = renderTestingNFSSubpath(jobTaskSpec.Properties.Cache.NFSProperties.Subpath, serviceName, serviceModule, jobTaskSpec.Properties.Envs)
+	}
 
-	// init tools install step
+	// init tools install step, the locked versions are used so that the cache key changes with them as well
 	tools := []*step.Tool{}
 	for _, tool := range testingInfo.PreTest.Installs {
 		tools = append(tools, &step.Tool{
 			Name:    tool.Name,
-			Version: tool.Version,
+			Version: testingInfo.PreTest.LockedVersion(tool),
 		})
 	}
 	toolInstallStep := &commonmodels.StepTask{
@@ -723,6 +1515,8 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 		Spec:     step.StepToolInstallSpec{Installs: tools},
 	}
 	jobTaskSpec.Steps = append(jobTaskSpec.Steps, toolInstallStep)
+	repos := applyRepos(testingInfo.Repos, testing.Repos)
+	cacheObjectPath := getTestingJobCacheObjectPath(j.workflow.Name, testing.Name, serviceName, serviceModule, genTestingCacheKey(tools, repos))
 	// init download object cache step
 	if jobTaskSpec.Properties.CacheEnable && jobTaskSpec.Properties.Cache.MediumType == types.ObjectMedium {
 		cacheDir := "/workspace"
@@ -737,30 +1531,56 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 				UnTar:      true,
 				IgnoreErr:  true,
 				FileName:   setting.TestingOSSCacheFileName,
-				ObjectPath: getTestingJobCacheObjectPath(j.workflow.Name, testing.Name),
+				ObjectPath: cacheObjectPath,
 				DestDir:    cacheDir,
 				S3:         modelS3toS3(cacheS3),
 			},
 		}
 		jobTaskSpec.Steps = append(jobTaskSpec.Steps, downloadArchiveStep)
 	}
-	repos := applyRepos(testingInfo.Repos, testing.Repos)
 	renderRepos(repos, jobTaskSpec.Properties.Envs)
+	if err := renderRepoDeployKeys(repos); err != nil {
+		return nil, fmt.Errorf("failed to render deploy keys of testing: %s, error: %v", testing.Name, err)
+	}
 	gitRepos, p4Repos := splitReposByType(repos)
+	if err := validateTestingWorkingDir(testing.WorkingDir, repos); err != nil {
+		return nil, fmt.Errorf("invalid working dir of testing: %s, error: %v", testing.Name, err)
+	}
 
+	if testing.RunPolicy != "" {
+		shouldRun, err := evaluateTestingRunPolicy(testing.RunPolicy, mergeKeyVals(getReposVariables(repos), jobTaskSpec.Properties.Envs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate run policy of testing: %s, error: %v", testing.Name, err)
+		}
+		if !shouldRun {
+			// keep the task in the workflow so that it is displayed as skipped
+			jobTask.Status = config.StatusSkipped
+		}
+	}
+	if j.workflow.HookPayload != nil && j.workflow.HookPayload.ChangedFiles != nil && len(testing.PathFilters) > 0 {
+		selected, reason := selectTestingByPathFilters(testing.PathFilters, j.workflow.HookPayload.ChangedFiles)
+		jobInfo["path_filter_selection"] = reason
+		if !selected {
+			jobTask.Status = config.StatusSkipped
+		}
+	}
+
+	start = time.Now()
 	codehosts, err := codehostrepo.NewCodehostColl().AvailableCodeHost(j.workflow.Project)
-	if err != nil {
-		return nil, fmt.Errorf("find %s project codehost error: %v", j.workflow.Project, err)
+	if err = j.observeLookup(testingLookupCodehost, start, err); err != nil {
+		return nil, fmt.Errorf("find %s project codehost error: %w", j.workflow.Project, err)
 	}
 
 	// init git clone step
-	gitStep := &commonmodels.StepTask{
-		Name:     testing.Name + "-git",
-		JobName:  jobTask.Name,
-		StepType: config.StepGit,
-		Spec:     step.StepGitSpec{Repos: gitRepos, CodeHosts: codehosts},
+	if !testing.SkipDefaultClone {
+		gitStep := &commonmodels.StepTask{
+			Name:     testing.Name + "-git",
+			JobName:  jobTask.Name,
+			StepType: config.StepGit,
+			Spec:     step.StepGitSpec{Repos: gitRepos, CodeHosts: codehosts},
+		}
+		jobTaskSpec.Steps = append(jobTaskSpec.Steps, gitStep)
 	}
-	jobTaskSpec.Steps = append(jobTaskSpec.Steps, gitStep)
 
 	p4Step := &commonmodels.StepTask{
 		Name:     testing.Name + "-perforce",
@@ -779,26 +1599,57 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 	}
 	jobTaskSpec.Steps = append(jobTaskSpec.Steps, debugBeforeStep)
 
+	// there is no pod spec on vm, so the host aliases are written into the hosts file of the vm before the scripts run
+	if jobTask.Infrastructure == setting.JobVMInfrastructure && len(testingInfo.PreTest.HostAliases) > 0 {
+		jobTaskSpec.Steps = append(jobTaskSpec.Steps, newScriptStep(testing.Name+"-host-aliases", jobTask.Name, testingInfo.ScriptType, testingHostAliasesScripts(testingInfo.PreTest.HostAliases, testingInfo.ScriptType)))
+	}
+
 	scriptStep := &commonmodels.StepTask{
 		JobName: jobTask.Name,
 	}
+	userScripts := strings.Split(replaceWrapLine(testingInfo.Scripts), "\n")
+	if testingInfo.ScriptFromRepo != nil {
+		if testingInfo.ScriptType == "" {
+			testingInfo.ScriptType = detectScriptType(testingInfo.ScriptFromRepo.FilePath)
+		}
+		userScripts, err = testingRepoScripts(testingInfo.ScriptFromRepo, repos, testingInfo.ScriptType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script file of testing: %s, error: %v", testing.Name, err)
+		}
+	}
+	scripts := append(testingWorkingDirScripts(testing.WorkingDir, testingInfo.ScriptType), userScripts...)
+	if testing.EnvFileFromRepo != nil {
+		// the steps do not share their environment, so the env file is loaded by the test script itself
+		envFileScripts, err := testingEnvFileScripts(testing.EnvFileFromRepo, repos, testingInfo.ScriptType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env file of testing: %s, error: %v", testing.Name, err)
+		}
+		scripts = append(envFileScripts, scripts...)
+	}
+	if testing.CleanupScript != "" {
+		// the outputs are saved for the cleanup script even if the script fails, so that it can find what it provisioned
+		scripts = append(testingOutputTrapScripts(testingInfo.Outputs, jobTask.Infrastructure, testingInfo.ScriptType), scripts...)
+	}
+	scripts = append(scripts, outputScript(testingInfo.Outputs, jobTask.Infrastructure)...)
 	if testingInfo.ScriptType == types.ScriptTypeShell || testingInfo.ScriptType == "" {
 		scriptStep.Name = testing.Name + "-shell"
 		scriptStep.StepType = config.StepShell
 		scriptStep.Spec = &step.StepShellSpec{
-			Scripts: append(strings.Split(replaceWrapLine(testingInfo.Scripts), "\n"), outputScript(testingInfo.Outputs, jobTask.Infrastructure)...),
+			Scripts:     scripts,
+			Interpreter: testingInfo.ShellInterpreter,
 		}
 	} else if testingInfo.ScriptType == types.ScriptTypeBatchFile {
 		scriptStep.Name = testing.Name + "-batchfile"
 		scriptStep.StepType = config.StepBatchFile
 		scriptStep.Spec = &step.StepBatchFileSpec{
-			Scripts: append(strings.Split(replaceWrapLine(testingInfo.Scripts), "\n"), outputScript(testingInfo.Outputs, jobTask.Infrastructure)...),
+			Scripts: scripts,
 		}
 	} else if testingInfo.ScriptType == types.ScriptTypePowerShell {
 		scriptStep.Name = testing.Name + "-powershell"
 		scriptStep.StepType = config.StepPowerShell
 		scriptStep.Spec = &step.StepPowerShellSpec{
-			Scripts: append(strings.Split(replaceWrapLine(testingInfo.Scripts), "\n"), outputScript(testingInfo.Outputs, jobTask.Infrastructure)...),
+			Scripts:     scripts,
+			Interpreter: testingInfo.ShellInterpreter,
 		}
 	}
 	jobTaskSpec.Steps = append(jobTaskSpec.Steps, scriptStep)
@@ -817,35 +1668,22 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 		tarDestDir = "%TMP%"
 	}
 
-	// init archive html step
-	if len(testingInfo.TestReportPath) > 0 {
-		testReportDir := filepath.Dir(testingInfo.TestReportPath)
-		testReportName := filepath.Base(testingInfo.TestReportPath)
-		tarArchiveStep := &commonmodels.StepTask{
-			Name:      config.TestJobHTMLReportStepName,
-			JobName:   jobTask.Name,
-			StepType:  config.StepTarArchive,
-			Onfailure: true,
-			Spec: &step.StepTarArchiveSpec{
-				FileName:     setting.HtmlReportArchivedFileName,
-				AbsResultDir: true,
-				ResultDirs:   []string{testReportName},
-				ChangeTarDir: true,
-				TarDir:       "$WORKSPACE/" + testReportDir,
-				DestDir:      tarDestDir,
-				S3DestDir:    path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "html-report"),
-			},
-		}
+	archiveOnFailure, archiveOnlyOnFailure := testingArchiveStepFlags(testingInfo.ArchivePolicy, true)
+	// init archive html steps
+	for _, tarArchiveStep := range newTestingHTMLReportSteps(testingInfo.GetTestReportPaths(), jobTask.Name, tarDestDir, path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "html-report")) {
+		tarArchiveStep.Onfailure = archiveOnFailure
+		tarArchiveStep.OnlyOnFailure = archiveOnlyOnFailure
 		jobTaskSpec.Steps = append(jobTaskSpec.Steps, tarArchiveStep)
 	}
 
 	// init test result storage step
 	if len(testingInfo.ArtifactPaths) > 0 {
 		tarArchiveStep := &commonmodels.StepTask{
-			Name:      config.TestJobArchiveResultStepName,
-			JobName:   jobTask.Name,
-			StepType:  config.StepTarArchive,
-			Onfailure: true,
+			Name:          config.TestJobArchiveResultStepName,
+			JobName:       jobTask.Name,
+			StepType:      config.StepTarArchive,
+			Onfailure:     archiveOnFailure,
+			OnlyOnFailure: archiveOnlyOnFailure,
 			Spec: &step.StepTarArchiveSpec{
 				ResultDirs: testingInfo.ArtifactPaths,
 				S3DestDir:  path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "test-result"),
@@ -860,6 +1698,11 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 
 	// init junit report step
 	if len(testingInfo.TestResultPath) > 0 {
+		layoutVariables := getTestingJunitS3LayoutVariables(j.workflow, taskID, jobTask.Name, testing.Name, serviceName, serviceModule, time.Now())
+		junitS3DestDir, err := commonmodels.RenderJunitS3Layout(testingInfo.JunitS3Layout, layoutVariables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render junit s3 dir of testing: %s, error: %v", testing.Name, err)
+		}
 		junitStep := &commonmodels.StepTask{
 			Name:      config.TestJobJunitReportStepName,
 			JobName:   jobTask.Name,
@@ -871,15 +1714,26 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 				JobTaskName:    jobName,
 				TaskID:         taskID,
 				ReportDir:      testingInfo.TestResultPath,
-				S3DestDir:      path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "junit"),
+				S3DestDir:      junitS3DestDir,
 				TestName:       testing.Name,
 				TestProject:    testing.ProjectName,
 				DestDir:        tarDestDir,
-				FileName:       "merged.xml",
+				FileName:       getTestingMergedReportName(testingInfo.MergedReportName, testType, serviceName, serviceModule),
 				ServiceName:    serviceName,
 				ServiceModule:  serviceModule,
+				RecordTrend:    true,
+				BaselineRun:    j.jobSpec.BaselineRun,
 			},
 		}
+		if shard != nil && testingInfo.JunitS3Layout != "" {
+			// the merged report of the shards is named after the job key of the test module, see setTestingShardReports
+			layoutVariables["JOB_NAME"] = unshardedJobKey
+			mergedS3DestDir, err := commonmodels.RenderJunitS3Layout(testingInfo.JunitS3Layout, layoutVariables)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render merged junit s3 dir of testing: %s, error: %v", testing.Name, err)
+			}
+			junitStep.Spec.(*step.StepJunitReportSpec).MergedS3DestDir = mergedS3DestDir
+		}
 		jobTaskSpec.Steps = append(jobTaskSpec.Steps, junitStep)
 	}
 
@@ -899,9 +1753,10 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 				AbsResultDir: true,
 				TarDir:       cacheDir,
 				ChangeTarDir: true,
-				S3DestDir:    getTestingJobCacheObjectPath(j.workflow.Name, testing.Name),
+				S3DestDir:    cacheObjectPath,
 				IgnoreErr:    true,
 				S3Storage:    modelS3toS3(cacheS3),
+				Compression:  jobTaskSpec.Properties.CacheCompression,
 			},
 		}
 		jobTaskSpec.Steps = append(jobTaskSpec.Steps, tarArchiveStep)
@@ -909,23 +1764,24 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 
 	// init object storage step
 	if testingInfo.PostTest != nil && testingInfo.PostTest.ObjectStorageUpload != nil && testingInfo.PostTest.ObjectStorageUpload.Enabled {
+		start = time.Now()
 		modelS3, err := commonrepo.NewS3StorageColl().Find(testingInfo.PostTest.ObjectStorageUpload.ObjectStorageID)
-		if err != nil {
-			return jobTask, fmt.Errorf("find object storage: %s failed, err: %v", testingInfo.PostTest.ObjectStorageUpload.ObjectStorageID, err)
+		if err = j.observeLookup(testingLookupS3, start, err); err != nil {
+			return jobTask, fmt.Errorf("find object storage: %s failed, err: %w", testingInfo.PostTest.ObjectStorageUpload.ObjectStorageID, err)
 		}
 		s3 := modelS3toS3(modelS3)
 		s3.Subfolder = ""
-		uploads := []*step.Upload{}
-		for _, detail := range testingInfo.PostTest.ObjectStorageUpload.UploadDetail {
-			uploads = append(uploads, &step.Upload{
-				FilePath:        detail.FilePath,
-				DestinationPath: detail.DestinationPath,
-			})
+		uploads, err := renderTestingUploads(testingInfo.PostTest.ObjectStorageUpload.UploadDetail, jobTaskSpec.Properties.Envs)
+		if err != nil {
+			return jobTask, err
 		}
+		uploadOnFailure, uploadOnlyOnFailure := testingArchiveStepFlags(testingInfo.ArchivePolicy, false)
 		archiveStep := &commonmodels.StepTask{
-			Name:     config.TestJobObjectStorageStepName,
-			JobName:  jobTask.Name,
-			StepType: config.StepArchive,
+			Name:          config.TestJobObjectStorageStepName,
+			JobName:       jobTask.Name,
+			StepType:      config.StepArchive,
+			Onfailure:     uploadOnFailure,
+			OnlyOnFailure: uploadOnlyOnFailure,
 			Spec: step.StepArchiveSpec{
 				UploadDetail:    uploads,
 				ObjectStorageID: testingInfo.PostTest.ObjectStorageUpload.ObjectStorageID,
@@ -934,29 +1790,1481 @@ func (j TestingJobController) toJobTask(jobSubTaskID int, testing *commonmodels.
 		}
 		jobTaskSpec.Steps = append(jobTaskSpec.Steps, archiveStep)
 	}
+
+	if testing.WarmCacheOnly {
+		jobTaskSpec.Steps = getTestingWarmCacheSteps(jobTaskSpec.Steps, scriptStep)
+	}
+	setTestingStepTimeouts(jobTaskSpec.Steps, scriptStep, testingInfo.StepTimeouts)
+
+	// there is nothing provisioned by the script to clean up in warm cache only mode
+	if testing.CleanupScript != "" && !testing.WarmCacheOnly {
+		jobTaskSpec.Steps = append(jobTaskSpec.Steps, newTestingCleanupStep(testing, jobTask.Name, testingInfo.ScriptType, testingInfo.Outputs, jobTask.Infrastructure))
+	}
 	return jobTask, nil
 }
 
-func getTestingJobCacheObjectPath(workflowName, testingName string) string {
-	return fmt.Sprintf("%s/cache/%s", workflowName, testingName)
+// getTestingRetryErrorPolicy returns the error policy of a test task, the retry spec of the test module overrides the
+// job's error policy, and only retries the failures that haven't written any outputs or test reports.
+func getTestingRetryErrorPolicy(retrySpec *commonmodels.TestRetrySpec, errorPolicy *commonmodels.JobErrorPolicy) *commonmodels.JobErrorPolicy {
+	if retrySpec == nil || retrySpec.MaxRetries <= 0 {
+		return errorPolicy
+	}
+	return &commonmodels.JobErrorPolicy{
+		Policy:                 config.JobErrorPolicyRetry,
+		MaximumRetry:           retrySpec.MaxRetries,
+		RetryInterval:          retrySpec.RetryIntervalSeconds,
+		RetryOnlyWithoutOutput: true,
+	}
 }
 
-// internal use only
-func getTestingJobVariables(repos []*types.Repository, taskID int64, project, workflowName, workflowDisplayName, testingProject, testingName, testType, serviceName, serviceModule, infrastructure string, log *zap.SugaredLogger) []*commonmodels.KeyVal {
-	ret := make([]*commonmodels.KeyVal, 0)
-	// basic envs
-	ret = append(ret, prepareDefaultWorkflowTaskEnvs(project, workflowName, workflowDisplayName, infrastructure, taskID)...)
-	// repo envs
-	ret = append(ret, getReposVariables(repos)...)
+// newTestingHTMLReportSteps returns the steps archiving the html reports to s3DestDir, a single report is archived to
+// s3DestDir itself as before and each of multiple reports is archived to the html/<index> subfolder of it
+func newTestingHTMLReportSteps(reportPaths []string, jobName, tarDestDir, s3DestDir string) []*commonmodels.StepTask {
+	steps := make([]*commonmodels.StepTask, 0, len(reportPaths))
+	for i, reportPath := range reportPaths {
+		stepName, reportS3DestDir := config.TestJobHTMLReportStepName, s3DestDir
+		if len(reportPaths) > 1 {
+			stepName, reportS3DestDir = config.TestJobHTMLReportIndexedStepName(i), path.Join(s3DestDir, "html", strconv.Itoa(i))
+		}
+		steps = append(steps, &commonmodels.StepTask{
+			Name:     stepName,
+			JobName:  jobName,
+			StepType: config.StepTarArchive,
+			Spec: &step.StepTarArchiveSpec{
+				FileName:     setting.HtmlReportArchivedFileName,
+				AbsResultDir: true,
+				ResultDirs:   []string{filepath.Base(reportPath)},
+				ChangeTarDir: true,
+				TarDir:       "$WORKSPACE/" + filepath.Dir(reportPath),
+				DestDir:      tarDestDir,
+				S3DestDir:    reportS3DestDir,
+			},
+		})
+	}
+	return steps
+}
 
-	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_PROJECT", Value: testingProject, IsCredential: false})
-	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_NAME", Value: testingName, IsCredential: false})
-	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_TYPE", Value: testType, IsCredential: false})
-	ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE", Value: serviceName, IsCredential: false})
-	ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_NAME", Value: serviceName, IsCredential: false})
-	ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_MODULE", Value: serviceModule, IsCredential: false})
-	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.SystemAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
-	ret = append(ret, &commonmodels.KeyVal{Key: "BUILD_URL", Value: buildURL, IsCredential: false})
+var testingArchiveStepNames = sets.NewString(
+	config.TestJobArchiveResultStepName,
+	config.TestJobJunitReportStepName,
+	config.TestJobObjectStorageStepName,
+)
+
+func isTestingArchiveStep(stepName string) bool {
+	return testingArchiveStepNames.Has(stepName) || config.IsTestJobHTMLReportStep(stepName)
+}
+
+const testingWarmCacheDisplayName = "warm-cache"
+
+// getTestingWarmCacheSteps drops the test script and the steps archiving the reports and the artifacts, the remaining
+// steps clone the repos, install the tools and upload the object cache
+func getTestingWarmCacheSteps(steps []*commonmodels.StepTask, scriptStep *commonmodels.StepTask) []*commonmodels.StepTask {
+	ret := make([]*commonmodels.StepTask, 0, len(steps))
+	for _, stepTask := range steps {
+		if stepTask == scriptStep || isTestingArchiveStep(stepTask.Name) {
+			continue
+		}
+		ret = append(ret, stepTask)
+	}
+	return ret
+}
+
+// setTestingStepTimeouts sets the timeouts of the clone steps, the test script step and the steps archiving the reports
+// and the artifacts. The other steps, e.g. the cache and the cleanup steps, are only limited by the job timeout.
+func setTestingStepTimeouts(steps []*commonmodels.StepTask, scriptStep *commonmodels.StepTask, timeouts *commonmodels.TestingStepTimeouts) {
+	if timeouts == nil {
+		return
+	}
+	for _, stepTask := range steps {
+		switch {
+		case stepTask.StepType == config.StepGit || stepTask.StepType == config.StepPerforce:
+			stepTask.Timeout = int64(timeouts.Clone)
+		case stepTask == scriptStep:
+			stepTask.Timeout = int64(timeouts.Script)
+		case isTestingArchiveStep(stepTask.Name):
+			stepTask.Timeout = int64(timeouts.Archive)
+		}
+	}
+}
+
+// newTestingCleanupStep returns the step running the cleanup script of the test module, it runs even if the steps
+// before it fail. On kubernetes the outputs written by the test script are loaded as variables before the cleanup script.
+func newTestingCleanupStep(testing *commonmodels.TestModule, jobName string, scriptType types.ScriptType, outputs []*commonmodels.Output, infrastructure string) *commonmodels.StepTask {
+	scripts := make([]string, 0)
+	if isTestingShellOnKubernetes(scriptType, infrastructure) {
+		for _, output := range outputs {
+			outputFile := path.Join(testingCleanupOutputDir, output.Name)
+			scripts = append(scripts, fmt.Sprintf(`if [ -f %s ]; then export %s="$(cat %s)"; fi`, outputFile, output.Name, outputFile))
+		}
+	}
+	scripts = append(scripts, strings.Split(replaceWrapLine(testing.CleanupScript), "\n")...)
+
+	cleanupStep := newScriptStep(testing.Name+"-cleanup", jobName, scriptType, scripts)
+	cleanupStep.Onfailure = true
+	return cleanupStep
+}
+
+// testingCleanupOutputDir keeps the outputs for the cleanup script only, the outputs of a failed test script are not
+// published as the job outputs, which would stop the test module from being retried.
+const testingCleanupOutputDir = "/zadig/cleanup/"
+
+// testingOutputTrapScripts returns the scripts saving the outputs for the cleanup script when the test script exits for
+// any reason, outputs are only supported by shell scripts on kubernetes
+func testingOutputTrapScripts(outputs []*commonmodels.Output, infrastructure string, scriptType types.ScriptType) []string {
+	if !isTestingShellOnKubernetes(scriptType, infrastructure) || len(outputs) == 0 {
+		return nil
+	}
+	writes := []string{fmt.Sprintf("mkdir -p %s", testingCleanupOutputDir)}
+	for _, output := range outputs {
+		writes = append(writes, fmt.Sprintf("echo $%s > %s", output.Name, path.Join(testingCleanupOutputDir, output.Name)))
+	}
+	return []string{fmt.Sprintf("trap '%s' EXIT", strings.Join(writes, "; "))}
+}
+
+func isTestingShellOnKubernetes(scriptType types.ScriptType, infrastructure string) bool {
+	return (scriptType == "" || scriptType == types.ScriptTypeShell) && (infrastructure == "" || infrastructure == setting.JobK8sInfrastructure)
+}
+
+// testingArchiveStepFlags returns the Onfailure and OnlyOnFailure flags of an archive step for the archive policy,
+// legacyOnFailure is the Onfailure flag the step has without a policy
+func testingArchiveStepFlags(policy commonmodels.TestingArchivePolicy, legacyOnFailure bool) (onFailure, onlyOnFailure bool) {
+	switch policy {
+	case commonmodels.TestingArchivePolicyAlways:
+		return true, false
+	case commonmodels.TestingArchivePolicyOnSuccess:
+		return false, false
+	case commonmodels.TestingArchivePolicyOnFailure:
+		return true, true
+	default:
+		return legacyOnFailure, false
+	}
+}
+
+// lookups timed while generating the job tasks of testing jobs, a failed lookup is also the cause of the generation failure
+const (
+	testingLookupTesting    = "testing"
+	testingLookupBasicImage = "basic_image"
+	testingLookupRegistry   = "registry"
+	testingLookupCluster    = "cluster"
+	testingLookupS3         = "s3"
+	testingLookupCodehost   = "codehost"
+	testingLookupSecret     = "secret"
+
+	// testingFailureCauseTargets is the cause of failing to resolve the service targets to test
+	testingFailureCauseTargets = "targets"
+	// testingFailureCauseSpec is the cause of the other failures, e.g. invalid configurations of the testing
+	testingFailureCauseSpec = "spec"
+)
+
+// testingLookupError is a failed lookup while generating the job tasks, the message of the lookup error is kept as is
+type testingLookupError struct {
+	lookup string
+	err    error
+}
+
+func (e *testingLookupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *testingLookupError) Unwrap() error {
+	return e.err
+}
+
+// isTestingNotFound returns whether err is caused by a testing which can't be found, which is the only case a target
+// of a service test is skipped for rather than failing the job
+func isTestingNotFound(err error) bool {
+	var lookupErr *testingLookupError
+	return errors.As(err, &lookupErr) && lookupErr.lookup == testingLookupTesting && errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// testingGenerationFailureCause returns the lookup that err is caused by, or testingFailureCauseSpec if err is not from a lookup
+func testingGenerationFailureCause(err error) string {
+	var lookupErr *testingLookupError
+	if errors.As(err, &lookupErr) {
+		return lookupErr.lookup
+	}
+	return testingFailureCauseSpec
+}
+
+// observeLookup records the time taken by the lookup started at start, err is wrapped so that the lookup can be told as
+// the cause of the failure
+func (j TestingJobController) observeLookup(lookup string, start time.Time, err error) error {
+	metrics.RegisterTestingJobLookup(lookup, string(j.jobSpec.TestType), j.workflow.Project, time.Since(start))
+	if err != nil {
+		return &testingLookupError{lookup: lookup, err: err}
+	}
+	return nil
+}
+
+func (j TestingJobController) registerGenerationFailure(cause string) {
+	metrics.RegisterTestingJobGenerationFailure(cause, string(j.jobSpec.TestType), j.workflow.Project)
+}
+
+var findTestingsByName = func(names []string) (map[string]*commonmodels.Testing, error) {
+	return commonrepo.NewTestingColl().FindMany(sets.NewString(names...).List())
+}
+
+// getTestingByName returns a copy of the testing found by findTestingsByName, so that every job task generated from
+// the same testing renders its own paths. A testing which is not found fails like a single Find does.
+func getTestingByName(testings map[string]*commonmodels.Testing, name string) (*commonmodels.Testing, error) {
+	testing, ok := testings[name]
+	if !ok {
+		return nil, fmt.Errorf("find testing: %s error: %w", name, mongo.ErrNoDocuments)
+	}
+	b, err := bson.Marshal(testing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy testing: %s, error: %v", name, err)
+	}
+	resp := new(commonmodels.Testing)
+	if err := bson.Unmarshal(b, resp); err != nil {
+		return nil, fmt.Errorf("failed to copy testing: %s, error: %v", name, err)
+	}
+	return resp, nil
+}
+
+// resolveTestingSecretRefs fetches the referred secrets as credential variables, the values must not be logged
+func resolveTestingSecretRefs(secretRefs []*commonmodels.SecretRef) ([]*commonmodels.KeyVal, error) {
+	resp := make([]*commonmodels.KeyVal, 0, len(secretRefs))
+	for _, secretRef := range secretRefs {
+		if secretRef.EnvName == "" {
+			return nil, fmt.Errorf("env name of secret %s cannot be empty", secretRef.Key)
+		}
+		value, err := commonservice.GetExternalSecret(secretRef.StoreID, secretRef.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret for %s: %v", secretRef.EnvName, err)
+		}
+		resp = append(resp, &commonmodels.KeyVal{Key: secretRef.EnvName, Value: value, IsCredential: true})
+	}
+	return resp, nil
+}
+
+// validateTestingWorkingDir checks that the working dir is the clone path of one of the repos
+func validateTestingWorkingDir(workingDir string, repos []*types.Repository) error {
+	if workingDir == "" {
+		return nil
+	}
+
+	cloneDirs := sets.NewString()
+	for _, repo := range repos {
+		cloneDir := repo.RepoName
+		if repo.CheckoutPath != "" {
+			cloneDir = repo.CheckoutPath
+		}
+		if cloneDir != "" {
+			cloneDirs.Insert(path.Clean(cloneDir))
+		}
+	}
+	if !cloneDirs.Has(path.Clean(workingDir)) {
+		return fmt.Errorf("%s is not the clone path of any repo, available: %v", workingDir, cloneDirs.List())
+	}
+	return nil
+}
+
+// detectScriptType returns the script type of the script file by its extension, shell is the default
+func detectScriptType(filePath string) types.ScriptType {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".bat", ".cmd":
+		return types.ScriptTypeBatchFile
+	case ".ps1":
+		return types.ScriptTypePowerShell
+	default:
+		return types.ScriptTypeShell
+	}
+}
+
+// testingRepoScripts returns the scripts running the script file in the checkout of the repo for the script type,
+// the job fails with a clear error if the file does not exist in the checkout
+func testingRepoScripts(scriptFromRepo *commonmodels.TestingScriptFromRepo, repos []*types.Repository, scriptType types.ScriptType) ([]string, error) {
+	if scriptFromRepo.RepoIndex < 0 || scriptFromRepo.RepoIndex >= len(repos) {
+		return nil, fmt.Errorf("repo index %d out of range, %d repos in total", scriptFromRepo.RepoIndex, len(repos))
+	}
+	if scriptFromRepo.FilePath == "" || path.IsAbs(scriptFromRepo.FilePath) {
+		return nil, fmt.Errorf("script file path %s must be relative to the repo", scriptFromRepo.FilePath)
+	}
+
+	repo := repos[scriptFromRepo.RepoIndex]
+	cloneDir := repo.RepoName
+	if repo.CheckoutPath != "" {
+		cloneDir = repo.CheckoutPath
+	}
+	scriptPath := path.Join(cloneDir, scriptFromRepo.FilePath)
+	notFoundMsg := fmt.Sprintf("script file %s not found in repo %s", scriptFromRepo.FilePath, repo.RepoName)
+
+	// the working dir may have been changed, so the file is located from the workspace
+	switch scriptType {
+	case types.ScriptTypeBatchFile:
+		scriptPath = `%WORKSPACE%\` + strings.ReplaceAll(scriptPath, "/", `\`)
+		return []string{
+			fmt.Sprintf(`if not exist "%s" (echo %s 1>&2 & exit /b 1)`, scriptPath, notFoundMsg),
+			fmt.Sprintf(`call "%s"`, scriptPath),
+		}, nil
+	case types.ScriptTypePowerShell:
+		scriptPath = "$env:WORKSPACE/" + scriptPath
+		return []string{
+			fmt.Sprintf(`if (-not (Test-Path -Path "%s" -PathType Leaf)) { Write-Error "%s"; exit 1 }`, scriptPath, notFoundMsg),
+			fmt.Sprintf(`. "%s"`, scriptPath),
+		}, nil
+	default:
+		scriptPath = "$WORKSPACE/" + scriptPath
+		return []string{
+			fmt.Sprintf(`if [ ! -f "%s" ]; then echo "%s" >&2; exit 1; fi`, scriptPath, notFoundMsg),
+			fmt.Sprintf(`. "%s"`, scriptPath),
+		}, nil
+	}
+}
+
+// testingEnvFileScripts returns the scripts loading the dotenv file in the repo into the environment of the test script,
+// a variable already defined in the environment takes precedence over the file. The file is read as data, none of its
+// values is evaluated by the script.
+func testingEnvFileScripts(envFile *commonmodels.TestingEnvFileFromRepo, repos []*types.Repository, scriptType types.ScriptType) ([]string, error) {
+	if envFile.RepoIndex < 0 || envFile.RepoIndex >= len(repos) {
+		return nil, fmt.Errorf("repo index %d of the env file out of range, %d repos in total", envFile.RepoIndex, len(repos))
+	}
+	if envFile.FilePath == "" || path.IsAbs(envFile.FilePath) {
+		return nil, fmt.Errorf("env file path %s must be relative to the repo", envFile.FilePath)
+	}
+
+	repo := repos[envFile.RepoIndex]
+	cloneDir := repo.RepoName
+	if repo.CheckoutPath != "" {
+		cloneDir = repo.CheckoutPath
+	}
+	envFilePath := path.Join(cloneDir, envFile.FilePath)
+	notFoundMsg := fmt.Sprintf("env file %s not found in repo %s", envFile.FilePath, repo.RepoName)
+
+	switch scriptType {
+	case types.ScriptTypeBatchFile:
+		envFilePath = `%WORKSPACE%\` + strings.ReplaceAll(envFilePath, "/", `\`)
+		return []string{
+			fmt.Sprintf(`if not exist "%s" (echo %s 1>&2 & exit /b 1)`, envFilePath, notFoundMsg),
+			`for /f "usebackq eol=# tokens=1,* delims==" %%a in ("` + envFilePath + `") do if not defined %%a set "%%a=%%~b"`,
+		}, nil
+	case types.ScriptTypePowerShell:
+		envFilePath = "$env:WORKSPACE/" + envFilePath
+		return []string{
+			fmt.Sprintf(`if (-not (Test-Path -Path "%s" -PathType Leaf)) { Write-Error "%s"; exit 1 }`, envFilePath, notFoundMsg),
+			fmt.Sprintf(`foreach ($zadigEnvLine in Get-Content -Path "%s") {`, envFilePath),
+			`    $zadigEnvLine = $zadigEnvLine.Trim()`,
+			`    if ($zadigEnvLine.StartsWith("export ")) { $zadigEnvLine = $zadigEnvLine.Substring(7).Trim() }`,
+			`    if ($zadigEnvLine -notmatch '^([A-Za-z_][A-Za-z0-9_]*)=(.*)$') { continue }`,
+			`    $zadigEnvKey = $Matches[1]; $zadigEnvValue = $Matches[2]`,
+			`    if (Test-Path -Path "env:$zadigEnvKey") { continue }`,
+			`    if ($zadigEnvValue -match '^"(.*)"$' -or $zadigEnvValue -match "^'(.*)'$") { $zadigEnvValue = $Matches[1] }`,
+			`    Set-Item -Path "env:$zadigEnvKey" -Value $zadigEnvValue`,
+			`}`,
+		}, nil
+	default:
+		envFilePath = "$WORKSPACE/" + envFilePath
+		return []string{
+			fmt.Sprintf(`if [ ! -f "%s" ]; then echo "%s" >&2; exit 1; fi`, envFilePath, notFoundMsg),
+			`while IFS= read -r zadig_env_line || [ -n "$zadig_env_line" ]; do`,
+			`  zadig_env_line="${zadig_env_line%$(printf '\r')}"`,
+			`  zadig_env_line="${zadig_env_line#export }"`,
+			`  zadig_env_key="${zadig_env_line%%=*}"`,
+			`  zadig_env_value="${zadig_env_line#*=}"`,
+			`  case "$zadig_env_key" in ""|[!A-Za-z_]*|*[!A-Za-z0-9_]*) continue ;; esac`,
+			`  [ "$zadig_env_key" = "$zadig_env_line" ] && continue`,
+			`  case "$zadig_env_value" in \"*\"|\'*\') zadig_env_value="${zadig_env_value#?}"; zadig_env_value="${zadig_env_value%?}" ;; esac`,
+			`  eval "[ -n \"\${$zadig_env_key+x}\" ]" || export "$zadig_env_key=$zadig_env_value"`,
+			fmt.Sprintf(`done < "%s"`, envFilePath),
+			`unset zadig_env_line zadig_env_key zadig_env_value`,
+		}, nil
+	}
+}
+
+// newScriptStep returns a step running the scripts as the script type
+func newScriptStep(name, jobName string, scriptType types.ScriptType, scripts []string) *commonmodels.StepTask {
+	scriptStep := &commonmodels.StepTask{
+		Name:     name,
+		JobName:  jobName,
+		StepType: config.StepShell,
+		Spec:     &step.StepShellSpec{Scripts: scripts},
+	}
+	switch scriptType {
+	case types.ScriptTypeBatchFile:
+		scriptStep.StepType = config.StepBatchFile
+		scriptStep.Spec = &step.StepBatchFileSpec{Scripts: scripts}
+	case types.ScriptTypePowerShell:
+		scriptStep.StepType = config.StepPowerShell
+		scriptStep.Spec = &step.StepPowerShellSpec{Scripts: scripts}
+	}
+	return scriptStep
+}
+
+// testingHostAliasesScripts returns the scripts adding the host aliases to the hosts file of the vm for the script type,
+// entries which are already in the file are skipped so that reused vms don't pile them up
+func testingHostAliasesScripts(hostAliases []*commonmodels.HostAlias, scriptType types.ScriptType) []string {
+	scripts := make([]string, 0, len(hostAliases))
+	for _, hostAlias := range hostAliases {
+		entry := fmt.Sprintf("%s %s", hostAlias.IP, strings.Join(hostAlias.Hostnames, " "))
+		switch scriptType {
+		case types.ScriptTypeBatchFile:
+			scripts = append(scripts, fmt.Sprintf(`findstr /x /c:"%s" "%%SystemRoot%%\System32\drivers\etc\hosts" >nul || (echo %s)>>"%%SystemRoot%%\System32\drivers\etc\hosts"`, entry, entry))
+		case types.ScriptTypePowerShell:
+			scripts = append(scripts, fmt.Sprintf(`if (-not (Select-String -Path "$env:SystemRoot\System32\drivers\etc\hosts" -Pattern '^%s$' -Quiet)) { Add-Content -Path "$env:SystemRoot\System32\drivers\etc\hosts" -Value '%s' }`, regexp.QuoteMeta(entry), entry))
+		default:
+			scripts = append(scripts, fmt.Sprintf(`grep -qxF "%s" /etc/hosts || echo "%s" >> /etc/hosts`, entry, entry))
+		}
+	}
+	return scripts
+}
+
+func validateTestingHostAliases(testingInfo *commonmodels.Testing) error {
+	testingName := testingInfo.Name
+	if testingInfo.PreTest == nil {
+		return nil
+	}
+	for _, hostAlias := range testingInfo.PreTest.HostAliases {
+		if net.ParseIP(hostAlias.IP) == nil {
+			return fmt.Errorf("invalid ip: %s in host aliases of testing: %s", hostAlias.IP, testingName)
+		}
+		if len(hostAlias.Hostnames) == 0 {
+			return fmt.Errorf("hostnames of ip: %s in host aliases of testing: %s cannot be empty", hostAlias.IP, testingName)
+		}
+		for _, hostname := range hostAlias.Hostnames {
+			if hostname == "" || strings.ContainsAny(hostname, " \t\"'") {
+				return fmt.Errorf("invalid hostname: %q of ip: %s in host aliases of testing: %s", hostname, hostAlias.IP, testingName)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTestingResourceLimits checks that the resource limits of the testing are not less than its resource requests
+func validateTestingResourceLimits(testingInfo *commonmodels.Testing) error {
+	if testingInfo.PreTest == nil || testingInfo.PreTest.ResLimitSpec == nil {
+		return nil
+	}
+	return checkTestingResourceLimits(testingInfo.Name, testingInfo.PreTest.ResReq.GetRequestSpec(testingInfo.PreTest.ResReqSpec), testingInfo.PreTest.ResLimitSpec)
+}
+
+// validateTestingVolumeClaims checks the volume claims of the testing and, if checkCluster is set, that their storage
+// classes exist in the cluster of the testing, the volume claims are ignored on vm infrastructure
+func validateTestingVolumeClaims(testingInfo *commonmodels.Testing, checkCluster bool) error {
+	testingName := testingInfo.Name
+	if testingInfo.PreTest == nil || len(testingInfo.PreTest.VolumeClaims) == 0 || testingInfo.Infrastructure == setting.JobVMInfrastructure {
+		return nil
+	}
+	if err := commonmodels.ValidateVolumeClaims(testingInfo.PreTest.VolumeClaims); err != nil {
+		return fmt.Errorf("invalid volume claims of testing: %s, error: %v", testingName, err)
+	}
+	if !checkCluster {
+		return nil
+	}
+
+	clusterID := testingInfo.PreTest.ClusterID
+	if clusterID == "" {
+		clusterID = setting.LocalClusterID
+	}
+	kubeClient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get kube client of cluster: %s, error: %v", clusterID, err)
+	}
+	checked := sets.NewString()
+	for _, claim := range testingInfo.PreTest.VolumeClaims {
+		if checked.Has(claim.StorageClass) {
+			continue
+		}
+		checked.Insert(claim.StorageClass)
+		_, found, err := getter.GetStorageClass(claim.StorageClass, kubeClient)
+		if err != nil {
+			return fmt.Errorf("failed to get storage class: %s of cluster: %s, error: %v", claim.StorageClass, clusterID, err)
+		}
+		if !found {
+			return fmt.Errorf("storage class: %s of the volume claims of testing: %s not found in cluster: %s", claim.StorageClass, testingName, clusterID)
+		}
+	}
+	return nil
+}
+
+var getTestingImagePullSecret = func(clusterID, namespace, name string) (bool, error) {
+	kubeClient, err := clientmanager.NewKubeClientManager().GetControllerRuntimeClient(clusterID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get kube client of cluster: %s, error: %v", clusterID, err)
+	}
+	_, found, err := getter.GetSecret(namespace, name, kubeClient)
+	return found, err
+}
+
+// checkTestingLogMaskPatterns checks that the log mask patterns of the testing compile, so that the job executor does
+// not fail on them when the test runs
+func checkTestingLogMaskPatterns(testingInfo *commonmodels.Testing) error {
+	if len(testingInfo.LogMaskPatterns) == 0 {
+		return nil
+	}
+	if testingInfo.Infrastructure == setting.JobVMInfrastructure {
+		return fmt.Errorf("log mask patterns of testing: %s are not supported on vm", testingInfo.Name)
+	}
+	if _, err := util.CompileLogMaskPatterns(testingInfo.LogMaskPatterns); err != nil {
+		return fmt.Errorf("testing: %s has an invalid log mask pattern: %v", testingInfo.Name, err)
+	}
+	return nil
+}
+
+// checkTestingShellInterpreter checks that the shell interpreter of the testing is allowed for its script type
+func checkTestingShellInterpreter(testingInfo *commonmodels.Testing) error {
+	scriptType := testingInfo.ScriptType
+	if scriptType == "" && testingInfo.ScriptFromRepo != nil {
+		scriptType = detectScriptType(testingInfo.ScriptFromRepo.FilePath)
+	}
+	if scriptType == "" {
+		scriptType = types.ScriptTypeShell
+	}
+	if !scriptType.IsValidInterpreter(testingInfo.ShellInterpreter) {
+		return fmt.Errorf("shell interpreter: %s of testing: %s is not supported for %s scripts", testingInfo.ShellInterpreter, testingInfo.Name, scriptType)
+	}
+	return nil
+}
+
+// checkTestingImagePullSecrets checks the names of the extra image pull secrets of the testing and, if checkCluster is
+// set, that the secrets exist in the namespace the job pods run in, the secrets are ignored on vm infrastructure
+func checkTestingImagePullSecrets(testingInfo *commonmodels.Testing, checkCluster bool) error {
+	if testingInfo.PreTest == nil || len(testingInfo.PreTest.ExtraImagePullSecrets) == 0 || testingInfo.Infrastructure == setting.JobVMInfrastructure {
+		return nil
+	}
+
+	clusterID := testingInfo.PreTest.ClusterID
+	if clusterID == "" {
+		clusterID = setting.LocalClusterID
+	}
+	namespace := setting.AttachedClusterNamespace
+	if clusterID == setting.LocalClusterID {
+		namespace = configbase.Namespace()
+	}
+	checked := sets.NewString()
+	for _, name := range testingInfo.PreTest.ExtraImagePullSecrets {
+		if name == "" {
+			return fmt.Errorf("the name of an extra image pull secret of testing: %s is empty", testingInfo.Name)
+		}
+		if !checkCluster || checked.Has(name) {
+			continue
+		}
+		checked.Insert(name)
+		found, err := getTestingImagePullSecret(clusterID, namespace, name)
+		if err != nil {
+			return fmt.Errorf("failed to get image pull secret: %s in namespace: %s of cluster: %s, error: %v", name, namespace, clusterID, err)
+		}
+		if !found {
+			return fmt.Errorf("image pull secret: %s of testing: %s not found in namespace: %s of cluster: %s", name, testingInfo.Name, namespace, clusterID)
+		}
+	}
+	return nil
+}
+
+// getTestingVolumeClaimStorages returns the storages provisioned for the volume claims when the job starts, the storages
+// are temporary so that the job controller deletes the PVCs after the job
+func getTestingVolumeClaimStorages(claims []*commonmodels.VolumeClaimSpec) []*types.NFSProperties {
+	storages := make([]*types.NFSProperties, 0, len(claims))
+	for _, claim := range claims {
+		storages = append(storages, &types.NFSProperties{
+			ProvisionType:    types.DynamicProvision,
+			StorageClass:     claim.StorageClass,
+			StorageSizeInGiB: claim.StorageSizeInGiB,
+			AccessMode:       corev1.ReadWriteOnce,
+			MountPath:        claim.MountPath,
+			IsTemporary:      true,
+		})
+	}
+	return storages
+}
+
+// validateTestingStepTimeouts checks that the sum of the step timeouts of the testing does not exceed its timeout,
+// or the timeout override of the run if it is positive
+func validateTestingStepTimeouts(testingInfo *commonmodels.Testing, timeoutOverride int) error {
+	timeout := testingInfo.Timeout
+	if timeoutOverride > 0 {
+		timeout = timeoutOverride
+	}
+	if err := testingInfo.StepTimeouts.Validate(timeout); err != nil {
+		return fmt.Errorf("invalid step timeouts of testing: %s, error: %v", testingInfo.Name, err)
+	}
+	return nil
+}
+
+// validateTestingStepTimeoutOverride checks the step timeouts of the testing found by findTestingsByName against the
+// timeout override of the run
+func validateTestingStepTimeoutOverride(testings map[string]*commonmodels.Testing, testingName string, timeoutOverride int) error {
+	testingInfo, err := getTestingByName(testings, testingName)
+	if err != nil {
+		return err
+	}
+	return validateTestingStepTimeouts(testingInfo, timeoutOverride)
+}
+
+func checkTestingResourceLimits(testingName string, reqSpec setting.RequestSpec, limitSpec *setting.ResourceLimitSpec) error {
+	if limitSpec.CpuLimit < 0 || limitSpec.MemoryLimit < 0 {
+		return fmt.Errorf("resource limits of testing: %s cannot be negative", testingName)
+	}
+	if limitSpec.CpuLimit > 0 && limitSpec.CpuLimit < reqSpec.CpuReq {
+		return fmt.Errorf("cpu limit: %dm of testing: %s is less than its cpu request: %dm", limitSpec.CpuLimit, testingName, reqSpec.CpuReq)
+	}
+	if limitSpec.MemoryLimit > 0 && limitSpec.MemoryLimit < reqSpec.MemoryReq {
+		return fmt.Errorf("memory limit: %dMi of testing: %s is less than its memory request: %dMi", limitSpec.MemoryLimit, testingName, reqSpec.MemoryReq)
+	}
+	return nil
+}
+
+// testingWorkingDirScripts returns the scripts changing into the working dir for the script type,
+// the working dir is relative to the workspace which the script starts in
+func testingWorkingDirScripts(workingDir string, scriptType types.ScriptType) []string {
+	if workingDir == "" {
+		return nil
+	}
+
+	switch scriptType {
+	case types.ScriptTypeBatchFile:
+		return []string{fmt.Sprintf(`cd /d "%s"`, strings.ReplaceAll(path.Clean(workingDir), "/", `\`))}
+	case types.ScriptTypePowerShell:
+		return []string{fmt.Sprintf(`Set-Location -Path '%s'`, strings.ReplaceAll(path.Clean(workingDir), "'", "''"))}
+	default:
+		return []string{fmt.Sprintf(`cd "%s"`, path.Clean(workingDir))}
+	}
+}
+
+// renderTestingReportPaths renders the report and artifact paths of the testing with the job variables,
+// variables unknown to the job such as $WORKSPACE are kept so that they can be resolved in the job executor.
+func renderTestingReportPaths(testingInfo *commonmodels.Testing, envs []*commonmodels.KeyVal) {
+	testingInfo.TestReportPath = commonutil.RenderEnv(testingInfo.TestReportPath, envs)
+	for i, reportPath := range testingInfo.TestReportPaths {
+		testingInfo.TestReportPaths[i] = commonutil.RenderEnv(reportPath, envs)
+	}
+	testingInfo.TestResultPath = commonutil.RenderEnv(testingInfo.TestResultPath, envs)
+	for i, artifactPath := range testingInfo.ArtifactPaths {
+		testingInfo.ArtifactPaths[i] = commonutil.RenderEnv(artifactPath, envs)
+	}
+}
+
+// renderTestingUploads renders the file and destination paths of the object storage uploads with the job variables,
+// a rendered destination path that escapes the destination with ".." is rejected.
+func renderTestingUploads(details []*types.ObjectStoragePathDetail, envs []*commonmodels.KeyVal) ([]*step.Upload, error) {
+	uploads := make([]*step.Upload, 0, len(details))
+	for _, detail := range details {
+		upload := &step.Upload{
+			FilePath:        commonutil.RenderEnv(detail.FilePath, envs),
+			DestinationPath: commonutil.RenderEnv(detail.DestinationPath, envs),
+		}
+		for _, segment := range strings.FieldsFunc(upload.DestinationPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if segment == ".." {
+				return nil, fmt.Errorf("destination path: %s of file: %s is rendered to: %s, which is not allowed to contain \"..\"", detail.DestinationPath, detail.FilePath, upload.DestinationPath)
+			}
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// getTestingJunitS3LayoutVariables returns the values of commonmodels.JunitS3LayoutVariables for the job task
+func getTestingJunitS3LayoutVariables(workflow *commonmodels.WorkflowV4, taskID int64, jobTaskName, testingName, serviceName, serviceModule string, now time.Time) map[string]string {
+	return map[string]string{
+		"PROJECT":        workflow.Project,
+		"WORKFLOW":       workflow.Name,
+		"TASK_ID":        fmt.Sprint(taskID),
+		"JOB_NAME":       jobTaskName,
+		"TESTING_NAME":   testingName,
+		"SERVICE_NAME":   serviceName,
+		"SERVICE_MODULE": serviceModule,
+		"DATE":           now.Format("2006-01-02"),
+	}
+}
+
+func getTestingMergedReportName(mergedReportName, testType, serviceName, serviceModule string) string {
+	if mergedReportName != "" {
+		return mergedReportName
+	}
+	if testType == string(config.ServiceTestType) {
+		return fmt.Sprintf("%s-%s.xml", serviceName, serviceModule)
+	}
+	return "merged.xml"
+}
+
+func getTestModuleEnvKeys(testing *commonmodels.TestModule) []string {
+	if testing == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(testing.KeyVals)+len(testing.SecretRefs))
+	for _, kv := range testing.KeyVals {
+		if kv.KeyVal != nil {
+			keys = append(keys, kv.Key)
+		}
+	}
+	for _, secretRef := range testing.SecretRefs {
+		keys = append(keys, secretRef.EnvName)
+	}
+	return keys
+}
+
+func getTestModuleKeyVals(testing *commonmodels.TestModule) []*commonmodels.KeyVal {
+	if testing == nil {
+		return nil
+	}
+	kvs := make([]*commonmodels.KeyVal, 0, len(testing.KeyVals))
+	for _, kv := range testing.KeyVals {
+		if kv.KeyVal != nil {
+			kvs = append(kvs, kv.KeyVal)
+		}
+	}
+	return kvs
+}
+
+// validateTestingEnvKeys checks that the env keys of the testing, together with the keys set in the job, can be used
+// as variables in the script type of the testing
+func validateTestingEnvKeys(testingInfo *commonmodels.Testing, jobKeys []string) error {
+	keys := sets.NewString(jobKeys...)
+	if testingInfo.PreTest != nil {
+		for _, kv := range testingInfo.PreTest.Envs {
+			keys.Insert(kv.Key)
+		}
+	}
+	if invalidKeys := getInvalidEnvKeys(keys.List(), testingInfo.ScriptType); len(invalidKeys) > 0 {
+		scriptType := testingInfo.ScriptType
+		if scriptType == "" {
+			scriptType = types.ScriptTypeShell
+		}
+		return fmt.Errorf("testing: %s has env keys that are not valid variable names in %s scripts: %s", testingInfo.Name, scriptType, strings.Join(invalidKeys, ", "))
+	}
+	return nil
+}
+
+// validateTestingEnvReferences checks that the ${NAME} references in the env values of the testing, with the values
+// set in the job, resolve to a custom env, a workflow param or a built-in job variable. The task itself keeps the
+// references it can not resolve as they are, so without this check a typo only shows up as a literal in the script.
+func (j TestingJobController) validateTestingEnvReferences(testingInfo *commonmodels.Testing, jobKeyVals []*commonmodels.KeyVal, jobKeys []string) error {
+	keys := sets.NewString(jobKeys...)
+	for _, param := range generateKeyValsFromWorkflowParam(j.workflow.Params) {
+		keys.Insert(param.Key)
+	}
+	return checkTestingEnvReferences(testingInfo, jobKeyVals, keys)
+}
+
+func checkTestingEnvReferences(testingInfo *commonmodels.Testing, jobKeyVals []*commonmodels.KeyVal, keys sets.String) error {
+	envs := jobKeyVals
+	if testingInfo.PreTest != nil {
+		envs = mergeKeyVals(jobKeyVals, testingInfo.PreTest.Envs)
+	}
+
+	keys = keys.Union(getTestingBuiltinEnvKeys(testingInfo.Repos))
+	for _, kv := range envs {
+		keys.Insert(kv.Key)
+	}
+
+	undefined := make([]string, 0)
+	for _, kv := range envs {
+		for _, match := range envReferenceRegexp.FindAllStringSubmatch(kv.Value, -1) {
+			if !keys.Has(match[1]) {
+				undefined = append(undefined, fmt.Sprintf("%s in %s", match[0], kv.Key))
+			}
+		}
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("testing: %s has env values referencing undefined variables: %s", testingInfo.Name, strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+// envReferenceRegexp matches the plain ${NAME} references, the ones with a default like ${NAME:-value} are left out
+// since the shell resolves them anyway
+var envReferenceRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// getTestingBuiltinEnvKeys returns the keys of all the variables the job may set for the testing, the repo variables
+// which depend on the branch, tag or pr of the run are all included, so are the ones the job executor sets
+func getTestingBuiltinEnvKeys(repos []*types.Repository) sets.String {
+	keys := sets.NewString("TEST_MODULE_INDEX", "TRACEPARENT", "TRACESTATE", "HOME", "PATH", "DOCKER_HOST")
+	for _, kv := range getTestingJobVariables(nil, 0, "", "", "", "", "", "", "", "", "", false, 0, nil, nil) {
+		keys.Insert(kv.Key)
+	}
+	for index, repo := range repos {
+		repoName := repoNameToRepoIndex(repo.RepoName)
+		keys.Insert(fmt.Sprintf("REPONAME_%d", index), fmt.Sprintf("REPO_%d", index))
+		for _, suffix := range []string{"BRANCH", "TAG", "PR", "PRE_MERGE_BRANCHES", "ORG", "COMMIT_ID"} {
+			keys.Insert(fmt.Sprintf("%s_%s", repoName, suffix))
+		}
+	}
+	return keys
+}
+
+var (
+	// shell variables follow the posix name rule
+	shellEnvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// $env:NAME in powershell stops at any character other than letters, digits and underscores
+	powerShellEnvKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	// %NAME% in batch files can not contain the characters below, and a leading digit is taken as an argument like %1
+	batchFileEnvKeyRegexp = regexp.MustCompile(`^[^0-9=%!\s"^&|<>()][^=%!\s"^&|<>()]*$`)
+)
+
+// getInvalidEnvKeys returns the keys which are not valid variable names in the script type
+func getInvalidEnvKeys(keys []string, scriptType types.ScriptType) []string {
+	envKeyRegexp := shellEnvKeyRegexp
+	switch scriptType {
+	case types.ScriptTypePowerShell:
+		envKeyRegexp = powerShellEnvKeyRegexp
+	case types.ScriptTypeBatchFile:
+		envKeyRegexp = batchFileEnvKeyRegexp
+	}
+
+	invalidKeys := make([]string, 0)
+	for _, key := range keys {
+		if !envKeyRegexp.MatchString(key) {
+			invalidKeys = append(invalidKeys, key)
+		}
+	}
+	return invalidKeys
+}
+
+func validateTestingImageIDOverride(testing *commonmodels.TestModule) error {
+	if testing == nil || testing.ImageIDOverride == "" {
+		return nil
+	}
+	if _, err := commonrepo.NewBasicImageColl().Find(testing.ImageIDOverride); err != nil {
+		return fmt.Errorf("failed to find the overriding basic image: %s of testing: %s, error: %v", testing.ImageIDOverride, testing.Name, err)
+	}
+	return nil
+}
+
+// validateTestingCache checks that the cache configured in the testing can actually be used, otherwise the cache
+// would be silently disabled when the job task is generated.
+func validateTestingCache(testingInfo *commonmodels.Testing) error {
+	testingName := testingInfo.Name
+	if !testingInfo.CacheEnable {
+		return nil
+	}
+	if testingInfo.CacheDirType == types.UserDefinedCacheDir && testingInfo.CacheUserDir == "" {
+		return fmt.Errorf("testing: %s uses a user defined cache dir but the cache dir is empty", testingName)
+	}
+	if err := checkTestingCacheDirOverlaps(testingInfo); err != nil {
+		return err
+	}
+	if testingInfo.Infrastructure == setting.JobVMInfrastructure || testingInfo.PreTest == nil {
+		return nil
+	}
+	clusterInfo, err := commonrepo.NewK8SClusterColl().Get(testingInfo.PreTest.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to find cluster: %s of testing: %s, error: %v", testingInfo.PreTest.ClusterID, testingName, err)
+	}
+	if clusterInfo.Cache.MediumType == "" {
+		return fmt.Errorf("testing: %s has cache enabled but cluster: %s has no cache medium configured", testingName, clusterInfo.Name)
+	}
+	return nil
+}
+
+// checkTestingCacheDirOverlaps checks that the user defined cache dir does not overlap with the artifact, junit and
+// html report paths, the cache tar archive step and the result archive steps would otherwise archive the same files.
+// The paths are compared after $WORKSPACE is replaced, the other variables are compared as they are.
+func checkTestingCacheDirOverlaps(testingInfo *commonmodels.Testing) error {
+	if !testingInfo.CacheEnable || testingInfo.CacheDirType != types.UserDefinedCacheDir || testingInfo.CacheUserDir == "" {
+		return nil
+	}
+	cacheDir := getTestingWorkspacePath(testingInfo.CacheUserDir, false)
+
+	paths := make([]string, 0)
+	paths = append(paths, testingInfo.ArtifactPaths...)
+	paths = append(paths, testingInfo.TestResultPath)
+	paths = append(paths, testingInfo.GetTestReportPaths()...)
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if testingPathsOverlap(cacheDir, getTestingWorkspacePath(p, true)) {
+			return fmt.Errorf("cache dir: %s of testing: %s overlaps with its result path: %s", testingInfo.CacheUserDir, testingInfo.Name, p)
+		}
+	}
+	return nil
+}
+
+const testingWorkspaceDir = "/workspace"
+
+// getTestingWorkspacePath returns the absolute path in the job workspace, the result paths are relative to the
+// workspace while the cache dir is relative to it only if it is not absolute
+func getTestingWorkspacePath(p string, isResultPath bool) string {
+	p = strings.NewReplacer("${WORKSPACE}", testingWorkspaceDir, "$WORKSPACE", testingWorkspaceDir).Replace(p)
+	if isResultPath && p != testingWorkspaceDir && !strings.HasPrefix(p, testingWorkspaceDir+"/") {
+		return path.Join(testingWorkspaceDir, p)
+	}
+	if !path.IsAbs(p) {
+		return path.Join(testingWorkspaceDir, p)
+	}
+	return path.Clean(p)
+}
+
+// testingPathsOverlap returns whether the paths are the same or one of them is nested in the other
+func testingPathsOverlap(a, b string) bool {
+	if a == b || a == "/" || b == "/" {
+		return true
+	}
+	return strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// validateTestingStorages checks that the default object storage and the object storages the testings refer to for the
+// cache and the post-test upload exist, all the missing ones are reported at once.
+func validateTestingStorages(testingInfos []*commonmodels.Testing) error {
+	missing := make([]string, 0)
+	if _, err := commonrepo.NewS3StorageColl().FindDefault(); err != nil {
+		missing = append(missing, "default object storage")
+	}
+
+	checked := make(map[string]bool)
+	checkStorage := func(storageID, usage, testingName string) {
+		found, ok := checked[storageID]
+		if !ok {
+			_, err := commonrepo.NewS3StorageColl().Find(storageID)
+			found = err == nil
+			checked[storageID] = found
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("%s: %s of testing: %s", usage, storageID, testingName))
+		}
+	}
+
+	for _, testingInfo := range testingInfos {
+		testingName := testingInfo.Name
+		if testingInfo.CacheEnable && testingInfo.Infrastructure != setting.JobVMInfrastructure && testingInfo.PreTest != nil {
+			clusterInfo, err := commonrepo.NewK8SClusterColl().Get(testingInfo.PreTest.ClusterID)
+			if err != nil {
+				return fmt.Errorf("failed to find cluster: %s of testing: %s, error: %v", testingInfo.PreTest.ClusterID, testingName, err)
+			}
+			if clusterInfo.Cache.MediumType == types.ObjectMedium {
+				checkStorage(clusterInfo.Cache.ObjectProperties.ID, "cache object storage", testingName)
+			}
+		}
+		if testingInfo.PostTest != nil && testingInfo.PostTest.ObjectStorageUpload != nil && testingInfo.PostTest.ObjectStorageUpload.Enabled {
+			checkStorage(testingInfo.PostTest.ObjectStorageUpload.ObjectStorageID, "upload object storage", testingName)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("object storages not found: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// getTestingJobCacheObjectPath returns the object path of the testing cache, the cache key is appended
+// so that the cache is not reused once the installed tools or the repos change.
+// Service tests get a path per service and module so that the targets running in parallel do not share a cache.
+func getTestingJobCacheObjectPath(workflowName, testingName, serviceName, serviceModule, cacheKey string) string {
+	cachePath := fmt.Sprintf("%s/cache/%s", workflowName, testingName)
+	if serviceName != "" {
+		cachePath = fmt.Sprintf("%s/%s/%s", cachePath, serviceName, serviceModule)
+	}
+	if cacheKey == "" {
+		return cachePath
+	}
+	return fmt.Sprintf("%s/%s", cachePath, cacheKey)
+}
+
+var (
+	// testingOutputRefRegexp matches the references to the outputs of other jobs, like {{.job.<job>.output.<key>}} or
+	// {{.job.<job>.<testing>.output.<key>}}
+	testingOutputRefRegexp = regexp.MustCompile(`{{\.job\.([\p{L}\d-]+)\.(?:[\p{L}\d_-]+\.)*output\.([\p{L}\d_-]+)}}`)
+	// testingShortOutputRefRegexp matches the references to the outputs of other jobs without the testing, service or shard
+	// parts, which are resolved to the output declared by the job when the job tasks are generated
+	testingShortOutputRefRegexp = regexp.MustCompile(`{{\.job\.([\p{L}\d-]+)\.output\.([\p{L}\d_-]+)}}`)
+)
+
+// serviceTesting is one of the testing definitions of a service module, it shares the test module of the spec
+type serviceTesting struct {
+	*commonmodels.TestModule
+	ServiceName   string
+	ServiceModule string
+	// multiple is set if the service module has several testing definitions, the testing name is then added to the
+	// keys of the job tasks so that they do not collide
+	multiple bool
+}
+
+func (s *serviceTesting) keyTestingName() string {
+	if !s.multiple {
+		return ""
+	}
+	return s.Name
+}
+
+// keyParts returns the parts of the job key following the job name
+func (s *serviceTesting) keyParts() []string {
+	if !s.multiple {
+		return []string{s.ServiceName, s.ServiceModule}
+	}
+	return []string{s.ServiceName, s.ServiceModule, s.Name}
+}
+
+// getServiceTestings expands the service modules into one item for each of their testing definitions
+func getServiceTestings(serviceAndTests []*commonmodels.ServiceAndTest) []*serviceTesting {
+	resp := make([]*serviceTesting, 0, len(serviceAndTests))
+	for _, svc := range serviceAndTests {
+		testModules := svc.GetTestModules()
+		for _, testModule := range testModules {
+			resp = append(resp, &serviceTesting{
+				TestModule:    testModule,
+				ServiceName:   svc.ServiceName,
+				ServiceModule: svc.ServiceModule,
+				multiple:      len(testModules) > 1,
+			})
+		}
+	}
+	return resp
+}
+
+// getSelectedServiceTestings expands the selected service modules, whether the testing name is added to the keys of a
+// service module is decided by its options, so that the keys do not change with the testings selected in a run
+func (j TestingJobController) getSelectedServiceTestings() []*serviceTesting {
+	optionCounts := make(map[string]int)
+	for _, option := range j.jobSpec.ServiceTestOptions {
+		optionCounts[option.GetKey()] += len(option.GetTestModules())
+	}
+	resp := getServiceTestings(j.jobSpec.ServiceAndTests)
+	for _, testing := range resp {
+		key := fmt.Sprintf("%s-%s", testing.ServiceName, testing.ServiceModule)
+		if count, ok := optionCounts[key]; ok {
+			testing.multiple = count > 1
+		}
+	}
+	return resp
+}
+
+// findServiceTestingOption finds the option of a selected testing definition of a service module, a service module
+// with a single option matches the selection whatever its testing name is, as it did before it could have several
+func findServiceTestingOption(options []*commonmodels.TestModule, testingName string) *commonmodels.TestModule {
+	if len(options) == 1 {
+		return options[0]
+	}
+	for _, option := range options {
+		if option.Name == testingName {
+			return option
+		}
+	}
+	return nil
+}
+
+// getAllTestModules returns the configured and the selected test modules of the job
+func (j TestingJobController) getAllTestModules() []*commonmodels.TestModule {
+	testModules := make([]*commonmodels.TestModule, 0)
+	testModules = append(testModules, j.jobSpec.TestModuleOptions...)
+	testModules = append(testModules, j.jobSpec.TestModules...)
+	for _, svcTestings := range [][]*commonmodels.ServiceAndTest{j.jobSpec.ServiceTestOptions, j.jobSpec.ServiceAndTests} {
+		for _, svcTesting := range getServiceTestings(svcTestings) {
+			testModules = append(testModules, svcTesting.TestModule)
+		}
+	}
+	return testModules
+}
+
+// validateTestingOutputRefs checks that the jobs whose outputs are referred by the variables of the test modules run
+// before the job
+func validateTestingOutputRefs(jobName string, jobRankMap map[string]int, testModules []*commonmodels.TestModule) error {
+	for _, testModule := range testModules {
+		for _, kv := range testModule.KeyVals {
+			if kv.KeyVal == nil {
+				continue
+			}
+			for _, match := range testingOutputRefRegexp.FindAllStringSubmatch(kv.Value, -1) {
+				refRank, ok := jobRankMap[match[1]]
+				if !ok {
+					return fmt.Errorf("variable %s of testing %s in job %s refers to the outputs of job %s which is not in the workflow", kv.Key, testModule.Name, jobName, match[1])
+				}
+				if refRank >= jobRankMap[jobName] {
+					return fmt.Errorf("variable %s of testing %s in job %s refers to the outputs of job %s which does not run before it", kv.Key, testModule.Name, jobName, match[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveTestingEnvOutputRefs resolves the short output references in the values of envs, the envs with references are
+// copied so that the job spec is not changed
+func (j TestingJobController) resolveTestingEnvOutputRefs(envs []*commonmodels.KeyVal) ([]*commonmodels.KeyVal, error) {
+	outputKeys := make(map[string][]string)
+	getOutputKeys := func(jobName string) ([]string, error) {
+		if keys, ok := outputKeys[jobName]; ok {
+			return keys, nil
+		}
+		keys, err := j.getJobOutputKeys(jobName)
+		if err != nil {
+			return nil, err
+		}
+		outputKeys[jobName] = keys
+		return keys, nil
+	}
+
+	resp := make([]*commonmodels.KeyVal, 0, len(envs))
+	for _, env := range envs {
+		if !testingShortOutputRefRegexp.MatchString(env.Value) {
+			resp = append(resp, env)
+			continue
+		}
+		value, err := resolveTestingOutputRefs(env.Value, getOutputKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of variable %s: %v", env.Key, err)
+		}
+		resolved := *env
+		resolved.Value = value
+		resp = append(resp, &resolved)
+	}
+	return resp, nil
+}
+
+// getJobOutputKeys returns the keys of the output variables declared by the job, like job.<job>.<testing>.output.<key>
+func (j TestingJobController) getJobOutputKeys(jobName string) ([]string, error) {
+	job, err := j.workflow.FindJob(jobName, "")
+	if err != nil {
+		return nil, err
+	}
+	ctrl, err := CreateJobController(job, j.workflow)
+	if err != nil {
+		return nil, err
+	}
+	variables, err := ctrl.GetVariableList(jobName, false, true, false, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the variables of job %s, error: %v", jobName, err)
+	}
+	keys := make([]string, 0)
+	for _, variable := range variables {
+		if strings.Contains(variable.Key, ".output.") {
+			keys = append(keys, variable.Key)
+		}
+	}
+	return keys, nil
+}
+
+// resolveTestingOutputRefs rewrites the references like {{.job.<job>.output.<key>}} in value to the output of the job,
+// which must be the only output named <key> declared by the job, e.g. {{.job.<job>.<testing>.output.<key>}} of a
+// product testing job with a single test module. The references that exist as they are are kept.
+func resolveTestingOutputRefs(value string, getOutputKeys func(jobName string) ([]string, error)) (string, error) {
+	var resolveErr error
+	resolved := testingShortOutputRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		match := testingShortOutputRefRegexp.FindStringSubmatch(ref)
+		jobName, outputName := match[1], match[2]
+		keys, err := getOutputKeys(jobName)
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+
+		refKey := strings.Join([]string{"job", jobName, "output", outputName}, ".")
+		candidates := make([]string, 0)
+		for _, key := range keys {
+			if key == refKey {
+				return ref
+			}
+			if strings.HasPrefix(key, "job."+jobName+".") && strings.HasSuffix(key, ".output."+outputName) {
+				candidates = append(candidates, key)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			resolveErr = fmt.Errorf("job %s does not declare output %s", jobName, outputName)
+			return ref
+		case 1:
+			return fmt.Sprintf("{{.%s}}", candidates[0])
+		default:
+			resolveErr = fmt.Errorf("output %s of job %s is ambiguous, refer to one of %s instead", outputName, jobName, strings.Join(candidates, ", "))
+			return ref
+		}
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
+
+var testingServiceVariableRegexp = regexp.MustCompile(`\$\{?SERVICE(_NAME|_MODULE)?\b`)
+
+// renderTestingNFSSubpath renders the nfs cache subpath with the job variables, the service and module are appended
+// for service tests unless the subpath already refers to them, so that each target gets its own cache directory
+func renderTestingNFSSubpath(subpath, serviceName, serviceModule string, envs []*commonmodels.KeyVal) string {
+	rendered := commonutil.RenderEnv(subpath, envs)
+	if serviceName == "" || testingServiceVariableRegexp.MatchString(subpath) {
+		return rendered
+	}
+	return path.Join(rendered, serviceName, serviceModule)
+}
+
+// genTestingCacheKey hashes the tool versions and the repo list of a testing, an empty key is returned
+// if there is neither, in which case the legacy cache path is kept.
+func genTestingCacheKey(tools []*step.Tool, repos []*types.Repository) string {
+	items := make([]string, 0, len(tools)+len(repos))
+	for _, tool := range tools {
+		items = append(items, fmt.Sprintf("tool:%s=%s", tool.Name, tool.Version))
+	}
+	for _, repo := range repos {
+		items = append(items, fmt.Sprintf("repo:%d/%s/%s", repo.CodehostID, repo.RepoOwner, repo.RepoName))
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	sort.Strings(items)
+
+	h := fnv.New32a()
+	for _, item := range items {
+		h.Write([]byte(item + ";"))
+	}
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// getTestingMatrixRows returns the rows a test module should be expanded into, a nil row is returned when no matrix is configured
+func getTestingMatrixRows(matrix []map[string]string) []map[string]string {
+	if len(matrix) == 0 {
+		return []map[string]string{nil}
+	}
+	return matrix
+}
+
+func sortedTestingMatrixKeys(matrixRow map[string]string) []string {
+	keys := make([]string, 0, len(matrixRow))
+	for key := range matrixRow {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// genTestingMatrixKey generates a stable key for a matrix row, it is used as the suffix of the job key so that outputs don't collide
+func genTestingMatrixKey(matrixRow map[string]string) string {
+	h := fnv.New32a()
+	for _, key := range sortedTestingMatrixKeys(matrixRow) {
+		h.Write([]byte(key + "=" + matrixRow[key] + ";"))
+	}
+	return fmt.Sprintf("matrix-%08x", h.Sum32())
+}
+
+func genTestingMatrixDisplayName(matrixRow map[string]string) string {
+	values := make([]string, 0, len(matrixRow))
+	for _, key := range sortedTestingMatrixKeys(matrixRow) {
+		values = append(values, matrixRow[key])
+	}
+	return strings.Join(values, "-")
+}
+
+func testingMatrixRowToKVs(matrixRow map[string]string) []*commonmodels.KeyVal {
+	resp := make([]*commonmodels.KeyVal, 0, len(matrixRow))
+	for _, key := range sortedTestingMatrixKeys(matrixRow) {
+		resp = append(resp, &commonmodels.KeyVal{
+			Key:   key,
+			Value: matrixRow[key],
+			Type:  commonmodels.StringType,
+		})
+	}
+	return resp
+}
+
+// testingShard is one of the parallel job tasks a sharded test module is split into
+type testingShard struct {
+	Index int
+	Total int
+}
+
+// getTestingShards returns the shards a test module should be split into, a nil shard is returned when it is not sharded
+func getTestingShards(shards int) []*testingShard {
+	if shards < 2 {
+		return []*testingShard{nil}
+	}
+	resp := make([]*testingShard, 0, shards)
+	for i := 0; i < shards; i++ {
+		resp = append(resp, &testingShard{Index: i, Total: shards})
+	}
+	return resp
+}
+
+// getTestingShardKeys returns the job key suffixes of the shards, an empty suffix is returned when it is not sharded
+func getTestingShardKeys(shards int) []string {
+	keys := make([]string, 0)
+	for _, shard := range getTestingShards(shards) {
+		if shard == nil {
+			keys = append(keys, "")
+			continue
+		}
+		keys = append(keys, shard.key())
+	}
+	return keys
+}
+
+// key is used as the suffix of the job key so that the outputs and the archived files of the shards don't collide
+func (s *testingShard) key() string {
+	return fmt.Sprintf("shard-%d", s.Index)
+}
+
+func (s *testingShard) toKVs() []*commonmodels.KeyVal {
+	return []*commonmodels.KeyVal{
+		{Key: "TEST_SHARD_INDEX", Value: strconv.Itoa(s.Index), Type: commonmodels.StringType},
+		{Key: "TEST_SHARD_TOTAL", Value: strconv.Itoa(s.Total), Type: commonmodels.StringType},
+	}
+}
+
+// setTestingShardReports tells the junit report steps of the shards of a test module about each other, so that the
+// shard reports are merged when the last shard is reported
+func setTestingShardReports(shardJobTasks []*commonmodels.JobTask, workflowName string, taskID int64) {
+	if len(shardJobTasks) < 2 {
+		return
+	}
+	shardJobTaskNames := make([]string, 0, len(shardJobTasks))
+	for _, jobTask := range shardJobTasks {
+		shardJobTaskNames = append(shardJobTaskNames, jobTask.Name)
+	}
+	mergedKey := strings.TrimSuffix(shardJobTasks[0].Key, ".shard-0")
+	for _, jobTask := range shardJobTasks {
+		jobTaskSpec, ok := jobTask.Spec.(*commonmodels.JobTaskFreestyleSpec)
+		if !ok {
+			continue
+		}
+		for _, stepTask := range jobTaskSpec.Steps {
+			if junitSpec, ok := stepTask.Spec.(*step.StepJunitReportSpec); ok {
+				junitSpec.ShardJobTaskNames = shardJobTaskNames
+				// the merged dir is already rendered if the testing has a junit s3 layout
+				if junitSpec.MergedS3DestDir == "" {
+					junitSpec.MergedS3DestDir = path.Join(workflowName, fmt.Sprint(taskID), mergedKey, "junit")
+				}
+			}
+		}
+	}
+}
+
+// ensureTestingOutputs appends the junit statistics outputs when the test module has a junit report configured, and
+// the commit outputs REPO_<index>_COMMIT of the git repos cloned by the git step. The index is the position of the repo
+// among the git repos of the test module, perforce repos are not counted. The commit outputs stay empty if the default
+// clone is skipped. They are marked as system outputs since they are written whether the test script succeeds or not.
+// The original outputs slice is left untouched since it is shared with the testing template.
+func ensureTestingOutputs(testing *commonmodels.Testing) []*commonmodels.Output {
+	keys := make([]string, 0)
+	if testing.TestResultPath != "" {
+		keys = append(keys,
+			setting.WorkflowTestingJobOutputKeyTotal,
+			setting.WorkflowTestingJobOutputKeyFailed,
+			setting.WorkflowTestingJobOutputKeySkipped,
+			setting.WorkflowTestingJobOutputKeyDurationMS,
+		)
+	}
+	gitRepos, _ := splitReposByType(testing.Repos)
+	for index := range gitRepos {
+		keys = append(keys, fmt.Sprintf(setting.WorkflowTestingJobOutputKeyRepoCommit, index))
+	}
+	if len(keys) == 0 {
+		return testing.Outputs
+	}
+
+	systemKeys := sets.NewString(keys...)
+	resp := make([]*commonmodels.Output, 0, len(testing.Outputs)+len(keys))
+	keyMap := map[string]struct{}{}
+	for _, output := range testing.Outputs {
+		keyMap[output.Name] = struct{}{}
+		if systemKeys.Has(output.Name) {
+			// the output is still written by zadig even if it is declared by the user
+			output = &commonmodels.Output{Name: output.Name, Description: output.Description, System: true}
+		}
+		resp = append(resp, output)
+	}
+	for _, key := range keys {
+		if _, ok := keyMap[key]; !ok {
+			resp = append(resp, &commonmodels.Output{Name: key, System: true})
+		}
+	}
+	return resp
+}
+
+// evaluateTestingRunPolicy evaluates the run policy expression with the given variables,
+// match(value, pattern) is provided to glob match a variable such as a branch name.
+func evaluateTestingRunPolicy(policy string, kvs []*commonmodels.KeyVal) (bool, error) {
+	functions := map[string]govaluate.ExpressionFunction{
+		"match": func(args ...interface{}) (interface{}, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("match requires 2 arguments, got %d", len(args))
+			}
+			return filepath.Match(fmt.Sprint(args[1]), fmt.Sprint(args[0]))
+		},
+	}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(policy, functions)
+	if err != nil {
+		return false, err
+	}
+
+	parameters := make(map[string]interface{})
+	for _, kv := range kvs {
+		parameters[kv.Key] = kv.Value
+	}
+	// variables referenced by the expression but not provided are treated as empty strings
+	for _, v := range expression.Vars() {
+		if _, ok := parameters[v]; !ok {
+			parameters[v] = ""
+		}
+	}
+	result, err := expression.Evaluate(parameters)
+	if err != nil {
+		return false, err
+	}
+	shouldRun, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("run policy must be a boolean expression, got: %v", result)
+	}
+	return shouldRun, nil
+}
+
+// selectTestingByPathFilters tells whether any of the changed files matches the path filters of a test module, along
+// with the reason of the decision. A filter matches the files under a matched directory as well, and a trailing "**"
+// matches any path with the prefix.
+func selectTestingByPathFilters(pathFilters, changedFiles []string) (bool, string) {
+	for _, pathFilter := range pathFilters {
+		for _, file := range changedFiles {
+			if matchTestingPathFilter(pathFilter, file) {
+				return true, fmt.Sprintf("selected: %s matches path filter %s", file, pathFilter)
+			}
+		}
+	}
+	return false, fmt.Sprintf("skipped: none of the %d changed files matches path filters %s", len(changedFiles), strings.Join(pathFilters, ", "))
+}
+
+func matchTestingPathFilter(pathFilter, file string) bool {
+	pathFilter = strings.Trim(pathFilter, "/")
+	file = strings.Trim(file, "/")
+	if prefix, ok := strings.CutSuffix(pathFilter, "**"); ok && !strings.Contains(prefix, "**") {
+		return strings.HasPrefix(file, prefix)
+	}
+	for dir := file; dir != "." && dir != ""; dir = path.Dir(dir) {
+		if matched, _ := path.Match(pathFilter, dir); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// testModuleIndex returns the index of the test module in the test modules of a product testing job, or -1 if it is not
+// one of them
+func testModuleIndex(testModules []*commonmodels.TestModule, testModule *commonmodels.TestModule) int {
+	for i, module := range testModules {
+		if module == testModule || (module.Name == testModule.Name && module.ProjectName == testModule.ProjectName) {
+			return i
+		}
+	}
+	return -1
+}
+
+// internal use only
+// getTestingJobVariables returns the builtin variables of the testing job task. If typedVariables is set, the service
+// variables are only injected into service tests and product tests get TEST_MODULE_INDEX instead, otherwise the service
+// variables are injected into both of them as before.
+func getTestingJobVariables(repos []*types.Repository, taskID int64, project, workflowName, workflowDisplayName, testingProject, testingName, testType, serviceName, serviceModule, infrastructure string, typedVariables bool, moduleIndex int, traceEnvs map[string]string, log *zap.SugaredLogger) []*commonmodels.KeyVal {
+	ret := make([]*commonmodels.KeyVal, 0)
+	// basic envs
+	ret = append(ret, prepareDefaultWorkflowTaskEnvs(project, workflowName, workflowDisplayName, infrastructure, taskID)...)
+	// repo envs
+	ret = append(ret, getReposVariables(repos)...)
+
+	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_PROJECT", Value: testingProject, IsCredential: false})
+	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_NAME", Value: testingName, IsCredential: false})
+	ret = append(ret, &commonmodels.KeyVal{Key: "TESTING_TYPE", Value: testType, IsCredential: false})
+	if !typedVariables || testType == string(config.ServiceTestType) {
+		ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE", Value: serviceName, IsCredential: false})
+		ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_NAME", Value: serviceName, IsCredential: false})
+		ret = append(ret, &commonmodels.KeyVal{Key: "SERVICE_MODULE", Value: serviceModule, IsCredential: false})
+	} else if moduleIndex >= 0 {
+		ret = append(ret, &commonmodels.KeyVal{Key: "TEST_MODULE_INDEX", Value: strconv.Itoa(moduleIndex), IsCredential: false})
+	}
+	buildURL := fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d?display_name=%s", configbase.ExternalAddress(), project, workflowName, taskID, url.QueryEscape(workflowDisplayName))
+	ret = append(ret, &commonmodels.KeyVal{Key: "BUILD_URL", Value: buildURL, IsCredential: false})
+	// the trace context lets the test process continue the trace of the workflow task
+	for _, key := range []string{"TRACEPARENT", "TRACESTATE"} {
+		if value, ok := traceEnvs[key]; ok {
+			ret = append(ret, &commonmodels.KeyVal{Key: key, Value: value, IsCredential: false})
+		}
+	}
 
 	// TODO: remove it
 	ret = append(ret, &commonmodels.KeyVal{Key: "GIT_SSL_NO_VERIFY", Value: "true", IsCredential: false})
@@ -0,0 +1,1764 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/workflowcontroller/jobcontroller"
+	"github.com/koderover/zadig/v2/pkg/setting"
+	"github.com/koderover/zadig/v2/pkg/types"
+	jobspec "github.com/koderover/zadig/v2/pkg/types/job"
+	"github.com/koderover/zadig/v2/pkg/types/step"
+)
+
+func TestRenderTestingReportPaths(t *testing.T) {
+	envs := []*commonmodels.KeyVal{
+		{Key: "WORKSPACE", Value: "/workspace"},
+		{Key: "TASK_ID", Value: "12"},
+	}
+
+	tests := []struct {
+		name    string
+		testing *commonmodels.Testing
+		want    *commonmodels.Testing
+	}{
+		{
+			name: "paths with variables",
+			testing: &commonmodels.Testing{
+				TestReportPath: "$WORKSPACE/reports/${TASK_ID}/index.html",
+				TestResultPath: "$WORKSPACE/junit",
+				ArtifactPaths:  []string{"$WORKSPACE/out/$TASK_ID"},
+			},
+			want: &commonmodels.Testing{
+				TestReportPath: "/workspace/reports/12/index.html",
+				TestResultPath: "/workspace/junit",
+				ArtifactPaths:  []string{"/workspace/out/12"},
+			},
+		},
+		{
+			name: "paths without variables",
+			testing: &commonmodels.Testing{
+				TestReportPath: "reports/index.html",
+				TestResultPath: "junit",
+				ArtifactPaths:  []string{"out", ""},
+			},
+			want: &commonmodels.Testing{
+				TestReportPath: "reports/index.html",
+				TestResultPath: "junit",
+				ArtifactPaths:  []string{"out", ""},
+			},
+		},
+		{
+			name: "multiple report paths",
+			testing: &commonmodels.Testing{
+				TestReportPaths: []string{"$WORKSPACE/coverage/index.html", "reports/$TASK_ID.html"},
+			},
+			want: &commonmodels.Testing{
+				TestReportPaths: []string{"/workspace/coverage/index.html", "reports/12.html"},
+			},
+		},
+		{
+			name: "unknown variables are kept",
+			testing: &commonmodels.Testing{
+				TestReportPath: "$UNKNOWN/index.html",
+			},
+			want: &commonmodels.Testing{
+				TestReportPath: "$UNKNOWN/index.html",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderTestingReportPaths(tt.testing, envs)
+			if !reflect.DeepEqual(tt.testing, tt.want) {
+				t.Errorf("renderTestingReportPaths() got = %+v, want %+v", tt.testing, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingJobSetRepo(t *testing.T) {
+	newRepo := func(codehostID int, name, branch string) *types.Repository {
+		return &types.Repository{Source: "gitlab", CodehostID: codehostID, RepoOwner: "koderover", RepoName: name, Branch: branch}
+	}
+	spec := &commonmodels.ZadigTestingJobSpec{
+		TestModules: []*commonmodels.TestModule{
+			{Name: "frontend", Repos: []*types.Repository{newRepo(1, "frontend", "main")}},
+			{Name: "backend", Repos: []*types.Repository{newRepo(1, "backend", "main")}},
+		},
+		ServiceAndTests: []*commonmodels.ServiceAndTest{
+			{ServiceName: "frontend", TestModule: &commonmodels.TestModule{Repos: []*types.Repository{newRepo(1, "frontend", "main")}}},
+			{ServiceName: "backend", TestModule: &commonmodels.TestModule{Repos: []*types.Repository{newRepo(2, "frontend", "main")}}},
+		},
+	}
+	ctrl := TestingJobController{jobSpec: spec}
+	if err := ctrl.SetRepo(newRepo(1, "frontend", "feature")); err != nil {
+		t.Fatalf("SetRepo() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		repo *types.Repository
+		want string
+	}{
+		{name: "module cloning the pushed repo", repo: spec.TestModules[0].Repos[0], want: "feature"},
+		{name: "module cloning another repo", repo: spec.TestModules[1].Repos[0], want: "main"},
+		{name: "service test cloning the pushed repo", repo: spec.ServiceAndTests[0].Repos[0], want: "feature"},
+		{name: "service test cloning the repo from another codehost", repo: spec.ServiceAndTests[1].Repos[0], want: "main"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.repo.Branch != tt.want {
+				t.Errorf("branch = %s, want %s", tt.repo.Branch, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingWorkingDirScripts(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		scriptType types.ScriptType
+		want       []string
+	}{
+		{
+			name:       "no working dir",
+			workingDir: "",
+			scriptType: types.ScriptTypeShell,
+			want:       nil,
+		},
+		{
+			name:       "shell",
+			workingDir: "services/api/",
+			scriptType: types.ScriptTypeShell,
+			want:       []string{`cd "services/api"`},
+		},
+		{
+			name:       "default script type is shell",
+			workingDir: "api",
+			scriptType: "",
+			want:       []string{`cd "api"`},
+		},
+		{
+			name:       "batch file",
+			workingDir: "services/api",
+			scriptType: types.ScriptTypeBatchFile,
+			want:       []string{`cd /d "services\api"`},
+		},
+		{
+			name:       "powershell",
+			workingDir: "services/o'neil",
+			scriptType: types.ScriptTypePowerShell,
+			want:       []string{`Set-Location -Path 'services/o''neil'`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testingWorkingDirScripts(tt.workingDir, tt.scriptType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("testingWorkingDirScripts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTestingWorkingDir(t *testing.T) {
+	repos := []*types.Repository{
+		{RepoName: "api"},
+		{RepoName: "web", CheckoutPath: "frontend/web"},
+	}
+
+	tests := []struct {
+		name       string
+		workingDir string
+		wantErr    bool
+	}{
+		{name: "empty", workingDir: ""},
+		{name: "repo name", workingDir: "api"},
+		{name: "checkout path", workingDir: "frontend/web/"},
+		{name: "repo name replaced by checkout path", workingDir: "web", wantErr: true},
+		{name: "unknown dir", workingDir: "docs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTestingWorkingDir(tt.workingDir, repos); (err != nil) != tt.wantErr {
+				t.Errorf("validateTestingWorkingDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTestingCachePathsPerService(t *testing.T) {
+	envs := []*commonmodels.KeyVal{
+		{Key: "WORKFLOW", Value: "wf"},
+		{Key: "SERVICE_NAME", Value: "api"},
+		{Key: "SERVICE_MODULE", Value: "api-server"},
+	}
+
+	tests := []struct {
+		name          string
+		subpath       string
+		serviceName   string
+		serviceModule string
+		want          string
+	}{
+		{name: "product test", subpath: "cache/$WORKFLOW", want: "cache/wf"},
+		{name: "service test", subpath: "cache/$WORKFLOW", serviceName: "api", serviceModule: "api-server", want: "cache/wf/api/api-server"},
+		{name: "subpath refers to the service", subpath: "cache/${SERVICE_NAME}-$SERVICE_MODULE", serviceName: "api", serviceModule: "api-server", want: "cache/api-api-server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderTestingNFSSubpath(tt.subpath, tt.serviceName, tt.serviceModule, envs); got != tt.want {
+				t.Errorf("renderTestingNFSSubpath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// two services sharing the same testing and cache settings must not share a cache
+	if renderTestingNFSSubpath("cache", "api", "api", nil) == renderTestingNFSSubpath("cache", "web", "web", nil) {
+		t.Errorf("nfs cache subpaths of different services collide")
+	}
+	if getTestingJobCacheObjectPath("wf", "unit", "api", "api", "key") == getTestingJobCacheObjectPath("wf", "unit", "web", "web", "key") {
+		t.Errorf("object cache paths of different services collide")
+	}
+	if got, want := getTestingJobCacheObjectPath("wf", "unit", "", "", "key"), "wf/cache/unit/key"; got != want {
+		t.Errorf("getTestingJobCacheObjectPath() = %s, want %s", got, want)
+	}
+}
+
+func TestTestingArchiveStepFlags(t *testing.T) {
+	tests := []struct {
+		name              string
+		policy            commonmodels.TestingArchivePolicy
+		legacyOnFailure   bool
+		wantOnFailure     bool
+		wantOnlyOnFailure bool
+	}{
+		{name: "default keeps the legacy flag", policy: commonmodels.TestingArchivePolicyDefault, legacyOnFailure: true, wantOnFailure: true},
+		{name: "default keeps the legacy flag of uploads", policy: commonmodels.TestingArchivePolicyDefault, legacyOnFailure: false, wantOnFailure: false},
+		{name: "always", policy: commonmodels.TestingArchivePolicyAlways, wantOnFailure: true},
+		{name: "on success", policy: commonmodels.TestingArchivePolicyOnSuccess, legacyOnFailure: true, wantOnFailure: false},
+		{name: "on failure", policy: commonmodels.TestingArchivePolicyOnFailure, wantOnFailure: true, wantOnlyOnFailure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onFailure, onlyOnFailure := testingArchiveStepFlags(tt.policy, tt.legacyOnFailure)
+			if onFailure != tt.wantOnFailure || onlyOnFailure != tt.wantOnlyOnFailure {
+				t.Errorf("testingArchiveStepFlags() = %v, %v, want %v, %v", onFailure, onlyOnFailure, tt.wantOnFailure, tt.wantOnlyOnFailure)
+			}
+		})
+	}
+}
+
+func TestGetTestingOriginJobInfo(t *testing.T) {
+	targets := []*commonmodels.ServiceTestTarget{
+		{ServiceName: "api", ServiceModule: "api-server"},
+		{ServiceName: "web", ServiceModule: "nginx"},
+	}
+	want := map[string]string{
+		"origin_job_name": "deploy-dev",
+		"origin_job_type": "zadig-deploy",
+		"origin_targets":  "api/api-server,web/nginx",
+	}
+	if got := getTestingOriginJobInfo("deploy-dev", "zadig-deploy", targets); !reflect.DeepEqual(got, want) {
+		t.Errorf("getTestingOriginJobInfo() = %v, want %v", got, want)
+	}
+	if got := getTestingOriginJobInfo("build", "zadig-build", nil); got["origin_targets"] != "" {
+		t.Errorf("getTestingOriginJobInfo() targets = %s, want empty", got["origin_targets"])
+	}
+}
+
+func TestTestingRepoScripts(t *testing.T) {
+	repos := []*types.Repository{
+		{RepoName: "api"},
+		{RepoName: "ci", CheckoutPath: "tools/ci"},
+	}
+
+	tests := []struct {
+		name           string
+		scriptFromRepo *commonmodels.TestingScriptFromRepo
+		scriptType     types.ScriptType
+		want           []string
+		wantErr        bool
+	}{
+		{
+			name:           "shell",
+			scriptFromRepo: &commonmodels.TestingScriptFromRepo{RepoIndex: 0, FilePath: "scripts/test.sh"},
+			scriptType:     types.ScriptTypeShell,
+			want: []string{
+				`if [ ! -f "$WORKSPACE/api/scripts/test.sh" ]; then echo "script file scripts/test.sh not found in repo api" >&2; exit 1; fi`,
+				`. "$WORKSPACE/api/scripts/test.sh"`,
+			},
+		},
+		{
+			name:           "batch file in checkout path",
+			scriptFromRepo: &commonmodels.TestingScriptFromRepo{RepoIndex: 1, FilePath: "test.bat"},
+			scriptType:     types.ScriptTypeBatchFile,
+			want: []string{
+				`if not exist "%WORKSPACE%\tools\ci\test.bat" (echo script file test.bat not found in repo ci 1>&2 & exit /b 1)`,
+				`call "%WORKSPACE%\tools\ci\test.bat"`,
+			},
+		},
+		{
+			name:           "powershell",
+			scriptFromRepo: &commonmodels.TestingScriptFromRepo{RepoIndex: 1, FilePath: "test.ps1"},
+			scriptType:     types.ScriptTypePowerShell,
+			want: []string{
+				`if (-not (Test-Path -Path "$env:WORKSPACE/tools/ci/test.ps1" -PathType Leaf)) { Write-Error "script file test.ps1 not found in repo ci"; exit 1 }`,
+				`. "$env:WORKSPACE/tools/ci/test.ps1"`,
+			},
+		},
+		{
+			name:           "repo index out of range",
+			scriptFromRepo: &commonmodels.TestingScriptFromRepo{RepoIndex: 2, FilePath: "test.sh"},
+			wantErr:        true,
+		},
+		{
+			name:           "absolute file path",
+			scriptFromRepo: &commonmodels.TestingScriptFromRepo{RepoIndex: 0, FilePath: "/etc/test.sh"},
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testingRepoScripts(tt.scriptFromRepo, repos, tt.scriptType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("testingRepoScripts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("testingRepoScripts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := detectScriptType("ci/Test.PS1"); got != types.ScriptTypePowerShell {
+		t.Errorf("detectScriptType() = %s, want %s", got, types.ScriptTypePowerShell)
+	}
+	if got := detectScriptType("ci/test"); got != types.ScriptTypeShell {
+		t.Errorf("detectScriptType() = %s, want %s", got, types.ScriptTypeShell)
+	}
+}
+
+func TestGetInvalidEnvKeys(t *testing.T) {
+	keys := []string{"GO_VERSION", "_private", "my-key", "1foo", "with space", "a=b", "v1"}
+
+	tests := []struct {
+		name       string
+		scriptType types.ScriptType
+		want       []string
+	}{
+		{name: "default is shell", scriptType: "", want: []string{"my-key", "1foo", "with space", "a=b"}},
+		{name: "shell", scriptType: types.ScriptTypeShell, want: []string{"my-key", "1foo", "with space", "a=b"}},
+		{name: "powershell", scriptType: types.ScriptTypePowerShell, want: []string{"my-key", "with space", "a=b"}},
+		{name: "batch file", scriptType: types.ScriptTypeBatchFile, want: []string{"1foo", "with space", "a=b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getInvalidEnvKeys(keys, tt.scriptType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getInvalidEnvKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTestingParallelBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		maxParallel int
+		want        []int
+	}{
+		{name: "unlimited", count: 4, maxParallel: 0, want: []int{0, 0, 0, 0}},
+		{name: "batches of 3", count: 10, maxParallel: 3, want: []int{1, 1, 1, 2, 2, 2, 3, 3, 3, 4}},
+		{name: "limit above count", count: 2, maxParallel: 5, want: []int{1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobTasks := make([]*commonmodels.JobTask, 0, tt.count)
+			for i := 0; i < tt.count; i++ {
+				jobTasks = append(jobTasks, &commonmodels.JobTask{OriginName: "test"})
+			}
+			setTestingParallelBatches(jobTasks, tt.maxParallel)
+
+			got := make([]int, 0, len(jobTasks))
+			for _, jobTask := range jobTasks {
+				got = append(got, jobTask.ParallelBatch)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setTestingParallelBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingHostAliasesScripts(t *testing.T) {
+	hostAliases := []*commonmodels.HostAlias{
+		{IP: "10.0.0.1", Hostnames: []string{"db.internal", "cache.internal"}},
+	}
+
+	tests := []struct {
+		name       string
+		scriptType types.ScriptType
+		want       []string
+	}{
+		{
+			name:       "shell",
+			scriptType: types.ScriptTypeShell,
+			want:       []string{`grep -qxF "10.0.0.1 db.internal cache.internal" /etc/hosts || echo "10.0.0.1 db.internal cache.internal" >> /etc/hosts`},
+		},
+		{
+			name:       "batch file",
+			scriptType: types.ScriptTypeBatchFile,
+			want:       []string{`findstr /x /c:"10.0.0.1 db.internal cache.internal" "%SystemRoot%\System32\drivers\etc\hosts" >nul || (echo 10.0.0.1 db.internal cache.internal)>>"%SystemRoot%\System32\drivers\etc\hosts"`},
+		},
+		{
+			name:       "powershell",
+			scriptType: types.ScriptTypePowerShell,
+			want:       []string{`if (-not (Select-String -Path "$env:SystemRoot\System32\drivers\etc\hosts" -Pattern '^10\.0\.0\.1 db\.internal cache\.internal$' -Quiet)) { Add-Content -Path "$env:SystemRoot\System32\drivers\etc\hosts" -Value '10.0.0.1 db.internal cache.internal' }`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testingHostAliasesScripts(hostAliases, tt.scriptType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("testingHostAliasesScripts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTestingSkippedTargets(t *testing.T) {
+	targets := []*commonmodels.ServiceTestTarget{
+		{ServiceName: "svc-a", ServiceModule: "a"},
+		{ServiceName: "svc-b", ServiceModule: "b"},
+		{ServiceName: "svc-c", ServiceModule: "c"},
+		{ServiceName: "svc-c", ServiceModule: "c"},
+		{ServiceName: "svc-d", ServiceModule: "d"},
+	}
+	tested := sets.NewString("svc-a++a++test-a", "svc-d++d++test-d1")
+	failed := map[string]error{
+		"svc-b++b++test-b":  fmt.Errorf("find testing: test-b error: not found"),
+		"svc-d++d++test-d2": fmt.Errorf("find testing: test-d2 error: not found"),
+	}
+
+	want := []string{
+		"svc-b/b/test-b: find testing: test-b error: not found",
+		"svc-c/c: no testing is configured",
+		"svc-d/d/test-d2: find testing: test-d2 error: not found",
+	}
+	if got := getTestingSkippedTargets(targets, tested, failed); !reflect.DeepEqual(got, want) {
+		t.Errorf("getTestingSkippedTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestIsTestingNotFound(t *testing.T) {
+	_, notFoundErr := getTestingByName(map[string]*commonmodels.Testing{}, "test-a")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "testing not found", err: &testingLookupError{lookup: testingLookupTesting, err: notFoundErr}, want: true},
+		{name: "testing lookup failed", err: &testingLookupError{lookup: testingLookupTesting, err: fmt.Errorf("connection refused")}},
+		{name: "registry not found", err: fmt.Errorf("list registries error: %w", &testingLookupError{lookup: testingLookupRegistry, err: mongo.ErrNoDocuments})},
+		{name: "not a lookup", err: fmt.Errorf("failed to resolve secret env: TOKEN")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTestingNotFound(tt.err); got != tt.want {
+				t.Errorf("isTestingNotFound() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTestingCleanupStep(t *testing.T) {
+	testModule := &commonmodels.TestModule{Name: "test", CleanupScript: "drop_db $DB_NAME\ndelete_queue"}
+	outputs := []*commonmodels.Output{{Name: "DB_NAME"}}
+
+	cleanupStep := newTestingCleanupStep(testModule, "job-1", types.ScriptTypeShell, outputs, setting.JobK8sInfrastructure)
+	if !cleanupStep.Onfailure || cleanupStep.OnlyOnFailure {
+		t.Errorf("cleanup step must run no matter whether the steps before fail, got Onfailure: %v, OnlyOnFailure: %v", cleanupStep.Onfailure, cleanupStep.OnlyOnFailure)
+	}
+	wantScripts := []string{
+		`if [ -f /zadig/cleanup/DB_NAME ]; then export DB_NAME="$(cat /zadig/cleanup/DB_NAME)"; fi`,
+		"drop_db $DB_NAME",
+		"delete_queue",
+	}
+	if spec, ok := cleanupStep.Spec.(*step.StepShellSpec); !ok || !reflect.DeepEqual(spec.Scripts, wantScripts) {
+		t.Errorf("newTestingCleanupStep() spec = %+v, want scripts %v", cleanupStep.Spec, wantScripts)
+	}
+
+	vmStep := newTestingCleanupStep(testModule, "job-1", types.ScriptTypePowerShell, outputs, setting.JobVMInfrastructure)
+	if spec, ok := vmStep.Spec.(*step.StepPowerShellSpec); !ok || !reflect.DeepEqual(spec.Scripts, []string{"drop_db $DB_NAME", "delete_queue"}) {
+		t.Errorf("newTestingCleanupStep() spec on vm = %+v", vmStep.Spec)
+	}
+}
+
+func TestTestingOutputTrapScripts(t *testing.T) {
+	outputs := []*commonmodels.Output{{Name: "DB_NAME"}, {Name: "QUEUE"}}
+
+	want := []string{"trap 'mkdir -p /zadig/cleanup/; echo $DB_NAME > /zadig/cleanup/DB_NAME; echo $QUEUE > /zadig/cleanup/QUEUE' EXIT"}
+	if got := testingOutputTrapScripts(outputs, setting.JobK8sInfrastructure, types.ScriptTypeShell); !reflect.DeepEqual(got, want) {
+		t.Errorf("testingOutputTrapScripts() = %v, want %v", got, want)
+	}
+	if got := testingOutputTrapScripts(outputs, setting.JobVMInfrastructure, types.ScriptTypeShell); len(got) != 0 {
+		t.Errorf("testingOutputTrapScripts() on vm = %v, want none", got)
+	}
+}
+
+func TestRenderTestingUploads(t *testing.T) {
+	envs := []*commonmodels.KeyVal{{Key: "BRANCH", Value: "main"}, {Key: "DATE", Value: "20250101"}, {Key: "UP", Value: ".."}}
+
+	tests := []struct {
+		name    string
+		details []*types.ObjectStoragePathDetail
+		want    []*step.Upload
+		wantErr bool
+	}{
+		{
+			name:    "static paths",
+			details: []*types.ObjectStoragePathDetail{{FilePath: "out/report.html", DestinationPath: "reports"}},
+			want:    []*step.Upload{{FilePath: "out/report.html", DestinationPath: "reports"}},
+		},
+		{
+			name:    "templated paths",
+			details: []*types.ObjectStoragePathDetail{{FilePath: "out/${BRANCH}.html", DestinationPath: "reports/${BRANCH}/$DATE"}},
+			want:    []*step.Upload{{FilePath: "out/main.html", DestinationPath: "reports/main/20250101"}},
+		},
+		{
+			name:    "dots in names",
+			details: []*types.ObjectStoragePathDetail{{FilePath: "a", DestinationPath: "reports/..v1/a..b"}},
+			want:    []*step.Upload{{FilePath: "a", DestinationPath: "reports/..v1/a..b"}},
+		},
+		{
+			name:    "static traversal",
+			details: []*types.ObjectStoragePathDetail{{FilePath: "a", DestinationPath: "../reports"}},
+			wantErr: true,
+		},
+		{
+			name:    "rendered traversal",
+			details: []*types.ObjectStoragePathDetail{{FilePath: "a", DestinationPath: "reports/${UP}/${UP}/other"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTestingUploads(tt.details, envs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTestingUploads() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderTestingUploads() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectTestingByPathFilters(t *testing.T) {
+	changedFiles := []string{"services/user/main.go", "docs/README.md"}
+
+	tests := []struct {
+		name        string
+		pathFilters []string
+		want        bool
+	}{
+		{name: "directory", pathFilters: []string{"services/user"}, want: true},
+		{name: "glob", pathFilters: []string{"services/*/main.go"}, want: true},
+		{name: "double star", pathFilters: []string{"services/**"}, want: true},
+		{name: "extension", pathFilters: []string{"docs/*.md"}, want: true},
+		{name: "other module", pathFilters: []string{"services/order", "services/order/**"}, want: false},
+		{name: "no prefix match of names", pathFilters: []string{"services/use"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := selectTestingByPathFilters(tt.pathFilters, changedFiles)
+			if got != tt.want {
+				t.Errorf("selectTestingByPathFilters() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTestingShardReports(t *testing.T) {
+	shardJobTasks := make([]*commonmodels.JobTask, 0)
+	for _, shard := range getTestingShards(2) {
+		shardJobTasks = append(shardJobTasks, &commonmodels.JobTask{
+			Key:  genJobKey("test-job", "unit", shard.key()),
+			Name: fmt.Sprintf("test-job-%d", shard.Index),
+			Spec: &commonmodels.JobTaskFreestyleSpec{
+				Steps: []*commonmodels.StepTask{{Spec: &step.StepJunitReportSpec{}}},
+			},
+		})
+	}
+
+	setTestingShardReports(shardJobTasks, "workflow", 3)
+	for _, jobTask := range shardJobTasks {
+		junitSpec := jobTask.Spec.(*commonmodels.JobTaskFreestyleSpec).Steps[0].Spec.(*step.StepJunitReportSpec)
+		if !reflect.DeepEqual(junitSpec.ShardJobTaskNames, []string{"test-job-0", "test-job-1"}) {
+			t.Errorf("ShardJobTaskNames of %s = %v", jobTask.Name, junitSpec.ShardJobTaskNames)
+		}
+		if junitSpec.MergedS3DestDir != "workflow/3/test-job.unit/junit" {
+			t.Errorf("MergedS3DestDir of %s = %s", jobTask.Name, junitSpec.MergedS3DestDir)
+		}
+	}
+
+	if shards := getTestingShards(1); len(shards) != 1 || shards[0] != nil {
+		t.Errorf("getTestingShards(1) = %v, want a single nil shard", shards)
+	}
+	if keys := getTestingShardKeys(3); !reflect.DeepEqual(keys, []string{"shard-0", "shard-1", "shard-2"}) {
+		t.Errorf("getTestingShardKeys(3) = %v", keys)
+	}
+}
+
+func TestCheckTestingResourceLimits(t *testing.T) {
+	reqSpec := setting.LowRequest.GetRequestSpec(setting.RequestSpec{})
+
+	tests := []struct {
+		name      string
+		limitSpec *setting.ResourceLimitSpec
+		wantErr   bool
+	}{
+		{name: "limits above requests", limitSpec: &setting.ResourceLimitSpec{CpuLimit: 2000, MemoryLimit: 2048}},
+		{name: "limits equal to requests", limitSpec: &setting.ResourceLimitSpec{CpuLimit: reqSpec.CpuReq, MemoryLimit: reqSpec.MemoryReq}},
+		{name: "zero limit keeps the request limit", limitSpec: &setting.ResourceLimitSpec{MemoryLimit: 2048}},
+		{name: "cpu limit below request", limitSpec: &setting.ResourceLimitSpec{CpuLimit: 500}, wantErr: true},
+		{name: "memory limit below request", limitSpec: &setting.ResourceLimitSpec{MemoryLimit: 512}, wantErr: true},
+		{name: "negative limit", limitSpec: &setting.ResourceLimitSpec{CpuLimit: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTestingResourceLimits("unit", reqSpec, tt.limitSpec); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingResourceLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnsureTestingOutputs(t *testing.T) {
+	outputNames := func(outputs []*commonmodels.Output) []string {
+		names := make([]string, 0, len(outputs))
+		for _, output := range outputs {
+			names = append(names, output.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name    string
+		testing *commonmodels.Testing
+		want    []string
+	}{
+		{
+			name:    "no junit report and no repo",
+			testing: &commonmodels.Testing{Outputs: []*commonmodels.Output{{Name: "RESULT"}}},
+			want:    []string{"RESULT"},
+		},
+		{
+			name: "multiple repos with junit report",
+			testing: &commonmodels.Testing{
+				TestResultPath: "reports",
+				Repos: []*types.Repository{
+					{Source: types.ProviderGitlab, RepoName: "frontend"},
+					{Source: types.ProviderPerforce, RepoName: "assets"},
+					{Source: types.ProviderGithub, RepoName: "backend"},
+				},
+			},
+			want: []string{
+				setting.WorkflowTestingJobOutputKeyTotal,
+				setting.WorkflowTestingJobOutputKeyFailed,
+				setting.WorkflowTestingJobOutputKeySkipped,
+				setting.WorkflowTestingJobOutputKeyDurationMS,
+				"REPO_0_COMMIT",
+				"REPO_1_COMMIT",
+			},
+		},
+		{
+			name: "user defined output is kept",
+			testing: &commonmodels.Testing{
+				Outputs: []*commonmodels.Output{{Name: "REPO_1_COMMIT"}},
+				Repos: []*types.Repository{
+					{Source: types.ProviderGitlab, RepoName: "frontend"},
+					{Source: types.ProviderGitlab, RepoName: "backend"},
+				},
+			},
+			want: []string{"REPO_1_COMMIT", "REPO_0_COMMIT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := tt.testing.Outputs
+			got := outputNames(ensureTestingOutputs(tt.testing))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ensureTestingOutputs() = %v, want %v", got, tt.want)
+			}
+			if len(tt.testing.Outputs) != len(outputs) {
+				t.Errorf("ensureTestingOutputs() modified the outputs of the testing")
+			}
+		})
+	}
+}
+
+func TestSetTestingStepTimeouts(t *testing.T) {
+	newSteps := func() (steps []*commonmodels.StepTask, scriptStep *commonmodels.StepTask) {
+		scriptStep = &commonmodels.StepTask{Name: "test-shell", StepType: config.StepShell}
+		return []*commonmodels.StepTask{
+			{Name: "test-git", StepType: config.StepGit},
+			{Name: "test-perforce", StepType: config.StepPerforce},
+			{Name: "test-host-aliases", StepType: config.StepShell},
+			scriptStep,
+			{Name: config.TestJobHTMLReportStepName, StepType: config.StepTarArchive},
+			{Name: config.TestJobJunitReportStepName, StepType: config.StepJunitReport},
+			{Name: "test-tar-archive", StepType: config.StepTarArchive},
+		}, scriptStep
+	}
+
+	tests := []struct {
+		name     string
+		timeouts *commonmodels.TestingStepTimeouts
+		want     []int64
+	}{
+		{
+			name: "no step timeouts",
+			want: []int64{0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:     "all step timeouts",
+			timeouts: &commonmodels.TestingStepTimeouts{Clone: 5, Script: 30, Archive: 10},
+			want:     []int64{5, 5, 0, 30, 10, 10, 0},
+		},
+		{
+			name:     "only script timeout",
+			timeouts: &commonmodels.TestingStepTimeouts{Script: 30},
+			want:     []int64{0, 0, 0, 30, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, scriptStep := newSteps()
+			setTestingStepTimeouts(steps, scriptStep, tt.timeouts)
+			got := make([]int64, 0, len(steps))
+			for _, stepTask := range steps {
+				got = append(got, stepTask.Timeout)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setTestingStepTimeouts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingStepTimeoutsValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeouts   *commonmodels.TestingStepTimeouts
+		jobTimeout int
+		wantErr    bool
+	}{
+		{name: "no step timeouts", jobTimeout: 60},
+		{name: "sum within job timeout", timeouts: &commonmodels.TestingStepTimeouts{Clone: 10, Script: 40, Archive: 10}, jobTimeout: 60},
+		{name: "sum exceeds job timeout", timeouts: &commonmodels.TestingStepTimeouts{Clone: 10, Script: 45, Archive: 10}, jobTimeout: 60, wantErr: true},
+		{name: "negative timeout", timeouts: &commonmodels.TestingStepTimeouts{Clone: -1}, jobTimeout: 60, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.timeouts.Validate(tt.jobTimeout); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTestingGenerationFailureCause(t *testing.T) {
+	lookupErr := &testingLookupError{lookup: testingLookupCluster, err: fmt.Errorf("not found")}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "lookup error", err: lookupErr, want: testingLookupCluster},
+		{name: "wrapped lookup error", err: fmt.Errorf("failed to find cluster: %w", lookupErr), want: testingLookupCluster},
+		{name: "lookup error wrapped with %v", err: fmt.Errorf("failed to find cluster: %v", lookupErr), want: testingFailureCauseSpec},
+		{name: "other error", err: fmt.Errorf("invalid working dir"), want: testingFailureCauseSpec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testingGenerationFailureCause(tt.err); got != tt.want {
+				t.Errorf("testingGenerationFailureCause() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTestingJobVariables(t *testing.T) {
+	tests := []struct {
+		name           string
+		testType       string
+		typedVariables bool
+		wantKeys       []string
+		unwantedKeys   []string
+	}{
+		{
+			name:         "product test with legacy variables",
+			wantKeys:     []string{"SERVICE", "SERVICE_NAME", "SERVICE_MODULE"},
+			unwantedKeys: []string{"TEST_MODULE_INDEX"},
+		},
+		{
+			name:         "service test with legacy variables",
+			testType:     string(config.ServiceTestType),
+			wantKeys:     []string{"SERVICE", "SERVICE_NAME", "SERVICE_MODULE"},
+			unwantedKeys: []string{"TEST_MODULE_INDEX"},
+		},
+		{
+			name:           "product test with typed variables",
+			typedVariables: true,
+			wantKeys:       []string{"TEST_MODULE_INDEX"},
+			unwantedKeys:   []string{"SERVICE", "SERVICE_NAME", "SERVICE_MODULE"},
+		},
+		{
+			name:           "service test with typed variables",
+			testType:       string(config.ServiceTestType),
+			typedVariables: true,
+			wantKeys:       []string{"SERVICE", "SERVICE_NAME", "SERVICE_MODULE"},
+			unwantedKeys:   []string{"TEST_MODULE_INDEX"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envs := getTestingJobVariables(nil, 1, "project", "workflow", "workflow", "project", "testing", tt.testType, "svc", "module", setting.JobK8sInfrastructure, tt.typedVariables, 1, nil, nil)
+			got := make(map[string]string)
+			for _, env := range envs {
+				got[env.Key] = env.Value
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := got[key]; !ok {
+					t.Errorf("getTestingJobVariables() misses %s", key)
+				}
+			}
+			for _, key := range tt.unwantedKeys {
+				if _, ok := got[key]; ok {
+					t.Errorf("getTestingJobVariables() should not inject %s", key)
+				}
+			}
+			if index, ok := got["TEST_MODULE_INDEX"]; ok && index != "1" {
+				t.Errorf("TEST_MODULE_INDEX = %s, want 1", index)
+			}
+		})
+	}
+}
+
+func TestRenderJunitS3Layout(t *testing.T) {
+	workflow := &commonmodels.WorkflowV4{Name: "workflow", Project: "project"}
+	now := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		layout      string
+		serviceName string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default layout", want: "workflow/3/test-job-0/junit"},
+		{name: "flat layout", layout: "$PROJECT/${SERVICE_NAME}/$DATE", serviceName: "svc", want: "project/svc/2025-03-04"},
+		{name: "empty variable", layout: "$PROJECT/$SERVICE_NAME/$DATE", want: "project/2025-03-04"},
+		{name: "traversal", layout: "$PROJECT/../$DATE", wantErr: true},
+		{name: "traversal in variable", layout: "$PROJECT/$SERVICE_NAME", serviceName: "..", wantErr: true},
+		{name: "absolute", layout: "/$PROJECT", wantErr: true},
+		{name: "empty result", layout: "$SERVICE_NAME", wantErr: true},
+		{name: "unknown variable", layout: "$PROJECT/$UNKNOWN", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables := getTestingJunitS3LayoutVariables(workflow, 3, "test-job-0", "unit", tt.serviceName, "", now)
+			got, err := commonmodels.RenderJunitS3Layout(tt.layout, variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderJunitS3Layout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderJunitS3Layout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := commonmodels.ValidateJunitS3Layout("$PROJECT/$SERVICE_NAME/$DATE"); err != nil {
+		t.Errorf("ValidateJunitS3Layout() error = %v", err)
+	}
+	if err := commonmodels.ValidateJunitS3Layout("reports/../$PROJECT"); err == nil {
+		t.Errorf("ValidateJunitS3Layout() should reject traversal")
+	}
+}
+
+func TestValidateTestingOutputRefs(t *testing.T) {
+	stages := []*commonmodels.WorkflowStage{
+		{Name: "build", Jobs: []*commonmodels.Job{{Name: "build"}}},
+		{Name: "test", Parallel: true, Jobs: []*commonmodels.Job{{Name: "product-test"}, {Name: "sibling-test"}}},
+		{Name: "gate", Jobs: []*commonmodels.Job{{Name: "service-test"}}},
+	}
+	jobRankMap := GetJobRankMap(stages)
+	testModule := func(value string) []*commonmodels.TestModule {
+		return []*commonmodels.TestModule{{
+			Name:    "gate",
+			KeyVals: commonmodels.RuntimeKeyValList{{KeyVal: &commonmodels.KeyVal{Key: "RESULT", Value: value}}},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		jobName string
+		value   string
+		wantErr bool
+	}{
+		{name: "earlier job", jobName: "service-test", value: "{{.job.product-test.output.RESULT}}"},
+		{name: "earlier job with testing", jobName: "service-test", value: "prefix-{{.job.product-test.unit.output.RESULT}}"},
+		{name: "no reference", jobName: "service-test", value: "{{.workflow.params.x}}"},
+		{name: "parallel sibling", jobName: "sibling-test", value: "{{.job.product-test.output.RESULT}}", wantErr: true},
+		{name: "forward reference", jobName: "product-test", value: "{{.job.service-test.output.RESULT}}", wantErr: true},
+		{name: "itself", jobName: "service-test", value: "{{.job.service-test.output.RESULT}}", wantErr: true},
+		{name: "unknown job", jobName: "service-test", value: "{{.job.unknown.output.RESULT}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTestingOutputRefs(tt.jobName, jobRankMap, testModule(tt.value)); (err != nil) != tt.wantErr {
+				t.Errorf("validateTestingOutputRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveTestingOutputRefs(t *testing.T) {
+	outputKeys := map[string][]string{
+		"freestyle":    {"job.freestyle.output.RESULT"},
+		"product-test": {"job.product-test.unit.output.RESULT", "job.product-test.unit.output.FAILURES"},
+		"matrix-test":  {"job.matrix-test.unit.shard-0.output.RESULT", "job.matrix-test.unit.shard-1.output.RESULT"},
+	}
+	getOutputKeys := func(jobName string) ([]string, error) {
+		keys, ok := outputKeys[jobName]
+		if !ok {
+			return nil, fmt.Errorf("job %s not found", jobName)
+		}
+		return keys, nil
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "declared as is", value: "{{.job.freestyle.output.RESULT}}", want: "{{.job.freestyle.output.RESULT}}"},
+		{name: "single test module", value: "v={{.job.product-test.output.RESULT}},{{.job.product-test.output.FAILURES}}", want: "v={{.job.product-test.unit.output.RESULT}},{{.job.product-test.unit.output.FAILURES}}"},
+		{name: "full reference", value: "{{.job.product-test.unit.output.RESULT}}", want: "{{.job.product-test.unit.output.RESULT}}"},
+		{name: "ambiguous", value: "{{.job.matrix-test.output.RESULT}}", wantErr: true},
+		{name: "undeclared output", value: "{{.job.product-test.output.UNKNOWN}}", wantErr: true},
+		{name: "unknown job", value: "{{.job.unknown.output.RESULT}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTestingOutputRefs(tt.value, getOutputKeys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveTestingOutputRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTestingOutputRefs() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTestingWarmCacheSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		want  []string
+	}{
+		{
+			name: "full test",
+			steps: []string{
+				"test-tool-install", "test-download-archive", "test-git", "test-perforce", "test-debug_before", "test-shell", "test-debug_after",
+				config.TestJobHTMLReportStepName, config.TestJobArchiveResultStepName, config.TestJobJunitReportStepName, "test-tar-archive", config.TestJobObjectStorageStepName,
+			},
+			want: []string{"test-tool-install", "test-download-archive", "test-git", "test-perforce", "test-debug_before", "test-debug_after", "test-tar-archive"},
+		},
+		{
+			name:  "vm test with host aliases and no reports",
+			steps: []string{"test-tool-install", "test-download-archive", "test-git", "test-perforce", "test-debug_before", "test-host-aliases", "test-shell", "test-debug_after", "test-tar-archive"},
+			want:  []string{"test-tool-install", "test-download-archive", "test-git", "test-perforce", "test-debug_before", "test-host-aliases", "test-debug_after", "test-tar-archive"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := make([]*commonmodels.StepTask, 0, len(tt.steps))
+			var scriptStep *commonmodels.StepTask
+			for _, name := range tt.steps {
+				stepTask := &commonmodels.StepTask{Name: name}
+				if name == "test-shell" {
+					scriptStep = stepTask
+				}
+				steps = append(steps, stepTask)
+			}
+			got := make([]string, 0)
+			for _, stepTask := range getTestingWarmCacheSteps(steps, scriptStep) {
+				got = append(got, stepTask.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getTestingWarmCacheSteps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTestingHTMLReportSteps(t *testing.T) {
+	type htmlReportStep struct {
+		Name      string
+		TarDir    string
+		Result    string
+		S3DestDir string
+	}
+	tests := []struct {
+		name        string
+		reportPaths []string
+		want        []htmlReportStep
+	}{
+		{
+			name: "no report",
+			want: []htmlReportStep{},
+		},
+		{
+			name:        "single report",
+			reportPaths: []string{"reports/index.html"},
+			want: []htmlReportStep{
+				{Name: config.TestJobHTMLReportStepName, TarDir: "$WORKSPACE/reports", Result: "index.html", S3DestDir: "wf/1/job/html-report"},
+			},
+		},
+		{
+			name:        "multiple reports",
+			reportPaths: []string{"coverage/index.html", "reports/test.html"},
+			want: []htmlReportStep{
+				{Name: "html-report-step-0", TarDir: "$WORKSPACE/coverage", Result: "index.html", S3DestDir: "wf/1/job/html-report/html/0"},
+				{Name: "html-report-step-1", TarDir: "$WORKSPACE/reports", Result: "test.html", S3DestDir: "wf/1/job/html-report/html/1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]htmlReportStep, 0)
+			for _, stepTask := range newTestingHTMLReportSteps(tt.reportPaths, "job", "/tmp", "wf/1/job/html-report") {
+				spec := stepTask.Spec.(*step.StepTarArchiveSpec)
+				got = append(got, htmlReportStep{Name: stepTask.Name, TarDir: spec.TarDir, Result: spec.ResultDirs[0], S3DestDir: spec.S3DestDir})
+				if !config.IsTestJobHTMLReportStep(stepTask.Name) {
+					t.Errorf("step %s is not recognized as a html report step", stepTask.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newTestingHTMLReportSteps() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingEnvFileScripts(t *testing.T) {
+	repos := []*types.Repository{{RepoName: "app"}, {RepoName: "lib", CheckoutPath: "deps/lib"}}
+	tests := []struct {
+		name       string
+		envFile    *commonmodels.TestingEnvFileFromRepo
+		scriptType types.ScriptType
+		wantFirst  string
+		wantErr    bool
+	}{
+		{
+			name:      "shell",
+			envFile:   &commonmodels.TestingEnvFileFromRepo{RepoIndex: 1, FilePath: "ci/.env"},
+			wantFirst: `if [ ! -f "$WORKSPACE/deps/lib/ci/.env" ]; then echo "env file ci/.env not found in repo lib" >&2; exit 1; fi`,
+		},
+		{
+			name:       "batch file",
+			envFile:    &commonmodels.TestingEnvFileFromRepo{FilePath: "ci/.env"},
+			scriptType: types.ScriptTypeBatchFile,
+			wantFirst:  `if not exist "%WORKSPACE%\app\ci\.env" (echo env file ci/.env not found in repo app 1>&2 & exit /b 1)`,
+		},
+		{
+			name:       "powershell",
+			envFile:    &commonmodels.TestingEnvFileFromRepo{FilePath: ".env"},
+			scriptType: types.ScriptTypePowerShell,
+			wantFirst:  `if (-not (Test-Path -Path "$env:WORKSPACE/app/.env" -PathType Leaf)) { Write-Error "env file .env not found in repo app"; exit 1 }`,
+		},
+		{
+			name:    "repo index out of range",
+			envFile: &commonmodels.TestingEnvFileFromRepo{RepoIndex: 2, FilePath: ".env"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			envFile: &commonmodels.TestingEnvFileFromRepo{FilePath: "/etc/.env"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testingEnvFileScripts(tt.envFile, repos, tt.scriptType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("testingEnvFileScripts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got[0] != tt.wantFirst {
+				t.Errorf("testingEnvFileScripts() first script = %s, want %s", got[0], tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestTestingEnvFileScriptsInShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not found")
+	}
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	envFile := "# comment\n\nFROM_FILE=file\nexport EXPORTED=exported\nQUOTED=\"a b\"\nSINGLE_QUOTED='$HOME'\nEXPLICIT=file\nCOMMAND=$(echo injected)\ninvalid line\n1INVALID=x\nLAST=no-newline"
+	if err := os.WriteFile(filepath.Join(workspace, "app", ".env"), []byte(envFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := testingEnvFileScripts(&commonmodels.TestingEnvFileFromRepo{FilePath: ".env"}, []*types.Repository{{RepoName: "app"}}, types.ScriptTypeShell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripts = append(scripts, `printf '%s|%s|%s|%s|%s|%s|%s\n' "$FROM_FILE" "$EXPORTED" "$QUOTED" "$SINGLE_QUOTED" "$EXPLICIT" "$COMMAND" "$LAST"`)
+	cmd := exec.Command(sh, "-c", strings.Join(scripts, "\n"))
+	cmd.Env = []string{"WORKSPACE=" + workspace, "EXPLICIT=key_vals"}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run the scripts, error: %v, output: %s", err, out)
+	}
+	if want := "file|exported|a b|$HOME|key_vals|$(echo injected)|no-newline\n"; string(out) != want {
+		t.Errorf("variables loaded from the env file = %q, want %q", out, want)
+	}
+}
+
+func TestValidateVolumeClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  []*commonmodels.VolumeClaimSpec
+		wantErr bool
+	}{
+		{
+			name: "no claim",
+		},
+		{
+			name: "valid claims",
+			claims: []*commonmodels.VolumeClaimSpec{
+				{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "/scratch"},
+				{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "/data"},
+			},
+		},
+		{
+			name:    "empty storage class",
+			claims:  []*commonmodels.VolumeClaimSpec{{StorageSizeInGiB: 100, MountPath: "/scratch"}},
+			wantErr: true,
+		},
+		{
+			name:    "no size",
+			claims:  []*commonmodels.VolumeClaimSpec{{StorageClass: "ssd", MountPath: "/scratch"}},
+			wantErr: true,
+		},
+		{
+			name:    "relative mount path",
+			claims:  []*commonmodels.VolumeClaimSpec{{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "scratch"}},
+			wantErr: true,
+		},
+		{
+			name: "same mount path",
+			claims: []*commonmodels.VolumeClaimSpec{
+				{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "/scratch"},
+				{StorageClass: "hdd", StorageSizeInGiB: 500, MountPath: "/scratch/"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := commonmodels.ValidateVolumeClaims(tt.claims); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateVolumeClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTestingVolumeClaimsWithoutCluster(t *testing.T) {
+	newTesting := func(claims ...*commonmodels.VolumeClaimSpec) *commonmodels.Testing {
+		return &commonmodels.Testing{Name: "unit", PreTest: &commonmodels.PreTest{ClusterID: "attached", VolumeClaims: claims}}
+	}
+	// the storage classes are only looked up in the cluster when the workflow is executed
+	if err := validateTestingVolumeClaims(newTesting(&commonmodels.VolumeClaimSpec{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "/scratch"}), false); err != nil {
+		t.Errorf("validateTestingVolumeClaims() error = %v", err)
+	}
+	if err := validateTestingVolumeClaims(newTesting(&commonmodels.VolumeClaimSpec{StorageClass: "ssd", MountPath: "/scratch"}), false); err == nil {
+		t.Errorf("validateTestingVolumeClaims() of a claim without size should fail")
+	}
+}
+
+func TestValidateTestingClusterSourceWithoutCluster(t *testing.T) {
+	// the cluster and the namespace are only looked up when the workflow is executed
+	if err := validateTestingClusterSource("deleted", "default", "app=web", false); err != nil {
+		t.Errorf("validateTestingClusterSource() error = %v", err)
+	}
+	if err := validateTestingClusterSource("deleted", "", "app=web", false); err == nil {
+		t.Errorf("validateTestingClusterSource() without namespace should fail")
+	}
+	if err := validateTestingClusterSource("deleted", "default", "app in (web", false); err == nil {
+		t.Errorf("validateTestingClusterSource() of an invalid label selector should fail")
+	}
+}
+
+func TestGetTestingVolumeClaimStorages(t *testing.T) {
+	claims := []*commonmodels.VolumeClaimSpec{
+		{StorageClass: "ssd", StorageSizeInGiB: 100, MountPath: "/scratch"},
+		{StorageClass: "hdd", StorageSizeInGiB: 500, MountPath: "/data"},
+	}
+	want := []*types.NFSProperties{
+		{ProvisionType: types.DynamicProvision, StorageClass: "ssd", StorageSizeInGiB: 100, AccessMode: "ReadWriteOnce", MountPath: "/scratch", IsTemporary: true},
+		{ProvisionType: types.DynamicProvision, StorageClass: "hdd", StorageSizeInGiB: 500, AccessMode: "ReadWriteOnce", MountPath: "/data", IsTemporary: true},
+	}
+	if got := getTestingVolumeClaimStorages(claims); !reflect.DeepEqual(got, want) {
+		t.Errorf("getTestingVolumeClaimStorages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetProductServiceTargets(t *testing.T) {
+	product := &commonmodels.Product{
+		Services: [][]*commonmodels.ProductService{
+			{
+				{ServiceName: "web", Containers: []*commonmodels.Container{{Name: "nginx"}, {Name: "sidecar"}}},
+				{ServiceName: "chart", Type: setting.HelmChartDeployType},
+			},
+			{
+				{ServiceName: "api", Containers: []*commonmodels.Container{{Name: "api"}}},
+				{ServiceName: "db", Containers: []*commonmodels.Container{{Name: "mysql"}}},
+			},
+		},
+	}
+	want := []*commonmodels.ServiceTestTarget{
+		{ServiceName: "web", ServiceModule: "nginx"},
+		{ServiceName: "web", ServiceModule: "sidecar"},
+		{ServiceName: "api", ServiceModule: "api"},
+		{ServiceName: "db", ServiceModule: "mysql"},
+	}
+	// the targets keep the order of the service groups on every run
+	for i := 0; i < 10; i++ {
+		if got := getProductServiceTargets(product); !reflect.DeepEqual(got, want) {
+			t.Fatalf("getProductServiceTargets() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestTestingJobFindsTestingsInOneQuery(t *testing.T) {
+	var queries [][]string
+	origin := findTestingsByName
+	defer func() { findTestingsByName = origin }()
+	findTestingsByName = func(names []string) (map[string]*commonmodels.Testing, error) {
+		queries = append(queries, names)
+		resp := make(map[string]*commonmodels.Testing)
+		for _, name := range names {
+			resp[name] = &commonmodels.Testing{
+				Name:    name,
+				Repos:   []*types.Repository{{RepoName: name, Branch: "main"}},
+				PreTest: &commonmodels.PreTest{},
+			}
+		}
+		return resp, nil
+	}
+
+	spec := &commonmodels.ZadigTestingJobSpec{TestType: config.ProductTestType}
+	for i := 0; i < 10; i++ {
+		spec.TestModuleOptions = append(spec.TestModuleOptions, &commonmodels.TestModule{Name: fmt.Sprintf("test-%d", i)})
+	}
+	job := &commonmodels.Job{Name: "test", JobType: config.JobZadigTesting, Spec: spec}
+	workflow := &commonmodels.WorkflowV4{Name: "workflow", Stages: []*commonmodels.WorkflowStage{{Jobs: []*commonmodels.Job{job}}}}
+	ctrl, err := CreateTestingJobController(job, workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := ctrl.GetUsedRepos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 10 {
+		t.Errorf("GetUsedRepos() returns %d repos, want 10", len(repos))
+	}
+	if err := ctrl.Update(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("GetUsedRepos() and Update() made %d queries, want one each", len(queries))
+	}
+	for _, names := range queries {
+		if len(names) != 10 {
+			t.Errorf("query finds %d testings, want 10", len(names))
+		}
+	}
+}
+
+func TestGetTestingByName(t *testing.T) {
+	testings := map[string]*commonmodels.Testing{
+		"unit": {Name: "unit", TestReportPaths: []string{"$WORKSPACE/report"}},
+	}
+
+	testing, err := getTestingByName(testings, "unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testing.TestReportPaths[0] = "/workspace/report"
+	if testings["unit"].TestReportPaths[0] != "$WORKSPACE/report" {
+		t.Errorf("the found testing is modified by its job task: %v", testings["unit"].TestReportPaths)
+	}
+
+	if _, err := getTestingByName(testings, "missing"); err == nil {
+		t.Errorf("getTestingByName() of a missing testing should fail")
+	}
+}
+
+func TestSetTestingTestedServices(t *testing.T) {
+	newJobTask := func(status config.Status, jobInfo map[string]string) *commonmodels.JobTask {
+		return &commonmodels.JobTask{Status: status, JobInfo: jobInfo}
+	}
+
+	tests := []struct {
+		name     string
+		jobTasks []*commonmodels.JobTask
+		want     string
+	}{
+		{
+			name: "matrix rows and shards of a test module are one target",
+			jobTasks: []*commonmodels.JobTask{
+				newJobTask("", map[string]string{"testing_name": "unit", "matrix_key": "go-1.21", "shard_index": "0"}),
+				newJobTask("", map[string]string{"testing_name": "unit", "matrix_key": "go-1.21", "shard_index": "1"}),
+				newJobTask("", map[string]string{"testing_name": "unit", "matrix_key": "go-1.22", "shard_index": "0"}),
+				newJobTask("", map[string]string{"testing_name": "e2e"}),
+			},
+			want: `[{"testing_name":"unit","job_tasks":3},{"testing_name":"e2e","job_tasks":1}]`,
+		},
+		{
+			name: "skipped and warm cache only job tasks are not counted",
+			jobTasks: []*commonmodels.JobTask{
+				newJobTask("", map[string]string{"service_name": "api", "service_module": "api", "shard_index": "0"}),
+				newJobTask("", map[string]string{"service_name": "api", "service_module": "api", "shard_index": "1"}),
+				newJobTask(config.StatusSkipped, map[string]string{"service_name": "web", "service_module": "web"}),
+				newJobTask("", map[string]string{"service_name": "worker", "service_module": "worker", "warm_cache_only": "true"}),
+			},
+			want: `[{"service_name":"api","service_module":"api","job_tasks":2}]`,
+		},
+		{
+			name: "all job tasks are skipped",
+			jobTasks: []*commonmodels.JobTask{
+				newJobTask(config.StatusSkipped, map[string]string{"testing_name": "unit"}),
+			},
+			want: `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setTestingTestedServices(tt.jobTasks); err != nil {
+				t.Fatal(err)
+			}
+			for i, jobTask := range tt.jobTasks {
+				if got := jobTask.JobInfo.(map[string]string)["tested_services"]; got != tt.want {
+					t.Errorf("tested_services of job task %d = %s, want %s", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTestingJobServiceTestModules(t *testing.T) {
+	origin := findTestingsByName
+	defer func() { findTestingsByName = origin }()
+	findTestingsByName = func(names []string) (map[string]*commonmodels.Testing, error) {
+		resp := make(map[string]*commonmodels.Testing)
+		for _, name := range names {
+			resp[name] = &commonmodels.Testing{
+				Name:    name,
+				Repos:   []*types.Repository{{RepoName: name, Branch: "main"}},
+				PreTest: &commonmodels.PreTest{},
+			}
+		}
+		return resp, nil
+	}
+
+	spec := &commonmodels.ZadigTestingJobSpec{
+		TestType: config.ServiceTestType,
+		ServiceTestOptions: []*commonmodels.ServiceAndTest{
+			{ServiceName: "api", ServiceModule: "api", TestModules: []*commonmodels.TestModule{
+				{Name: "unit", Shards: 2},
+				{Name: "contract", RunPolicy: "true"},
+			}},
+			{ServiceName: "web", ServiceModule: "web", TestModule: &commonmodels.TestModule{Name: "e2e"}},
+		},
+		ServiceAndTests: []*commonmodels.ServiceAndTest{
+			{ServiceName: "api", ServiceModule: "api", TestModules: []*commonmodels.TestModule{{Name: "contract"}, {Name: "removed"}}},
+			{ServiceName: "web", ServiceModule: "web", TestModule: &commonmodels.TestModule{Name: "e2e"}},
+		},
+	}
+	job := &commonmodels.Job{Name: "test", JobType: config.JobZadigTesting, Spec: spec}
+	workflow := &commonmodels.WorkflowV4{Name: "workflow", Stages: []*commonmodels.WorkflowStage{{Jobs: []*commonmodels.Job{job}}}}
+	ctrl, err := CreateTestingJobController(job, workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := ctrl.GetUsedRepos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 3 {
+		t.Errorf("GetUsedRepos() returns %d repos, want one for each of the 3 testings", len(repos))
+	}
+
+	if err := ctrl.Update(true, nil); err != nil {
+		t.Fatal(err)
+	}
+	testingCtrl := ctrl.(TestingJobController)
+	selected := testingCtrl.jobSpec.ServiceAndTests
+	if len(selected) != 2 || len(selected[0].TestModules) != 1 || selected[0].TestModules[0].RunPolicy != "true" {
+		t.Fatalf("Update() should keep the configured testing contract of api only, got %+v", selected[0].TestModules)
+	}
+	if selected[1].TestModule == nil || len(selected[1].TestModules) != 0 {
+		t.Errorf("Update() should keep the singular testing of web, got %+v", selected[1])
+	}
+
+	keys := make([]string, 0)
+	for _, testing := range testingCtrl.getSelectedServiceTestings() {
+		keys = append(keys, genJobKey("test", testing.keyParts()...))
+	}
+	if want := []string{"test.api.api.contract", "test.web.web"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("job keys of the selected testings = %v, want %v", keys, want)
+	}
+
+	kvs, err := ctrl.GetVariableList("test", false, false, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceNameKeys := make([]string, 0)
+	for _, kv := range kvs {
+		if strings.HasSuffix(kv.Key, ".SERVICE_NAME") {
+			serviceNameKeys = append(serviceNameKeys, kv.Key)
+		}
+	}
+	want := []string{"job.test.api.api.unit.SERVICE_NAME", "job.test.api.api.contract.SERVICE_NAME", "job.test.web.web.SERVICE_NAME"}
+	if !reflect.DeepEqual(serviceNameKeys, want) {
+		t.Errorf("GetVariableList() keys = %v, want %v", serviceNameKeys, want)
+	}
+}
+
+func TestTestingJobResetSelectionForRerun(t *testing.T) {
+	newSpec := func(testType config.TestModuleType, source config.DeploySourceType) *commonmodels.ZadigTestingJobSpec {
+		return &commonmodels.ZadigTestingJobSpec{
+			TestType:        testType,
+			Source:          source,
+			JobName:         "build",
+			OriginJobName:   "build",
+			DefaultServices: []*commonmodels.ServiceTestTarget{{ServiceName: "api", ServiceModule: "api"}},
+			TestModules:     []*commonmodels.TestModule{{Name: "unit"}},
+			ServiceAndTests: []*commonmodels.ServiceAndTest{
+				{ServiceName: "api", ServiceModule: "api", TestModule: &commonmodels.TestModule{Name: "unit"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		spec             *commonmodels.ZadigTestingJobSpec
+		wantServiceTests int
+	}{
+		{name: "product test", spec: newSpec(config.ProductTestType, ""), wantServiceTests: 1},
+		{name: "services picked by the user", spec: newSpec(config.ServiceTestType, config.SourceRuntime), wantServiceTests: 0},
+		{name: "services resolved from the origin job", spec: newSpec(config.ServiceTestType, config.SourceFromJob), wantServiceTests: 1},
+		{name: "services resolved from the env", spec: newSpec(config.ServiceTestType, config.SourceFromEnv), wantServiceTests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TestingJobController{jobSpec: tt.spec}.ResetSelectionForRerun()
+			if len(tt.spec.TestModules) != 0 {
+				t.Errorf("test modules are not cleared: %v", tt.spec.TestModules)
+			}
+			if len(tt.spec.ServiceAndTests) != tt.wantServiceTests {
+				t.Errorf("got %d service tests, want %d", len(tt.spec.ServiceAndTests), tt.wantServiceTests)
+			}
+			if tt.spec.JobName != "build" || tt.spec.OriginJobName != "build" || len(tt.spec.DefaultServices) != 1 {
+				t.Errorf("the origin job reference and the target services should be kept, got %+v", tt.spec)
+			}
+		})
+	}
+}
+
+func TestCheckTestingImagePullSecrets(t *testing.T) {
+	origin := getTestingImagePullSecret
+	defer func() { getTestingImagePullSecret = origin }()
+	lookups := 0
+	getTestingImagePullSecret = func(clusterID, namespace, name string) (bool, error) {
+		lookups++
+		if name == "error" {
+			return false, fmt.Errorf("forbidden")
+		}
+		return clusterID == "attached" && namespace == setting.AttachedClusterNamespace && name == "mirror", nil
+	}
+
+	newTesting := func(infrastructure string, secrets ...string) *commonmodels.Testing {
+		return &commonmodels.Testing{
+			Name:           "unit",
+			Infrastructure: infrastructure,
+			PreTest:        &commonmodels.PreTest{ClusterID: "attached", ExtraImagePullSecrets: secrets},
+		}
+	}
+	tests := []struct {
+		name        string
+		testing     *commonmodels.Testing
+		noCluster   bool
+		wantErr     bool
+		wantLookups int
+	}{
+		{name: "no extra secret", testing: newTesting("")},
+		{name: "existing secret is checked once", testing: newTesting("", "mirror", "mirror"), wantLookups: 1},
+		{name: "missing secret", testing: newTesting("", "mirror", "missing"), wantErr: true, wantLookups: 2},
+		{name: "failed lookup", testing: newTesting("", "error"), wantErr: true, wantLookups: 1},
+		{name: "empty name", testing: newTesting("", ""), wantErr: true},
+		{name: "ignored on vm", testing: newTesting(setting.JobVMInfrastructure, "missing")},
+		{name: "cluster not checked", testing: newTesting("", "missing"), noCluster: true},
+		{name: "empty name without cluster check", testing: newTesting("", ""), noCluster: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups = 0
+			err := checkTestingImagePullSecrets(tt.testing, !tt.noCluster)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingImagePullSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if lookups != tt.wantLookups {
+				t.Errorf("made %d lookups, want %d", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestCheckTestingCacheDirOverlaps(t *testing.T) {
+	newTesting := func(cacheDir string, artifactPaths []string, resultPath, reportPath string) *commonmodels.Testing {
+		return &commonmodels.Testing{
+			Name:           "unit",
+			CacheEnable:    true,
+			CacheDirType:   types.UserDefinedCacheDir,
+			CacheUserDir:   cacheDir,
+			ArtifactPaths:  artifactPaths,
+			TestResultPath: resultPath,
+			TestReportPath: reportPath,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		testing *commonmodels.Testing
+		wantErr bool
+	}{
+		{name: "separate dirs", testing: newTesting("/workspace/.cache", []string{"out"}, "reports/junit", "reports/html/index.html")},
+		{name: "cache dir outside the workspace", testing: newTesting("/root/.m2", []string{"root/.m2"}, "", "")},
+		{name: "similar prefix is not nested", testing: newTesting("/workspace/out", []string{"output"}, "", "")},
+		{name: "same dir", testing: newTesting("$WORKSPACE/out", []string{"out"}, "", ""), wantErr: true},
+		{name: "artifact nested in the cache dir", testing: newTesting("/workspace", []string{"$WORKSPACE/out"}, "", ""), wantErr: true},
+		{name: "cache dir nested in the junit dir", testing: newTesting("/workspace/reports/cache", nil, "reports", ""), wantErr: true},
+		{name: "html report in the cache dir", testing: newTesting("reports", nil, "", "reports/index.html"), wantErr: true},
+		{name: "workspace cache dir type is not checked", testing: &commonmodels.Testing{CacheEnable: true, CacheDirType: types.WorkspaceCacheDir, ArtifactPaths: []string{"out"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTestingCacheDirOverlaps(tt.testing); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingCacheDirOverlaps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTestingEnvReferences(t *testing.T) {
+	testingInfo := &commonmodels.Testing{
+		Name:  "unit-test",
+		Repos: []*types.Repository{{RepoName: "zadig"}},
+		PreTest: &commonmodels.PreTest{
+			Envs: commonmodels.KeyValList{
+				{Key: "DB_HOST", Value: "mysql"},
+				{Key: "DB_URL", Value: "mysql://${DB_HOST}:3306"},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		jobKeyVals []*commonmodels.KeyVal
+		keys       []string
+		wantErr    bool
+	}{
+		{name: "custom envs", jobKeyVals: []*commonmodels.KeyVal{{Key: "REPORT", Value: "${DB_HOST}-${TOKEN}"}}, keys: []string{"TOKEN"}},
+		{name: "built-in job variables", jobKeyVals: []*commonmodels.KeyVal{{Key: "REPORT", Value: "${WORKSPACE}/${TASK_ID}/${zadig_BRANCH}/${SERVICE_MODULE}"}}},
+		{name: "defaults are left to the shell", jobKeyVals: []*commonmodels.KeyVal{{Key: "REPORT", Value: "${OUTPUT_DIR:-/tmp} $OUTPUT_DIR"}}},
+		{name: "typo in a custom env", jobKeyVals: []*commonmodels.KeyVal{{Key: "DB_URL", Value: "mysql://${DB_HOTS}:3306"}}, wantErr: true},
+		{name: "typo in a built-in job variable", jobKeyVals: []*commonmodels.KeyVal{{Key: "REPORT", Value: "${TASKID}"}}, wantErr: true},
+		{name: "repo variables of another repo", jobKeyVals: []*commonmodels.KeyVal{{Key: "REPORT", Value: "${koderover_BRANCH}"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTestingEnvReferences(testingInfo, tt.jobKeyVals, sets.NewString(tt.keys...)); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingEnvReferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTestingLogMaskPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		testing *commonmodels.Testing
+		wantErr bool
+	}{
+		{name: "no patterns", testing: &commonmodels.Testing{Name: "unit-test"}},
+		{name: "valid patterns", testing: &commonmodels.Testing{Name: "unit-test", LogMaskPatterns: []string{`token=\w+`}}},
+		{name: "invalid regex", testing: &commonmodels.Testing{Name: "unit-test", LogMaskPatterns: []string{`token=(\w+`}}, wantErr: true},
+		{name: "patterns on vm", testing: &commonmodels.Testing{Name: "unit-test", Infrastructure: setting.JobVMInfrastructure, LogMaskPatterns: []string{`token=\w+`}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTestingLogMaskPatterns(tt.testing); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingLogMaskPatterns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTestingShellInterpreter(t *testing.T) {
+	tests := []struct {
+		name    string
+		testing *commonmodels.Testing
+		wantErr bool
+	}{
+		{name: "default interpreter", testing: &commonmodels.Testing{Name: "unit-test"}},
+		{name: "dash for shell", testing: &commonmodels.Testing{Name: "unit-test", ShellInterpreter: "dash"}},
+		{name: "pwsh for powershell", testing: &commonmodels.Testing{Name: "unit-test", ScriptType: types.ScriptTypePowerShell, ShellInterpreter: "pwsh"}},
+		{name: "pwsh for shell", testing: &commonmodels.Testing{Name: "unit-test", ScriptType: types.ScriptTypeShell, ShellInterpreter: "pwsh"}, wantErr: true},
+		{name: "any interpreter for batch file", testing: &commonmodels.Testing{Name: "unit-test", ScriptType: types.ScriptTypeBatchFile, ShellInterpreter: "cmd"}, wantErr: true},
+		{name: "detected from repo script", testing: &commonmodels.Testing{Name: "unit-test", ScriptFromRepo: &commonmodels.TestingScriptFromRepo{FilePath: "ci/test.ps1"}, ShellInterpreter: "pwsh"}},
+		{name: "path instead of name", testing: &commonmodels.Testing{Name: "unit-test", ShellInterpreter: "/bin/dash"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTestingShellInterpreter(tt.testing); (err != nil) != tt.wantErr {
+				t.Errorf("checkTestingShellInterpreter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTestingRetryErrorPolicy(t *testing.T) {
+	jobPolicy := &commonmodels.JobErrorPolicy{Policy: config.JobErrorPolicyIgnoreError}
+	tests := []struct {
+		name      string
+		retrySpec *commonmodels.TestRetrySpec
+		want      *commonmodels.JobErrorPolicy
+	}{
+		{name: "no retry spec", want: jobPolicy},
+		{name: "no retries", retrySpec: &commonmodels.TestRetrySpec{RetryIntervalSeconds: 5}, want: jobPolicy},
+		{
+			name:      "retries override the job policy",
+			retrySpec: &commonmodels.TestRetrySpec{MaxRetries: 2, RetryIntervalSeconds: 5},
+			want: &commonmodels.JobErrorPolicy{
+				Policy:                 config.JobErrorPolicyRetry,
+				MaximumRetry:           2,
+				RetryInterval:          5,
+				RetryOnlyWithoutOutput: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getTestingRetryErrorPolicy(tt.retrySpec, jobPolicy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getTestingRetryErrorPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestingRetryWithGitRepo(t *testing.T) {
+	testingInfo := &commonmodels.Testing{
+		TestResultPath: "reports",
+		Outputs:        []*commonmodels.Output{{Name: "DB_INSTANCE"}, {Name: "REPO_1_COMMIT", Description: "commit of the backend"}},
+		Repos: []*types.Repository{
+			{Source: types.ProviderGitlab, RepoName: "frontend"},
+			{Source: types.ProviderGitlab, RepoName: "backend"},
+		},
+	}
+	jobTask := &commonmodels.JobTask{
+		Key:         "test.api",
+		Outputs:     ensureTestingOutputs(testingInfo),
+		ErrorPolicy: getTestingRetryErrorPolicy(&commonmodels.TestRetrySpec{MaxRetries: 2}, nil),
+	}
+	if !jobTask.ErrorPolicy.RetryOnlyWithoutOutput {
+		t.Fatalf("the error policy of the retry spec should only retry the failures without outputs")
+	}
+
+	// the git step writes the commits before the test script fails, and the junit step writes the statistics after it
+	globalContext := map[string]string{
+		jobspec.GetJobOutputKey(jobTask.Key, "REPO_0_COMMIT"):                               "3f2a9c1",
+		jobspec.GetJobOutputKey(jobTask.Key, "REPO_1_COMMIT"):                               "8be07d4",
+		jobspec.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeyTotal):      "0",
+		jobspec.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeyFailed):     "0",
+		jobspec.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeySkipped):    "0",
+		jobspec.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeyDurationMS): "0",
+	}
+	workflowCtx := &commonmodels.WorkflowTaskCtx{
+		GlobalContextGet: func(key string) (string, bool) {
+			v, ok := globalContext[key]
+			return v, ok
+		},
+	}
+	if jobcontroller.JobWroteOutputs(jobTask, workflowCtx) {
+		t.Errorf("the failed script wrote no outputs, the outputs of zadig should not stop the retries")
+	}
+
+	// the output script writes the variables which are never set by the failed script as empty outputs
+	globalContext[jobspec.GetJobOutputKey(jobTask.Key, "DB_INSTANCE")] = ""
+	if jobcontroller.JobWroteOutputs(jobTask, workflowCtx) {
+		t.Errorf("the empty outputs should not stop the retries")
+	}
+
+	globalContext[jobspec.GetJobOutputKey(jobTask.Key, "DB_INSTANCE")] = "db-1"
+	if !jobcontroller.JobWroteOutputs(jobTask, workflowCtx) {
+		t.Errorf("the output written by the failed script should stop the retries")
+	}
+}
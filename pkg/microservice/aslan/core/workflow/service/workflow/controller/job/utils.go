@@ -18,17 +18,24 @@ package job
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+	"go.uber.org/zap"
 
 	configbase "github.com/koderover/zadig/v2/pkg/config"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	commonservice "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/service/registry"
 	commonutil "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/util"
 	"github.com/koderover/zadig/v2/pkg/setting"
 	"github.com/koderover/zadig/v2/pkg/types"
@@ -184,7 +191,29 @@ func renderRepos(base []*types.Repository, kvs []*commonmodels.KeyVal) {
 		if repo.RemoteName == "" {
 			repo.RemoteName = "origin"
 		}
+		if repo.CloneDepth < 0 {
+			repo.CloneDepth = 0
+		}
+	}
+}
+
+// renderRepoDeployKeys resolves the deploy keys referred by the repos, an error is returned when a key cannot be
+// found so that the clone doesn't silently fall back to the credentials of the code host.
+func renderRepoDeployKeys(repos []*types.Repository) error {
+	for _, repo := range repos {
+		if repo.DeployKeyID == "" {
+			continue
+		}
+		key, err := commonrepo.NewPrivateKeyColl().Find(commonrepo.FindPrivateKeyOption{ID: repo.DeployKeyID})
+		if err != nil {
+			return fmt.Errorf("failed to find deploy key: %s of repo: %s/%s, please check if the key has been deleted, error: %v", repo.DeployKeyID, repo.RepoOwner, repo.RepoName, err)
+		}
+		if key.PrivateKey == "" {
+			return fmt.Errorf("deploy key: %s of repo: %s/%s has no private key configured", key.Name, repo.RepoOwner, repo.RepoName)
+		}
+		repo.DeployKey = key.PrivateKey
 	}
+	return nil
 }
 
 func renderReferredRepo(repos []*types.Repository, params []*commonmodels.Param) ([]*types.Repository, error) {
@@ -525,7 +554,7 @@ func prepareDefaultWorkflowTaskEnvs(projectKey, workflowName, workflowDisplayNam
 		envs = append(envs, &commonmodels.KeyVal{Key: "WORKSPACE", Value: "/workspace"})
 	}
 
-	url := getTaskLink(configbase.SystemAddress(), projectKey, workflowName, workflowDisplayName, taskID)
+	url := getTaskLink(configbase.ExternalAddress(), projectKey, workflowName, workflowDisplayName, taskID)
 
 	envs = append(envs, &commonmodels.KeyVal{Key: "TASK_URL", Value: url})
 	envs = append(envs, &commonmodels.KeyVal{Key: "TASK_ID", Value: strconv.FormatInt(taskID, 10)})
@@ -656,3 +685,60 @@ func renderParams(origin, input []*commonmodels.Param) []*commonmodels.Param {
 
 	return resp
 }
+
+const registryPreflightTimeout = 5 * time.Second
+
+// checkImageRegistryReachable checks the registry of the image before the job is created. An integrated registry of the
+// same host is validated with its credentials, any other registry only has to respond to the registry api.
+func checkImageRegistryReachable(image string, registries []*commonmodels.RegistryNamespace, log *zap.SugaredLogger) error {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return fmt.Errorf("invalid image %s: %v", image, err)
+	}
+	host := reference.Domain(named)
+
+	for _, reg := range registries {
+		if registryHost(reg.RegAddr) != host {
+			continue
+		}
+		tlsEnabled, tlsCert := false, ""
+		if reg.AdvancedSetting != nil {
+			tlsEnabled, tlsCert = reg.AdvancedSetting.TLSEnabled, reg.AdvancedSetting.TLSCert
+		}
+		err = registry.NewV2Service(reg.RegProvider, tlsEnabled, tlsCert).ValidateRegistry(registry.Endpoint{
+			Addr:      reg.RegAddr,
+			Ak:        reg.AccessKey,
+			Sk:        reg.SecretKey,
+			Namespace: reg.Namespace,
+			Region:    reg.Region,
+		}, log)
+		if err != nil {
+			return fmt.Errorf("registry %s of image %s is unreachable: %v", host, image, err)
+		}
+		return nil
+	}
+
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	httpClient := &http.Client{Timeout: registryPreflightTimeout}
+	resp, err := httpClient.Get(fmt.Sprintf("https://%s/v2/", host))
+	if err != nil {
+		return fmt.Errorf("registry %s of image %s is unreachable: %v", host, image, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// registryHost returns the host of the registry address which may come with a scheme or a path
+func registryHost(regAddr string) string {
+	addr := regAddr
+	if !strings.Contains(addr, "://") {
+		addr = "https://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return regAddr
+	}
+	return u.Host
+}
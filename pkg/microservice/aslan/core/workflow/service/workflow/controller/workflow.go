@@ -26,6 +26,8 @@ import (
 
 	configbase "github.com/koderover/zadig/v2/pkg/config"
 	"github.com/koderover/zadig/v2/pkg/microservice/aslan/config"
+	codeclient "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/code/client"
+	"github.com/koderover/zadig/v2/pkg/microservice/aslan/core/code/client/open"
 	commonmodels "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb"
 	templaterepo "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/common/repository/mongodb/template"
@@ -34,6 +36,7 @@ import (
 	jobctrl "github.com/koderover/zadig/v2/pkg/microservice/aslan/core/workflow/service/workflow/controller/job"
 	"github.com/koderover/zadig/v2/pkg/setting"
 	"github.com/koderover/zadig/v2/pkg/shared/client/plutusvendor"
+	"github.com/koderover/zadig/v2/pkg/shared/client/systemconfig"
 	e "github.com/koderover/zadig/v2/pkg/tool/errors"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
 	"github.com/koderover/zadig/v2/pkg/types"
@@ -716,6 +719,92 @@ func (w *Workflow) GetUsedRepos() ([]*types.Repository, error) {
 	return resp, nil
 }
 
+// GetReposWithDefaults returns the repos used by the workflow like GetUsedRepos, if resolveRemote is true the default
+// branch of each repo without a branch is looked up from its codehost. A failed lookup only leaves the branch of the
+// repo empty, the returned repos are copies so the workflow itself is not changed.
+func (w *Workflow) GetReposWithDefaults(resolveRemote bool) ([]*types.Repository, error) {
+	repos, err := w.GetUsedRepos()
+	if err != nil {
+		return nil, err
+	}
+	if !resolveRemote {
+		return repos, nil
+	}
+
+	resp, lookupErrs := fillRepoDefaultBranches(repos, getRepoDefaultBranch)
+	for key, err := range lookupErrs {
+		log.Warnf("failed to get the default branch of repo %s, err: %v", key, err)
+	}
+	return resp, nil
+}
+
+// fillRepoDefaultBranches copies the repos and sets the default branch of the ones without a branch, the branch of a
+// repo is looked up once however many jobs use it. The lookup errors are keyed by the codehost id and the repo key.
+func fillRepoDefaultBranches(repos []*types.Repository, getDefaultBranch func(repo *types.Repository) (string, error)) ([]*types.Repository, map[string]error) {
+	resp := make([]*types.Repository, 0, len(repos))
+	branches := make(map[string]string)
+	lookupErrs := make(map[string]error)
+	for _, repo := range repos {
+		repoCopy := *repo
+		resp = append(resp, &repoCopy)
+		if repoCopy.Branch != "" {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%s", repoCopy.CodehostID, repoCopy.GetKey())
+		if _, failed := lookupErrs[key]; failed {
+			continue
+		}
+		branch, ok := branches[key]
+		if !ok {
+			var err error
+			branch, err = getDefaultBranch(&repoCopy)
+			if err != nil {
+				lookupErrs[key] = err
+				continue
+			}
+			branches[key] = branch
+		}
+		repoCopy.Branch = branch
+	}
+	return resp, lookupErrs
+}
+
+// getRepoDefaultBranch finds the repo in the projects of its namespace on the codehost, repos of codehosts without
+// an api have no default branch
+func getRepoDefaultBranch(repo *types.Repository) (string, error) {
+	ch, err := systemconfig.New().GetCodeHost(repo.CodehostID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get codehost %d, err: %v", repo.CodehostID, err)
+	}
+	if ch.Type == setting.SourceFromOther || ch.Type == types.ProviderPerforce {
+		return "", nil
+	}
+	cli, err := open.OpenClient(ch, log.SugaredLogger())
+	if err != nil {
+		return "", fmt.Errorf("failed to open codehost %d, err: %v", repo.CodehostID, err)
+	}
+
+	// the namespace of a gitlab repo may be either a user or a group
+	namespace := repo.GetRepoNamespace()
+	for _, kind := range []string{codeclient.UserKind, codeclient.GroupKind} {
+		projects, listErr := cli.ListProjects(codeclient.ListOpt{Namespace: namespace, NamespaceType: kind, Key: repo.RepoName})
+		if listErr != nil {
+			err = listErr
+			continue
+		}
+		for _, project := range projects {
+			if project.Name == repo.RepoName || project.RepoID == repo.RepoName {
+				return project.DefaultBranch, nil
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("repo %s is not found in namespace %s", repo.RepoName, namespace)
+}
+
 func renderParams(origin, input []*commonmodels.Param) []*commonmodels.Param {
 	resp := make([]*commonmodels.Param, 0)
 	for _, originParam := range origin {
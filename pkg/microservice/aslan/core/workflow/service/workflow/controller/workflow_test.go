@@ -0,0 +1,66 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/koderover/zadig/v2/pkg/types"
+)
+
+func TestFillRepoDefaultBranches(t *testing.T) {
+	lookups := make(map[string]int)
+	getDefaultBranch := func(repo *types.Repository) (string, error) {
+		lookups[repo.RepoName]++
+		switch repo.RepoName {
+		case "unreachable":
+			return "", fmt.Errorf("connection refused")
+		case "nodefault":
+			return "", nil
+		}
+		return "main", nil
+	}
+
+	repos := []*types.Repository{
+		{CodehostID: 1, RepoOwner: "koderover", RepoName: "zadig"},
+		{CodehostID: 1, RepoOwner: "koderover", RepoName: "zadig"},
+		{CodehostID: 1, RepoOwner: "koderover", RepoName: "unreachable"},
+		{CodehostID: 1, RepoOwner: "koderover", RepoName: "unreachable"},
+		{CodehostID: 1, RepoOwner: "koderover", RepoName: "pinned", Branch: "release"},
+		{CodehostID: 2, RepoOwner: "koderover", RepoName: "nodefault"},
+	}
+	resp, lookupErrs := fillRepoDefaultBranches(repos, getDefaultBranch)
+
+	wantBranches := []string{"main", "main", "", "", "release", ""}
+	for i, repo := range resp {
+		if repo.Branch != wantBranches[i] {
+			t.Errorf("repo %d %s has branch %q, want %q", i, repo.RepoName, repo.Branch, wantBranches[i])
+		}
+		if repos[i].Branch != "" && repos[i].Branch != "release" {
+			t.Errorf("repo %d %s of the workflow is changed", i, repos[i].RepoName)
+		}
+	}
+	for name, count := range map[string]int{"zadig": 1, "unreachable": 1, "pinned": 0, "nodefault": 1} {
+		if lookups[name] != count {
+			t.Errorf("default branch of %s is looked up %d times, want %d", name, lookups[name], count)
+		}
+	}
+	if len(lookupErrs) != 1 || lookupErrs["1//koderover/unreachable"] == nil {
+		t.Errorf("lookup errors = %v, want only the error of the unreachable repo", lookupErrs)
+	}
+}
@@ -542,6 +542,7 @@ func CreateWorkflowTaskV4(args *CreateWorkflowTaskV4Args, workflow *commonmodels
 
 		// Always use the latest workflow's notification settings
 		workflow.NotifyCtls = originalWorkflow.NotifyCtls
+		workflow.TestingTypedVariables = originalWorkflow.TestingTypedVariables
 		workflowTask.Hash = originalWorkflow.Hash
 	} else {
 		if workflow.Disabled {
@@ -981,12 +982,14 @@ func ManualExecWorkflowTaskV4(workflowName string, taskID int64, stageName strin
 				}
 
 				for _, jobTask := range jobTasks {
+					// job tasks may be skipped by the job controller itself, e.g. the run policy of a test module
+					skippedByController := jobTask.Status == config.StatusSkipped
 					jobTask.Status = ""
 					jobTask.StartTime = 0
 					jobTask.EndTime = 0
 					jobTask.Error = ""
 
-					if job.RunPolicy == config.SkipRun {
+					if job.RunPolicy == config.SkipRun || skippedByController {
 						jobTask.Status = config.StatusSkipped
 					}
 					newStageNameJobTasksMap[stage.Name] = append(newStageNameJobTasksMap[stage.Name], jobTask)
@@ -1840,8 +1843,10 @@ func ListWorkflowTaskV4ByFilter(filter *TaskHistoryFilter, filterList []string,
 								ServiceModule: service.ServiceModule,
 							},
 						}
-						for _, repo := range service.Repos {
-							sm.CodeInfo = append(sm.CodeInfo, repo)
+						for _, testModule := range service.GetTestModules() {
+							for _, repo := range testModule.Repos {
+								sm.CodeInfo = append(sm.CodeInfo, repo)
+							}
 						}
 						serviceModules = append(serviceModules, sm)
 					}
@@ -2213,7 +2218,7 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask, context map[string]string,
 					if step.Name == config.TestJobArchiveResultStepName {
 						spec.Archive = true
 					}
-					if step.Name == config.TestJobHTMLReportStepName {
+					if config.IsTestJobHTMLReportStep(step.Name) {
 						spec.HtmlReport = true
 					}
 					if step.Name == config.TestJobJunitReportStepName {
@@ -99,6 +99,7 @@ func CreateWorkflowV4(user string, workflow *commonmodels.WorkflowV4, logger *za
 	workflow.UpdatedBy = user
 	workflow.CreateTime = time.Now().Unix()
 	workflow.UpdateTime = time.Now().Unix()
+	workflow.TestingTypedVariables = true
 
 	if _, err := commonrepo.NewWorkflowV4Coll().Create(workflow); err != nil {
 		logger.Errorf("Failed to create workflow v4, the error is: %s", err)
@@ -270,6 +271,10 @@ func UpdateWorkflowV4(name, user string, inputWorkflow *commonmodels.WorkflowV4,
 	inputWorkflow.UpdateTime = time.Now().Unix()
 	inputWorkflow.ID = workflow.ID
 	inputWorkflow.CustomField = workflow.CustomField
+	// clients unaware of the flag must not turn the typed testing variables off
+	if workflow.TestingTypedVariables {
+		inputWorkflow.TestingTypedVariables = true
+	}
 
 	if err := commonrepo.NewWorkflowV4Coll().Update(
 		workflow.ID.Hex(),
@@ -1444,13 +1449,15 @@ func ensureWorkflowV4JobResp(job *commonmodels.Job, logger *zap.SugaredLogger, b
 			return e.ErrFindWorkflow.AddErr(err)
 		}
 		job.Spec = spec
-		for _, testing := range spec.ServiceTestOptions {
-			testingInfo, err := commonrepo.NewTestingColl().Find(testing.Name, "")
-			if err != nil {
-				logger.Errorf("find testing: %s error: %s", testing.Name, err)
-				continue
+		for _, svcTesting := range spec.ServiceTestOptions {
+			for _, testing := range svcTesting.GetTestModules() {
+				testingInfo, err := commonrepo.NewTestingColl().Find(testing.Name, "")
+				if err != nil {
+					logger.Errorf("find testing: %s error: %s", testing.Name, err)
+					continue
+				}
+				testing.KeyVals = commonservice.MergeBuildEnvs(testingInfo.PreTest.Envs.ToRuntimeList(), testing.KeyVals)
 			}
-			testing.KeyVals = commonservice.MergeBuildEnvs(testingInfo.PreTest.Envs.ToRuntimeList(), testing.KeyVals)
 		}
 		for _, testing := range spec.TestModuleOptions {
 			testingInfo, err := commonrepo.NewTestingColl().Find(testing.Name, "")
@@ -88,3 +88,20 @@ func GetTestLocalTestSuite(c *gin.Context) {
 
 	ctx.Resp, ctx.RespErr = service.GetTestLocalTestSuite(c.Param("testName"), ctx.Logger)
 }
+
+func GetTestTrend(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	limit := 10
+	if c.Query("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil {
+			ctx.RespErr = e.ErrInvalidParam.AddDesc("invalid limit")
+			return
+		}
+	}
+
+	ctx.Resp, ctx.RespErr = service.GetTestTrend(c.Param("workflowName"), c.Param("jobName"), c.Query("service"), limit, ctx.Logger)
+}
@@ -28,6 +28,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 	{
 		testReport.GET("/html/testing/:projectName/:testingName/:taskID/*path", GetTestTaskHtmlReportInfo)
 		testReport.GET("/html/workflowv4/:projectName/:workflowName/:jobName/:taskID/*path", GetWorkflowV4HTMLTestReport)
+		testReport.GET("/html/workflowv4-index/:projectName/:workflowName/:jobName/:taskID/", GetWorkflowV4TestReportIndex)
 	}
 
 	// sse apis
@@ -43,6 +44,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 	{
 		itReport.GET("/pipelines/:pipelineName/id/:id/names/:testName", GetLocalTestSuite)
 		itReport.GET("/workflowv4/:workflowName/id/:id/job/:jobName", GetWorkflowV4LocalTestSuite)
+		itReport.GET("/workflowv4/:workflowName/job/:jobName/trend", GetTestTrend)
 		itReport.GET("/workflow/:pipelineName/id/:id/names/:testName/service/:serviceName", GetWorkflowLocalTestSuite)
 		itReport.GET("/latest/service/:testName", GetTestLocalTestSuite)
 	}
@@ -57,6 +59,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		tester.GET("", ListTestModules)
 		tester.GET("/:name", GetTestModule)
 		tester.DELETE("/:name", DeleteTestModule)
+		tester.POST("/:name/toolLocks/refresh", RefreshTestModuleToolLocks)
 	}
 
 	// ---------------------------------------------------------------------------------------
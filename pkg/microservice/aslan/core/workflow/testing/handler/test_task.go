@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -297,14 +298,15 @@ func GetTestTaskHtmlReportInfo(c *gin.Context) {
 
 func findDefaultHtmlReportFilePath(htmlReportDir string, htmlFilepath string) (string, error) {
 	// user specified path, just return
-	if htmlFilepath != "/" {
+	if !strings.HasSuffix(htmlFilepath, "/") {
 		return htmlFilepath, nil
 	}
 
-	// user not specified, find default html file path for user
-	files, err := os.ReadDir(htmlReportDir)
+	// user not specified, find default html file path in the dir for user, e.g. a subfolder of multiple html reports
+	dir := filepath.Join(htmlReportDir, filepath.Clean("/"+htmlFilepath))
+	files, err := os.ReadDir(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to read dir %s, err :%s", htmlReportDir, err)
+		return "", fmt.Errorf("failed to read dir %s, err :%s", dir, err)
 	}
 
 	fileName := ""
@@ -322,12 +324,12 @@ func findDefaultHtmlReportFilePath(htmlReportDir string, htmlFilepath string) (s
 	}
 
 	if foundIndex {
-		// return / avoid always 301 redirect
-		return "/", nil
+		// return the dir to avoid always 301 redirect
+		return htmlFilepath, nil
 	}
 
 	if fileName != "" {
-		htmlFilepath = "/" + fileName
+		htmlFilepath = htmlFilepath + fileName
 		return htmlFilepath, nil
 	} else {
 		return "", fmt.Errorf("no html file found in %s", htmlReportDir)
@@ -276,6 +276,58 @@ func DeleteTestModule(c *gin.Context) {
 	ctx.RespErr = commonservice.DeleteTestModule(name, projectKey, ctx.RequestID, ctx.Logger)
 }
 
+func RefreshTestModuleToolLocks(c *gin.Context) {
+	ctx, err := internalhandler.NewContextWithAuthorization(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	if err != nil {
+		ctx.RespErr = fmt.Errorf("authorization Info Generation failed: err %s", err)
+		ctx.UnAuthorized = true
+		return
+	}
+
+	projectKey := c.Query("projectName")
+
+	internalhandler.InsertOperationLog(c, ctx.UserName, projectKey, "更新", "项目管理-测试-工具版本锁定", c.Param("name"), c.Param("name"), "", types.RequestBodyTypeJSON, ctx.Logger)
+
+	// authorization check
+	if !ctx.Resources.IsSystemAdmin {
+		if _, ok := ctx.Resources.ProjectAuthInfo[projectKey]; !ok {
+			ctx.UnAuthorized = true
+			return
+		}
+
+		if !ctx.Resources.ProjectAuthInfo[projectKey].IsProjectAdmin &&
+			!ctx.Resources.ProjectAuthInfo[projectKey].Test.Edit {
+			ctx.UnAuthorized = true
+			return
+		}
+	}
+
+	name := c.Param("name")
+	if name == "" {
+		ctx.RespErr = e.ErrInvalidParam.AddDesc("empty Name")
+		return
+	}
+
+	ctx.Resp, ctx.RespErr = service.RefreshTestingToolVersionLocks(ctx.UserName, name, projectKey, ctx.Logger)
+}
+
+func GetWorkflowV4TestReportIndex(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("taskID"), 10, 64)
+	if err != nil {
+		c.JSON(500, gin.H{"err": fmt.Sprintf("invalid taskID %s", c.Param("taskID"))})
+		return
+	}
+	index, err := service.GetWorkflowV4TestReportIndex(c.Param("projectName"), c.Param("workflowName"), c.Param("jobName"), taskID, ginzap.WithContext(c).Sugar())
+	if err != nil {
+		c.JSON(500, gin.H{"err": fmt.Sprintf("get workflow test report index failed, err: %v", err)})
+		return
+	}
+
+	c.Data(200, "text/html; charset=utf-8", index)
+}
+
 func GetWorkflowV4HTMLTestReport(c *gin.Context) {
 	filepath := c.Param("path")
 	taskID, err := strconv.ParseInt(c.Param("taskID"), 10, 64)
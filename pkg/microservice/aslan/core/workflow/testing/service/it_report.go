@@ -60,3 +60,20 @@ func GetTestLocalTestSuite(testName string, log *zap.SugaredLogger) (*commonmode
 
 	return resp, nil
 }
+
+// GetTestTrend returns the summaries of the latest runs of the tests in the workflow job, filtered by the service if it is not empty.
+// At most limit runs are returned for each test, a non-positive limit returns all the recorded runs.
+func GetTestTrend(workflowName, jobName, serviceName string, limit int, log *zap.SugaredLogger) ([]*commonmodels.TestTrend, error) {
+	trends, err := commonrepo.NewTestTrendColl().List(workflowName, jobName, serviceName)
+	if err != nil {
+		log.Errorf("failed to list test trends of workflow: %s, job: %s, error: %s", workflowName, jobName, err)
+		return nil, err
+	}
+
+	for _, trend := range trends {
+		if limit > 0 && len(trend.Runs) > limit {
+			trend.Runs = trend.Runs[len(trend.Runs)-limit:]
+		}
+	}
+	return trends, nil
+}
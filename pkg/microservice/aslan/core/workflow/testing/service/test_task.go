@@ -206,7 +206,7 @@ func GetTestTaskDetail(projectKey, testName string, taskID int64, log *zap.Sugar
 
 	for _, step := range jobSpec.Steps {
 		if workflowTask.Stages[0].Jobs[0].Status == config.StatusPassed || workflowTask.Stages[0].Jobs[0].Status == config.StatusFailed {
-			if step.Name == config.TestJobHTMLReportStepName {
+			if config.IsTestJobHTMLReportStep(step.Name) {
 				htmlReport = true
 			}
 			if step.Name == config.TestJobJunitReportStepName {
@@ -17,12 +17,15 @@ limitations under the License.
 package service
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/koderover/zadig/v2/pkg/tool/log"
@@ -45,7 +48,9 @@ import (
 	s3tool "github.com/koderover/zadig/v2/pkg/tool/s3"
 	tartool "github.com/koderover/zadig/v2/pkg/tool/tar"
 	"github.com/koderover/zadig/v2/pkg/types"
+	"github.com/koderover/zadig/v2/pkg/types/job"
 	"github.com/koderover/zadig/v2/pkg/types/step"
+	"github.com/koderover/zadig/v2/pkg/util"
 )
 
 func CreateTesting(username string, testing *commonmodels.Testing, log *zap.SugaredLogger) error {
@@ -55,6 +60,33 @@ func CreateTesting(username string, testing *commonmodels.Testing, log *zap.Suga
 	if err := commonutil.CheckDefineResourceParam(testing.PreTest.ResReq, testing.PreTest.ResReqSpec); err != nil {
 		return e.ErrCreateTestModule.AddDesc(err.Error())
 	}
+	if err := testing.StepTimeouts.Validate(testing.Timeout); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateJunitS3Layout(testing.JunitS3Layout); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateTestReportPaths(testing.TestReportPaths); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateVolumeClaims(testing.PreTest.VolumeClaims); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingArchivePolicy(testing.ArchivePolicy); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingScriptFromRepo(testing); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingLogMaskPatterns(testing); err != nil {
+		return e.ErrCreateTestModule.AddDesc(err.Error())
+	}
+	if !testing.CacheCompression.Valid() {
+		return e.ErrCreateTestModule.AddDesc(fmt.Sprintf("invalid cache compression: %s", testing.CacheCompression))
+	}
+	if err := commonservice.ResolveAndLockToolVersions(testing.PreTest, false); err != nil {
+		return e.ErrCreateTestModule.AddErr(err)
+	}
 	err := HandleCronjob(testing, log)
 	if err != nil {
 		return e.ErrCreateTestModule.AddErr(err)
@@ -118,6 +150,30 @@ func UpdateTesting(username string, testing *commonmodels.Testing, log *zap.Suga
 	if err := commonutil.CheckDefineResourceParam(testing.PreTest.ResReq, testing.PreTest.ResReqSpec); err != nil {
 		return e.ErrUpdateTestModule.AddDesc(err.Error())
 	}
+	if err := testing.StepTimeouts.Validate(testing.Timeout); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateJunitS3Layout(testing.JunitS3Layout); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateTestReportPaths(testing.TestReportPaths); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := commonmodels.ValidateVolumeClaims(testing.PreTest.VolumeClaims); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingArchivePolicy(testing.ArchivePolicy); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingScriptFromRepo(testing); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if err := validateTestingLogMaskPatterns(testing); err != nil {
+		return e.ErrUpdateTestModule.AddDesc(err.Error())
+	}
+	if !testing.CacheCompression.Valid() {
+		return e.ErrUpdateTestModule.AddDesc(fmt.Sprintf("invalid cache compression: %s", testing.CacheCompression))
+	}
 	err := HandleCronjob(testing, log)
 	if err != nil {
 		return e.ErrUpdateTestModule.AddErr(err)
@@ -126,6 +182,12 @@ func UpdateTesting(username string, testing *commonmodels.Testing, log *zap.Suga
 	existed, err := commonrepo.NewTestingColl().Find(testing.Name, testing.ProductName)
 	if err == nil && existed.PreTest != nil && testing.PreTest != nil {
 		commonservice.EnsureSecretEnvs(existed.PreTest.Envs, testing.PreTest.Envs)
+		if testing.PreTest.InstallLocks == nil {
+			testing.PreTest.InstallLocks = existed.PreTest.InstallLocks
+		}
+	}
+	if err := commonservice.ResolveAndLockToolVersions(testing.PreTest, false); err != nil {
+		return e.ErrUpdateTestModule.AddErr(err)
 	}
 
 	err = commonservice.ProcessWebhook(testing.HookCtl.Items, existed.HookCtl.Items, webhook.TestingPrefix+testing.Name, log)
@@ -144,6 +206,65 @@ func UpdateTesting(username string, testing *commonmodels.Testing, log *zap.Suga
 	return nil
 }
 
+// RefreshTestingToolVersionLocks resolves the version patterns of the testing installs again and returns the new locks
+func RefreshTestingToolVersionLocks(username, name, productName string, log *zap.SugaredLogger) ([]*commonmodels.ToolVersionLock, error) {
+	testing, err := commonrepo.NewTestingColl().Find(name, productName)
+	if err != nil {
+		return nil, e.ErrGetTestModule.AddErr(err)
+	}
+	if testing.PreTest == nil {
+		return []*commonmodels.ToolVersionLock{}, nil
+	}
+
+	if err := commonservice.ResolveAndLockToolVersions(testing.PreTest, true); err != nil {
+		return nil, e.ErrUpdateTestModule.AddErr(err)
+	}
+	testing.UpdateBy = username
+	testing.UpdateTime = time.Now().Unix()
+	if err := commonrepo.NewTestingColl().Update(testing); err != nil {
+		log.Errorf("[Testing.Upsert] %s error: %v", testing.Name, err)
+		return nil, e.ErrUpdateTestModule.AddErr(err)
+	}
+	return testing.PreTest.InstallLocks, nil
+}
+
+func validateTestingArchivePolicy(policy commonmodels.TestingArchivePolicy) error {
+	switch policy {
+	case commonmodels.TestingArchivePolicyDefault, commonmodels.TestingArchivePolicyAlways, commonmodels.TestingArchivePolicyOnSuccess, commonmodels.TestingArchivePolicyOnFailure:
+		return nil
+	default:
+		return fmt.Errorf("invalid archive policy: %s", policy)
+	}
+}
+
+func validateTestingScriptFromRepo(testing *commonmodels.Testing) error {
+	if testing.ScriptFromRepo == nil {
+		return nil
+	}
+	if testing.ScriptFromRepo.RepoIndex < 0 || testing.ScriptFromRepo.RepoIndex >= len(testing.Repos) {
+		return fmt.Errorf("repo index %d of the script file is out of range", testing.ScriptFromRepo.RepoIndex)
+	}
+	if testing.ScriptFromRepo.FilePath == "" || path.IsAbs(testing.ScriptFromRepo.FilePath) {
+		return fmt.Errorf("script file path %s must be relative to the repo", testing.ScriptFromRepo.FilePath)
+	}
+	return nil
+}
+
+// validateTestingLogMaskPatterns rejects the log mask patterns of the testings running on vm, since zadig-agent
+// doesn't mask the script output
+func validateTestingLogMaskPatterns(testing *commonmodels.Testing) error {
+	if len(testing.LogMaskPatterns) == 0 {
+		return nil
+	}
+	if testing.Infrastructure == setting.JobVMInfrastructure {
+		return fmt.Errorf("log mask patterns are not supported on vm")
+	}
+	if _, err := util.CompileLogMaskPatterns(testing.LogMaskPatterns); err != nil {
+		return fmt.Errorf("invalid log mask pattern: %v", err)
+	}
+	return nil
+}
+
 type TestingOpt struct {
 	Name        string                     `bson:"name"                   json:"name"`
 	ProductName string                     `bson:"product_name"           json:"product_name"`
@@ -436,6 +557,126 @@ func GetWorkflowV4HTMLTestReport(workflowName, jobName string, taskID int64, log
 	return downloadHtmlReportFromJobTask(jobTask, workflowTask.ProjectName, workflowName, taskID, log)
 }
 
+var testReportIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.JobName}} #{{.TaskID}}</title></head>
+<body>
+<h2>{{.JobName}} #{{.TaskID}}</h2>
+<table border="1" cellpadding="6" cellspacing="0">
+<tr><th>Test</th><th>Status</th><th>Total</th><th>Failed</th><th>Skipped</th></tr>
+{{- range .Modules}}
+<tr><td><a href="{{.Link}}">{{.Name}}</a>{{range .Reports}} <a href="{{.Link}}">{{.Name}}</a>{{end}}</td><td>{{.Status}}</td><td>{{.Total}}</td><td>{{.Failed}}</td><td>{{.Skipped}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+var testReportListTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.JobName}} #{{.TaskID}}</title></head>
+<body>
+<h2>{{.JobName}} #{{.TaskID}}</h2>
+<ul>
+{{- range .Reports}}
+<li><a href="{{.Link}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+type testReportIndexModule struct {
+	Name    string
+	Link    string
+	Status  string
+	Total   string
+	Failed  string
+	Skipped string
+	// Reports link to each of the html reports of a test module with multiple html reports
+	Reports []*testReportLink
+}
+
+type testReportLink struct {
+	Name string
+	Link string
+}
+
+// GetWorkflowV4TestReportIndex renders an index page linking to the html report of every test module of a testing job,
+// the index is rendered when requested so that it always reflects the final status of all the modules.
+func GetWorkflowV4TestReportIndex(projectName, workflowName, jobName string, taskID int64, log *zap.SugaredLogger) ([]byte, error) {
+	workflowTask, err := mongodb.NewworkflowTaskv4Coll().Find(workflowName, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find workflow task, workflow name: %s, task id: %d", workflowName, taskID)
+	}
+
+	enabled := false
+	for _, stage := range workflowTask.WorkflowArgs.Stages {
+		for _, wfJob := range stage.Jobs {
+			if wfJob.Name != jobName || wfJob.JobType != config.JobZadigTesting {
+				continue
+			}
+			spec := new(commonmodels.ZadigTestingJobSpec)
+			if err := commonmodels.IToi(wfJob.Spec, spec); err != nil {
+				return nil, fmt.Errorf("failed to decode testing job spec, error: %v", err)
+			}
+			enabled = spec.GenerateReportIndex
+		}
+	}
+	if !enabled {
+		return nil, fmt.Errorf("report index is not enabled for job: %s", jobName)
+	}
+
+	modules := make([]*testReportIndexModule, 0)
+	for _, stage := range workflowTask.Stages {
+		for _, jobTask := range stage.Jobs {
+			if jobTask.OriginName != jobName || jobTask.JobType != string(config.JobZadigTesting) {
+				continue
+			}
+			jobSpec := &commonmodels.JobTaskFreestyleSpec{}
+			if err := commonmodels.IToi(jobTask.Spec, jobSpec); err != nil {
+				return nil, fmt.Errorf("unmashal job spec error: %v", err)
+			}
+			reportSteps := make([]*commonmodels.StepTask, 0)
+			for _, stepTask := range jobSpec.Steps {
+				if config.IsTestJobHTMLReportStep(stepTask.Name) {
+					reportSteps = append(reportSteps, stepTask)
+				}
+			}
+			if len(reportSteps) == 0 {
+				continue
+			}
+
+			link := fmt.Sprintf("../../../../../workflowv4/%s/%s/%s/%d/", projectName, workflowName, jobTask.Name, taskID)
+			reports := make([]*testReportLink, 0)
+			if len(reportSteps) > 1 {
+				for i, stepTask := range reportSteps {
+					reports = append(reports, &testReportLink{Name: getHtmlReportStepName(stepTask, jobSpec.Properties.Envs), Link: link + testReportSubfolderLink(i)})
+				}
+			}
+			modules = append(modules, &testReportIndexModule{
+				Name:    jobTask.DisplayName,
+				Link:    link,
+				Reports: reports,
+				Status:  string(jobTask.Status),
+				Total:   workflowTask.GlobalContext[job.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeyTotal)],
+				Failed:  workflowTask.GlobalContext[job.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeyFailed)],
+				Skipped: workflowTask.GlobalContext[job.GetJobOutputKey(jobTask.Key, setting.WorkflowTestingJobOutputKeySkipped)],
+			})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := testReportIndexTemplate.Execute(buf, map[string]interface{}{
+		"JobName": jobName,
+		"TaskID":  taskID,
+		"Modules": modules,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to render report index, error: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
 func GetTestTaskHTMLTestReport(testName string, taskID int64, log *zap.SugaredLogger) (string, error) {
 	workflowName := commonutil.GenTestingWorkflowName(testName)
 	workflowTask, err := mongodb.NewworkflowTaskv4Coll().Find(workflowName, taskID)
@@ -466,9 +707,9 @@ func downloadHtmlReportFromJobTask(jobTask *commonmodels.JobTask, projectName, w
 		return "", err
 	}
 
-	var stepTask *commonmodels.StepTask
+	stepTasks := make([]*commonmodels.StepTask, 0)
 	for _, step := range jobSpec.Steps {
-		if step.Name != config.TestJobHTMLReportStepName {
+		if !config.IsTestJobHTMLReportStep(step.Name) {
 			continue
 		}
 		if step.StepType != config.StepArchive && step.StepType != config.StepTarArchive {
@@ -476,9 +717,9 @@ func downloadHtmlReportFromJobTask(jobTask *commonmodels.JobTask, projectName, w
 			log.Error(err)
 			return "", err
 		}
-		stepTask = step
+		stepTasks = append(stepTasks, step)
 	}
-	if stepTask == nil {
+	if len(stepTasks) == 0 {
 		err := fmt.Errorf("cannot find step task for test task, workflow name: %s, task id: %d", workflowName, taskID)
 		log.Error(err)
 		return "", err
@@ -520,10 +761,48 @@ func downloadHtmlReportFromJobTask(jobTask *commonmodels.JobTask, projectName, w
 		return "", e.ErrGetTestReport.AddErr(err)
 	}
 
+	if len(stepTasks) == 1 {
+		if err := downloadHtmlReportStep(client, store, stepTasks[0], jobSpec.Properties.Envs, htmlReportPath, log); err != nil {
+			return "", err
+		}
+		return htmlReportPath, nil
+	}
+
+	// each of the multiple reports is extracted to the html/<index> subfolder and linked by the generated index.html
+	reports := make([]*testReportLink, 0, len(stepTasks))
+	for i, stepTask := range stepTasks {
+		reportPath := filepath.Join(htmlReportPath, "html", strconv.Itoa(i))
+		if err := os.MkdirAll(reportPath, os.ModePerm); err != nil {
+			err = fmt.Errorf("failed to create html report path, path: %s, err: %s", reportPath, err)
+			log.Error(err)
+			return "", e.ErrGetTestReport.AddErr(err)
+		}
+		if err := downloadHtmlReportStep(client, store, stepTask, jobSpec.Properties.Envs, reportPath, log); err != nil {
+			return "", err
+		}
+		reports = append(reports, &testReportLink{Name: getHtmlReportStepName(stepTask, jobSpec.Properties.Envs), Link: testReportSubfolderLink(i)})
+	}
+
+	buf := new(bytes.Buffer)
+	if err := testReportListTemplate.Execute(buf, map[string]interface{}{
+		"JobName": jobTask.DisplayName,
+		"TaskID":  taskID,
+		"Reports": reports,
+	}); err != nil {
+		return "", e.ErrGetTestReport.AddErr(fmt.Errorf("failed to render html report list, error: %v", err))
+	}
+	if err := os.WriteFile(filepath.Join(htmlReportPath, "index.html"), buf.Bytes(), 0644); err != nil {
+		return "", e.ErrGetTestReport.AddErr(fmt.Errorf("failed to write html report list, error: %v", err))
+	}
+	return htmlReportPath, nil
+}
+
+// downloadHtmlReportStep downloads the html report archived by the step and extracts it to htmlReportPath
+func downloadHtmlReportStep(client *s3tool.Client, store *s3.S3, stepTask *commonmodels.StepTask, envs []*commonmodels.KeyVal, htmlReportPath string, log *zap.SugaredLogger) error {
 	if stepTask.StepType == config.StepArchive {
 		stepSpec := &step.StepArchiveSpec{}
 		if err := commonmodels.IToi(stepTask.Spec, stepSpec); err != nil {
-			return "", fmt.Errorf("unmashal step spec error: %v", err)
+			return fmt.Errorf("unmashal step spec error: %v", err)
 		}
 
 		fpath := ""
@@ -533,91 +812,104 @@ func downloadHtmlReportFromJobTask(jobTask *commonmodels.JobTask, projectName, w
 			fpath = filepath.Join(artifact.DestinationPath, fname)
 		}
 
-		fname = commonutil.RenderEnv(fname, jobSpec.Properties.Envs)
-		fpath = commonutil.RenderEnv(fpath, jobSpec.Properties.Envs)
+		fname = commonutil.RenderEnv(fname, envs)
+		fpath = commonutil.RenderEnv(fpath, envs)
 
 		objectKey := store.GetObjectPath(fpath)
 		downloadDest := filepath.Join(htmlReportPath, fname)
-		err = client.Download(store.Bucket, objectKey, downloadDest)
+		err := client.Download(store.Bucket, objectKey, downloadDest)
 		if err != nil {
 			err = fmt.Errorf("download html test report error: %s", err)
 			log.Error(err)
-			return "", e.ErrGetTestReport.AddErr(err)
+			return e.ErrGetTestReport.AddErr(err)
 		}
 
-		return htmlReportPath, nil
-	} else if stepTask.StepType == config.StepTarArchive {
-		stepSpec := &step.StepTarArchiveSpec{}
-		if err := commonmodels.IToi(stepTask.Spec, stepSpec); err != nil {
-			return "", e.ErrGetTestReport.AddErr(fmt.Errorf("unmashal step spec error: %v", err))
-		}
+		return nil
+	}
 
-		downloadDest := filepath.Join(htmlReportPath, setting.HtmlReportArchivedFileName)
-		objectKey := filepath.Join(stepSpec.S3DestDir, stepSpec.FileName)
-		objectKey = commonutil.RenderEnv(objectKey, jobSpec.Properties.Envs)
+	stepSpec := &step.StepTarArchiveSpec{}
+	if err := commonmodels.IToi(stepTask.Spec, stepSpec); err != nil {
+		return e.ErrGetTestReport.AddErr(fmt.Errorf("unmashal step spec error: %v", err))
+	}
 
-		err = client.Download(store.Bucket, objectKey, downloadDest)
-		if err != nil {
-			err = fmt.Errorf("download html test report error: %s", err)
-			log.Error(err)
-			return "", e.ErrGetTestReport.AddErr(err)
-		}
+	downloadDest := filepath.Join(htmlReportPath, setting.HtmlReportArchivedFileName)
+	objectKey := filepath.Join(stepSpec.S3DestDir, stepSpec.FileName)
+	objectKey = commonutil.RenderEnv(objectKey, envs)
 
-		err = tartool.Untar(downloadDest, htmlReportPath, true)
-		if err != nil {
-			err = fmt.Errorf("Untar %s err: %v", downloadDest, err)
-			log.Error(err)
-			return "", e.ErrGetTestReport.AddErr(err)
-		}
+	err := client.Download(store.Bucket, objectKey, downloadDest)
+	if err != nil {
+		err = fmt.Errorf("download html test report error: %s", err)
+		log.Error(err)
+		return e.ErrGetTestReport.AddErr(err)
+	}
 
-		if len(stepSpec.ResultDirs) == 0 {
-			return "", e.ErrGetTestReport.AddErr(fmt.Errorf("not found html report step in job task"))
-		}
+	err = tartool.Untar(downloadDest, htmlReportPath, true)
+	if err != nil {
+		err = fmt.Errorf("Untar %s err: %v", downloadDest, err)
+		log.Error(err)
+		return e.ErrGetTestReport.AddErr(err)
+	}
 
-		unTarFilePath := filepath.Join(htmlReportPath, stepSpec.ResultDirs[0])
-		unTarFilePath = commonutil.RenderEnv(unTarFilePath, jobSpec.Properties.Envs)
-		unTarFileInfo, err := os.Stat(unTarFilePath)
+	if len(stepSpec.ResultDirs) == 0 {
+		return e.ErrGetTestReport.AddErr(fmt.Errorf("not found html report step in job task"))
+	}
+
+	unTarFilePath := filepath.Join(htmlReportPath, stepSpec.ResultDirs[0])
+	unTarFilePath = commonutil.RenderEnv(unTarFilePath, envs)
+	unTarFileInfo, err := os.Stat(unTarFilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to stat untar files %s, err: %v", unTarFilePath, err)
+		log.Error(err)
+		return e.ErrGetTestReport.AddErr(err)
+	}
+
+	if unTarFileInfo.IsDir() {
+		untarFiles, err := os.ReadDir(unTarFilePath)
 		if err != nil {
-			err = fmt.Errorf("failed to stat untar files %s, err: %v", unTarFilePath, err)
+			err = fmt.Errorf("failed to read files in extracted directory, path: %s, err: %s", htmlReportPath, err)
 			log.Error(err)
-			return "", e.ErrGetTestReport.AddErr(err)
+			return e.ErrGetTestReport.AddErr(err)
 		}
 
-		if unTarFileInfo.IsDir() {
-			untarFiles, err := os.ReadDir(unTarFilePath)
+		// Batch move files
+		for _, file := range untarFiles {
+			oldPath := filepath.Join(unTarFilePath, file.Name())
+			newPath := filepath.Join(htmlReportPath, file.Name())
+			err := os.Rename(oldPath, newPath)
 			if err != nil {
-				err = fmt.Errorf("failed to read files in extracted directory, path: %s, err: %s", htmlReportPath, err)
+				err = fmt.Errorf("failed to move file from %s to %s, err: %s", oldPath, newPath, err)
 				log.Error(err)
-				return "", e.ErrGetTestReport.AddErr(err)
-			}
-
-			// Batch move files
-			for _, file := range untarFiles {
-				oldPath := filepath.Join(unTarFilePath, file.Name())
-				newPath := filepath.Join(htmlReportPath, file.Name())
-				err := os.Rename(oldPath, newPath)
-				if err != nil {
-					err = fmt.Errorf("failed to move file from %s to %s, err: %s", oldPath, newPath, err)
-					log.Error(err)
-					return "", e.ErrGetTestReport.AddErr(err)
-				}
-			}
-
-			err = os.Remove(unTarFilePath)
-			if err != nil {
-				log.Errorf("remove extracted directory %s err: %v", downloadDest, err)
+				return e.ErrGetTestReport.AddErr(err)
 			}
 		}
 
-		err = os.Remove(downloadDest)
+		err = os.Remove(unTarFilePath)
 		if err != nil {
-			log.Errorf("remove download file %s err: %v", downloadDest, err)
+			log.Errorf("remove extracted directory %s err: %v", downloadDest, err)
 		}
+	}
 
-		return htmlReportPath, nil
+	err = os.Remove(downloadDest)
+	if err != nil {
+		log.Errorf("remove download file %s err: %v", downloadDest, err)
 	}
 
-	return "", e.ErrGetTestReport.AddErr(fmt.Errorf("not found html report step in job task"))
+	return nil
+}
+
+// getHtmlReportStepName returns the report path archived by the html report step relative to the workspace
+func getHtmlReportStepName(stepTask *commonmodels.StepTask, envs []*commonmodels.KeyVal) string {
+	stepSpec := &step.StepTarArchiveSpec{}
+	if err := commonmodels.IToi(stepTask.Spec, stepSpec); err != nil || len(stepSpec.ResultDirs) == 0 {
+		return stepTask.Name
+	}
+	reportPath := commonutil.RenderEnv(path.Join(stepSpec.TarDir, stepSpec.ResultDirs[0]), envs)
+	return strings.TrimPrefix(reportPath, "$WORKSPACE/")
+}
+
+// testReportSubfolderLink is the link of the html report at the index relative to the html report dir of the job task
+func testReportSubfolderLink(index int) string {
+	return fmt.Sprintf("html/%d/", index)
 }
 
 func validateTestReportParam(pipelineName, pipelineType, taskIDStr, testName string, log *zap.SugaredLogger) error {
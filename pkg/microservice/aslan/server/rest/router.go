@@ -75,6 +75,12 @@ func init() {
 	metrics.Metrics.MustRegister(metrics.Healthy)
 	metrics.Metrics.MustRegister(metrics.Cluster)
 	metrics.Metrics.MustRegister(metrics.ResponseTime)
+	metrics.Metrics.MustRegister(metrics.HelmRepoCacheRequests)
+	metrics.Metrics.MustRegister(metrics.HelmEnvLockWaitTime)
+	metrics.Metrics.MustRegister(metrics.BasicImageCacheRequests)
+	metrics.Metrics.MustRegister(metrics.TestingJobGenerationTime)
+	metrics.Metrics.MustRegister(metrics.TestingJobLookupTime)
+	metrics.Metrics.MustRegister(metrics.TestingJobGenerationFailures)
 
 	metrics.UpdatePodMetrics()
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 )
@@ -35,6 +36,11 @@ type Command struct {
 }
 
 func (c *Command) Run() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext runs the command like Run, the command is killed if ctx is done before it exits
+func (c *Command) RunContext(ctx context.Context) error {
 	if c.BeforeRun != nil {
 		if err := c.BeforeRun(c.BeforeRunArgs...); err != nil {
 			if !c.IgnoreError {
@@ -43,7 +49,10 @@ func (c *Command) Run() error {
 		}
 	}
 
-	err := c.Cmd.Run()
+	err := runCmdContext(ctx, c.Cmd)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if !c.IgnoreError && err != nil {
 		return err
 	}
@@ -58,3 +67,21 @@ func (c *Command) Run() error {
 
 	return nil
 }
+
+func runCmdContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
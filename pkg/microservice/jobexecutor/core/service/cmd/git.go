@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"os/exec"
 
 	"github.com/koderover/zadig/v2/pkg/types"
@@ -83,16 +84,30 @@ func GitCheckoutCommit(commit string) *exec.Cmd {
 	)
 }
 
-// GitFetch fetches changes by ref, ref can be a tag, branch or pr. --depth=1 is used to limit fetching
-// to the last commit from the tip of each remote branch history.
+// GitFetch fetches changes by ref, ref can be a tag, branch or pr. --depth is used to limit fetching
+// to the last commits from the tip of each remote branch history, 1 is used if depth is not positive.
 // e.g. git fetch origin +refs/heads/onboarding --depth=1
-func GitFetch(remoteName, ref string) *exec.Cmd {
+func GitFetch(remoteName, ref string, depth int) *exec.Cmd {
+	if depth <= 0 {
+		depth = 1
+	}
+	return exec.Command(
+		"git",
+		"fetch",
+		remoteName,
+		"+"+ref, // "+" means overwrite
+		fmt.Sprintf("--depth=%d", depth),
+	)
+}
+
+// GitFullFetch fetches changes by ref with the whole history
+// e.g. git fetch origin +6e3ac0f
+func GitFullFetch(remoteName, ref string) *exec.Cmd {
 	return exec.Command(
 		"git",
 		"fetch",
 		remoteName,
 		"+"+ref, // "+" means overwrite
-		"--depth=1",
 	)
 }
 
@@ -161,6 +176,18 @@ func GitSetConfig(key, value string) *exec.Cmd {
 	)
 }
 
+// GitSetLocalConfig returns command: git config --local $KEY $VALUE, it is run in the dir of the repo
+// e.g. git config --local core.sshCommand "ssh -i ~/.ssh/id_rsa"
+func GitSetLocalConfig(key, value string) *exec.Cmd {
+	return exec.Command(
+		"git",
+		"config",
+		"--local",
+		key,
+		value,
+	)
+}
+
 // GitGc returns command: git gc
 func GitGc() *exec.Cmd {
 	return exec.Command(
@@ -181,6 +208,16 @@ func GitShowLastLog() *exec.Cmd {
 	)
 }
 
+// GitRevParseHead returns command: git rev-parse HEAD
+// It shows the sha of the checked out commit
+func GitRevParseHead() *exec.Cmd {
+	return exec.Command(
+		"git",
+		"rev-parse",
+		"HEAD",
+	)
+}
+
 // GitListRemoteBranch returns command: git ls-remote --heads
 func GitListRemoteBranch(remote string) *exec.Cmd {
 	return exec.Command(
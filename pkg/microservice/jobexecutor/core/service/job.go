@@ -143,10 +143,13 @@ func (j *Job) Run(ctx context.Context) error {
 	hasFailed := false
 	var respErr error
 	for _, stepInfo := range j.Ctx.Steps {
-		if hasFailed && !stepInfo.Onfailure {
+		if hasFailed && !stepInfo.Onfailure && !stepInfo.OnlyOnFailure {
 			continue
 		}
-		if err := step.RunStep(ctx, stepInfo, j.ActiveWorkspace, j.Ctx.Paths, j.getUserEnvs(), j.Ctx.SecretEnvs, j.ConfigMapUpdater); err != nil {
+		if !hasFailed && stepInfo.OnlyOnFailure {
+			continue
+		}
+		if err := step.RunStep(ctx, stepInfo, j.ActiveWorkspace, j.Ctx.Paths, j.getUserEnvs(), j.Ctx.SecretEnvs, j.Ctx.LogMaskPatterns, j.ConfigMapUpdater); err != nil {
 			hasFailed = true
 			respErr = err
 		}
@@ -32,16 +32,20 @@ type JobContext struct {
 	Paths string `yaml:"paths"`
 	// ConfigMapName save the name of the configmap in which the jobContext resides
 	ConfigMapName string `yaml:"config_map_name"`
+	// LogMaskPatterns 脚本输出中匹配的内容会被替换为掩码 [optional]
+	LogMaskPatterns []string `yaml:"log_mask_patterns"`
 
 	Steps   []*Step  `yaml:"steps"`
 	Outputs []string `yaml:"outputs"`
 }
 
 type Step struct {
-	Name      string      `yaml:"name"`
-	StepType  string      `yaml:"type"`
-	Onfailure bool        `yaml:"on_failure"`
-	Spec      interface{} `yaml:"spec"`
+	Name          string      `yaml:"name"`
+	StepType      string      `yaml:"type"`
+	Onfailure     bool        `yaml:"on_failure"`
+	OnlyOnFailure bool        `yaml:"only_on_failure"`
+	Timeout       int64       `yaml:"timeout"`
+	Spec          interface{} `yaml:"spec"`
 }
 
 type EnvVar []string
@@ -37,13 +37,13 @@ type Step interface {
 	Run(ctx context.Context) error
 }
 
-func RunStep(ctx context.Context, step *meta.Step, workspace, paths string, envs, secretEnvs []string, updater configmap.Updater) error {
+func RunStep(ctx context.Context, step *meta.Step, workspace, paths string, envs, secretEnvs, logMaskPatterns []string, updater configmap.Updater) error {
 	var stepInstance Step
 	var err error
 
 	switch step.StepType {
 	case "shell":
-		stepInstance, err = NewShellStep(step.Spec, workspace, paths, envs, secretEnvs)
+		stepInstance, err = NewShellStep(step.Spec, workspace, paths, envs, secretEnvs, logMaskPatterns)
 		if err != nil {
 			return err
 		}
@@ -122,27 +122,56 @@ func RunStep(ctx context.Context, step *meta.Step, workspace, paths string, envs
 		log.Error(err)
 		return err
 	}
-	if err := stepInstance.Run(ctx); err != nil {
+	if err := runWithTimeout(ctx, stepInstance, step.Name, time.Duration(step.Timeout)*time.Minute); err != nil {
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
+// runWithTimeout runs the step and returns once the timeout is exceeded, even if the step does not stop when its ctx is done.
+// The step is not limited if the timeout is not positive, and it is waited for if the job is cancelled so that it can clean up.
+func runWithTimeout(ctx context.Context, stepInstance Step, name string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return stepInstance.Run(ctx)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stepInstance.Run(stepCtx)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil && ctx.Err() == nil && stepCtx.Err() != nil {
+			return fmt.Errorf("step %s timed out after %s: %v", name, timeout, err)
+		}
+		return err
+	case <-stepCtx.Done():
+		if ctx.Err() != nil {
+			return <-errCh
+		}
+		return fmt.Errorf("step %s timed out after %s", name, timeout)
+	}
+}
+
 func prepareScriptsEnv() []string {
 	scripts := []string{}
 	scripts = append(scripts, "eval $(ssh-agent -s) > /dev/null")
 	// $HOME/.ssh/id_rsa 为 github 私钥
-	scripts = append(scripts, fmt.Sprintf("ssh-add %s/.ssh/id_rsa.github &> /dev/null", config.Home()))
-	scripts = append(scripts, fmt.Sprintf("rm %s/.ssh/id_rsa.github &> /dev/null", config.Home()))
+	scripts = append(scripts, fmt.Sprintf("ssh-add %s/.ssh/id_rsa.github >/dev/null 2>&1", config.Home()))
+	scripts = append(scripts, fmt.Sprintf("rm %s/.ssh/id_rsa.github >/dev/null 2>&1", config.Home()))
 	// $HOME/.ssh/gitlab 为 gitlab 私钥
-	scripts = append(scripts, fmt.Sprintf("ssh-add %s/.ssh/id_rsa.gitlab &> /dev/null", config.Home()))
-	scripts = append(scripts, fmt.Sprintf("rm %s/.ssh/id_rsa.gitlab &> /dev/null", config.Home()))
+	scripts = append(scripts, fmt.Sprintf("ssh-add %s/.ssh/id_rsa.gitlab >/dev/null 2>&1", config.Home()))
+	scripts = append(scripts, fmt.Sprintf("rm %s/.ssh/id_rsa.gitlab >/dev/null 2>&1", config.Home()))
 
 	return scripts
 }
 
-func handleCmdOutput(pipe io.ReadCloser, needPersistentLog bool, logFile string, secretEnvs []string) {
+func handleCmdOutput(pipe io.ReadCloser, needPersistentLog bool, logFile string, masker *util.LogMasker) {
 	reader := bufio.NewReader(pipe)
 
 	for {
@@ -156,10 +185,11 @@ func handleCmdOutput(pipe io.ReadCloser, needPersistentLog bool, logFile string,
 			break
 		}
 
-		fmt.Printf("%s   %s", time.Now().Format(setting.WorkflowTimeFormat), util.MaskSecretEnvs(string(lineBytes), secretEnvs))
+		maskedLine := masker.Mask(string(lineBytes))
+		fmt.Printf("%s   %s", time.Now().Format(setting.WorkflowTimeFormat), maskedLine)
 
 		if needPersistentLog {
-			err := util.WriteFile(logFile, lineBytes, 0700)
+			err := util.WriteFile(logFile, []byte(maskedLine), 0700)
 			if err != nil {
 				log.Warnf("Failed to write file when processing cmd output: %s", err)
 			}
@@ -110,8 +110,18 @@ func (s *DownloadArchiveStep) Run(ctx context.Context) error {
 					return fmt.Errorf("failed to MkdirAll destPath %s, err: %s", destPath, err)
 				}
 			}
+			// the compression is detected from the archive so that caches created with another compression are still restored
+			compression, err := util.DetectArchiveCompression(sourceFilename)
+			if err != nil {
+				if s.spec.IgnoreErr {
+					log.Errorf("failed to detect compression of %s, err: %s", sourceFilename, err)
+					return nil
+				} else {
+					return fmt.Errorf("failed to detect compression of %s, err: %s", sourceFilename, err)
+				}
+			}
 			out := bytes.NewBufferString("")
-			cmd := exec.Command("tar", "xzf", sourceFilename, "-C", destPath)
+			cmd := exec.Command("tar", append(compression.TarFlags(), "-xf", sourceFilename, "-C", destPath)...)
 			cmd.Stderr = out
 			if err := cmd.Run(); err != nil {
 				if s.spec.IgnoreErr {
@@ -18,12 +18,14 @@ package step
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
@@ -39,6 +41,7 @@ import (
 	gittool "github.com/koderover/zadig/v2/pkg/tool/git"
 	"github.com/koderover/zadig/v2/pkg/tool/log"
 	"github.com/koderover/zadig/v2/pkg/types"
+	"github.com/koderover/zadig/v2/pkg/types/job"
 	"github.com/koderover/zadig/v2/pkg/types/step"
 	"github.com/koderover/zadig/v2/pkg/util"
 )
@@ -68,7 +71,7 @@ func (s *GitStep) Run(ctx context.Context) error {
 	defer func() {
 		log.Infof("Git clone ended. Duration: %.2f seconds.", time.Since(start).Seconds())
 	}()
-	return s.runGitCmds()
+	return s.runGitCmds(ctx)
 }
 
 func (s *GitStep) RunGitGc(folder string) error {
@@ -81,7 +84,7 @@ func (s *GitStep) RunGitGc(folder string) error {
 	return cmd.Run()
 }
 
-func (s *GitStep) runGitCmds() error {
+func (s *GitStep) runGitCmds(ctx context.Context) error {
 	if err := os.MkdirAll(path.Join(config.Home(), "/.ssh"), os.ModePerm); err != nil {
 		return fmt.Errorf("create ssh folder error: %v", err)
 	}
@@ -143,7 +146,7 @@ func (s *GitStep) runGitCmds() error {
 			tokens = append(tokens, repo.SSHKey)
 		}
 
-		tokens = append(tokens, repo.OauthToken)
+		tokens = append(tokens, repo.OauthToken, repo.DeployKey)
 		cmds = append(cmds, s.buildGitCommands(repo, hostNames)...)
 	}
 	// write ssh key
@@ -181,13 +184,39 @@ func (s *GitStep) runGitCmds() error {
 			fmt.Printf("%s   %s\n", time.Now().Format(setting.WorkflowTimeFormat), strings.Join(c.Cmd.Args, " "))
 		}
 
-		if err := c.Run(); err != nil {
+		if err := c.RunContext(ctx); err != nil {
 			return err
 		}
 	}
+
+	s.writeRepoCommitOutputs(envs, job.JobOutputDir)
 	return nil
 }
 
+// writeRepoCommitOutputs writes the sha of the checked out commit of each repo into the output REPO_<index>_COMMIT,
+// the index is the position of the repo in the step. Failures are only logged since the code is already cloned.
+func (s *GitStep) writeRepoCommitOutputs(envs []string, outputDir string) {
+	for index, repo := range s.spec.Repos {
+		if repo == nil || len(repo.RepoName) == 0 {
+			continue
+		}
+
+		cmd := c.GitRevParseHead()
+		cmd.Dir = s.GetWorkDir(repo)
+		cmd.Env = envs
+		out, err := cmd.Output()
+		if err != nil {
+			log.Warnf("failed to resolve the commit of repo %s, error: %v", repo.RepoName, err)
+			continue
+		}
+
+		outputName := fmt.Sprintf(setting.WorkflowTestingJobOutputKeyRepoCommit, index)
+		if err := os.WriteFile(filepath.Join(outputDir, outputName), bytes.TrimSpace(out), 0644); err != nil {
+			log.Warnf("failed to write output %s, error: %v", outputName, err)
+		}
+	}
+}
+
 func (s *GitStep) GetWorkDir(repo *types.Repository) string {
 	workDir := filepath.Join(s.workspace, repo.RepoName)
 	if len(repo.CheckoutPath) != 0 {
@@ -234,7 +263,26 @@ func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String
 	if len(owner) == 0 {
 		owner = repo.RepoOwner
 	}
-	if repo.Source == types.ProviderGitlab {
+	if repo.DeployKey != "" {
+		// deploy key of the repo takes precedence over the credentials of the code host
+		// the key is set on the repo since other repos on the same host may be cloned with other keys
+		host, remoteURL := repo.DeployKeySSHHostAndURL()
+		sshKeyPath, err := util.WriteDeployKeyFile(repo.DeployKey, repo.DeployKeyID)
+		if err != nil {
+			log.Errorf("failed to write deploy key file, err: %v", err)
+		} else {
+			cmds = append(cmds, &c.Command{
+				Cmd:          c.GitSetLocalConfig("core.sshCommand", fmt.Sprintf("ssh -i %s", sshKeyPath)),
+				DisableTrace: true,
+			})
+		}
+		// the host is kept in the ssh config for the proxy
+		hostNames.Insert(host)
+		cmds = append(cmds, &c.Command{
+			Cmd:          c.GitRemoteAdd(repo.RemoteName, remoteURL),
+			DisableTrace: true,
+		})
+	} else if repo.Source == types.ProviderGitlab {
 		// gitlab
 		u, _ := url.Parse(repo.Address)
 		host := strings.TrimSuffix(strings.Join([]string{u.Host, u.Path}, "/"), "/")
@@ -297,7 +345,14 @@ func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String
 		return cmds
 	}
 
-	cmds = append(cmds, &c.Command{Cmd: c.GitFetch(repo.RemoteName, ref)}, &c.Command{Cmd: c.GitCheckoutHead()})
+	fetchCmd := &c.Command{Cmd: c.GitFetch(repo.RemoteName, ref, repo.CloneDepth)}
+	if repo.EnableCommit && repo.CloneDepth > 0 {
+		// the commit may be outside the shallow window, fall back to a full clone if the shallow fetch failed
+		fetchCmd.IgnoreError = true
+		fetchCmd.AfterRun = fullFetchOnFailure
+		fetchCmd.AfterRunArgs = []interface{}{fetchCmd.Cmd, repo}
+	}
+	cmds = append(cmds, fetchCmd, &c.Command{Cmd: c.GitCheckoutHead()})
 
 	// PR rebase branch 请求
 	if len(repo.MergeBranches) > 0 {
@@ -349,6 +404,33 @@ func (s *GitStep) buildGitCommands(repo *types.Repository, hostNames sets.String
 	return cmds
 }
 
+func fullFetchOnFailure(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("invalid args length: %d", len(args))
+	}
+	shallowFetch, ok := args[0].(*exec.Cmd)
+	if !ok {
+		return fmt.Errorf("invalid args[0] type: %T", args[0])
+	}
+	repo, ok := args[1].(*types.Repository)
+	if !ok {
+		return fmt.Errorf("invalid args[1] type: %T", args[1])
+	}
+	if shallowFetch.ProcessState != nil && shallowFetch.ProcessState.Success() {
+		return nil
+	}
+
+	log.Warnf("failed to fetch commit %s of repo %s with depth %d, falling back to full clone", repo.CommitID, repo.RepoName, repo.CloneDepth)
+	fullFetch := c.GitFullFetch(repo.RemoteName, repo.Ref())
+	fullFetch.Dir = shallowFetch.Dir
+	fullFetch.Env = shallowFetch.Env
+	if err := fullFetch.Run(); err != nil {
+		log.Errorf("failed to fetch commit %s of repo %s, error: %v", repo.CommitID, repo.RepoName, err)
+		return err
+	}
+	return nil
+}
+
 func writeSSHConfigFile(hostNames sets.String, proxy *step.Proxy) error {
 	out := "Include ~/.ssh/config.d/*\n"
 	out += "\nHOST *\nStrictHostKeyChecking=no\nUserKnownHostsFile=/dev/null\n"
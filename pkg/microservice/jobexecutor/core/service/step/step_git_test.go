@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/koderover/zadig/v2/pkg/setting"
+	"github.com/koderover/zadig/v2/pkg/types"
+	"github.com/koderover/zadig/v2/pkg/types/step"
+)
+
+func TestBuildGitCommandsDeployKeysOnSameHost(t *testing.T) {
+	viper.Set(setting.Home, t.TempDir())
+	defer viper.Set(setting.Home, "")
+
+	repos := []*types.Repository{
+		{Source: types.ProviderGithub, RepoOwner: "koderover", RepoName: "zadig", RemoteName: "origin", DeployKeyID: "key-1", DeployKey: "zadig-deploy-key"},
+		{Source: types.ProviderGithub, RepoOwner: "koderover", RepoName: "zadig-doc", RemoteName: "origin", DeployKeyID: "key-2", DeployKey: "zadig-doc-deploy-key"},
+	}
+	s := &GitStep{spec: &step.StepGitSpec{Repos: repos}, workspace: t.TempDir()}
+	hostNames := sets.NewString()
+
+	keyPaths := make(map[string]string)
+	for _, repo := range repos {
+		var sshCommand string
+		for _, cmd := range s.buildGitCommands(repo, hostNames) {
+			if len(cmd.Cmd.Args) == 5 && cmd.Cmd.Args[3] == "core.sshCommand" {
+				if cmd.Cmd.Dir != s.GetWorkDir(repo) {
+					t.Errorf("core.sshCommand of repo %s is set in %s, want %s", repo.RepoName, cmd.Cmd.Dir, s.GetWorkDir(repo))
+				}
+				sshCommand = cmd.Cmd.Args[4]
+			}
+		}
+		if !strings.HasPrefix(sshCommand, "ssh -i ") {
+			t.Fatalf("core.sshCommand of repo %s = %q, want ssh -i <key file>", repo.RepoName, sshCommand)
+		}
+		keyPaths[repo.RepoName] = strings.TrimPrefix(sshCommand, "ssh -i ")
+	}
+
+	if keyPaths[repos[0].RepoName] == keyPaths[repos[1].RepoName] {
+		t.Fatalf("repos on the same host share the key file %s", keyPaths[repos[0].RepoName])
+	}
+	// the commands run after all of them are built, so the key of the first repo must not be overwritten by then
+	for _, repo := range repos {
+		key, err := os.ReadFile(keyPaths[repo.RepoName])
+		if err != nil {
+			t.Fatalf("failed to read the key file of repo %s: %v", repo.RepoName, err)
+		}
+		if string(key) != repo.DeployKey {
+			t.Errorf("key file of repo %s = %q, want %q", repo.RepoName, key, repo.DeployKey)
+		}
+	}
+}
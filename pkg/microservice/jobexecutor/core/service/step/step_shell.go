@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -38,12 +39,18 @@ type ShellStep struct {
 	spec       *step.StepShellSpec
 	envs       []string
 	secretEnvs []string
+	logMasker  *util.LogMasker
 	workspace  string
 	Paths      string
 }
 
-func NewShellStep(spec interface{}, workspace, paths string, envs, secretEnvs []string) (*ShellStep, error) {
+func NewShellStep(spec interface{}, workspace, paths string, envs, secretEnvs, logMaskPatterns []string) (*ShellStep, error) {
 	shellStep := &ShellStep{workspace: workspace, envs: envs, secretEnvs: secretEnvs}
+	logMasker, err := util.NewLogMasker(secretEnvs, logMaskPatterns)
+	if err != nil {
+		return shellStep, err
+	}
+	shellStep.logMasker = logMasker
 	yamlBytes, err := yaml.Marshal(spec)
 	if err != nil {
 		return shellStep, fmt.Errorf("marshal spec %+v failed", spec)
@@ -87,7 +94,11 @@ func (s *ShellStep) Run(ctx context.Context) error {
 		return fmt.Errorf("write script file error: %v", err)
 	}
 
-	cmd := exec.Command("/bin/bash", filepath.Join(os.TempDir(), userScriptFile))
+	interpreter := "/bin/bash"
+	if s.spec.Interpreter != "" {
+		interpreter = s.spec.Interpreter
+	}
+	cmd := exec.Command(interpreter, filepath.Join(os.TempDir(), userScriptFile))
 	cmd.Dir = s.workspace
 	cmd.Env = s.envs
 
@@ -108,7 +119,7 @@ func (s *ShellStep) Run(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 
-		handleCmdOutput(cmdStdoutReader, needPersistentLog, fileName, s.secretEnvs)
+		handleCmdOutput(cmdStdoutReader, needPersistentLog, fileName, s.logMasker)
 	}()
 
 	cmdStdErrReader, err := cmd.StderrPipe()
@@ -120,13 +131,27 @@ func (s *ShellStep) Run(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 
-		handleCmdOutput(cmdStdErrReader, needPersistentLog, fileName, s.secretEnvs)
+		handleCmdOutput(cmdStdErrReader, needPersistentLog, fileName, s.logMasker)
 	}()
 
 	if err := cmd.Start(); err != nil {
 		return err
 	}
 
+	// forward the termination signal to the user script so that its trap handler can clean up before the pod is killed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Infof("Job is terminating, sending SIGTERM to user script.")
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				log.Warnf("Failed to send SIGTERM to user script, error: %v", err)
+			}
+		case <-done:
+		}
+	}()
+
 	wg.Wait()
 
 	return cmd.Wait()
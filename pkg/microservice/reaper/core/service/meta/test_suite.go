@@ -36,10 +36,17 @@ type TestSuite struct {
 	SystemOut string     `bson:"system_out,omitempty"    json:"system_out"               xml:"system-out,omitempty"`
 	SystemErr string     `bson:"system-err,omitempty"    json:"system_err"               xml:"system-err,omitempty"`
 	TestCases []TestCase `bson:"testcase"                json:"testcase"                 xml:"testcase"`
+	// Metadata are written as the properties of the test suite, e.g. the commits of the tested repos
+	Metadata  []Property `bson:"metadata,omitempty"      json:"metadata,omitempty"       xml:"properties>property,omitempty"`
 	SuiteType string     `bson:"-"                       json:"-"                        xml:"-"`
 	Name      string     `bson:"name"                    json:"-"                        xml:"-"`
 }
 
+type Property struct {
+	Name  string `bson:"name"   json:"name"   xml:"name,attr"`
+	Value string `bson:"value"  json:"value"  xml:"value,attr"`
+}
+
 type Skipped struct {
 }
 
@@ -24,6 +24,7 @@ const LocalConfig = "local.env"
 const (
 	// common
 	ENVSystemAddress           = "ADDRESS"
+	ENVExternalAddress         = "EXTERNAL_ADDRESS"
 	ENVImagePullPolicy         = "IMAGE_PULL_POLICY"
 	ENVBuildKitImage           = "BUILD_KIT_IMAGE"
 	ENVMode                    = "MODE"
@@ -48,14 +49,23 @@ const (
 	ENVNamespace               = "BE_POD_NAMESPACE"
 
 	// Aslan
-	ENVLogLevel                  = "LOG_LEVEL"
-	ENVExecutorLogLevel          = "EXECUTOR_LOG_LEVEL"
-	ENVServiceStartTimeout       = "SERVICE_START_TIMEOUT"
-	ENVDefaultEnvRecycleDay      = "DEFAULT_ENV_RECYCLE_DAY"
-	ENVDefaultIngressClass       = "DEFAULT_INGRESS_CLASS"
-	ENVLarkPluginID              = "LARK_PLUGIN_ID"
-	ENVLarkPluginSecret          = "LARK_PLUGIN_SECRET"
-	ENVLarkPluginAccessTokenType = "LARK_PLUGIN_ACCESS_TOKEN_TYPE"
+	ENVLogLevel                   = "LOG_LEVEL"
+	ENVExecutorLogLevel           = "EXECUTOR_LOG_LEVEL"
+	ENVServiceStartTimeout        = "SERVICE_START_TIMEOUT"
+	ENVDefaultEnvRecycleDay       = "DEFAULT_ENV_RECYCLE_DAY"
+	ENVHelmRepoCacheTTLSeconds    = "HELM_REPO_CACHE_TTL_SECONDS"
+	ENVBasicImageCacheTTLSeconds  = "BASIC_IMAGE_CACHE_TTL_SECONDS"
+	ENVTracingEnabled             = "TRACING_ENABLED"
+	ENVHelmEnvLockTTLSeconds      = "HELM_ENV_LOCK_TTL_SECONDS"
+	ENVHelmEnvLockBlocking        = "HELM_ENV_LOCK_BLOCKING"
+	ENVHelmEnvUpdateWebhooks      = "HELM_ENV_UPDATE_WEBHOOKS"
+	ENVHelmEnvUpdateWebhookToken  = "HELM_ENV_UPDATE_WEBHOOK_TOKEN"
+	ENVHelmImportDeployRerender   = "HELM_IMPORT_TO_DEPLOY_RERENDER"
+	ENVHelmChartUploadConcurrency = "HELM_CHART_UPLOAD_CONCURRENCY"
+	ENVDefaultIngressClass        = "DEFAULT_INGRESS_CLASS"
+	ENVLarkPluginID               = "LARK_PLUGIN_ID"
+	ENVLarkPluginSecret           = "LARK_PLUGIN_SECRET"
+	ENVLarkPluginAccessTokenType  = "LARK_PLUGIN_ACCESS_TOKEN_TYPE"
 
 	ENVBuildBaseImage = "BUILD_BASE_IMAGE"
 
@@ -168,9 +178,13 @@ const (
 	EditorIDAnnotation              = companyLabel + "/" + "editor-id"
 	LastUpdateTimeAnnotation        = companyLabel + "/" + "last-update-time"
 
-	JobLabelTaskKey  = "s-task"
-	JobLabelNameKey  = "s-name"
-	JobLabelSTypeKey = "s-type"
+	JobLabelTaskKey     = "s-task"
+	JobLabelNameKey     = "s-name"
+	JobLabelSTypeKey    = "s-type"
+	JobLabelProjectKey  = "s-project"
+	JobLabelWorkflowKey = "s-workflow"
+	JobLabelTestingKey  = "s-testing"
+	JobLabelTeamKey     = "s-team"
 
 	LabelValueTrue = "true"
 
@@ -926,6 +940,18 @@ const (
 	WorkflowScanningJobOutputKeyBranch  = "SonarBranchKey"
 )
 
+const (
+	WorkflowTestingJobOutputKeyTotal      = "TEST_TOTAL"
+	WorkflowTestingJobOutputKeyFailed     = "TEST_FAILED"
+	WorkflowTestingJobOutputKeySkipped    = "TEST_SKIPPED"
+	WorkflowTestingJobOutputKeyDurationMS = "TEST_DURATION_MS"
+	// WorkflowTestingJobOutputKeyRepoCommit is the checked out commit of the git repo at the index
+	WorkflowTestingJobOutputKeyRepoCommit = "REPO_%d_COMMIT"
+	// WorkflowTestingJobOutputKeyTestedServices is the json array of the targets tested by the job, it is an output of
+	// the job rather than of its job tasks
+	WorkflowTestingJobOutputKeyTestedServices = "TESTED_SERVICES"
+)
+
 type NotifyWebHookType string
 
 const (
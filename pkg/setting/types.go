@@ -48,6 +48,31 @@ func (spec RequestSpec) Equal(target RequestSpec) bool {
 	return spec.CpuReq == target.CpuReq && spec.CpuLimit == target.CpuLimit && spec.MemoryLimit == target.MemoryLimit && spec.MemoryReq == target.MemoryReq
 }
 
+// ResourceLimitSpec sets the cpu limit in m and the memory limit in Mi of the job container independently from the request,
+// a zero limit keeps the limit of the request
+type ResourceLimitSpec struct {
+	CpuLimit    int `bson:"cpu_limit"    json:"cpu_limit"    yaml:"cpu_limit"`
+	MemoryLimit int `bson:"memory_limit" json:"memory_limit" yaml:"memory_limit"`
+}
+
+// GetRequestSpec returns the spec of the preset request, spec is returned for DefineRequest
+func (req Request) GetRequestSpec(spec RequestSpec) RequestSpec {
+	switch req {
+	case HighRequest:
+		return HighRequestSpec
+	case MediumRequest:
+		return MediumRequestSpec
+	case LowRequest:
+		return LowRequestSpec
+	case MinRequest:
+		return MinRequestSpec
+	case DefineRequest:
+		return spec
+	default:
+		return DefaultRequestSpec
+	}
+}
+
 func (spec RequestSpec) FindResourceRequestType() Request {
 	if spec.GpuLimit != "" {
 		return DefineRequest
@@ -17,6 +17,8 @@ limitations under the License.
 package cache
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"time"
 
@@ -47,6 +49,7 @@ func NewRedisLock(key string) *RedisLock {
 
 func NewRedisLockWithExpiry(key string, expiry time.Duration) *RedisLock {
 	return &RedisLock{
+		key:   key,
 		mutex: resync.NewMutex(key, redsync.WithRetryDelay(time.Millisecond*500), redsync.WithExpiry(expiry)),
 	}
 }
@@ -71,6 +74,29 @@ func (lock *RedisLock) TryLock() error {
 	return err
 }
 
+// LockContext is the same as Lock, but it stops waiting for the lock when ctx is done
+func (lock *RedisLock) LockContext(ctx context.Context) error {
+	err := lock.mutex.LockContext(ctx)
+	if err != nil {
+		if !strings.Contains(err.Error(), "lock already taken") {
+			log.Errorf("failed to acquire redis lock: %s, err: %s", lock.key, err)
+		}
+	}
+	return err
+}
+
+// TryLockContext is the same as TryLock, ctx is used for the redis requests
+func (lock *RedisLock) TryLockContext(ctx context.Context) error {
+	return lock.mutex.TryLockContext(ctx)
+}
+
+// IsLockTaken returns whether the lock failed to be acquired because it is held by others,
+// instead of the failures of the redis requests
+func IsLockTaken(err error) bool {
+	var takenErr *redsync.ErrTaken
+	return errors.As(err, &takenErr)
+}
+
 func (lock *RedisLock) Unlock() error {
 	_, err := lock.mutex.Unlock()
 	return err
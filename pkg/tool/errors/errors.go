@@ -17,6 +17,7 @@ limitations under the License.
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"regexp"
 )
@@ -124,8 +125,18 @@ func NewWithExtras(e error, desc string, extra map[string]interface{}) error {
 	return e
 }
 
+// HTTPErrorConverter is implemented by typed errors which are returned to users as a specific http error
+type HTTPErrorConverter interface {
+	HTTPError() *HTTPError
+}
+
 // ErrorMessage returns the code and message for Gins JSON helpers
 func ErrorMessage(err error) (code int, message map[string]interface{}) {
+	var converter HTTPErrorConverter
+	if stderrors.As(err, &converter) {
+		err = converter.HTTPError()
+	}
+
 	v, ok := err.(*HTTPError)
 	if ok {
 		code = v.Code()
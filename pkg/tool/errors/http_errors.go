@@ -29,6 +29,8 @@ var (
 	ErrForbidden = NewHTTPError(403, "Forbidden")
 	// ErrNotFound ...
 	ErrNotFound = NewHTTPError(404, "Request Not Found")
+	// ErrConflict ...
+	ErrConflict = NewHTTPError(409, "Conflict")
 	// ErrInternalError ...
 	ErrInternalError = NewHTTPError(500, "Internal Error")
 
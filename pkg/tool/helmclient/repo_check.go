@@ -0,0 +1,183 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+type RepoCheckResult struct {
+	Reachable bool `json:"reachable"`
+	AuthOK    bool `json:"auth_ok"`
+	// ChartCount is the number of charts in index.yaml, it is always 0 for oci registries since they have no index
+	ChartCount int `json:"chart_count"`
+}
+
+// CheckRepo checks whether the repo can be reached with its credentials in timeout.
+// For classic repos index.yaml is fetched, for oci registries the registry api is pinged.
+func (hClient *HelmClient) CheckRepo(repoEntry *repo.Entry, timeout time.Duration) (*RepoCheckResult, error) {
+	httpClient := hClient.newCheckHTTPClient(timeout)
+	if registry.IsOCI(repoEntry.URL) {
+		return checkOCIRegistry(httpClient, repoEntry)
+	}
+	result, _, err := checkChartRepo(httpClient, repoEntry)
+	return result, err
+}
+
+// FetchRepoIndex fetches index.yaml of the classic repo in timeout, oci registries are not supported since they have no index
+func (hClient *HelmClient) FetchRepoIndex(repoEntry *repo.Entry, timeout time.Duration) (*repo.IndexFile, error) {
+	if registry.IsOCI(repoEntry.URL) {
+		return nil, fmt.Errorf("oci registry %s has no chart index", repoEntry.URL)
+	}
+	_, index, err := checkChartRepo(hClient.newCheckHTTPClient(timeout), repoEntry)
+	return index, err
+}
+
+func (hClient *HelmClient) newCheckHTTPClient(timeout time.Duration) *http.Client {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if hClient.Transport != nil {
+		transport.Proxy = hClient.Transport.Proxy
+		transport.TLSClientConfig = hClient.Transport.TLSClientConfig
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+func checkChartRepo(httpClient *http.Client, repoEntry *repo.Entry) (*RepoCheckResult, *repo.IndexFile, error) {
+	result := &RepoCheckResult{}
+
+	indexURL := strings.TrimSuffix(repoEntry.URL, "/") + "/index.yaml"
+	req, err := http.NewRequest(http.MethodGet, indexURL, nil)
+	if err != nil {
+		return result, nil, fmt.Errorf("invalid repo url %s: %s", repoEntry.URL, err)
+	}
+	if repoEntry.Username != "" || repoEntry.Password != "" {
+		req.SetBasicAuth(repoEntry.Username, repoEntry.Password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to reach %s: %s", indexURL, err)
+	}
+	defer resp.Body.Close()
+	result.Reachable = true
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return result, nil, fmt.Errorf("failed to authenticate to %s, status: %d", indexURL, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return result, nil, fmt.Errorf("failed to get %s, status: %d", indexURL, resp.StatusCode)
+	}
+	result.AuthOK = true
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to read %s: %s", indexURL, err)
+	}
+	index := &repo.IndexFile{}
+	if err = yaml.Unmarshal(body, index); err != nil {
+		return result, nil, fmt.Errorf("%s is not a valid helm repo index: %s", indexURL, err)
+	}
+	result.ChartCount = len(index.Entries)
+	return result, index, nil
+}
+
+// checkOCIRegistry pings the registry api of the host, bearer token challenges are answered with the basic credentials
+func checkOCIRegistry(httpClient *http.Client, repoEntry *repo.Entry) (*RepoCheckResult, error) {
+	result := &RepoCheckResult{}
+
+	host := strings.TrimPrefix(repoEntry.URL, fmt.Sprintf("%s://", registry.OCIScheme))
+	host = strings.SplitN(host, "/", 2)[0]
+	pingURL := fmt.Sprintf("https://%s/v2/", host)
+
+	resp, err := doWithBasicAuth(httpClient, pingURL, repoEntry)
+	if err != nil {
+		return result, fmt.Errorf("failed to reach %s: %s", pingURL, err)
+	}
+	resp.Body.Close()
+	result.Reachable = true
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return result, fmt.Errorf("failed to authenticate to %s, status: %d", pingURL, resp.StatusCode)
+		}
+		tokenURL, err := bearerTokenURL(challenge)
+		if err != nil {
+			return result, err
+		}
+		resp, err = doWithBasicAuth(httpClient, tokenURL, repoEntry)
+		if err != nil {
+			return result, fmt.Errorf("failed to reach %s: %s", tokenURL, err)
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("failed to authenticate to %s, status: %d", host, resp.StatusCode)
+	}
+	result.AuthOK = true
+	return result, nil
+}
+
+func doWithBasicAuth(httpClient *http.Client, reqURL string, repoEntry *repo.Entry) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if repoEntry.Username != "" || repoEntry.Password != "" {
+		req.SetBasicAuth(repoEntry.Username, repoEntry.Password)
+	}
+	return httpClient.Do(req)
+}
+
+// bearerTokenURL builds the token url from a challenge like: Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func bearerTokenURL(challenge string) (string, error) {
+	params := make(map[string]string)
+	for _, param := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("invalid authenticate challenge: %s", challenge)
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %s: %s", params["realm"], err)
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	tokenURL.RawQuery = query.Encode()
+	return tokenURL.String(), nil
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getter
+
+import (
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func GetStorageClass(name string, cl client.Client) (*storagev1.StorageClass, bool, error) {
+	g := &storagev1.StorageClass{}
+	found, err := GetResourceInCache("", name, g, cl)
+	if err != nil || !found {
+		g = nil
+	}
+
+	return g, found, err
+}
@@ -115,6 +115,57 @@ var (
 		[]string{"cluster"},
 	)
 
+	HelmRepoCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "helm_repo_cache_requests_total",
+			Help: "Number of helm repo list requests served by the in-process cache",
+		},
+		[]string{"result"},
+	)
+
+	BasicImageCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "basic_image_cache_requests_total",
+			Help: "Number of basic image lookups served by the in-process cache",
+		},
+		[]string{"result"},
+	)
+
+	HelmEnvLockWaitTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "helm_env_lock_wait_time",
+			Help:    "The time in seconds waited for the lock of updating helm environments",
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 8),
+		},
+		[]string{"result"},
+	)
+
+	TestingJobGenerationTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "testing_job_generation_time",
+			Help:    "The time in seconds taken to generate the job tasks of testing jobs",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+		},
+		[]string{"test_type", "project"},
+	)
+
+	TestingJobLookupTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "testing_job_lookup_time",
+			Help:    "The time in seconds taken by each lookup while generating the job tasks of testing jobs",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		},
+		[]string{"lookup", "test_type", "project"},
+	)
+
+	TestingJobGenerationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "testing_job_generation_failures_total",
+			Help: "Number of testing job tasks failed to generate",
+		},
+		[]string{"cause", "test_type", "project"},
+	)
+
 	ResponseTime = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "api_response_time",
@@ -138,6 +189,42 @@ func RegisterRequest(startTime int64, method, handler string, status int) {
 	ResponseTime.WithLabelValues(method, handler, fmt.Sprintf("%d", status)).Observe(float64(time.Now().UnixMilli()-startTime) / 1000)
 }
 
+func RegisterHelmRepoCacheRequest(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	HelmRepoCacheRequests.WithLabelValues(result).Inc()
+}
+
+func RegisterBasicImageCacheRequest(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	BasicImageCacheRequests.WithLabelValues(result).Inc()
+}
+
+func RegisterHelmEnvLockWait(wait time.Duration, acquired bool) {
+	result := "locked"
+	if acquired {
+		result = "acquired"
+	}
+	HelmEnvLockWaitTime.WithLabelValues(result).Observe(wait.Seconds())
+}
+
+func RegisterTestingJobGeneration(testType, project string, duration time.Duration) {
+	TestingJobGenerationTime.WithLabelValues(testType, project).Observe(duration.Seconds())
+}
+
+func RegisterTestingJobLookup(lookup, testType, project string, duration time.Duration) {
+	TestingJobLookupTime.WithLabelValues(lookup, testType, project).Observe(duration.Seconds())
+}
+
+func RegisterTestingJobGenerationFailure(cause, testType, project string) {
+	TestingJobGenerationFailures.WithLabelValues(cause, testType, project).Inc()
+}
+
 func SetCPUUsage(serviceName, podName string, value int64) {
 	// convert to full core
 	CPU.WithLabelValues(serviceName, podName).Set(float64(value) / 1000)
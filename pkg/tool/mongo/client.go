@@ -48,6 +48,10 @@ func SessionContext(ctx context.Context, session mongo.Session) context.Context
 	if session == nil {
 		return ctx
 	}
+	// a session context carries the context of the caller, e.g. a request, which the operations are bound to
+	if sessCtx, ok := session.(mongo.SessionContext); ok {
+		return sessCtx
+	}
 	return mongo.NewSessionContext(ctx, session)
 }
 
@@ -0,0 +1,57 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/koderover/zadig/v2"
+
+var noopTracer = noop.NewTracerProvider().Tracer(instrumentationName)
+
+// Tracer returns the tracer of zadig. When tracing is enabled the spans are handed to the tracer provider registered
+// by otel.SetTracerProvider, which decides the exporter. Otherwise a no-op tracer is returned so that the spans cost
+// nothing.
+func Tracer(enabled bool) trace.Tracer {
+	if !enabled {
+		return noopTracer
+	}
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceContextEnvs returns the w3c trace context of the span in ctx as the TRACEPARENT and TRACESTATE envs, so that a
+// process started with them can continue the trace. Nothing is returned for the spans of the no-op tracer.
+func TraceContextEnvs(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	envs := make(map[string]string, len(carrier))
+	for key, value := range carrier {
+		envs[strings.ToUpper(key)] = value
+	}
+	return envs
+}
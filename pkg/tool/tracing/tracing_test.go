@@ -0,0 +1,49 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextEnvs(t *testing.T) {
+	ctx, span := Tracer(false).Start(context.Background(), "test")
+	defer span.End()
+	if envs := TraceContextEnvs(ctx); envs != nil {
+		t.Errorf("spans of the no-op tracer should have no trace context envs, got %v", envs)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("vendor=value")
+	ctx = trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+	}))
+	envs := TraceContextEnvs(ctx)
+	if got, want := envs["TRACEPARENT"], "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; got != want {
+		t.Errorf("TRACEPARENT = %q, want %q", got, want)
+	}
+	if got, want := envs["TRACESTATE"], "vendor=value"; got != want {
+		t.Errorf("TRACESTATE = %q, want %q", got, want)
+	}
+}
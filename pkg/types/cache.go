@@ -67,6 +67,50 @@ const (
 	UserDefinedCacheDir CacheDirType = "user_defined"
 )
 
+// CacheCompression is the compression of the cache archive in the object storage, empty means gzip
+type CacheCompression string
+
+const (
+	GzipCacheCompression CacheCompression = "gzip"
+	ZstdCacheCompression CacheCompression = "zstd"
+	NoneCacheCompression CacheCompression = "none"
+)
+
+// Valid tells whether the compression is supported
+func (c CacheCompression) Valid() bool {
+	switch c {
+	case "", GzipCacheCompression, ZstdCacheCompression, NoneCacheCompression:
+		return true
+	default:
+		return false
+	}
+}
+
+// TarFlags returns the flags of tar to create or extract an archive with the compression
+func (c CacheCompression) TarFlags() []string {
+	switch c {
+	case ZstdCacheCompression:
+		return []string{"--use-compress-program=zstd"}
+	case NoneCacheCompression:
+		return nil
+	default:
+		return []string{"-z"}
+	}
+}
+
+// DetectCacheCompression detects the compression from the magic number at the head of the archive,
+// archives which are neither gzip nor zstd are taken as plain tar
+func DetectCacheCompression(header []byte) CacheCompression {
+	switch {
+	case len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+		return GzipCacheCompression
+	case len(header) >= 4 && header[0] == 0x28 && header[1] == 0xb5 && header[2] == 0x2f && header[3] == 0xfd:
+		return ZstdCacheCompression
+	default:
+		return NoneCacheCompression
+	}
+}
+
 type StorageClassType string
 
 const (
@@ -80,3 +124,26 @@ const (
 	ScriptTypeBatchFile  ScriptType = "batch_file"
 	ScriptTypePowerShell ScriptType = "powershell"
 )
+
+// scriptInterpreters are the interpreters a script of the type may be run with besides the default one,
+// batch files are always run by cmd
+var scriptInterpreters = map[ScriptType][]string{
+	ScriptTypeShell:      {"bash", "sh", "dash", "ash", "zsh"},
+	ScriptTypePowerShell: {"powershell", "pwsh"},
+}
+
+// IsValidInterpreter returns whether the script type may be run with the interpreter, empty means the default one
+func (t ScriptType) IsValidInterpreter(interpreter string) bool {
+	if interpreter == "" {
+		return true
+	}
+	if t == "" {
+		t = ScriptTypeShell
+	}
+	for _, valid := range scriptInterpreters[t] {
+		if interpreter == valid {
+			return true
+		}
+	}
+	return false
+}
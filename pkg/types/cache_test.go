@@ -0,0 +1,40 @@
+/*
+Copyright 2025 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import "testing"
+
+func TestDetectCacheCompression(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   CacheCompression
+	}{
+		{name: "gzip", header: []byte{0x1f, 0x8b, 0x08, 0x00}, want: GzipCacheCompression},
+		{name: "zstd", header: []byte{0x28, 0xb5, 0x2f, 0xfd}, want: ZstdCacheCompression},
+		{name: "plain tar", header: []byte("dir/"), want: NoneCacheCompression},
+		{name: "empty", header: nil, want: NoneCacheCompression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectCacheCompression(tt.header); got != tt.want {
+				t.Errorf("DetectCacheCompression() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package types
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -41,6 +42,8 @@ type Repository struct {
 	CommitMessage string `bson:"commit_message,omitempty"  json:"commit_message,omitempty" yaml:"commit_message,omitempty"`
 	CheckoutPath  string `bson:"checkout_path,omitempty"   json:"checkout_path,omitempty"  yaml:"checkout_path,omitempty"`
 	SubModules    bool   `bson:"submodules,omitempty"      json:"submodules,omitempty"     yaml:"submodules,omitempty"`
+	// CloneDepth limits the fetched history of the repo, 0 means using the default depth of the git step
+	CloneDepth int `bson:"clone_depth,omitempty" json:"clone_depth,omitempty" yaml:"clone_depth,omitempty"`
 	// Hidden defines whether the frontend needs to hide this repo
 	Hidden bool `bson:"hidden" json:"hidden" yaml:"hidden"`
 	// UseDefault defines if the repo can be configured in start pipeline task page
@@ -67,6 +70,10 @@ type Repository struct {
 	AuthType           AuthType `bson:"auth_type,omitempty"             json:"auth_type,omitempty"               yaml:"auth_type,omitempty"`
 	SSHKey             string   `bson:"ssh_key,omitempty"               json:"ssh_key,omitempty"                 yaml:"ssh_key,omitempty"`
 	PrivateAccessToken string   `bson:"private_access_token,omitempty"  json:"private_access_token,omitempty"    yaml:"private_access_token,omitempty"`
+	// DeployKeyID refers to a private key used only to clone this repo over ssh instead of the code host credentials
+	DeployKeyID string `bson:"deploy_key_id,omitempty"   json:"deploy_key_id,omitempty"   yaml:"deploy_key_id,omitempty"`
+	// DeployKey is the resolved private key of DeployKeyID, it is filled when the job task is generated
+	DeployKey string `bson:"deploy_key,omitempty"      json:"deploy_key,omitempty"      yaml:"deploy_key,omitempty"`
 	/*
 		repo can come from params or other job, introduced in 1.3.1
 	*/
@@ -153,6 +160,26 @@ func (repo *Repository) GetRepoNamespace() string {
 	return repo.RepoOwner
 }
 
+// DeployKeySSHHostAndURL returns the ssh host and the ssh clone url used when the repo is cloned with a deploy key
+// e.g. github.com, git@github.com:owner/name.git
+func (repo *Repository) DeployKeySSHHostAndURL() (string, string) {
+	var host string
+	switch repo.Source {
+	case ProviderGithub:
+		host = "github.com"
+	case ProviderGitee:
+		host = "gitee.com"
+	default:
+		u, err := url.Parse(repo.Address)
+		if err != nil || u.Hostname() == "" {
+			host = strings.TrimPrefix(repo.Address, "git@")
+		} else {
+			host = u.Hostname()
+		}
+	}
+	return host, fmt.Sprintf("git@%s:%s/%s.git", host, repo.GetRepoNamespace(), repo.RepoName)
+}
+
 func (repo *Repository) GetPreMergeBranches() string {
 	return strings.Join(append([]string{repo.Branch}, repo.MergeBranches...), ",")
 }
@@ -31,4 +31,12 @@ type StepJunitReportSpec struct {
 	TestName      string `bson:"test_name"                  json:"test_name"                         yaml:"test_name"`
 	TestProject   string `bson:"test_project"               json:"test_project"                      yaml:"test_project"`
 	S3Storage     *S3    `bson:"s3_storage"                 json:"s3_storage"                        yaml:"s3_storage"`
+	// RecordTrend appends the result to the test trend of the workflow job and service
+	RecordTrend bool `bson:"record_trend"               json:"record_trend"                      yaml:"record_trend"`
+	// BaselineRun records the result as the new baseline of the test trend instead of comparing it against the baseline
+	BaselineRun bool `bson:"baseline_run,omitempty"     json:"baseline_run,omitempty"            yaml:"baseline_run,omitempty"`
+	// ShardJobTaskNames are the job tasks of all the shards of a sharded test, their reports are merged into
+	// MergedS3DestDir once all of them are reported, and the trend is recorded from the merged report
+	ShardJobTaskNames []string `bson:"shard_job_task_names,omitempty" json:"shard_job_task_names,omitempty" yaml:"shard_job_task_names,omitempty"`
+	MergedS3DestDir   string   `bson:"merged_s3_dest_dir,omitempty"   json:"merged_s3_dest_dir,omitempty"   yaml:"merged_s3_dest_dir,omitempty"`
 }
@@ -20,4 +20,6 @@ type StepPowerShellSpec struct {
 	Scripts     []string `bson:"scripts"                              json:"scripts"                                 yaml:"scripts,omitempty"`
 	Script      string   `bson:"script"                               json:"script"                                  yaml:"script"`
 	SkipPrepare bool     `bson:"skip_prepare"                         json:"skip_prepare"                            yaml:"skip_prepare"`
+	// Interpreter runs the scripts instead of powershell if set
+	Interpreter string `bson:"interpreter,omitempty"                json:"interpreter,omitempty"                   yaml:"interpreter,omitempty"`
 }
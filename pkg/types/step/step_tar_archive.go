@@ -16,6 +16,8 @@ limitations under the License.
 
 package step
 
+import "github.com/koderover/zadig/v2/pkg/types"
+
 type StepTarArchiveSpec struct {
 	// Source file/dir path
 	ResultDirs []string `bson:"result_dirs"                json:"result_dirs"                       yaml:"result_dirs"`
@@ -33,4 +35,6 @@ type StepTarArchiveSpec struct {
 	FileName  string `bson:"file_name"                  json:"file_name"                         yaml:"file_name"`
 	IgnoreErr bool   `bson:"ignore_err"                 json:"ignore_err"                        yaml:"ignore_err"`
 	S3Storage *S3    `bson:"s3_storage"                 json:"s3_storage"                        yaml:"s3_storage"`
+	// Compression of the archive, gzip is used if it is empty
+	Compression types.CacheCompression `bson:"compression"                json:"compression"                       yaml:"compression"`
 }
@@ -18,11 +18,13 @@ package util
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/koderover/zadig/v2/pkg/config"
+	"github.com/koderover/zadig/v2/pkg/types"
 )
 
 func GenerateTmpFile() (string, error) {
@@ -85,6 +87,22 @@ func ReadFile(filename string) ([]byte, error) {
 	return contentByte, nil
 }
 
+// DetectArchiveCompression detects the compression of the tar archive from its content regardless of the file name
+func DetectArchiveCompression(filename string) (types.CacheCompression, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return types.DetectCacheCompression(header[:n]), nil
+}
+
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
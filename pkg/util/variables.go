@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -30,7 +31,8 @@ func MaskSecretEnvs(message string, secretEnvs []string) string {
 		if len(val) == 0 {
 			continue
 		}
-		sl := strings.Split(val, "=")
+		// the value of a secret, like a base64 encoded one, may contain "=" as well
+		sl := strings.SplitN(val, "=", 2)
 
 		if len(sl) != 2 {
 			continue
@@ -40,7 +42,46 @@ func MaskSecretEnvs(message string, secretEnvs []string) string {
 			// invalid key value pair received
 			continue
 		}
-		out = strings.Replace(out, strings.Join(sl[1:], "="), secretEnvMask, -1)
+		out = strings.Replace(out, sl[1], secretEnvMask, -1)
+	}
+	return out
+}
+
+// LogMasker redacts the values of the secret envs and the substrings matching the mask patterns from job logs
+type LogMasker struct {
+	secretEnvs []string
+	patterns   []*regexp.Regexp
+}
+
+func NewLogMasker(secretEnvs, patterns []string) (*LogMasker, error) {
+	compiled, err := CompileLogMaskPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &LogMasker{secretEnvs: secretEnvs, patterns: compiled}, nil
+}
+
+// CompileLogMaskPatterns compiles the mask patterns, a pattern matching the empty string is rejected since it would
+// insert the mask between all the characters of a line
+func CompileLogMaskPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	resp := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log mask pattern %q: %s", pattern, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("log mask pattern %q matches the empty string", pattern)
+		}
+		resp = append(resp, re)
+	}
+	return resp, nil
+}
+
+func (m *LogMasker) Mask(message string) string {
+	out := MaskSecretEnvs(message, m.secretEnvs)
+	for _, re := range m.patterns {
+		out = re.ReplaceAllLiteralString(out, secretEnvMask)
 	}
 	return out
 }